@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// FinishInput moves the input file into -archive-dir, or removes it if -delete-input.
+// It must be called only after the file was chopped completely.
+//
+// WARNING: this function reads commandline flags directly.
+func FinishInput(path string) error {
+	switch {
+	case *archiveDir != "":
+		dst := filepath.Join(*archiveDir, filepath.Base(path))
+		if err := moveFile(path, dst); err != nil {
+			return fmt.Errorf("failed to archive input file: %w", err)
+		}
+		logger.With("input", path, "archive", dst).Infof("archive %s into %s", path, dst)
+	case *deleteInput:
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to delete input file: %w", err)
+		}
+		logger.With("input", path).Infof("delete %s", path)
+	}
+	return nil
+}
+
+// moveFile moves the file from src to dst.
+// If they are on different filesystems, the file is copied and then removed.
+// The existing file in dst is not overwritten.
+func moveFile(src, dst string) error {
+	if _, err := os.Lstat(dst); err == nil {
+		return fmt.Errorf("%s: already exists", dst)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if err := copyFile(src, dst, info); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
+
+// copyFile copies the file from src to dst, keeping the permission and the modification time.
+func copyFile(src, dst string, info os.FileInfo) error {
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFinishInput(t *testing.T) {
+	mtime := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		Name     string
+		Archive  bool
+		Delete   bool
+		Archived bool
+		Removed  bool
+	}{
+		{"keep", false, false, false, false},
+		{"archive", true, false, true, true},
+		{"delete", false, true, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			dir := t.TempDir()
+			input := filepath.Join(dir, "input", "a.csv")
+			if err := os.MkdirAll(filepath.Dir(input), 0755); err != nil {
+				t.Fatalf("failed to prepare directory: %s", err)
+			}
+			if err := os.WriteFile(input, []byte("20230401,a\n"), 0644); err != nil {
+				t.Fatalf("failed to prepare input: %s", err)
+			}
+			if err := os.Chtimes(input, mtime, mtime); err != nil {
+				t.Fatalf("failed to prepare input: %s", err)
+			}
+
+			archive := filepath.Join(dir, "archive")
+			origArchive, origDelete := *archiveDir, *deleteInput
+			*deleteInput = tt.Delete
+			if tt.Archive {
+				*archiveDir = archive
+			} else {
+				*archiveDir = ""
+			}
+			defer func() { *archiveDir, *deleteInput = origArchive, origDelete }()
+
+			if err := FinishInput(input); err != nil {
+				t.Fatalf("failed to finish input: %s", err)
+			}
+
+			if _, err := os.Stat(input); os.IsNotExist(err) != tt.Removed {
+				t.Errorf("expected removed=%v but got %v", tt.Removed, err)
+			}
+
+			info, err := os.Stat(filepath.Join(archive, "a.csv"))
+			if tt.Archived {
+				if err != nil {
+					t.Fatalf("failed to stat archived file: %s", err)
+				}
+				if !info.ModTime().Equal(mtime) {
+					t.Errorf("expected mtime %s but got %s", mtime, info.ModTime())
+				}
+			} else if !os.IsNotExist(err) {
+				t.Errorf("expected not archived but got %v", err)
+			}
+		})
+	}
+}
+
+func TestMoveFile_exists(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "a.csv"), filepath.Join(dir, "b.csv")
+	for _, p := range []string{src, dst} {
+		if err := os.WriteFile(p, []byte(p), 0644); err != nil {
+			t.Fatalf("failed to prepare file: %s", err)
+		}
+	}
+
+	if err := moveFile(src, dst); err == nil {
+		t.Fatalf("expected error but got nil")
+	}
+	if b, err := os.ReadFile(dst); err != nil || string(b) != dst {
+		t.Errorf("expected %s is not overwritten but got %q and %v", dst, b, err)
+	}
+	if _, err := os.Stat(src); err != nil {
+		t.Errorf("expected %s is kept but got %v", src, err)
+	}
+}
+
+func TestCopyFile(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "a.csv"), filepath.Join(dir, "b.csv")
+	mtime := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+	if err := os.WriteFile(src, []byte("hello"), 0640); err != nil {
+		t.Fatalf("failed to prepare file: %s", err)
+	}
+	if err := os.Chtimes(src, mtime, mtime); err != nil {
+		t.Fatalf("failed to prepare file: %s", err)
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		t.Fatalf("failed to stat: %s", err)
+	}
+
+	if err := copyFile(src, dst, info); err != nil {
+		t.Fatalf("failed to copy: %s", err)
+	}
+
+	if b, err := os.ReadFile(dst); err != nil || string(b) != "hello" {
+		t.Errorf("expected %q but got %q and %v", "hello", b, err)
+	}
+	if got, err := os.Stat(dst); err != nil {
+		t.Errorf("failed to stat: %s", err)
+	} else if got.Mode().Perm() != 0640 || !got.ModTime().Equal(mtime) {
+		t.Errorf("expected %s %s but got %s %s", os.FileMode(0640), mtime, got.Mode().Perm(), got.ModTime())
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// azureVersion is the version of Azure Storage REST API.
+const azureVersion = "2020-10-02"
+
+// azureSink is the Sink for URLs like az://container/blob.
+//
+// The storage account and the credentials are read from the environment variables:
+// AZURE_STORAGE_ACCOUNT, and AZURE_STORAGE_KEY for Shared Key or AZURE_STORAGE_SAS_TOKEN for a SAS token.
+// AZURE_STORAGE_ENDPOINT overrides the endpoint of Blob service, like "http://127.0.0.1:10000/devstoreaccount1" for Azurite.
+type azureSink struct {
+	account  string
+	key      []byte
+	sas      url.Values
+	endpoint string
+}
+
+func (s *azureSink) Setup() error {
+	s.account = os.Getenv("AZURE_STORAGE_ACCOUNT")
+	if s.account == "" {
+		return fmt.Errorf("AZURE_STORAGE_ACCOUNT is required")
+	}
+
+	if key := os.Getenv("AZURE_STORAGE_KEY"); key != "" {
+		b, err := base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			return fmt.Errorf("invalid AZURE_STORAGE_KEY: %w", err)
+		}
+		s.key = b
+	} else if sas := os.Getenv("AZURE_STORAGE_SAS_TOKEN"); sas != "" {
+		q, err := url.ParseQuery(strings.TrimPrefix(sas, "?"))
+		if err != nil {
+			return fmt.Errorf("invalid AZURE_STORAGE_SAS_TOKEN: %w", err)
+		}
+		s.sas = q
+	} else {
+		return fmt.Errorf("AZURE_STORAGE_KEY or AZURE_STORAGE_SAS_TOKEN is required")
+	}
+
+	s.endpoint = strings.TrimSuffix(os.Getenv("AZURE_STORAGE_ENDPOINT"), "/")
+	if s.endpoint == "" {
+		s.endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", s.account)
+	}
+	return nil
+}
+
+func (s *azureSink) Create(u string) (RemoteObject, error) {
+	container, blob, err := parseBucketURL(u)
+	if err != nil {
+		return nil, err
+	}
+	return newMultipartObject(azureBlob{s, container, blob}, u), nil
+}
+
+// request calls an API of Blob service.
+func (s *azureSink) request(method, container, blob string, query url.Values, header http.Header, body []byte) (*http.Response, []byte, error) {
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+	for k, v := range s.sas {
+		q[k] = v
+	}
+
+	u := fmt.Sprintf("%s/%s/%s", s.endpoint, container, escapeKey(blob))
+	if len(q) > 0 {
+		u += "?" + canonicalQuery(q)
+	}
+
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	// Azure rejects the request if x-ms-date is far from the real time, so -now is not used.
+	req.Header.Set("x-ms-date", SystemClock.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("x-ms-version", azureVersion)
+	if s.key != nil {
+		s.sign(req, query, len(body))
+	}
+
+	return doXMLRequest(req, "az://"+container+"/"+blob)
+}
+
+// sign signs req with Shared Key.
+func (s *azureSink) sign(req *http.Request, query url.Values, length int) {
+	contentLength := ""
+	if length > 0 {
+		contentLength = strconv.Itoa(length)
+	}
+
+	var headers []string
+	for k := range req.Header {
+		if k := strings.ToLower(k); strings.HasPrefix(k, "x-ms-") {
+			headers = append(headers, k)
+		}
+	}
+	sort.Strings(headers)
+
+	var b strings.Builder
+	for _, v := range []string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		contentLength,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		"", // Date, that replaced by x-ms-date
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+	} {
+		b.WriteString(v)
+		b.WriteByte('\n')
+	}
+	for _, k := range headers {
+		fmt.Fprintf(&b, "%s:%s\n", k, strings.TrimSpace(req.Header.Get(k)))
+	}
+
+	fmt.Fprintf(&b, "/%s%s", s.account, req.URL.EscapedPath())
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		vs := append([]string{}, query[k]...)
+		sort.Strings(vs)
+		fmt.Fprintf(&b, "\n%s:%s", strings.ToLower(k), strings.Join(vs, ","))
+	}
+
+	h := hmac.New(sha256.New, s.key)
+	h.Write([]byte(b.String()))
+	sig := base64.StdEncoding.EncodeToString(h.Sum(nil))
+	req.Header.Set("Authorization", fmt.Sprintf("SharedKey %s:%s", s.account, sig))
+}
+
+// azureBlob is the multipartAPI of a block blob.
+// The parts are uploaded as blocks, and committed with Put Block List.
+type azureBlob struct {
+	s         *azureSink
+	container string
+	blob      string
+}
+
+func (b azureBlob) Put(data []byte) error {
+	h := http.Header{"X-Ms-Blob-Type": {"BlockBlob"}}
+	_, _, err := b.s.request("PUT", b.container, b.blob, nil, h, data)
+	return err
+}
+
+// Begin does nothing, because Blob service has no API to start uploading.
+func (b azureBlob) Begin() (string, error) {
+	return SystemClock.Now().UTC().Format("20060102150405"), nil
+}
+
+func (b azureBlob) UploadPart(uploadID string, n int, data []byte) (string, error) {
+	// All block IDs in a blob must have the same length.
+	id := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s-%06d", uploadID, n)))
+	q := url.Values{"comp": {"block"}, "blockid": {id}}
+	_, _, err := b.s.request("PUT", b.container, b.blob, q, nil, data)
+	return id, err
+}
+
+func (b azureBlob) Complete(uploadID string, parts []string) error {
+	var body bytes.Buffer
+	body.WriteString(`<?xml version="1.0" encoding="utf-8"?><BlockList>`)
+	for _, id := range parts {
+		fmt.Fprintf(&body, "<Latest>%s</Latest>", id)
+	}
+	body.WriteString("</BlockList>")
+
+	_, _, err := b.s.request("PUT", b.container, b.blob, url.Values{"comp": {"blocklist"}}, nil, body.Bytes())
+	return err
+}
+
+// Abort does nothing, because Blob service deletes uncommitted blocks automatically.
+func (b azureBlob) Abort(uploadID string) {
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// benchNames and benchMemos are the values of the synthetic data for bench subcommand.
+// They have many multibyte characters, so that the decoding from Shift-JIS is measured too.
+var (
+	benchNames = []string{"りんご", "みかん", "ぶどう", "もも", "なし", "かき", "メロン", "スイカ", "イチゴ", "バナナ"}
+	benchMemos = []string{"", "特売品", "産地直送、数量限定", "「訳あり」品", "予約受付中", `"季節限定"`, "東京都千代田区", "大阪府大阪市"}
+)
+
+// BenchData is the synthetic input files for bench subcommand.
+type BenchData struct {
+	Files []string
+	Rows  int64
+	Bytes int64
+}
+
+// GenerateBenchData writes the synthetic CSV files in Shift-JIS into dir, that have size bytes in total.
+// The rows are sorted by date in each file, and spread across the days from 2023-01-01.
+// The same seed always makes the same data.
+func GenerateBenchData(dir string, size int64, files, days int, seed int64) (BenchData, error) {
+	rnd := rand.New(rand.NewSource(seed))
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	enc := CP932.NewEncoder()
+
+	var data BenchData
+	for i := 0; i < files; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("input-%03d.csv", i+1))
+		f, err := os.Create(path)
+		if err != nil {
+			return data, err
+		}
+		w := bufio.NewWriter(f)
+
+		limit := size / int64(files)
+		var written, rows int64
+		for written < limit {
+			// The date goes forward by the written bytes, so the rows are sorted and spread evenly.
+			row, err := enc.String(fmt.Sprintf("%s,%s,%d,%d,%s\r\n",
+				start.AddDate(0, 0, int(written*int64(days)/limit)).Format("20060102"),
+				benchNames[rnd.Intn(len(benchNames))],
+				rnd.Intn(100000),
+				rnd.Intn(100),
+				CSVQuote(benchMemos[rnd.Intn(len(benchMemos))]),
+			))
+			if err != nil {
+				f.Close()
+				return data, err
+			}
+			if _, err := w.WriteString(row); err != nil {
+				f.Close()
+				return data, err
+			}
+			written += int64(len(row))
+			rows++
+		}
+		if err := w.Flush(); err != nil {
+			f.Close()
+			return data, err
+		}
+		if err := f.Close(); err != nil {
+			return data, err
+		}
+
+		data.Files = append(data.Files, path)
+		data.Rows += rows
+		data.Bytes += written
+	}
+	return data, nil
+}
+
+// CSVQuote quotes the value for CSV if needed.
+func CSVQuote(s string) string {
+	if !strings.ContainsAny(s, "\",\r\n") {
+		return s
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// BenchResult is the result of a benchmark, that is the best of the runs.
+type BenchResult struct {
+	Format      string
+	Jobs        int
+	Duration    time.Duration
+	OutputBytes int64
+}
+
+// dirSize returns the total size of the files in dir.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// RunBench chops data by running chop-csv itself with the options, and measures the time in wall clock.
+// The time of the fastest run is reported, to reduce the noise.
+func RunBench(exe string, options []string, data BenchData, format string, jobs, runs int, dir string) (BenchResult, error) {
+	result := BenchResult{Format: format, Jobs: jobs}
+
+	for i := 0; i < runs; i++ {
+		out := filepath.Join(dir, fmt.Sprintf("out-%s-%d", format, jobs))
+		if err := os.RemoveAll(out); err != nil {
+			return result, err
+		}
+
+		// The options of bench come after the user options, so that they take precedence.
+		args := append([]string{}, options...)
+		args = append(args, "-encoding", "sjis", "-format", format, "-jobs", strconv.Itoa(jobs), "-out-dir", out, "-q", "-log-level", "warn")
+		args = append(args, data.Files...)
+
+		var stderr bytes.Buffer
+		cmd := exec.Command(exe, args...)
+		cmd.Stderr = &stderr
+
+		start := SystemClock.Now()
+		err := cmd.Run()
+		d := SystemClock.Now().Sub(start)
+		if err != nil {
+			return result, fmt.Errorf("-format=%s -jobs=%d: %w\n%s", format, jobs, err, stderr.String())
+		}
+
+		if i == 0 || d < result.Duration {
+			result.Duration = d
+		}
+		if result.OutputBytes, err = dirSize(out); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// parseBenchJobs parses the comma separated list of the numbers of jobs.
+func parseBenchJobs(s string) ([]int, error) {
+	var jobs []int
+	for _, x := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(x))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid number of jobs: %s", x)
+		}
+		jobs = append(jobs, n)
+	}
+	return jobs, nil
+}
+
+// runBench runs bench subcommand.
+//
+// WARNING: this function reads commandline flags directly.
+func runBench(args []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	size := fs.Int64("size", 64, "The total size of the synthetic input files in MB.")
+	files := fs.Int("files", 8, "The number of the synthetic input files.")
+	days := fs.Int("days", 30, "The number of days that the rows are spread across.")
+	seed := fs.Int64("seed", 1, "The seed of random numbers to generate the input files.")
+	formats := fs.String("formats", "csv,parquet,sqlite", "The comma separated list of -format to measure.")
+	jobsList := fs.String("jobs", "1,2,4", "The comma separated list of -jobs to measure.")
+	runs := fs.Int("runs", 1, "The number of runs for each combination. The fastest run is reported.")
+	keep := fs.Bool("keep", false, "Keep the temporary directory of the input and output files.")
+	fs.Usage = func() {
+		fmt.Println("Usage: chop-csv bench [OPTIONS] [BENCH OPTIONS]")
+		fmt.Println()
+		fmt.Println("Generate synthetic CSV files in Shift-JIS, and chop them with each -format and -jobs, to measure the throughput.")
+		fmt.Println("The OPTIONS are used for chopping, like -compression-level or -write-buffer.")
+		fmt.Println("The same BENCH OPTIONS always make the same input files, so the results can be compared between versions and machines.")
+		fmt.Println()
+		fmt.Println("BENCH OPTIONS:")
+		printCommandDefaults(fs)
+	}
+	parseCommand(fs, args)
+
+	if fs.NArg() != 0 || *size < 1 || *files < 1 || *days < 1 || *runs < 1 {
+		fs.Usage()
+		os.Exit(ExitUsage)
+	}
+	jobs, err := parseBenchJobs(*jobsList)
+	if err != nil {
+		fatalf(ExitUsage, "invalid -jobs: %s", err)
+	}
+	var fmts []string
+	for _, f := range strings.Split(*formats, ",") {
+		switch f = strings.TrimSpace(f); f {
+		case "csv", "parquet", "sqlite":
+			fmts = append(fmts, f)
+		default:
+			fatalf(ExitUsage, "invalid -formats: unsupported format: %s", f)
+		}
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		fatalf(ExitError, "failed to find chop-csv executable: %s", err)
+	}
+	// The options before and after the subcommand name are passed to chop-csv as is.
+	options := append(append([]string{}, os.Args[1:len(os.Args)-flag.NArg()]...), commandOptions...)
+
+	dir, err := os.MkdirTemp("", "chop-csv-bench-")
+	if err != nil {
+		fatalf(ExitOutputError, "failed to make temporary directory: %s", err)
+	}
+	if *keep {
+		logger.With("dir", dir).Infof("keep the files in %s", dir)
+	} else {
+		defer os.RemoveAll(dir)
+	}
+
+	logger.Infof("generate %dMB of input files", *size)
+	data, err := GenerateBenchData(dir, *size*1000*1000, *files, *days, *seed)
+	if err != nil {
+		os.RemoveAll(dir)
+		fatalf(ExitOutputError, "failed to generate input files: %s", err)
+	}
+
+	var results []BenchResult
+	for _, f := range fmts {
+		for _, j := range jobs {
+			logger.With("format", f, "jobs", j).Infof("run -format=%s -jobs=%d", f, j)
+			r, err := RunBench(exe, options, data, f, j, *runs, dir)
+			if err != nil {
+				os.RemoveAll(dir)
+				fatalf(ExitError, "failed to run benchmark: %s", err)
+			}
+			results = append(results, r)
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FORMAT\tJOBS\tROWS\tTIME\tROWS/S\tMB/S\tOUTPUT")
+	for _, r := range results {
+		sec := r.Duration.Seconds()
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.2fs\t%.0f\t%.2f\t%d\n", r.Format, r.Jobs, data.Rows, sec, float64(data.Rows)/sec, float64(data.Bytes)/sec/1000/1000, r.OutputBytes)
+	}
+	w.Flush()
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestGenerateBenchData(t *testing.T) {
+	var contents [][]byte
+	for i := 0; i < 2; i++ {
+		data, err := GenerateBenchData(t.TempDir(), 10000, 2, 3, 1)
+		if err != nil {
+			t.Fatalf("failed to generate: %s", err)
+		}
+		if len(data.Files) != 2 {
+			t.Fatalf("expected 2 files but got %q", data.Files)
+		}
+
+		var all []byte
+		var rows int64
+		prevDate := ""
+		for _, path := range data.Files {
+			b, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("failed to read: %s", err)
+			}
+			all = append(all, b...)
+
+			records, err := csv.NewReader(CP932.NewDecoder().Reader(bytes.NewReader(b))).ReadAll()
+			if err != nil {
+				t.Fatalf("failed to parse %s: %s", path, err)
+			}
+			prevDate = ""
+			for _, r := range records {
+				if len(r) != 5 {
+					t.Fatalf("unexpected row: %q", r)
+				}
+				if r[0] < prevDate {
+					t.Fatalf("expected sorted by date but %s after %s", r[0], prevDate)
+				}
+				prevDate = r[0]
+			}
+			rows += int64(len(records))
+		}
+
+		if rows != data.Rows {
+			t.Errorf("expected %d rows but got %d", data.Rows, rows)
+		}
+		if int64(len(all)) != data.Bytes {
+			t.Errorf("expected %d bytes but got %d", data.Bytes, len(all))
+		}
+		if prevDate != "20230103" {
+			t.Errorf("expected the last date is 20230103 but got %s", prevDate)
+		}
+		contents = append(contents, all)
+	}
+
+	if !bytes.Equal(contents[0], contents[1]) {
+		t.Errorf("expected the same seed makes the same data")
+	}
+}
+
+func TestCSVQuote(t *testing.T) {
+	tests := []struct {
+		Input  string
+		Output string
+	}{
+		{"", ""},
+		{"hello", "hello"},
+		{"a,b", `"a,b"`},
+		{`"quoted"`, `"""quoted"""`},
+	}
+
+	for _, tt := range tests {
+		if got := CSVQuote(tt.Input); got != tt.Output {
+			t.Errorf("%q: expected %q but got %q", tt.Input, tt.Output, got)
+		}
+	}
+}
+
+func TestParseBenchJobs(t *testing.T) {
+	if got, err := parseBenchJobs("1, 2,4"); err != nil {
+		t.Errorf("failed to parse: %s", err)
+	} else if want := []int{1, 2, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v but got %v", want, got)
+	}
+
+	for _, s := range []string{"", "0", "a"} {
+		if _, err := parseBenchJobs(s); err == nil {
+			t.Errorf("%q: expected error but got nil", s)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// bundleVerifyScript is the script in the bundle to verify the files on arrival.
+const bundleVerifyScript = `#!/bin/sh
+# Verify the files in this bundle that made by chop-csv.
+# Extract the bundle, and run this script in the extracted directory.
+cd "$(dirname "$0")" || exit 1
+if command -v sha256sum >/dev/null 2>&1; then
+	sha256sum -c SHA256SUMS
+else
+	shasum -a 256 -c SHA256SUMS
+fi
+`
+
+// WriteBundle writes a tar file that includes the output files of this run, the manifest, the checksums, and the verification script.
+// The bundle is self-contained, so that it can be transferred into an air-gapped environment and verified there.
+//
+// WARNING: this function reads commandline flags directly.
+func WriteBundle(path string, m Manifest) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tw := tar.NewWriter(f)
+	now := outputTime()
+	var sums bytes.Buffer
+
+	for _, e := range m.Files {
+		src := filepath.Join(*outputDir, filepath.FromSlash(e.Path))
+		if err := addBundleFile(tw, e.Path, src, now, &sums); err != nil {
+			return err
+		}
+		if _, err := os.Stat(src + ".idx"); err == nil {
+			if err := addBundleFile(tw, e.Path+".idx", src+".idx", now, &sums); err != nil {
+				return err
+			}
+		}
+	}
+
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	manifest = append(manifest, '\n')
+	fmt.Fprintf(&sums, "%s  %s\n", sha256Hex(manifest), "manifest.json")
+
+	extras := []struct {
+		name string
+		mode int64
+		data []byte
+	}{
+		{"manifest.json", 0644, manifest},
+		{"SHA256SUMS", 0644, sums.Bytes()},
+		{"verify.sh", 0755, []byte(bundleVerifyScript)},
+	}
+	for _, x := range extras {
+		h := &tar.Header{Name: x.name, Mode: x.mode, Size: int64(len(x.data)), ModTime: now}
+		if err := tw.WriteHeader(h); err != nil {
+			return err
+		}
+		if _, err := tw.Write(x.data); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// addBundleFile adds the file src into the bundle as name, and writes its checksum into sums.
+func addBundleFile(tw *tar.Writer, name, src string, now time.Time, sums io.Writer) error {
+	size, sum, err := fileDigest(src)
+	if err != nil {
+		return err
+	}
+
+	h := &tar.Header{Name: name, Mode: 0644, Size: size, ModTime: now}
+	if err := tw.WriteHeader(h); err != nil {
+		return err
+	}
+
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.CopyN(tw, f, size); err != nil {
+		return fmt.Errorf("%s: %w", src, err)
+	}
+
+	fmt.Fprintf(sums, "%s  %s\n", sum, name)
+	return nil
+}
+
+// WriteOutputTar writes all files in the output directory into a tar file, that is compressed by gzip if the name ends with ".tar.gz" or ".tgz".
+// The entries are named by the relative paths from dir, like "year=2023/month=4/day=1/xxx.csv.bz2".
+//
+// The tar file is written into a temporary file and renamed into place, so that a half-written tar file is not left.
+// The gzip header has no modification time, and the entries have fixed metadata if -deterministic is set.
+func WriteOutputTar(path, dir string) error {
+	tmp := tempOutputPath(path)
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	defer f.Close()
+
+	var w io.Writer = f
+	var gz *gzip.Writer
+	if strings.HasSuffix(path, ".tar.gz") || strings.HasSuffix(path, ".tgz") {
+		gz = gzip.NewWriter(f)
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+
+	err = filepath.Walk(dir, func(p string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == dir {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+
+		h, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		h.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			h.Name += "/"
+		}
+		if deterministic {
+			// The owners, the permissions, and the timestamps are different on each environment.
+			h.Uid, h.Gid, h.Uname, h.Gname = 0, 0, "", ""
+			h.Mode = 0644
+			if info.IsDir() {
+				h.Mode = 0755
+			}
+			h.ModTime, h.AccessTime, h.ChangeTime = deterministicTime, time.Time{}, time.Time{}
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		src, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		if _, err := io.CopyN(tw, src, info.Size()); err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return renameOutput(tmp, path)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteBundle(t *testing.T) {
+	dir := setOutputDir(t)
+	day := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+	writePartitionFile(t, dir, day, "a.csv.bz2", [][]string{{"20230401", "hello"}})
+
+	name := PartitionDir(day) + "/a.csv.bz2"
+	size, sum, err := fileDigest(filepath.Join(dir, filepath.FromSlash(name)))
+	if err != nil {
+		t.Fatalf("failed to digest: %s", err)
+	}
+	m := Manifest{Files: []ManifestEntry{{Path: name, Size: size, SHA256: sum, Rows: 1, Inputs: []string{"input.csv"}}}}
+
+	path := filepath.Join(t.TempDir(), "bundle.tar")
+	if err := WriteBundle(path, m); err != nil {
+		t.Fatalf("failed to write bundle: %s", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open bundle: %s", err)
+	}
+	defer f.Close()
+
+	files := map[string][]byte{}
+	var names []string
+	tr := tar.NewReader(f)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("failed to read bundle: %s", err)
+		}
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("failed to read %s: %s", h.Name, err)
+		}
+		names = append(names, h.Name)
+		files[h.Name] = b
+	}
+
+	if want := []string{name, "manifest.json", "SHA256SUMS", "verify.sh"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("expected files %q but got %q", want, names)
+	}
+
+	sums := strings.Split(strings.TrimSuffix(string(files["SHA256SUMS"]), "\n"), "\n")
+	want := []string{
+		sum + "  " + name,
+		sha256Hex(files["manifest.json"]) + "  manifest.json",
+	}
+	if !reflect.DeepEqual(sums, want) {
+		t.Errorf("unexpected SHA256SUMS\nexpected: %q\n but got: %q", want, sums)
+	}
+}
+
+func TestWriteOutputTar(t *testing.T) {
+	dir := t.TempDir()
+	day := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+	writePartitionFile(t, dir, day, "a.csv.bz2", [][]string{{"20230401", "hello"}})
+	content, err := os.ReadFile(filepath.Join(dir, PartitionDir(day), "a.csv.bz2"))
+	if err != nil {
+		t.Fatalf("failed to read: %s", err)
+	}
+
+	for _, name := range []string{"out.tar", "out.tar.gz"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			if err := WriteOutputTar(path, dir); err != nil {
+				t.Fatalf("failed to write tar: %s", err)
+			}
+
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatalf("failed to open tar: %s", err)
+			}
+			defer f.Close()
+
+			var r io.Reader = f
+			if strings.HasSuffix(name, ".gz") {
+				gz, err := gzip.NewReader(f)
+				if err != nil {
+					t.Fatalf("failed to open gzip: %s", err)
+				}
+				r = gz
+			}
+
+			var names []string
+			tr := tar.NewReader(r)
+			for {
+				h, err := tr.Next()
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatalf("failed to read tar: %s", err)
+				}
+				names = append(names, h.Name)
+
+				if h.Typeflag == tar.TypeReg {
+					b, err := io.ReadAll(tr)
+					if err != nil {
+						t.Fatalf("failed to read %s: %s", h.Name, err)
+					}
+					if string(b) != string(content) {
+						t.Errorf("%s: unexpected content", h.Name)
+					}
+				}
+			}
+
+			want := []string{"year=2023/", "year=2023/month=4/", "year=2023/month=4/day=1/", "year=2023/month=4/day=1/a.csv.bz2"}
+			if !reflect.DeepEqual(names, want) {
+				t.Errorf("expected %q but got %q", want, names)
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Checkpoint is the progress of a run, that saved by -checkpoint to resume with -resume.
+type Checkpoint struct {
+	Inputs     []string         `json:"inputs"`
+	Done       []string         `json:"done"`
+	Current    *InputCheckpoint `json:"current,omitempty"`
+	Partitions []string         `json:"partitions"`
+	Summary    Summary          `json:"summary"`
+}
+
+// InputCheckpoint is the progress of the input file that was being chopped.
+type InputCheckpoint struct {
+	Path  string                    `json:"path"`
+	Rows  int                       `json:"rows"`  // the number of rows read, excluding the header
+	Files map[string]CheckpointFile `json:"files"` // the key is the path relative to the output directory, slash separated
+}
+
+// CheckpointFile is the state of an output file at a checkpoint.
+type CheckpointFile struct {
+	Size int64 `json:"size"`
+	Rows int64 `json:"rows"`
+}
+
+// Checkpointer saves checkpoints while chopping, and resumes from the saved checkpoint.
+// All methods do nothing if the Checkpointer is nil.
+//
+// WARNING: this struct reads commandline flags directly.
+type Checkpointer struct {
+	path     string
+	interval int
+	cp       Checkpoint
+	done     map[string]bool
+	resume   *InputCheckpoint // the progress to resume, or nil
+}
+
+// checkpoint is the Checkpointer of -checkpoint, or nil if disabled.
+var checkpoint *Checkpointer
+
+// NewCheckpointer makes a Checkpointer that saves a checkpoint into path every interval rows.
+func NewCheckpointer(path string, interval int, inputs []string) *Checkpointer {
+	return &Checkpointer{
+		path:     path,
+		interval: interval,
+		cp:       Checkpoint{Inputs: inputs, Done: []string{}},
+		done:     make(map[string]bool),
+	}
+}
+
+// ResumeCheckpointer loads the checkpoint in path, to resume the interrupted run with the same inputs.
+// The summary and the written partitions are restored from the checkpoint.
+func ResumeCheckpointer(path string, interval int, inputs []string) (*Checkpointer, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode into a new Checkpoint, because decoding into c.cp would overwrite inputs that shares the backing array.
+	var cp Checkpoint
+	if err := json.Unmarshal(b, &cp); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	c := NewCheckpointer(path, interval, inputs)
+	c.cp = cp
+	if !sameStrings(c.cp.Inputs, inputs) {
+		return nil, fmt.Errorf("%s: the inputs are different from the interrupted run: %s", path, strings.Join(c.cp.Inputs, " "))
+	}
+
+	for _, p := range c.cp.Done {
+		c.done[p] = true
+	}
+	c.resume = c.cp.Current
+	chopMu.Lock()
+	summary = c.cp.Summary
+	chopMu.Unlock()
+	for _, p := range c.cp.Partitions {
+		writtenPartitions[p] = true
+	}
+
+	return c, nil
+}
+
+// Done reports whether the input file was chopped before interrupted.
+func (c *Checkpointer) Done(inputPath string) bool {
+	return c != nil && c.done[inputPath]
+}
+
+// Begin starts chopping the input file with the writers, and returns the number of rows to skip.
+//
+// If the input file was being chopped when interrupted, Begin truncates the output files to the checkpoint,
+// and sets up the writers to append into them.
+func (c *Checkpointer) Begin(inputPath string, w, overflow *PartitionWriter) (int, error) {
+	if c == nil || c.resume == nil || c.resume.Path != inputPath {
+		return 0, nil
+	}
+	r := c.resume
+	c.resume = nil
+
+	for rel, f := range r.Files {
+		for _, dir := range outputDirs() {
+			path := filepath.Join(dir, filepath.FromSlash(rel))
+			for _, p := range []string{path, path + ".idx"} {
+				if _, err := os.Stat(tempOutputPath(p)); err == nil {
+					// The file was not renamed into place yet, so continue writing into the temporary file.
+					pendingFiles[p] = true
+				}
+			}
+			if err := os.Truncate(localOutputPath(path), f.Size); err != nil {
+				return 0, err
+			}
+			if err := truncateIndex(localOutputPath(path+".idx"), f); err != nil {
+				return 0, err
+			}
+		}
+
+		path := filepath.Join(*outputDir, filepath.FromSlash(rel))
+		if strings.HasPrefix(rel, overflowDir+"/") {
+			if overflow == nil {
+				return 0, fmt.Errorf("%s: -max-row-size is required to resume", path)
+			}
+			overflow.Resume(path, f.Rows)
+		} else {
+			w.Resume(path, f.Rows)
+		}
+	}
+
+	chopMu.Lock()
+	summary = c.cp.Summary
+	chopMu.Unlock()
+	logger.With("input", inputPath, "row", r.Rows).Infof("resume %s from row %d", inputPath, r.Rows)
+	return r.Rows, nil
+}
+
+// truncateIndex removes the entries after the end of the truncated file from the seek index, if exists.
+func truncateIndex(path string, f CheckpointFile) error {
+	index, err := ReadIndex(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	kept := make([]IndexEntry, 0, len(index)+1)
+	for _, e := range index {
+		if e.Offset < f.Size {
+			kept = append(kept, e)
+		}
+	}
+	kept = append(kept, IndexEntry{Row: f.Rows, Offset: f.Size})
+	return WriteIndex(path, kept)
+}
+
+// Due reports whether a checkpoint should be saved, to save every -checkpoint-interval rows.
+// rows is the number of rows that read from the input file so far.
+func (c *Checkpointer) Due(rows int) bool {
+	return c != nil && rows > 0 && rows%c.interval == 0
+}
+
+// Save saves a checkpoint that rows were read from the input file.
+// The output files are flushed, so that they can be truncated to the checkpoint when resumed.
+func (c *Checkpointer) Save(inputPath string, rows int, w, overflow *PartitionWriter) error {
+	if c == nil {
+		return nil
+	}
+
+	cur := &InputCheckpoint{Path: inputPath, Rows: rows, Files: make(map[string]CheckpointFile)}
+	for _, p := range []*PartitionWriter{w, overflow} {
+		if p == nil {
+			continue
+		}
+		if err := p.Flush(); err != nil {
+			return err
+		}
+		for _, path := range p.Files() {
+			s, err := os.Stat(localOutputPath(path))
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(*outputDir, path)
+			if err != nil {
+				return err
+			}
+			cur.Files[filepath.ToSlash(rel)] = CheckpointFile{Size: s.Size(), Rows: p.Rows(path)}
+		}
+	}
+
+	c.cp.Current = cur
+	return c.save()
+}
+
+// Finish saves a checkpoint that the input file was chopped.
+func (c *Checkpointer) Finish(inputPath string) error {
+	if c == nil {
+		return nil
+	}
+	c.cp.Done = append(c.cp.Done, inputPath)
+	c.done[inputPath] = true
+	c.cp.Current = nil
+	return c.save()
+}
+
+// Remove removes the checkpoint file, because the run finished.
+func (c *Checkpointer) Remove() error {
+	if c == nil {
+		return nil
+	}
+	if err := os.Remove(c.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// save writes the checkpoint into the file.
+// The file is replaced atomically, so that the checkpoint is not broken even if stopped while writing.
+func (c *Checkpointer) save() error {
+	c.cp.Partitions = WrittenPartitions()
+	c.cp.Summary = summary
+
+	b, err := json.MarshalIndent(c.cp, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, append(b, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
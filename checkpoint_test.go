@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCheckpointer_resume(t *testing.T) {
+	dir := setOutputDir(t)
+
+	origSummary, origPartitions := summary, writtenPartitions
+	summary, writtenPartitions = Summary{}, map[string]bool{}
+	defer func() { summary, writtenPartitions = origSummary, origPartitions }()
+
+	day := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+	rows := [][]string{{"20230401", "a"}, {"20230401", "b"}, {"20230401", "c"}, {"20230401", "d"}}
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	inputs := []string{"input.csv"}
+
+	// The first run saves a checkpoint after 2 rows, and is interrupted after the 3rd row is written.
+	c := NewCheckpointer(path, 2, inputs)
+	w := NewPartitionWriter("a.csv.bz2")
+	for i, row := range rows[:3] {
+		if c.Due(i) {
+			if err := c.Save("input.csv", i, w, nil); err != nil {
+				t.Fatalf("failed to save checkpoint: %s", err)
+			}
+		}
+		if err := w.Write(day, row); err != nil {
+			t.Fatalf("failed to write: %s", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+
+	// The second run truncates the output to the checkpoint, and continues from the 3rd row.
+	// The file was not renamed into place, so it is still the temporary file.
+	pendingFiles = map[string]bool{}
+
+	c, err := ResumeCheckpointer(path, 2, inputs)
+	if err != nil {
+		t.Fatalf("failed to load checkpoint: %s", err)
+	}
+	if c.Done("input.csv") {
+		t.Errorf("expected the interrupted input not to be done")
+	}
+	w = NewPartitionWriter("a.csv.bz2")
+	skip, err := c.Begin("input.csv", w, nil)
+	if err != nil {
+		t.Fatalf("failed to resume: %s", err)
+	}
+	if skip != 2 {
+		t.Fatalf("expected to skip 2 rows but got %d", skip)
+	}
+	for _, row := range rows[skip:] {
+		if err := w.Write(day, row); err != nil {
+			t.Fatalf("failed to write: %s", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+	if err := CompleteUploads(); err != nil {
+		t.Fatalf("failed to rename into place: %s", err)
+	}
+
+	got := readBzip2CSV(t, filepath.Join(dir, PartitionDir(day), "a.csv.bz2"))
+	if !reflect.DeepEqual(got, rows) {
+		t.Errorf("unexpected output\nexpected: %q\n but got: %q", rows, got)
+	}
+
+	if err := c.Finish("input.csv"); err != nil {
+		t.Fatalf("failed to finish: %s", err)
+	}
+	c, err = ResumeCheckpointer(path, 2, inputs)
+	if err != nil {
+		t.Fatalf("failed to load checkpoint: %s", err)
+	}
+	if !c.Done("input.csv") {
+		t.Errorf("expected the finished input to be done")
+	}
+
+	if err := c.Remove(); err != nil {
+		t.Fatalf("failed to remove: %s", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected the checkpoint to be removed but got %v", err)
+	}
+}
+
+func TestResumeCheckpointer_differentInputs(t *testing.T) {
+	origSummary := summary
+	defer func() { summary = origSummary }()
+
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	if err := NewCheckpointer(path, 1, []string{"a.csv"}).Finish("a.csv"); err != nil {
+		t.Fatalf("failed to save checkpoint: %s", err)
+	}
+	if _, err := ResumeCheckpointer(path, 1, []string{"b.csv"}); err == nil {
+		t.Errorf("expected error for different inputs but got nil")
+	}
+}
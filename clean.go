@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// cleanColumns is the columns to apply CleanField.
+var cleanColumns ColumnSet
+
+// CleanField removes padding spaces and surrounding quotes from s.
+//
+// Such garbage is often left when a fixed-width record is converted into CSV naively, like `  "foo"   `.
+func CleanField(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		s = strings.TrimSpace(s[1 : len(s)-1])
+	}
+	return s
+}
+
+// CleanRecord applies CleanField to the columns in cleanColumns.
+func CleanRecord(record []string) {
+	if cleanColumns.Empty() {
+		return
+	}
+	for i := range record {
+		if cleanColumns.Has(i) {
+			record[i] = CleanField(record[i])
+		}
+	}
+}
+
+// normalizeForms is the Unicode normalization forms of -normalize.
+var normalizeForms = map[string]norm.Form{
+	"nfc":  norm.NFC,
+	"nfkc": norm.NFKC,
+}
+
+// normalizeForm is the Unicode normalization form of -normalize, or nil if not set.
+var normalizeForm *norm.Form
+
+// NormalizeField applies -normalize and -trim to s.
+//
+// NFKC makes full-width digits and symbols like "２０２３／０４／０１" into "2023/04/01".
+// Trimming removes the spaces around s, including full-width spaces and CR.
+//
+// WARNING: this function reads commandline flags directly.
+func NormalizeField(s string) string {
+	if normalizeForm != nil {
+		s = normalizeForm.String(s)
+	}
+	if *trimFields {
+		s = strings.TrimSpace(s)
+	}
+	return s
+}
+
+// NormalizeRecord applies NormalizeField to the timestamp column, or all columns with -normalize-all.
+// It is applied before parsing the timestamp, so that the same date in different forms is written as the same value.
+// The timestamps like "２０２３年４月１日" can be parsed without this by NormalizeJapaneseDate, but they are written as is.
+//
+// WARNING: this function reads commandline flags directly.
+func NormalizeRecord(record []string) {
+	if normalizeForm == nil && !*trimFields {
+		return
+	}
+	if !*normalizeAll {
+		record[0] = NormalizeField(record[0])
+		return
+	}
+	for i := range record {
+		record[i] = NormalizeField(record[i])
+	}
+}
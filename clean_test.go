@@ -0,0 +1,79 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+func TestCleanField(t *testing.T) {
+	tests := []struct {
+		Input  string
+		Output string
+	}{
+		{"foo", "foo"},
+		{"  foo   ", "foo"},
+		{`  "foo"   `, "foo"},
+		{`" foo "`, "foo"},
+		{"'foo'", "foo"},
+		{`"foo'`, `"foo'`},
+		{`"`, `"`},
+		{`""`, ""},
+		{`a "b" c`, `a "b" c`},
+	}
+
+	for _, tt := range tests {
+		if got := CleanField(tt.Input); got != tt.Output {
+			t.Errorf("CleanField(%q): expected %q but got %q", tt.Input, tt.Output, got)
+		}
+	}
+}
+
+func TestCleanRecord(t *testing.T) {
+	orig := cleanColumns
+	defer func() { cleanColumns = orig }()
+
+	var err error
+	if cleanColumns, err = ParseColumnSet("2,3"); err != nil {
+		t.Fatalf("failed to parse columns: %s", err)
+	}
+
+	record := []string{" 20230401 ", ` "a" `, " b ", " c "}
+	CleanRecord(record)
+	if want := []string{" 20230401 ", "a", "b", " c "}; !reflect.DeepEqual(record, want) {
+		t.Errorf("expected %q but got %q", want, record)
+	}
+}
+
+func TestNormalizeRecord(t *testing.T) {
+	nfkc := norm.NFKC
+
+	tests := []struct {
+		Name   string
+		Form   *norm.Form
+		Trim   bool
+		All    bool
+		Output []string
+	}{
+		{"none", nil, false, false, []string{"　２０２３/04/01\r", " Ａ "}},
+		{"nfkc", &nfkc, false, false, []string{" 2023/04/01\r", " Ａ "}},
+		{"trim", nil, true, false, []string{"２０２３/04/01", " Ａ "}},
+		{"both", &nfkc, true, false, []string{"2023/04/01", " Ａ "}},
+		{"all", &nfkc, true, true, []string{"2023/04/01", "A"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			origForm, origTrim, origAll := normalizeForm, *trimFields, *normalizeAll
+			normalizeForm, *trimFields, *normalizeAll = tt.Form, tt.Trim, tt.All
+			defer func() { normalizeForm, *trimFields, *normalizeAll = origForm, origTrim, origAll }()
+
+			record := []string{"　２０２３/04/01\r", " Ａ "}
+			NormalizeRecord(record)
+			if !reflect.DeepEqual(record, tt.Output) {
+				t.Errorf("expected %q but got %q", tt.Output, record)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"time"
+)
+
+// Clock is a source of the current time.
+//
+// chop-csv asks a Clock instead of calling time.Now directly, so that tests can replace it.
+// DefaultClock is the current time to write into the output, like the creation time of the manifest, and -now fixes it to replay a past run.
+// SystemClock is for the elapsed times, the timers, and the requests to the APIs, that must advance even if -now is set.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc is an adapter to use a function as a Clock.
+type ClockFunc func() time.Time
+
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// FixedClock makes a Clock that always returns t.
+func FixedClock(t time.Time) Clock {
+	return ClockFunc(func() time.Time {
+		return t
+	})
+}
+
+var (
+	// SystemClock is a Clock that uses the system time.
+	SystemClock Clock = ClockFunc(time.Now)
+
+	// DefaultClock is the Clock of the current time to write into the output, that fixed by -now.
+	DefaultClock = SystemClock
+)
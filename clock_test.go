@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFixedClock(t *testing.T) {
+	now := time.Date(2023, 4, 1, 12, 34, 56, 0, time.UTC)
+	c := FixedClock(now)
+
+	for i := 0; i < 2; i++ {
+		if got := c.Now(); !got.Equal(now) {
+			t.Errorf("expected %s but got %s", now, got)
+		}
+	}
+}
+
+func TestSystemClock(t *testing.T) {
+	before := time.Now()
+	got := SystemClock.Now()
+	after := time.Now()
+
+	if got.Before(before) || got.After(after) {
+		t.Errorf("expected between %s and %s but got %s", before, after, got)
+	}
+}
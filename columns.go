@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ColumnSet is a set of columns that specified by commandline flag, like "1,3,5" or "all".
+//
+// The column numbers in commandline are 1-origin, but ColumnSet uses 0-origin internally.
+type ColumnSet struct {
+	all     bool
+	columns map[int]bool
+}
+
+// ParseColumnSet parses comma separated column numbers or "all".
+func ParseColumnSet(s string) (ColumnSet, error) {
+	if s == "" {
+		return ColumnSet{}, nil
+	}
+	if s == "all" {
+		return ColumnSet{all: true}, nil
+	}
+
+	cs := ColumnSet{columns: make(map[int]bool)}
+	for _, x := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(x))
+		if err != nil || n < 1 {
+			return ColumnSet{}, fmt.Errorf("invalid column number: %q", x)
+		}
+		cs.columns[n-1] = true
+	}
+	return cs, nil
+}
+
+// Has reports whether the i-th (0-origin) column is in the set.
+func (cs ColumnSet) Has(i int) bool {
+	return cs.all || cs.columns[i]
+}
+
+// Empty reports whether the set has no columns.
+func (cs ColumnSet) Empty() bool {
+	return !cs.all && len(cs.columns) == 0
+}
+
+// ColumnList is an ordered list of columns that specified by commandline flag, like "1,3,5" or "id,name".
+//
+// Each item is a column number (1-origin) or a column name in header.
+type ColumnList []string
+
+// outputColumns is the columns to write into output files.
+var outputColumns ColumnList
+
+// ParseColumnList parses comma separated column numbers or names.
+func ParseColumnList(s string) ColumnList {
+	if s == "" {
+		return nil
+	}
+
+	var l ColumnList
+	for _, x := range strings.Split(s, ",") {
+		l = append(l, strings.TrimSpace(x))
+	}
+	return l
+}
+
+// Resolve converts the list into 0-origin column indexes.
+// The names are looked up in header, and numbers are used as is.
+func (l ColumnList) Resolve(header []string) ([]int, error) {
+	idx := make([]int, 0, len(l))
+	for _, x := range l {
+		if n, err := strconv.Atoi(x); err == nil {
+			if n < 1 {
+				return nil, fmt.Errorf("invalid column number: %d", n)
+			}
+			idx = append(idx, n-1)
+			continue
+		}
+
+		found := false
+		for i, h := range header {
+			if h == x {
+				idx = append(idx, i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			if header == nil {
+				return nil, fmt.Errorf("column name %q is not available without header", x)
+			}
+			return nil, fmt.Errorf("no such column: %q", x)
+		}
+	}
+	return idx, nil
+}
+
+// Project makes a new row that has only the columns in idx.
+// Missing columns and negative indexes are filled with empty strings.
+func Project(row []string, idx []int) []string {
+	projected := make([]string, len(idx))
+	for i, j := range idx {
+		if 0 <= j && j < len(row) {
+			projected[i] = row[j]
+		}
+	}
+	return projected
+}
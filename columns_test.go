@@ -0,0 +1,93 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseColumnSet(t *testing.T) {
+	tests := []struct {
+		Input string
+		Has   []int
+		Not   []int
+		Empty bool
+	}{
+		{"", nil, []int{0, 1}, true},
+		{"all", []int{0, 1, 100}, nil, false},
+		{"1,3, 5", []int{0, 2, 4}, []int{1, 3, 5}, false},
+	}
+
+	for _, tt := range tests {
+		cs, err := ParseColumnSet(tt.Input)
+		if err != nil {
+			t.Fatalf("%q: failed to parse: %s", tt.Input, err)
+		}
+		if cs.Empty() != tt.Empty {
+			t.Errorf("%q: expected Empty is %v", tt.Input, tt.Empty)
+		}
+		for _, i := range tt.Has {
+			if !cs.Has(i) {
+				t.Errorf("%q: expected to have %d", tt.Input, i)
+			}
+		}
+		for _, i := range tt.Not {
+			if cs.Has(i) {
+				t.Errorf("%q: expected not to have %d", tt.Input, i)
+			}
+		}
+	}
+
+	for _, s := range []string{"0", "a", "1,,2", "-1"} {
+		if _, err := ParseColumnSet(s); err == nil {
+			t.Errorf("%q: expected error but got nil", s)
+		}
+	}
+}
+
+func TestColumnList_Resolve(t *testing.T) {
+	header := []string{"date", "id", "name"}
+
+	tests := []struct {
+		Name   string
+		Input  string
+		Header []string
+		Output []int
+		Error  string
+	}{
+		{"numbers", "3, 1", nil, []int{2, 0}, ""},
+		{"names", "name,date", header, []int{2, 0}, ""},
+		{"mixed", "id,1", header, []int{1, 0}, ""},
+		{"invalid number", "0", header, nil, "invalid column number: 0"},
+		{"no such column", "email", header, nil, `no such column: "email"`},
+		{"name without header", "name", nil, nil, `column name "name" is not available without header`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			got, err := ParseColumnList(tt.Input).Resolve(tt.Header)
+			if tt.Error != "" {
+				if err == nil || err.Error() != tt.Error {
+					t.Fatalf("expected error %q but got %v", tt.Error, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to resolve: %s", err)
+			}
+			if !reflect.DeepEqual(got, tt.Output) {
+				t.Errorf("expected %v but got %v", tt.Output, got)
+			}
+		})
+	}
+
+	if l := ParseColumnList(""); l != nil {
+		t.Errorf("expected nil for empty string but got %q", l)
+	}
+}
+
+func TestProject(t *testing.T) {
+	got := Project([]string{"a", "b", "c"}, []int{2, 0, 5, -1})
+	if want := []string{"c", "a", "", ""}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// Command is a subcommand of chop-csv, like "chop-csv lint FILE...".
+type Command struct {
+	Name    string
+	Summary string
+	Run     func(args []string)
+}
+
+// commands is the subcommands of chop-csv.
+// "chop" is not included, because it is handled by main as the default command.
+var commands []Command
+
+func init() {
+	commands = []Command{
+		{"verify", "Check if the input files can be decoded without any loss.", runVerify},
+		{"lint", "Check if the input files can be chopped, and print the problems.", runLint},
+		{"merge", "Merge the partitions into a CSV in the order of timestamp.", runMerge},
+		{"list", "Print the partitions with the number of files, the size, and the rows.", runList},
+		{"sample", "Print rows at random from a partition.", runSample},
+		{"compact", "Merge the small files in each partition into a file.", runCompact},
+		{"repartition", "Write the partitions into another granularity.", runRepartition},
+		{"status", "Show the history of past runs.", runStatus},
+		{"ddl", "Print CREATE EXTERNAL TABLE statement for Hive and Athena.", runDDL},
+		{"bench", "Measure the throughput with synthetic input files.", runBench},
+		{"version", "Print the version of chop-csv.", runVersion},
+		{"help", "Print the usage of chop-csv or a subcommand.", runHelp},
+	}
+}
+
+// findCommand returns the subcommand of the name, or nil if not found.
+func findCommand(name string) *Command {
+	for i := range commands {
+		if commands[i].Name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// printUsage prints the usage of chop-csv with the list of the subcommands and OPTIONS.
+func printUsage() {
+	fmt.Println("Usage: chop-csv [chop] [OPTIONS] FILE...")
+	fmt.Println("       chop-csv COMMAND [OPTIONS] [COMMAND OPTIONS] ARGS...")
+	fmt.Println()
+	fmt.Println("COMMANDS:")
+	fmt.Printf("  %-12s %s\n", "chop", "Chop the input files into partitions. This is the default command.")
+	for _, c := range commands {
+		fmt.Printf("  %-12s %s\n", c.Name, c.Summary)
+	}
+	fmt.Println()
+	fmt.Println(`Run "chop-csv help COMMAND" to see the COMMAND OPTIONS of each command.`)
+	fmt.Println("OPTIONS are available for all commands, and can be written before or after COMMAND.")
+	fmt.Println()
+	fmt.Println("OPTIONS:")
+	flag.PrintDefaults()
+}
+
+// commandOptions is OPTIONS that written after the subcommand name, like "-encoding=utf8".
+var commandOptions []string
+
+// sharedFlag is a flag of OPTIONS that added into the flag set of a subcommand.
+// It sets the flag in flag.CommandLine, so that flag.Visit and the configuration file treat it as set by commandline.
+type sharedFlag struct {
+	name  string
+	value flag.Value
+}
+
+func (f sharedFlag) String() string {
+	if f.value == nil {
+		return ""
+	}
+	return f.value.String()
+}
+
+func (f sharedFlag) Set(s string) error {
+	if err := flag.CommandLine.Set(f.name, s); err != nil {
+		return err
+	}
+	commandOptions = append(commandOptions, "-"+f.name+"="+s)
+	return nil
+}
+
+func (f sharedFlag) IsBoolFlag() bool {
+	b, ok := f.value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// parseCommand parses args of a subcommand by fs, and sets up OPTIONS like main does for chopping.
+// OPTIONS are also accepted in args, like "chop-csv lint -header FILE", unless fs has a flag of the same name.
+//
+// WARNING: this function reads commandline flags directly.
+// WARNING: this method can stop program with log.Fatal.
+func parseCommand(fs *flag.FlagSet, args []string) {
+	flag.VisitAll(func(f *flag.Flag) {
+		if fs.Lookup(f.Name) == nil {
+			fs.Var(sharedFlag{f.Name, f.Value}, f.Name, f.Usage)
+		}
+	})
+	fs.Parse(args)
+
+	loadConfig()
+	if err := SetupLogger(*logFormat, *logLevelName); err != nil {
+		fatalf(ExitUsage, "invalid -log-format or -log-level: %s", err)
+	}
+	StartProfiling()
+	setupOptions()
+}
+
+// printCommandDefaults prints the flags of fs like fs.PrintDefaults, excluding OPTIONS that added by parseCommand.
+func printCommandDefaults(fs *flag.FlagSet) {
+	own := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	own.SetOutput(fs.Output())
+	fs.VisitAll(func(f *flag.Flag) {
+		if _, ok := f.Value.(sharedFlag); !ok {
+			own.Var(f.Value, f.Name, f.Usage)
+			own.Lookup(f.Name).DefValue = f.DefValue
+		}
+	})
+	own.PrintDefaults()
+}
+
+// runVersion runs version subcommand.
+func runVersion(args []string) {
+	fmt.Printf("chop-csv %s\n", version)
+}
+
+// runHelp runs help subcommand.
+func runHelp(args []string) {
+	if len(args) == 0 || args[0] == "chop" {
+		printUsage()
+		return
+	}
+	c := findCommand(args[0])
+	if c != nil && (c.Name == "help" || c.Name == "version") {
+		printUsage()
+		return
+	}
+	if c == nil {
+		fmt.Fprintf(os.Stderr, "unknown command: %s\nRun \"chop-csv help\" to see the commands.\n", args[0])
+		os.Exit(ExitUsage)
+	}
+	c.Run([]string{"-h"})
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFindCommand(t *testing.T) {
+	if c := findCommand("lint"); c == nil || c.Name != "lint" {
+		t.Errorf("expected lint command but got %v", c)
+	}
+	for _, name := range []string{"chop", "unknown", ""} {
+		if c := findCommand(name); c != nil {
+			t.Errorf("%q: expected nil but got %v", name, c)
+		}
+	}
+}
+
+func TestSharedFlag(t *testing.T) {
+	origCommandLine, origOptions := flag.CommandLine, commandOptions
+	defer func() { flag.CommandLine, commandOptions = origCommandLine, origOptions }()
+
+	flag.CommandLine = flag.NewFlagSet("chop-csv", flag.ContinueOnError)
+	timezone := flag.String("timezone", "", "Timezone.")
+	verbose := flag.Bool("verbose", false, "Verbose.")
+	commandOptions = nil
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	own := fs.String("timezone", "UTC", "The own flag of the command.")
+	format := fs.String("format", "text", "The format of the command.")
+	flag.VisitAll(func(f *flag.Flag) {
+		if fs.Lookup(f.Name) == nil {
+			fs.Var(sharedFlag{f.Name, f.Value}, f.Name, f.Usage)
+		}
+	})
+
+	if err := fs.Parse([]string{"-verbose", "-timezone=Asia/Tokyo", "-format=json", "FILE"}); err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+
+	if !*verbose {
+		t.Errorf("expected the shared flag is set in the command line")
+	}
+	if *timezone != "" || *own != "Asia/Tokyo" {
+		t.Errorf("expected the own flag takes precedence but got %q and %q", *timezone, *own)
+	}
+	if *format != "json" || !reflect.DeepEqual(fs.Args(), []string{"FILE"}) {
+		t.Errorf("unexpected result: %q %q", *format, fs.Args())
+	}
+	if want := []string{"-verbose=true"}; !reflect.DeepEqual(commandOptions, want) {
+		t.Errorf("expected options %q but got %q", want, commandOptions)
+	}
+	set := false
+	flag.Visit(func(f *flag.Flag) { set = set || f.Name == "verbose" })
+	if !set {
+		t.Errorf("expected the shared flag is visited as set")
+	}
+
+	var buf bytes.Buffer
+	fs.SetOutput(&buf)
+	printCommandDefaults(fs)
+	if s := buf.String(); !strings.Contains(s, "-format") || strings.Contains(s, "-verbose") {
+		t.Errorf("expected only the own flags but got:\n%s", s)
+	}
+}
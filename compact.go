@@ -0,0 +1,188 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// compactFile is a file in a partition to compact.
+type compactFile struct {
+	path string
+	size int64
+	rows []timedRow
+}
+
+// planCompaction groups the files into bins to merge into a file.
+// The files larger than maxSize or maxRows are left as is, and each bin does not exceed them in total. 0 means unlimited.
+// The bins with only one file are omitted, because there is nothing to merge.
+func planCompaction(files []compactFile, maxSize, maxRows int64) [][]compactFile {
+	var bins [][]compactFile
+	var bin []compactFile
+	var size, rows int64
+
+	flush := func() {
+		if len(bin) > 1 {
+			bins = append(bins, bin)
+		}
+		bin = nil
+		size, rows = 0, 0
+	}
+
+	for _, f := range files {
+		r := int64(len(f.rows))
+		if (maxSize > 0 && f.size > maxSize) || (maxRows > 0 && r > maxRows) {
+			continue
+		}
+		if (maxSize > 0 && size+f.size > maxSize) || (maxRows > 0 && rows+r > maxRows) {
+			flush()
+		}
+		bin = append(bin, f)
+		size += f.size
+		rows += r
+	}
+	flush()
+
+	return bins
+}
+
+// compactedName decides the name of the file that merged from the files.
+func compactedName(files []compactFile) string {
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = filepath.Base(f.path)
+	}
+	return "compacted-" + md5sum(strings.Join(names, "\n")) + csvExtension()
+}
+
+// compactBin merges the files into a new file in the order of timestamp, and removes the original files.
+//
+// The new file is renamed into place after completed,
+// so that the rows never disappear and never duplicate if the compaction stopped in the middle.
+func compactBin(dir string, files []compactFile) (string, error) {
+	dest := filepath.Join(dir, compactedName(files))
+
+	w, err := Create(dest)
+	if err != nil {
+		return "", err
+	}
+
+	sources := make([][]timedRow, len(files))
+	for i, f := range files {
+		sources[i] = f.rows
+	}
+	if err := mergeSorted(sources, w.Write); err != nil {
+		w.Close()
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	if err := CompleteUploads(); err != nil {
+		return "", err
+	}
+
+	for _, f := range files {
+		if f.path == dest {
+			continue
+		}
+		if err := os.Remove(f.path); err != nil {
+			return "", err
+		}
+		if err := os.Remove(f.path + ".idx"); err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	return dest, nil
+}
+
+// Compact merges the small files in each partition in dir.
+// If dryRun is true, Compact only prints the plan.
+func Compact(dir string, maxSize, maxRows int64, dryRun bool) error {
+	ps, err := ListPartitions(dir)
+	if err != nil {
+		return err
+	}
+
+	var merged, written int
+	for _, p := range ps {
+		if len(p.Files) < 2 {
+			continue
+		}
+
+		files := make([]compactFile, len(p.Files))
+		for i, path := range p.Files {
+			s, err := os.Stat(path)
+			if err != nil {
+				return err
+			}
+			rows, err := readSortedRows(path)
+			if err != nil {
+				return err
+			}
+			files[i] = compactFile{path: path, size: s.Size(), rows: rows}
+		}
+
+		for _, bin := range planCompaction(files, maxSize, maxRows) {
+			if dryRun {
+				logger.With("partition", p.Dir, "files", len(bin)).Infof("would merge %d files into %s", len(bin), filepath.Join(p.Dir, compactedName(bin)))
+			} else {
+				dest, err := compactBin(p.Dir, bin)
+				if err != nil {
+					return err
+				}
+				logger.With("partition", p.Dir, "files", len(bin), "file", dest).Infof("merge %d files into %s", len(bin), dest)
+			}
+			merged += len(bin)
+			written++
+		}
+	}
+
+	logger.With("files", merged, "written_files", written).Infof("compact %d files into %d files", merged, written)
+	return nil
+}
+
+// runCompact runs compact subcommand.
+func runCompact(args []string) {
+	fs := flag.NewFlagSet("compact", flag.ExitOnError)
+	maxSize := fs.Int64("max-size", 128*1024*1024, "The maximum total size in bytes of the files to merge into a file. The larger files are left as is. 0 means unlimited.")
+	maxRows := fs.Int64("max-rows", 0, "The maximum total number of rows of the files to merge into a file. The larger files are left as is. 0 means unlimited.")
+	dryRun := fs.Bool("dry-run", false, "Print what would be merged, without changing anything.")
+	fs.Usage = func() {
+		fmt.Println("Usage: chop-csv compact [OPTIONS] [COMPACT OPTIONS] OUTDIR")
+		fmt.Println()
+		fmt.Println("Merge the small files in each partition of OUTDIR into a file, in the order of timestamp.")
+		fmt.Println("The merged rows will be duplicated if the original input files are chopped again, so compact only the partitions that finished.")
+		fmt.Println()
+		fmt.Println("COMPACT OPTIONS:")
+		printCommandDefaults(fs)
+	}
+	parseCommand(fs, args)
+
+	if fs.NArg() != 1 || *maxSize < 0 || *maxRows < 0 {
+		fs.Usage()
+		os.Exit(ExitUsage)
+	}
+
+	if !*dryRun && !*noLock {
+		l, err := LockOutputDir(fs.Arg(0), *waitLock)
+		if err != nil {
+			fatalf(ExitError, "failed to lock output directory: %s", err)
+		}
+		outputLocks = append(outputLocks, l)
+	}
+
+	if *zstdDict {
+		d, err := ReadZstdDict(fs.Arg(0))
+		if err != nil {
+			fatalf(ExitInputError, "failed to read dictionary of -zstd-dict: %s", err)
+		}
+		zstdDictionary = d
+	}
+
+	if err := Compact(fs.Arg(0), *maxSize, *maxRows, *dryRun); err != nil {
+		fatalf(ExitError, "failed to compact: %s", err)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPlanCompaction(t *testing.T) {
+	files := []compactFile{
+		{path: "a", size: 10, rows: make([]timedRow, 1)},
+		{path: "b", size: 100, rows: make([]timedRow, 1)},
+		{path: "c", size: 20, rows: make([]timedRow, 2)},
+		{path: "d", size: 30, rows: make([]timedRow, 3)},
+		{path: "e", size: 10, rows: make([]timedRow, 1)},
+	}
+
+	tests := []struct {
+		Name    string
+		MaxSize int64
+		MaxRows int64
+		Output  [][]string
+	}{
+		{"unlimited", 0, 0, [][]string{{"a", "b", "c", "d", "e"}}},
+		{"max size", 50, 0, [][]string{{"a", "c"}, {"d", "e"}}},
+		{"max rows", 0, 3, [][]string{{"a", "b"}}},
+		{"too small", 5, 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			var got [][]string
+			for _, bin := range planCompaction(files, tt.MaxSize, tt.MaxRows) {
+				var names []string
+				for _, f := range bin {
+					names = append(names, f.path)
+				}
+				got = append(got, names)
+			}
+			if !reflect.DeepEqual(got, tt.Output) {
+				t.Errorf("expected %q but got %q", tt.Output, got)
+			}
+		})
+	}
+}
+
+func TestCompact(t *testing.T) {
+	origFormats := dateFormats
+	dateFormats = stringList{"2006-01-02 15:04"}
+	defer func() { dateFormats = origFormats }()
+
+	dir := t.TempDir()
+	day := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+	writePartitionFile(t, dir, day, "a.csv.bz2", [][]string{
+		{"2023-04-01 12:00", "a2"},
+		{"2023-04-01 09:00", "a1"},
+	})
+	writePartitionFile(t, dir, day, "b.csv.bz2", [][]string{
+		{"2023-04-01 10:00", "b1"},
+	})
+
+	if err := Compact(dir, 0, 0, true); err != nil {
+		t.Fatalf("failed to compact in dry-run: %s", err)
+	}
+	if ps, err := ListPartitions(dir); err != nil || len(ps[0].Files) != 2 {
+		t.Fatalf("expected dry-run to keep the files but got %v and %v", ps, err)
+	}
+
+	if err := Compact(dir, 0, 0, false); err != nil {
+		t.Fatalf("failed to compact: %s", err)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, PartitionDir(day)))
+	if err != nil {
+		t.Fatalf("failed to read partition: %s", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected only the compacted file but got %v", entries)
+	}
+
+	got := readBzip2CSV(t, filepath.Join(dir, PartitionDir(day), entries[0].Name()))
+	want := [][]string{
+		{"2023-04-01 09:00", "a1"},
+		{"2023-04-01 10:00", "b1"},
+		{"2023-04-01 12:00", "a2"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected output\nexpected: %q\n but got: %q", want, got)
+	}
+}
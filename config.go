@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// envPrefix is the prefix of the environment variables to set the flags, like CHOPCSV_OUT_DIR for -out-dir.
+const envPrefix = "CHOPCSV_"
+
+// ConfigFile is the flag values in a configuration file.
+// The keys are the flag names without "-", and each value is the list of values to set into the flag.
+type ConfigFile map[string][]string
+
+// LoadConfig reads a configuration file.
+func LoadConfig(path string) (ConfigFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cfg, err := ParseConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// ParseConfig parses a configuration file, that written in a subset of YAML like below.
+//
+//	out-dir: ./output
+//	header: true
+//	date-format: ["2006-01-02", "2006/01/02"]
+//	filter:
+//	  - "3>=1000"
+//	  - "4!=deleted"
+//
+// Only the flat mapping of scalars and lists is supported. The comments start with "#".
+func ParseConfig(r io.Reader) (ConfigFile, error) {
+	cfg := make(ConfigFile)
+
+	s := bufio.NewScanner(r)
+	var list string // the key of the block list that reading
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimRight(stripConfigComment(s.Text()), " \t\r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+
+		if line[0] == ' ' || line[0] == '\t' || line[0] == '-' {
+			if list == "" || !strings.HasPrefix(trimmed, "-") {
+				return nil, fmt.Errorf("line %d: unexpected indent", n)
+			}
+			v, err := parseConfigScalar(strings.TrimSpace(trimmed[1:]))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			cfg[list] = append(cfg[list], v)
+			continue
+		}
+
+		i := strings.Index(line, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", n)
+		}
+		key := strings.TrimSpace(line[:i])
+		value := strings.TrimSpace(line[i+1:])
+		if _, ok := cfg[key]; ok {
+			return nil, fmt.Errorf("line %d: duplicated key: %s", n, key)
+		}
+
+		list = ""
+		switch {
+		case value == "":
+			list = key
+			cfg[key] = []string{}
+		case strings.HasPrefix(value, "["):
+			vs, err := parseConfigList(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			cfg[key] = vs
+		default:
+			v, err := parseConfigScalar(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			cfg[key] = []string{v}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// stripConfigComment removes the comment that starts with "#" outside of quotes.
+func stripConfigComment(line string) string {
+	var quote rune
+	for i, c := range line {
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				// The next character is escaped, but it can not be a quote that closes the string.
+				continue
+			}
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// parseConfigScalar parses a plain, a single quoted, or a double quoted scalar.
+func parseConfigScalar(s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return "", fmt.Errorf("invalid quoted string: %s", s)
+		}
+		return v, nil
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return "", fmt.Errorf("invalid quoted string: %s", s)
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	}
+	return s, nil
+}
+
+// parseConfigList parses a flow list like `[a, "b", 'c']`.
+func parseConfigList(s string) ([]string, error) {
+	if !strings.HasSuffix(s, "]") {
+		return nil, fmt.Errorf("unterminated list: %s", s)
+	}
+	s = strings.TrimSpace(s[1 : len(s)-1])
+	if s == "" {
+		return []string{}, nil
+	}
+
+	var vs []string
+	var quote rune
+	start := 0
+	for i, c := range s + "," {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			v, err := parseConfigScalar(strings.TrimSpace(s[start:i]))
+			start = i + 1
+			if err != nil {
+				return nil, err
+			}
+			vs = append(vs, v)
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated string: %s", s)
+	}
+	return vs, nil
+}
+
+// envName returns the name of the environment variable for the flag.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// ApplyConfig sets the flags from the environment variables and the configuration file.
+// The flags that set in the command line are kept, and the environment variables take precedence over the configuration file.
+// cfg can be nil if there is no configuration file.
+func ApplyConfig(fs *flag.FlagSet, cfg ConfigFile) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	keys := make([]string, 0, len(cfg))
+	for k := range cfg {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if fs.Lookup(k) == nil {
+			return fmt.Errorf("unknown option in configuration file: %s", k)
+		}
+		if k == "config" {
+			return fmt.Errorf("-config can not be set in configuration file")
+		}
+	}
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || set[f.Name] {
+			return
+		}
+
+		if v, ok := os.LookupEnv(envName(f.Name)); ok {
+			if e := fs.Set(f.Name, v); e != nil {
+				err = fmt.Errorf("invalid %s: %w", envName(f.Name), e)
+			}
+			return
+		}
+
+		for _, v := range cfg[f.Name] {
+			if e := fs.Set(f.Name, v); e != nil {
+				err = fmt.Errorf("invalid %s in configuration file: %w", f.Name, e)
+				return
+			}
+		}
+	})
+	return err
+}
+
+// loadConfig applies the configuration file of -config and the environment variables into the commandline flags.
+//
+// WARNING: this function reads commandline flags directly.
+// WARNING: this method can stop program with log.Fatal.
+func loadConfig() {
+	path := *configPath
+	if path == "" {
+		path = os.Getenv(envName("config"))
+	}
+
+	var cfg ConfigFile
+	if path != "" {
+		var err error
+		if cfg, err = LoadConfig(path); err != nil {
+			fatalf(ExitUsage, "failed to read configuration file: %s", err)
+		}
+	}
+
+	if err := ApplyConfig(flag.CommandLine, cfg); err != nil {
+		fatalf(ExitUsage, "%s", err)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	input := strings.Join([]string{
+		"---",
+		"# comment",
+		"out-dir: ./output  # trailing comment",
+		"header: true",
+		`date-format: ["2006-01-02", '2006/01/02', 20060102]`,
+		"empty-list: []",
+		"filter:",
+		`  - "3>=1000"`,
+		"  - '4!=it''s # not a comment'",
+		"- plain",
+		"",
+		`double: "a\tb # \"not\" a comment"`,
+		"single: 'it''s'",
+		"hash: a#b",
+		"colon: http://localhost:8080",
+		"crlf: value\r",
+	}, "\n")
+
+	cfg, err := ParseConfig(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+
+	want := ConfigFile{
+		"out-dir":     {"./output"},
+		"header":      {"true"},
+		"date-format": {"2006-01-02", "2006/01/02", "20060102"},
+		"empty-list":  {},
+		"filter":      {"3>=1000", "4!=it's # not a comment", "plain"},
+		"double":      {"a\tb # \"not\" a comment"},
+		"single":      {"it's"},
+		"hash":        {"a#b"},
+		"colon":       {"http://localhost:8080"},
+		"crlf":        {"value"},
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("unexpected result\nexpected: %q\n but got: %q", want, cfg)
+	}
+}
+
+func TestParseConfig_error(t *testing.T) {
+	tests := []struct {
+		Name  string
+		Input string
+		Error string
+	}{
+		{"no colon", "out-dir", `line 1: expected "key: value"`},
+		{"duplicated", "a: 1\na: 2", "line 2: duplicated key: a"},
+		{"unexpected indent", "a: 1\n  - b", "line 2: unexpected indent"},
+		{"nested mapping", "a:\n  b: c", "line 2: unexpected indent"},
+		{"unterminated list", "a: [1, 2", "line 1: unterminated list: [1, 2"},
+		{"unterminated string in list", `a: ["1, 2]`, `line 1: unterminated string: "1, 2`},
+		{"invalid double quote", `a: "abc`, `line 1: invalid quoted string: "abc`},
+		{"invalid single quote", "a: 'abc", "line 1: invalid quoted string: 'abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			_, err := ParseConfig(strings.NewReader(tt.Input))
+			if err == nil {
+				t.Fatalf("expected error but got nil")
+			}
+			if err.Error() != tt.Error {
+				t.Errorf("expected error %q but got %q", tt.Error, err)
+			}
+		})
+	}
+}
+
+// listFlag is a flag that can be set multiple times, for the test of ApplyConfig.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+func TestApplyConfig(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	outDir := fs.String("out-dir", "chopped", "")
+	format := fs.String("format", "csv", "")
+	header := fs.Bool("header", false, "")
+	jobs := fs.Int("jobs", 1, "")
+	var filters listFlag
+	fs.Var(&filters, "filter", "")
+
+	if err := fs.Parse([]string{"-out-dir", "from-args"}); err != nil {
+		t.Fatalf("failed to parse flags: %s", err)
+	}
+	t.Setenv("CHOPCSV_FORMAT", "parquet")
+	t.Setenv("CHOPCSV_OUT_DIR", "from-env")
+
+	cfg := ConfigFile{
+		"out-dir": {"from-config"},
+		"format":  {"sqlite"},
+		"header":  {"true"},
+		"filter":  {"1=a", "2=b"},
+	}
+	if err := ApplyConfig(fs, cfg); err != nil {
+		t.Fatalf("failed to apply: %s", err)
+	}
+
+	if *outDir != "from-args" {
+		t.Errorf("expected -out-dir from the command line but got %s", *outDir)
+	}
+	if *format != "parquet" {
+		t.Errorf("expected -format from the environment variable but got %s", *format)
+	}
+	if !*header {
+		t.Errorf("expected -header from the configuration file but got false")
+	}
+	if *jobs != 1 {
+		t.Errorf("expected -jobs is the default but got %d", *jobs)
+	}
+	if want := (listFlag{"1=a", "2=b"}); !reflect.DeepEqual(filters, want) {
+		t.Errorf("expected -filter %q but got %q", want, filters)
+	}
+}
+
+func TestApplyConfig_error(t *testing.T) {
+	tests := []struct {
+		Name   string
+		Config ConfigFile
+		Env    string
+		Error  string
+	}{
+		{"unknown option", ConfigFile{"no-such-option": {"1"}}, "", "unknown option in configuration file: no-such-option"},
+		{"config", ConfigFile{"config": {"other.yaml"}}, "", "-config can not be set in configuration file"},
+		{"invalid value", ConfigFile{"jobs": {"many"}}, "", `invalid jobs in configuration file: parse error`},
+		{"invalid environment variable", nil, "many", `invalid CHOPCSV_JOBS: parse error`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.String("config", "", "")
+			fs.Int("jobs", 1, "")
+			if tt.Env != "" {
+				t.Setenv("CHOPCSV_JOBS", tt.Env)
+			}
+
+			err := ApplyConfig(fs, tt.Config)
+			if err == nil {
+				t.Fatalf("expected error but got nil")
+			}
+			if err.Error() != tt.Error {
+				t.Errorf("expected error %q but got %q", tt.Error, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Quoting policies for -quote.
+const (
+	QuoteMinimal    = "minimal"     // quote only the fields that need quotes
+	QuoteAll        = "all"         // quote all fields
+	QuoteNonNumeric = "non-numeric" // quote all fields except numbers
+)
+
+// CSVWriter is a CSV writer like encoding/csv.Writer, but can change the quoting policy.
+//
+// With the zero value options, the output is the same as encoding/csv.Writer.
+type CSVWriter struct {
+	// UseCRLF uses CRLF as the line terminator, and also converts all line breaks in the fields into CRLF.
+	// Bare CR and LF never appear in the output.
+	UseCRLF bool
+
+	// Quote is the quoting policy. Empty is the same as QuoteMinimal.
+	Quote string
+
+	w   *bufio.Writer
+	err error
+}
+
+// NewCSVWriter makes a new CSVWriter that writes into w.
+func NewCSVWriter(w io.Writer) *CSVWriter {
+	return &CSVWriter{w: bufio.NewWriter(w)}
+}
+
+// NewOutputCSVWriter makes a new CSVWriter with the options from commandline flags.
+//
+// WARNING: this function reads commandline flags directly.
+func NewOutputCSVWriter(w io.Writer) *CSVWriter {
+	c := NewCSVWriter(w)
+	c.UseCRLF = *rfc4180
+	c.Quote = *quotePolicy
+	return c
+}
+
+func (w *CSVWriter) Write(record []string) error {
+	if w.err != nil {
+		return w.err
+	}
+
+	for i, field := range record {
+		if i > 0 {
+			w.w.WriteByte(',')
+		}
+
+		if !w.needsQuotes(field) {
+			w.w.WriteString(field)
+			continue
+		}
+
+		w.w.WriteByte('"')
+		for j := 0; j < len(field); j++ {
+			switch c := field[j]; c {
+			case '"':
+				w.w.WriteString(`""`)
+			case '\r':
+				if w.UseCRLF {
+					w.w.WriteString("\r\n")
+					if j+1 < len(field) && field[j+1] == '\n' {
+						j++
+					}
+				} else {
+					w.w.WriteByte(c)
+				}
+			case '\n':
+				if w.UseCRLF {
+					w.w.WriteString("\r\n")
+				} else {
+					w.w.WriteByte(c)
+				}
+			default:
+				w.w.WriteByte(c)
+			}
+		}
+		w.w.WriteByte('"')
+	}
+
+	var err error
+	if w.UseCRLF {
+		_, err = w.w.WriteString("\r\n")
+	} else {
+		err = w.w.WriteByte('\n')
+	}
+	w.err = err
+	return err
+}
+
+// needsQuotes reports whether the field should be quoted.
+// The rules for QuoteMinimal are the same as encoding/csv.Writer.
+func (w *CSVWriter) needsQuotes(field string) bool {
+	switch w.Quote {
+	case QuoteAll:
+		return true
+	case QuoteNonNumeric:
+		return !isNumeric(field)
+	}
+
+	if field == "" {
+		return false
+	}
+	if field == `\.` || strings.ContainsAny(field, "\",\r\n") {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(field)
+	return unicode.IsSpace(r)
+}
+
+// Flush writes any buffered data into the underlying io.Writer.
+func (w *CSVWriter) Flush() {
+	if err := w.w.Flush(); w.err == nil {
+		w.err = err
+	}
+}
+
+// Error reports any error that has occurred during a previous Write or Flush.
+func (w *CSVWriter) Error() error {
+	return w.err
+}
+
+// isNumeric reports whether s is a decimal number like "123" or "-1.5e3".
+// "NaN", "Inf", and hexadecimal numbers are not numeric, because the loaders can not read them as number.
+func isNumeric(s string) bool {
+	if strings.Trim(s, "0123456789+-.eE") != "" {
+		return false
+	}
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+)
+
+func TestCSVWriter(t *testing.T) {
+	record := []string{"20230401", "", "a,b", "say \"hi\"", " space", "line1\nline2", "cr\rlf\r\n", `\.`}
+
+	tests := []struct {
+		Name    string
+		UseCRLF bool
+		Quote   string
+		Output  string
+	}{
+		{
+			"minimal",
+			false,
+			QuoteMinimal,
+			"20230401,,\"a,b\",\"say \"\"hi\"\"\",\" space\",\"line1\nline2\",\"cr\rlf\r\n\",\"\\.\"\n",
+		},
+		{
+			"all",
+			false,
+			QuoteAll,
+			"\"20230401\",\"\",\"a,b\",\"say \"\"hi\"\"\",\" space\",\"line1\nline2\",\"cr\rlf\r\n\",\"\\.\"\n",
+		},
+		{
+			"non-numeric",
+			false,
+			QuoteNonNumeric,
+			"20230401,\"\",\"a,b\",\"say \"\"hi\"\"\",\" space\",\"line1\nline2\",\"cr\rlf\r\n\",\"\\.\"\n",
+		},
+		{
+			"crlf",
+			true,
+			QuoteMinimal,
+			"20230401,,\"a,b\",\"say \"\"hi\"\"\",\" space\",\"line1\r\nline2\",\"cr\r\nlf\r\n\",\"\\.\"\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := NewCSVWriter(&buf)
+			w.UseCRLF = tt.UseCRLF
+			w.Quote = tt.Quote
+
+			if err := w.Write(record); err != nil {
+				t.Fatalf("failed to write: %s", err)
+			}
+			w.Flush()
+			if err := w.Error(); err != nil {
+				t.Fatalf("failed to flush: %s", err)
+			}
+
+			if got := buf.String(); got != tt.Output {
+				t.Errorf("expected %q but got %q", tt.Output, got)
+			}
+		})
+	}
+}
+
+func TestIsNumeric(t *testing.T) {
+	tests := []struct {
+		Input  string
+		Output bool
+	}{
+		{"123", true},
+		{"-1.5e3", true},
+		{"+0.25", true},
+		{"", false},
+		{"1,000", false},
+		{"NaN", false},
+		{"Inf", false},
+		{"0x1F", false},
+		{"1-2", false},
+	}
+
+	for _, tt := range tests {
+		if got := isNumeric(tt.Input); got != tt.Output {
+			t.Errorf("%q: expected %v but got %v", tt.Input, tt.Output, got)
+		}
+	}
+}
+
+func TestCSVWriter_compatible(t *testing.T) {
+	records := [][]string{
+		{"20230401", "", "a,b", "say \"hi\"", " space", "\ttab", "line1\nline2", "cr\rlf", `\.`, "日本語"},
+		{""},
+	}
+
+	var want bytes.Buffer
+	cw := csv.NewWriter(&want)
+	if err := cw.WriteAll(records); err != nil {
+		t.Fatalf("failed to write by encoding/csv: %s", err)
+	}
+
+	var got bytes.Buffer
+	w := NewCSVWriter(&got)
+	for _, r := range records {
+		if err := w.Write(r); err != nil {
+			t.Fatalf("failed to write: %s", err)
+		}
+	}
+	w.Flush()
+
+	if got.String() != want.String() {
+		t.Errorf("expected the same output as encoding/csv\nexpected: %q\n but got: %q", want.String(), got.String())
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// execParserCacheSize is the number of results that ExecTimestampParser remembers.
+// The dates in a file are mostly repeated, so the cache avoids most of the round trips to the command.
+const execParserCacheSize = 10000
+
+// ExecTimestampParser is a TimestampParser that asks an external command, for -date-parser=exec:COMMAND.
+//
+// The command is started once, and reads the values of the date column from stdin line by line.
+// For each line, the command writes a line of the timestamp in RFC3339 (or "2006-01-02T15:04:05" without zone) into stdout,
+// or an empty line if the value can not be parsed.
+type ExecTimestampParser struct {
+	command string
+
+	mu    sync.Mutex
+	in    io.WriteCloser
+	w     *bufio.Writer
+	r     *bufio.Reader
+	cache map[string]time.Time
+}
+
+// NewExecTimestampParser starts the command, and makes a new ExecTimestampParser.
+func NewExecTimestampParser(command string) (*ExecTimestampParser, error) {
+	cmd := shellCommand(command)
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	return &ExecTimestampParser{
+		command: command,
+		in:      in,
+		w:       bufio.NewWriter(in),
+		r:       bufio.NewReader(out),
+		cache:   make(map[string]time.Time),
+	}, nil
+}
+
+func (p *ExecTimestampParser) Parse(s string) (time.Time, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if t, ok := p.cache[s]; ok {
+		return t, nil
+	}
+
+	if strings.ContainsAny(s, "\r\n") {
+		return time.Time{}, fmt.Errorf("can not pass a value with line break to -date-parser: %q", s)
+	}
+
+	p.w.WriteString(s)
+	p.w.WriteByte('\n')
+	if err := p.w.Flush(); err != nil {
+		return time.Time{}, fmt.Errorf("%s: %w", p.command, err)
+	}
+
+	line, err := p.r.ReadString('\n')
+	if err == io.EOF {
+		return time.Time{}, fmt.Errorf("%s: command exited", p.command)
+	} else if err != nil {
+		return time.Time{}, fmt.Errorf("%s: %w", p.command, err)
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return time.Time{}, fmt.Errorf("%s: can not parse", p.command)
+	}
+
+	t, err := ParseTimeFlag(line)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s: invalid output: %w", p.command, err)
+	}
+	if timezone != nil {
+		t = t.In(timezone)
+	}
+
+	if len(p.cache) >= execParserCacheSize {
+		p.cache = make(map[string]time.Time)
+	}
+	p.cache[s] = t
+	return t, nil
+}
+
+// Close closes stdin of the command, to let it exit.
+func (p *ExecTimestampParser) Close() error {
+	return p.in.Close()
+}
+
+// ParseDateParser makes a TimestampParser from -date-parser, like "exec:./parse".
+func ParseDateParser(s string) (TimestampParser, error) {
+	if strings.HasPrefix(s, "exec:") {
+		return NewExecTimestampParser(strings.TrimPrefix(s, "exec:"))
+	}
+	return nil, fmt.Errorf("unsupported parser: %s", s)
+}
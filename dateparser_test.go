@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecTimestampParser(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test command is for sh")
+	}
+
+	// The command records the received values, to check the cache.
+	log := filepath.Join(t.TempDir(), "log")
+	p, err := ParseDateParser(`exec:while read v; do echo "$v" >> ` + shellQuote(log) + `; case "$v" in bad) echo;; *) echo "${v}T09:00:00+09:00";; esac; done`)
+	if err != nil {
+		t.Fatalf("failed to start parser: %s", err)
+	}
+
+	want := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 2; i++ {
+		got, err := p.Parse("2023-04-01")
+		if err != nil {
+			t.Fatalf("failed to parse: %s", err)
+		}
+		if !got.Equal(want) {
+			t.Errorf("expected %s but got %s", want, got)
+		}
+	}
+
+	if _, err := p.Parse("bad"); err == nil || !strings.HasSuffix(err.Error(), ": can not parse") {
+		t.Errorf("expected can not parse error but got %v", err)
+	}
+	if _, err := p.Parse("2023-04-01\n2023-04-02"); err == nil {
+		t.Errorf("expected error for value with line break")
+	}
+
+	// The command writes the log before the result, so the log is complete here.
+	b, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatalf("failed to read log: %s", err)
+	}
+	if got, want := string(b), "2023-04-01\nbad\n"; got != want {
+		t.Errorf("expected the command received %q but got %q", want, got)
+	}
+
+	if err := p.(*ExecTimestampParser).Close(); err != nil {
+		t.Errorf("failed to close: %s", err)
+	}
+}
+
+func TestParseDateParser(t *testing.T) {
+	if _, err := ParseDateParser("python:parse.py"); err == nil || err.Error() != "unsupported parser: python:parse.py" {
+		t.Errorf("expected unsupported parser error but got %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// WriteDBTManifest writes a dbt sources manifest for dbt-external-tables package.
+//
+// See also https://github.com/dbt-labs/dbt-external-tables
+func WriteDBTManifest(path, sourceName, tableName, location string) error {
+	if location == "" {
+		var err error
+		location, err = outputLocation(*outputDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("version: 2\n")
+	b.WriteString("\n")
+	b.WriteString("sources:\n")
+	fmt.Fprintf(&b, "  - name: %s\n", strconv.Quote(sourceName))
+	b.WriteString("    tables:\n")
+	fmt.Fprintf(&b, "      - name: %s\n", strconv.Quote(tableName))
+	b.WriteString("        external:\n")
+	fmt.Fprintf(&b, "          location: %s\n", strconv.Quote(location))
+	if *outputFormat == "parquet" {
+		b.WriteString("          file_format: parquet\n")
+	} else {
+		b.WriteString("          file_format: textfile\n")
+		b.WriteString("          row_format: \"serde 'org.apache.hadoop.hive.serde2.OpenCSVSerde'\"\n")
+		b.WriteString("          table_properties: \"('compressionType'='bzip2')\"\n")
+	}
+	b.WriteString("          partitions:\n")
+	for _, name := range PartitionKeys() {
+		fmt.Fprintf(&b, "            - name: %s\n", name)
+		b.WriteString("              data_type: int\n")
+	}
+
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
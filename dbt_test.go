@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteDBTManifest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sources.yml")
+	if err := WriteDBTManifest(path, "my source", "logs", "s3://bucket/prefix"); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read: %s", err)
+	}
+	s := string(b)
+
+	for _, want := range []string{
+		"version: 2\n",
+		`  - name: "my source"` + "\n",
+		`      - name: "logs"` + "\n",
+		`          location: "s3://bucket/prefix"` + "\n",
+		"            - name: year\n",
+		"            - name: month\n",
+		"            - name: day\n",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("expected to contain %q but got:\n%s", want, s)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// hiveTypes is the Hive types for the types of -parquet-schema.
+var hiveTypes = map[string]string{
+	"string":  "string",
+	"int64":   "bigint",
+	"double":  "double",
+	"boolean": "boolean",
+}
+
+// GenerateDDL generates a CREATE EXTERNAL TABLE statement for Hive and Athena, that matches to the output of chop-csv.
+//
+// WARNING: this function reads commandline flags directly.
+func GenerateDDL(table, location string, columns []string) (string, error) {
+	if location == "" {
+		var err error
+		location, err = outputLocation(*outputDir)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "CREATE EXTERNAL TABLE %s (\n", quoteHiveTable(table))
+	for i, c := range columns {
+		typ := "string"
+		if *outputFormat == "parquet" {
+			if t, ok := parquetTypes[c]; ok {
+				typ = hiveTypes[t]
+			}
+		}
+		sep := ","
+		if i == len(columns)-1 {
+			sep = ""
+		}
+		fmt.Fprintf(&b, "  %s %s%s\n", quoteHiveIdent(c), typ, sep)
+	}
+	b.WriteString(")\n")
+	keys := PartitionKeys()
+	for i, k := range keys {
+		keys[i] = k + " int"
+	}
+	fmt.Fprintf(&b, "PARTITIONED BY (%s)\n", strings.Join(keys, ", "))
+
+	switch *outputFormat {
+	case "csv":
+		if *zstdDict || hasZstdDict(*outputDir) {
+			return "", fmt.Errorf("-zstd-dict is not supported by Hive, because Hive can not decompress zstd with a dictionary")
+		}
+		b.WriteString("ROW FORMAT SERDE 'org.apache.hadoop.hive.serde2.OpenCSVSerde'\n")
+		b.WriteString("STORED AS TEXTFILE\n")
+	case "parquet":
+		b.WriteString("STORED AS PARQUET\n")
+	default:
+		return "", fmt.Errorf("-format=%s is not supported by Hive", *outputFormat)
+	}
+
+	fmt.Fprintf(&b, "LOCATION '%s'\n", strings.ReplaceAll(location, "'", "\\'"))
+	if *outputFormat == "csv" {
+		b.WriteString("TBLPROPERTIES ('compressionType'='bzip2')\n")
+	} else {
+		b.WriteString("TBLPROPERTIES ('parquet.compression'='SNAPPY')\n")
+	}
+	b.WriteString(";\n")
+	b.WriteString("\n")
+	if partitionStyle == "plain" {
+		// MSCK REPAIR TABLE can not find the directories without keys.
+		example := PartitionDir(time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC))
+		values := partitionValues(filepath.ToSlash(example))
+		keys := PartitionKeys()
+		for i, k := range keys {
+			// The values are written without zero padding, like hour=0 for "00".
+			v := values[i]
+			if n, err := strconv.Atoi(v); err == nil {
+				v = strconv.Itoa(n)
+			}
+			keys[i] = fmt.Sprintf("%s=%s", k, v)
+		}
+		fmt.Fprintf(&b, "-- Add each partition with: ALTER TABLE %s ADD PARTITION (%s) LOCATION '%s/%s';\n", quoteHiveTable(table), strings.Join(keys, ", "), strings.ReplaceAll(location, "'", "\\'"), filepath.ToSlash(example))
+	} else {
+		fmt.Fprintf(&b, "-- Load the partitions with: MSCK REPAIR TABLE %s;\n", quoteHiveTable(table))
+	}
+
+	return b.String(), nil
+}
+
+func quoteHiveIdent(s string) string {
+	return "`" + strings.ReplaceAll(s, "`", "``") + "`"
+}
+
+// quoteHiveTable quotes a table name like "db.table".
+func quoteHiveTable(s string) string {
+	names := strings.Split(s, ".")
+	for i, n := range names {
+		names[i] = quoteHiveIdent(n)
+	}
+	return strings.Join(names, ".")
+}
+
+// readOutputColumns reads the column names of the output from the input file.
+// If -header is not set, the columns are named like "col1", "col2", and so on.
+//
+// WARNING: this function reads commandline flags directly.
+func readOutputColumns(inputPath string) ([]string, error) {
+	r, err := Open(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	row, err := r.Next()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%s: empty file", inputPath)
+	} else if err != nil {
+		return nil, err
+	}
+	ReplaceInvalidChars(row)
+
+	var header []string
+	if *hasHeader {
+		header = row
+	}
+	if len(outputColumns) > 0 {
+		projection, err := outputColumns.Resolve(header)
+		if err != nil {
+			return nil, err
+		}
+		row = Project(row, projection)
+		if header != nil {
+			header = row
+		}
+	}
+
+	if header == nil {
+		header = make([]string, len(row))
+		for i := range header {
+			header[i] = fmt.Sprintf("col%d", i+1)
+		}
+	}
+	return header, nil
+}
+
+// runDDL runs ddl subcommand.
+func runDDL(args []string) {
+	fs := flag.NewFlagSet("ddl", flag.ExitOnError)
+	table := fs.String("table", "", `Table name, like "db.table". The default is the input file name without extension.`)
+	location := fs.String("location", "", "Location of the table, like s3://bucket/path. The default is absolute path of -out-dir.")
+	fs.Usage = func() {
+		fmt.Println("Usage: chop-csv ddl [OPTIONS] [DDL OPTIONS] FILE")
+		fmt.Println()
+		fmt.Println("Print CREATE EXTERNAL TABLE statement for Hive and Athena, that matches to the output of FILE.")
+		fmt.Println("The column names are read from the header of FILE if -header is set.")
+		fmt.Println()
+		fmt.Println("DDL OPTIONS:")
+		printCommandDefaults(fs)
+	}
+	parseCommand(fs, args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(ExitUsage)
+	}
+
+	columns, err := readOutputColumns(fs.Arg(0))
+	if err != nil {
+		fatalf(ExitInputError, "failed to read columns: %s", err)
+	}
+
+	if *table == "" {
+		*table = fileStem(fs.Arg(0))
+	}
+
+	ddl, err := GenerateDDL(*table, *location, columns)
+	if err != nil {
+		fatalf(ExitUsage, "failed to generate DDL: %s", err)
+	}
+	fmt.Print(ddl)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateDDL(t *testing.T) {
+	origFormat, origTypes := *outputFormat, parquetTypes
+	defer func() { *outputFormat, parquetTypes = origFormat, origTypes }()
+
+	*outputFormat = "csv"
+	got, err := GenerateDDL("db.logs", "s3://bucket/it's", []string{"time", "na`me"})
+	if err != nil {
+		t.Fatalf("failed to generate: %s", err)
+	}
+	want := "CREATE EXTERNAL TABLE `db`.`logs` (\n" +
+		"  `time` string,\n" +
+		"  `na``me` string\n" +
+		")\n" +
+		"PARTITIONED BY (year int, month int, day int)\n" +
+		"ROW FORMAT SERDE 'org.apache.hadoop.hive.serde2.OpenCSVSerde'\n" +
+		"STORED AS TEXTFILE\n" +
+		"LOCATION 's3://bucket/it\\'s'\n" +
+		"TBLPROPERTIES ('compressionType'='bzip2')\n" +
+		";\n" +
+		"\n" +
+		"-- Load the partitions with: MSCK REPAIR TABLE `db`.`logs`;\n"
+	if got != want {
+		t.Errorf("unexpected DDL\nexpected:\n%s\nbut got:\n%s", want, got)
+	}
+
+	origDict := *zstdDict
+	*zstdDict = true
+	_, err = GenerateDDL("logs", "/data", []string{"time"})
+	*zstdDict = origDict
+	if err == nil || !strings.HasPrefix(err.Error(), "-zstd-dict is not supported by Hive") {
+		t.Errorf("expected unsupported -zstd-dict error but got %v", err)
+	}
+
+	*outputFormat = "parquet"
+	parquetTypes = map[string]string{"count": "int64", "ok": "boolean"}
+	got, err = GenerateDDL("logs", "/data", []string{"time", "count", "ok"})
+	if err != nil {
+		t.Fatalf("failed to generate: %s", err)
+	}
+	for _, s := range []string{"  `time` string,\n", "  `count` bigint,\n", "  `ok` boolean\n", "STORED AS PARQUET\n", "'parquet.compression'='SNAPPY'"} {
+		if !strings.Contains(got, s) {
+			t.Errorf("expected %q in DDL but got:\n%s", s, got)
+		}
+	}
+
+	*outputFormat = "sqlite"
+	if _, err := GenerateDDL("logs", "/data", []string{"time"}); err == nil || err.Error() != "-format=sqlite is not supported by Hive" {
+		t.Errorf("expected unsupported format error but got %v", err)
+	}
+}
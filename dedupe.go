@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"sync"
+)
+
+// dedupeHash is the truncated SHA-256 of a row, to keep the seen rows in small memory.
+type dedupeHash [16]byte
+
+// Deduplicator remembers the rows written into each partition in this run, to drop duplicated rows by -dedupe.
+//
+// The rows are remembered as hashes in memory, so it uses about 50 bytes for each unique row.
+// All methods do nothing if the Deduplicator is nil.
+type Deduplicator struct {
+	mu   sync.Mutex
+	seen map[string]map[dedupeHash]struct{} // the hashes of the rows for each partition
+}
+
+// dedupe is the Deduplicator of -dedupe, or nil if disabled.
+var dedupe *Deduplicator
+
+// dedupeKey is the columns to compare rows by -dedupe-key, or nil to compare whole rows.
+var dedupeKey ColumnList
+
+// NewDeduplicator makes a new empty Deduplicator.
+func NewDeduplicator() *Deduplicator {
+	return &Deduplicator{
+		seen: make(map[string]map[dedupeHash]struct{}),
+	}
+}
+
+// hashRow calculates the hash of the columns in key, or the whole row if key is nil.
+// Each value is prefixed by its length, so that ["a,b"] and ["a", "b"] are different.
+func hashRow(row []string, key []int) dedupeHash {
+	h := sha256.New()
+	var l [8]byte
+	write := func(s string) {
+		binary.BigEndian.PutUint64(l[:], uint64(len(s)))
+		h.Write(l[:])
+		h.Write([]byte(s))
+	}
+
+	if key == nil {
+		for _, s := range row {
+			write(s)
+		}
+	} else {
+		for _, i := range key {
+			if i < len(row) {
+				write(row[i])
+			} else {
+				write("")
+			}
+		}
+	}
+
+	var d dedupeHash
+	copy(d[:], h.Sum(nil))
+	return d
+}
+
+// Duplicated reports whether the same row already seen in the partition, and remembers the row if not.
+// The row is compared by the columns in key, or the whole row if key is nil.
+func (d *Deduplicator) Duplicated(partition string, row []string, key []int) bool {
+	if d == nil {
+		return false
+	}
+
+	h := hashRow(row, key)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	seen, ok := d.seen[partition]
+	if !ok {
+		seen = make(map[dedupeHash]struct{})
+		d.seen[partition] = seen
+	}
+	if _, ok := seen[h]; ok {
+		return true
+	}
+	seen[h] = struct{}{}
+	return false
+}
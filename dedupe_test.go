@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeduplicator(t *testing.T) {
+	d := NewDeduplicator()
+
+	tests := []struct {
+		Partition string
+		Row       []string
+		Key       []int
+		Output    bool
+	}{
+		{"p1", []string{"20230401", "a", "1"}, nil, false},
+		{"p1", []string{"20230401", "a", "1"}, nil, true},
+		{"p2", []string{"20230401", "a", "1"}, nil, false},
+		{"p1", []string{"20230401", "a", "2"}, nil, false},
+		{"p1", []string{"20230401", "a,1"}, nil, false},
+		{"p1", []string{"20230401", "a", "3"}, []int{1}, false},
+		{"p1", []string{"20230402", "a", "4"}, []int{1}, true},
+		{"p1", []string{"20230402"}, []int{1}, false},
+	}
+
+	for i, tt := range tests {
+		if got := d.Duplicated(tt.Partition, tt.Row, tt.Key); got != tt.Output {
+			t.Errorf("%d: %s %q %v: expected %v but got %v", i, tt.Partition, tt.Row, tt.Key, tt.Output, got)
+		}
+	}
+}
+
+func TestDeduplicator_nil(t *testing.T) {
+	var d *Deduplicator
+	if d.Duplicated("p1", []string{"a"}, nil) {
+		t.Errorf("expected nil Deduplicator reports no duplicate")
+	}
+}
+
+func TestChop_dedupe(t *testing.T) {
+	dir := t.TempDir()
+	inputs := []string{filepath.Join(dir, "a.csv"), filepath.Join(dir, "b.csv")}
+	if err := os.WriteFile(inputs[0], []byte("20230401,a,1\n20230401,a,1\n20230401,b,1\n"), 0644); err != nil {
+		t.Fatalf("failed to prepare input: %s", err)
+	}
+	if err := os.WriteFile(inputs[1], []byte("20230401,b,2\n20230402,a,1\n"), 0644); err != nil {
+		t.Fatalf("failed to prepare input: %s", err)
+	}
+
+	tests := []struct {
+		Name       string
+		Key        ColumnList
+		Duplicates int
+		Output     map[string][][]string
+	}{
+		{
+			"whole row",
+			nil,
+			1,
+			map[string][][]string{
+				"2023-04-01": {{"20230401", "a", "1"}, {"20230401", "b", "1"}, {"20230401", "b", "2"}},
+				"2023-04-02": {{"20230402", "a", "1"}},
+			},
+		},
+		{
+			"key",
+			ParseColumnList("2"),
+			2,
+			map[string][][]string{
+				"2023-04-01": {{"20230401", "a", "1"}, {"20230401", "b", "1"}},
+				"2023-04-02": {{"20230402", "a", "1"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			out := setOutputDir(t)
+
+			origDedupe, origKey, origSummary := dedupe, dedupeKey, summary
+			dedupe, dedupeKey, summary = NewDeduplicator(), tt.Key, Summary{}
+			defer func() { dedupe, dedupeKey, summary = origDedupe, origKey, origSummary }()
+
+			for _, input := range inputs {
+				Chop(context.Background(), input)
+			}
+
+			if summary.DuplicateRows != tt.Duplicates {
+				t.Errorf("expected %d duplicated rows but got %d", tt.Duplicates, summary.DuplicateRows)
+			}
+
+			for day, want := range tt.Output {
+				d, _ := time.Parse("2006-01-02", day)
+				pdir := filepath.Join(out, PartitionDir(d))
+				entries, err := os.ReadDir(pdir)
+				if err != nil {
+					t.Fatalf("failed to read partition: %s", err)
+				}
+				var got [][]string
+				for _, e := range entries {
+					got = append(got, readBzip2CSV(t, filepath.Join(pdir, e.Name()))...)
+				}
+				// The files are named by the input file, so the order of files is not the order of inputs.
+				sort.Slice(got, func(i, j int) bool {
+					return strings.Join(got[i], ",") < strings.Join(got[j], ",")
+				})
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("%s: expected %q but got %q", day, want, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+var (
+	// deterministic is true if -deterministic is set.
+	deterministic = false
+
+	// deterministicTime is the time that written into the metadata of the output files instead of the current time, if deterministic is true.
+	deterministicTime time.Time
+)
+
+// SourceDateEpoch returns the time of $SOURCE_DATE_EPOCH, or the UNIX epoch if not set.
+// $SOURCE_DATE_EPOCH is the common way to fix the timestamps for reproducible builds, see https://reproducible-builds.org/specs/source-date-epoch/.
+func SourceDateEpoch() (time.Time, error) {
+	s := os.Getenv("SOURCE_DATE_EPOCH")
+	if s == "" {
+		return time.Unix(0, 0).UTC(), nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(n, 0).UTC(), nil
+}
+
+// outputTime returns the time to write into the metadata of the output files, like the timestamps in the tar files and the manifest.
+// It is always deterministicTime if -deterministic is set, so that the same input makes byte-identical output.
+func outputTime() time.Time {
+	if deterministic {
+		return deterministicTime
+	}
+	return DefaultClock.Now()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSourceDateEpoch(t *testing.T) {
+	tests := []struct {
+		Env    string
+		Output time.Time
+		Error  bool
+	}{
+		{"", time.Unix(0, 0).UTC(), false},
+		{"1680307200", time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC), false},
+		{"yesterday", time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("SOURCE_DATE_EPOCH", tt.Env)
+		got, err := SourceDateEpoch()
+		if (err != nil) != tt.Error {
+			t.Errorf("%q: unexpected error: %v", tt.Env, err)
+		} else if !got.Equal(tt.Output) {
+			t.Errorf("%q: expected %s but got %s", tt.Env, tt.Output, got)
+		}
+	}
+}
+
+func TestWriteOutputTar_deterministic(t *testing.T) {
+	orig, origTime := deterministic, deterministicTime
+	deterministic, deterministicTime = true, time.Unix(0, 0).UTC()
+	defer func() { deterministic, deterministicTime = orig, origTime }()
+
+	if got := outputTime(); !got.Equal(deterministicTime) {
+		t.Errorf("expected output time %s but got %s", deterministicTime, got)
+	}
+
+	day := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+	var outputs [][]byte
+	for i, mtime := range []time.Time{time.Now(), time.Now().Add(-time.Hour)} {
+		dir := t.TempDir()
+		writePartitionFile(t, dir, day, "a.csv.bz2", [][]string{{"20230401", "hello"}})
+		if err := os.Chtimes(filepath.Join(dir, PartitionDir(day), "a.csv.bz2"), mtime, mtime); err != nil {
+			t.Fatalf("failed to change mtime: %s", err)
+		}
+
+		path := filepath.Join(t.TempDir(), "out.tar.gz")
+		if err := WriteOutputTar(path, dir); err != nil {
+			t.Fatalf("%d: failed to write tar: %s", i, err)
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("%d: failed to read tar: %s", i, err)
+		}
+		outputs = append(outputs, b)
+	}
+
+	if !bytes.Equal(outputs[0], outputs[1]) {
+		t.Errorf("expected byte-identical tar files")
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// duckdbOutput is whether -format=duckdb, that writes Parquet files into a temporary -out-dir and loads them into -out-db at the end.
+var duckdbOutput bool
+
+// quoteDuckDBString quotes s as a string literal of DuckDB SQL.
+func quoteDuckDBString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// hasParquetFiles reports whether dir has any Parquet file.
+func hasParquetFiles(dir string) (bool, error) {
+	found := false
+	err := filepath.Walk(dir, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(path, ".parquet") {
+			found = true
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return found, err
+}
+
+// DuckDBLoadSQL makes the SQL to load the Parquet files in the partition directories of dir into table.
+// The keys of the partition directories become the columns like year, month, and day, by hive_partitioning of DuckDB.
+// The table is made if not exists, and the rows are appended by the column names if exists.
+func DuckDBLoadSQL(table, dir string) string {
+	src := fmt.Sprintf("read_parquet(%s, hive_partitioning = true)", quoteDuckDBString(filepath.ToSlash(dir)+"/year=*/**/*.parquet"))
+	t := quoteSQLiteIdent(table) // DuckDB quotes identifiers in the same way as SQLite.
+
+	return "BEGIN TRANSACTION;\n" +
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s AS SELECT * FROM %s LIMIT 0;\n", t, src) +
+		fmt.Sprintf("INSERT INTO %s BY NAME SELECT * FROM %s;\n", t, src) +
+		"COMMIT;\n"
+}
+
+// LoadDuckDB loads the Parquet files in dir into the table of the DuckDB database db, by DuckDB CLI of -duckdb-cli.
+// DuckDB has no stable file format that can be written without DuckDB itself, so chop-csv writes Parquet files and lets DuckDB read them.
+//
+// WARNING: this function reads commandline flags directly.
+func LoadDuckDB(db, table, dir string) error {
+	if ok, err := hasParquetFiles(dir); err != nil {
+		return err
+	} else if !ok {
+		logger.With("file", db).Infof("no rows to load into %s", db)
+		return nil
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(*duckdbCLI, "-bail", db)
+	cmd.Stdin = strings.NewReader(DuckDBLoadSQL(table, dir))
+	cmd.Stdout = &stderr
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w: %s", *duckdbCLI, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDuckDBLoadSQL(t *testing.T) {
+	got := DuckDBLoadSQL("my table", "/tmp/it's")
+	src := `read_parquet('/tmp/it''s/year=*/**/*.parquet', hive_partitioning = true)`
+	want := "BEGIN TRANSACTION;\n" +
+		`CREATE TABLE IF NOT EXISTS "my table" AS SELECT * FROM ` + src + " LIMIT 0;\n" +
+		`INSERT INTO "my table" BY NAME SELECT * FROM ` + src + ";\n" +
+		"COMMIT;\n"
+	if got != want {
+		t.Errorf("unexpected SQL\nexpected: %s\n but got: %s", want, got)
+	}
+}
+
+func TestLoadDuckDB(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test command is for sh")
+	}
+
+	dir := t.TempDir()
+	log := filepath.Join(dir, "cli.log")
+	cli := filepath.Join(dir, "duckdb")
+	if err := os.WriteFile(cli, []byte("#!/bin/sh\necho \"$@\" > "+log+"\ncat >> "+log+"\n"), 0755); err != nil {
+		t.Fatalf("failed to prepare CLI: %s", err)
+	}
+
+	orig := *duckdbCLI
+	*duckdbCLI = cli
+	defer func() { *duckdbCLI = orig }()
+
+	out := filepath.Join(dir, "out")
+	db := filepath.Join(dir, "chopped.duckdb")
+
+	// Nothing to load yet.
+	if err := os.MkdirAll(filepath.Join(out, "year=2023", "month=4", "day=1"), 0755); err != nil {
+		t.Fatalf("failed to prepare output: %s", err)
+	}
+	if err := LoadDuckDB(db, "chopped", out); err != nil {
+		t.Fatalf("failed to load: %s", err)
+	}
+	if _, err := os.Stat(log); !os.IsNotExist(err) {
+		t.Errorf("expected CLI is not called without Parquet files")
+	}
+
+	if err := os.WriteFile(filepath.Join(out, "year=2023", "month=4", "day=1", "a.parquet"), []byte("dummy"), 0644); err != nil {
+		t.Fatalf("failed to prepare output: %s", err)
+	}
+	if err := LoadDuckDB(db, "chopped", out); err != nil {
+		t.Fatalf("failed to load: %s", err)
+	}
+	b, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatalf("failed to read CLI log: %s", err)
+	}
+	if want := "-bail " + db + "\n" + DuckDBLoadSQL("chopped", out); string(b) != want {
+		t.Errorf("unexpected CLI call\nexpected: %q\n but got: %q", want, string(b))
+	}
+
+	*duckdbCLI = "false"
+	if err := LoadDuckDB(db, "chopped", out); err == nil || !strings.HasPrefix(err.Error(), "false: ") {
+		t.Errorf("expected error of the CLI but got %v", err)
+	}
+}
+
+func TestPartitionWriter_duckdb(t *testing.T) {
+	dir := setOutputDir(t)
+
+	origFormat := *outputFormat
+	*outputFormat = "duckdb"
+	defer func() { *outputFormat = origFormat }()
+
+	name, err := outputName("input.csv")
+	if err != nil {
+		t.Fatalf("failed to make output name: %s", err)
+	}
+	if !strings.HasSuffix(name, ".parquet") {
+		t.Fatalf("expected Parquet file name but got %q", name)
+	}
+
+	w := NewPartitionWriter(name)
+	w.SetHeader([]string{"date", "value"})
+	if err := w.Write(time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC), []string{"20230401", "x"}); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+	if err := CompleteUploads(); err != nil {
+		t.Fatalf("failed to complete: %s", err)
+	}
+
+	if ok, err := hasParquetFiles(dir); err != nil {
+		t.Fatalf("failed to find Parquet files: %s", err)
+	} else if !ok {
+		t.Errorf("expected Parquet files in %s", dir)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// shortEncodingNames is a list of short names for the encodings that are often used with chop-csv.
+// The other names are resolved by htmlindex, like "shift_jis", "euc-kr", or "windows-1252".
+var shortEncodingNames = map[string]encoding.Encoding{
+	"sjis":    CP932,
+	"cp932":   CP932,
+	"eucjp":   japanese.EUCJP,
+	"jis":     japanese.ISO2022JP,
+	"utf8":    unicode.UTF8,
+	"utf16le": unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM),
+	"utf16be": unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM),
+}
+
+// LookupEncoding finds character encoding by name.
+func LookupEncoding(name string) (encoding.Encoding, error) {
+	if e, ok := shortEncodingNames[strings.ToLower(name)]; ok {
+		return e, nil
+	}
+
+	e, err := htmlindex.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported encoding: %s", name)
+	}
+	return e, nil
+}
+
+// ReplaceInvalidChars replaces invalid UTF-8 sequences in the record with U+FFFD, and counts how many characters are replaced.
+//
+// The decoders replace undecodable bytes with U+FFFD, so U+FFFD that already in the record is counted as well.
+func ReplaceInvalidChars(record []string) (replaced int) {
+	for i, field := range record {
+		if utf8.ValidString(field) {
+			replaced += strings.Count(field, string(utf8.RuneError))
+			continue
+		}
+
+		var b strings.Builder
+		for _, r := range field {
+			// range loop over string yields RuneError for each invalid byte.
+			if r == utf8.RuneError {
+				replaced++
+			}
+			b.WriteRune(r)
+		}
+		record[i] = b.String()
+	}
+	return replaced
+}
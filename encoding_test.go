@@ -0,0 +1,157 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+func TestLookupEncoding(t *testing.T) {
+	tests := []struct {
+		Name  string
+		Input string
+	}{
+		{"short name", "eucjp"},
+		{"short name in upper case", "EUCJP"},
+		{"htmlindex", "euc-jp"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			e, err := LookupEncoding(tt.Input)
+			if err != nil {
+				t.Fatalf("failed to lookup: %s", err)
+			}
+			if e != japanese.EUCJP {
+				t.Errorf("expected EUC-JP but got %v", e)
+			}
+		})
+	}
+
+	if _, err := LookupEncoding("no-such-encoding"); err == nil || err.Error() != "unsupported encoding: no-such-encoding" {
+		t.Errorf("expected unsupported encoding error but got %v", err)
+	}
+}
+
+func TestOpen_encoding(t *testing.T) {
+	utf16le := unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+
+	tests := []struct {
+		Name     string
+		Encoding string
+		Input    []byte
+	}{
+		{"sjis", "sjis", []byte("20230401,\x93\xfa\x96\x7b\x8c\xea\n")},
+		{"eucjp", "eucjp", []byte("20230401,\xc6\xfc\xcb\xdc\xb8\xec\n")},
+		{"utf8", "utf8", []byte("20230401,日本語\n")},
+		{"utf16le", "utf16le", func() []byte {
+			b, _ := utf16le.NewEncoder().Bytes([]byte("20230401,日本語\n"))
+			return b
+		}()},
+	}
+
+	orig := inputEncoding
+	defer func() { inputEncoding = orig }()
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "input.csv")
+			if err := os.WriteFile(path, tt.Input, 0644); err != nil {
+				t.Fatalf("failed to prepare input: %s", err)
+			}
+
+			var err error
+			if inputEncoding, err = LookupEncoding(tt.Encoding); err != nil {
+				t.Fatalf("failed to lookup: %s", err)
+			}
+
+			r, err := Open(path)
+			if err != nil {
+				t.Fatalf("failed to open: %s", err)
+			}
+			defer r.Close()
+
+			row, err := r.Next()
+			if err != nil {
+				t.Fatalf("failed to read: %s", err)
+			}
+			if want := []string{"20230401", "日本語"}; !reflect.DeepEqual(row, want) {
+				t.Errorf("expected %q but got %q", want, row)
+			}
+		})
+	}
+}
+
+func TestOpen_bom(t *testing.T) {
+	utf16 := func(order unicode.Endianness) []byte {
+		b, _ := unicode.UTF16(order, unicode.IgnoreBOM).NewEncoder().Bytes([]byte("\ufeff20230401,日本語\n"))
+		return b
+	}
+
+	tests := []struct {
+		Name  string
+		Input []byte
+	}{
+		{"utf8", []byte("\xef\xbb\xbf20230401,日本語\n")},
+		{"utf16le", utf16(unicode.LittleEndian)},
+		{"utf16be", utf16(unicode.BigEndian)},
+	}
+
+	// The BOM overrides -encoding.
+	orig := inputEncoding
+	inputEncoding = japanese.ShiftJIS
+	defer func() { inputEncoding = orig }()
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "input.csv")
+			if err := os.WriteFile(path, tt.Input, 0644); err != nil {
+				t.Fatalf("failed to prepare input: %s", err)
+			}
+
+			r, err := Open(path)
+			if err != nil {
+				t.Fatalf("failed to open: %s", err)
+			}
+			defer r.Close()
+
+			row, err := r.Next()
+			if err != nil {
+				t.Fatalf("failed to read: %s", err)
+			}
+			if want := []string{"20230401", "日本語"}; !reflect.DeepEqual(row, want) {
+				t.Errorf("expected %q but got %q", want, row)
+			}
+		})
+	}
+}
+
+func TestReplaceInvalidChars(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Input    []string
+		Output   []string
+		Replaced int
+	}{
+		{"valid", []string{"20230401", "日本語"}, []string{"20230401", "日本語"}, 0},
+		{"invalid bytes", []string{"20230401", "a\xff\xfeb"}, []string{"20230401", "a\ufffd\ufffdb"}, 2},
+		{"replaced by decoder", []string{"20230401", "a\ufffdb"}, []string{"20230401", "a\ufffdb"}, 1},
+		{"multiple fields", []string{"\xff", "x", "\ufffd"}, []string{"\ufffd", "x", "\ufffd"}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			record := append([]string{}, tt.Input...)
+			if n := ReplaceInvalidChars(record); n != tt.Replaced {
+				t.Errorf("expected %d replaced but got %d", tt.Replaced, n)
+			}
+			if !reflect.DeepEqual(record, tt.Output) {
+				t.Errorf("expected %q but got %q", tt.Output, record)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// referenceHeader is the header of the first input file in this run.
+// It is used to align the columns of the later files by -schema-evolution=align.
+var referenceHeader []string
+
+// AlignHeader compares header with the header of the first file, and makes the column mapping to align rows by name.
+//
+// The returned mapping is nil if rows don't have to be aligned.
+// Otherwise, the i-th column of an aligned row is the mapping[i]-th column of the original row, or empty if mapping[i] is -1.
+//
+// WARNING: this function reads commandline flags directly.
+func AlignHeader(inputPath string, header []string) ([]int, error) {
+	chopMu.Lock()
+	defer chopMu.Unlock()
+
+	if referenceHeader == nil {
+		referenceHeader = append([]string{}, header...)
+		return nil, nil
+	}
+
+	if *schemaEvolution == "none" || equalStrings(header, referenceHeader) {
+		return nil, nil
+	}
+
+	if *schemaEvolution == "error" {
+		return nil, fmt.Errorf("%s: header is different from the first file: %s", inputPath, strings.Join(header, ","))
+	}
+
+	pos := make(map[string]int, len(header))
+	for i, h := range header {
+		pos[h] = i
+	}
+
+	mapping := make([]int, len(referenceHeader))
+	var missing []string
+	for i, h := range referenceHeader {
+		if j, ok := pos[h]; ok {
+			mapping[i] = j
+			delete(pos, h)
+		} else {
+			mapping[i] = -1
+			missing = append(missing, h)
+		}
+	}
+
+	if len(missing) > 0 {
+		logger.With("input", inputPath, "columns", missing).Warnf("%s: fill missing columns with empty: %s", inputPath, strings.Join(missing, ","))
+	}
+	if len(pos) > 0 {
+		var extra []string
+		for _, h := range header {
+			if _, ok := pos[h]; ok {
+				extra = append(extra, h)
+			}
+		}
+		logger.With("input", inputPath, "columns", extra).Warnf("%s: ignore columns that not in the first file: %s", inputPath, strings.Join(extra, ","))
+	}
+
+	return mapping, nil
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
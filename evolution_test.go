@@ -0,0 +1,50 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAlignHeader(t *testing.T) {
+	tests := []struct {
+		Name    string
+		Policy  string
+		Header  []string
+		Mapping []int
+		Error   string
+	}{
+		{"same header", "align", []string{"date", "id", "name"}, nil, ""},
+		{"none", "none", []string{"name", "date"}, nil, ""},
+		{"reordered", "align", []string{"name", "date", "id"}, []int{1, 2, 0}, ""},
+		{"missing and extra", "align", []string{"date", "email", "name"}, []int{0, -1, 2}, ""},
+		{"error", "error", []string{"date", "name"}, nil, "b.csv: header is different from the first file: date,name"},
+	}
+
+	origPolicy, origReference := *schemaEvolution, referenceHeader
+	defer func() { *schemaEvolution, referenceHeader = origPolicy, origReference }()
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			*schemaEvolution, referenceHeader = tt.Policy, nil
+
+			// The first file becomes the reference.
+			if m, err := AlignHeader("a.csv", []string{"date", "id", "name"}); m != nil || err != nil {
+				t.Fatalf("expected nil for the first file but got %v, %v", m, err)
+			}
+
+			m, err := AlignHeader("b.csv", tt.Header)
+			if tt.Error != "" {
+				if err == nil || err.Error() != tt.Error {
+					t.Fatalf("expected error %q but got %v", tt.Error, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to align: %s", err)
+			}
+			if !reflect.DeepEqual(m, tt.Mapping) {
+				t.Errorf("expected mapping %v but got %v", tt.Mapping, m)
+			}
+		})
+	}
+}
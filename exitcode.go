@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+)
+
+// The exit codes of chop-csv.
+// The interrupted run exits with 128 + the signal number, see InterruptedExitCode.
+const (
+	ExitOK          = 0 // all rows were chopped
+	ExitError       = 1 // the other errors
+	ExitUsage       = 2 // invalid options or arguments
+	ExitInputError  = 3 // an input file was not found or not readable
+	ExitDecodeError = 4 // an input file was not valid CSV, or had invalid characters with -on-decode-error=fail
+	ExitPartial     = 5 // finished, but some rows were ignored or some input files were not readable
+	ExitOutputError = 6 // failed to write an output file
+)
+
+// fatalf logs the message like log.Fatalf, and exits with the code.
+// The uploads not completed yet are aborted, the lock files are removed, and the failure is notified by -notify-url and -notify-command before exiting.
+func fatalf(code int, format string, args ...interface{}) {
+	log.Printf(format, args...)
+	abortUploads()
+	UnlockOutputDirs()
+	notifier.Notify("failed", code, fmt.Sprintf(format, args...))
+	os.Exit(code)
+}
+
+// InputError is an error of an input file, that stops chopping the file.
+// With -keep-going, the other files are still chopped, and the program exits with Code at the end.
+type InputError struct {
+	Code int // the exit code
+	Err  error
+}
+
+// inputErrorf makes an InputError with the exit code, and the message like fmt.Errorf.
+func inputErrorf(code int, format string, args ...interface{}) error {
+	return &InputError{Code: code, Err: fmt.Errorf(format, args...)}
+}
+
+func (e *InputError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *InputError) Unwrap() error {
+	return e.Err
+}
+
+// inputExitCode returns the exit code of the InputError, or ExitError if err is not an InputError.
+func inputExitCode(err error) int {
+	var e *InputError
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ExitError
+}
+
+// failInput handles the error of an input file.
+// If -keep-going is set, the error is recorded into summary to report at the end. Otherwise, the program exits with the code of the error.
+//
+// WARNING: this function reads commandline flags directly.
+func failInput(inputPath string, err error) {
+	code := inputExitCode(err)
+	if !*keepGoing {
+		fatalf(code, "%s", err)
+	}
+	addFailed(inputPath, code, err)
+}
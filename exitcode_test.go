@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestFatalf(t *testing.T) {
+	if code := os.Getenv("CHOPCSV_TEST_FATALF"); code != "" {
+		n, _ := strconv.Atoi(code)
+		fatalf(n, "failed with %d", n)
+		return
+	}
+
+	for _, code := range []int{ExitUsage, ExitInputError, ExitOutputError} {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestFatalf$")
+		cmd.Env = append(os.Environ(), "CHOPCSV_TEST_FATALF="+strconv.Itoa(code))
+		out, err := cmd.CombinedOutput()
+
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			t.Fatalf("expected to exit with %d but got %v", code, err)
+		}
+		if exitErr.ExitCode() != code {
+			t.Errorf("expected exit code %d but got %d", code, exitErr.ExitCode())
+		}
+		if want := "failed with " + strconv.Itoa(code); !strings.Contains(string(out), want) {
+			t.Errorf("expected %q in the output but got %q", want, out)
+		}
+	}
+}
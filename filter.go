@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	// filters is the list of conditions that rows must satisfy to be written.
+	filters []Filter
+
+	// decimalSeparator and thousandsSeparator are the separators to parse numbers in filters.
+	decimalSeparator   = "."
+	thousandsSeparator = ","
+)
+
+// filterOperators is the list of operators in filter expressions.
+// Longer operators have to be before shorter ones.
+var filterOperators = []string{"==", "!=", ">=", "<=", ">", "<"}
+
+// Filter is a condition like "3>=1000", that compares a column with a value.
+//
+// The column is compared as a number if both of the column and the value are numbers, otherwise compared as a string.
+type Filter struct {
+	Column   int // 0-origin
+	Operator string
+	Value    string
+}
+
+// ParseFilter parses a filter expression like "3>=1000".
+// The column number in the expression is 1-origin.
+func ParseFilter(s string) (Filter, error) {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	col, err := strconv.Atoi(s[:i])
+	if err != nil || col < 1 {
+		return Filter{}, fmt.Errorf("invalid filter: %q: the column number is missing", s)
+	}
+
+	for _, op := range filterOperators {
+		if strings.HasPrefix(s[i:], op) {
+			return Filter{Column: col - 1, Operator: op, Value: s[i+len(op):]}, nil
+		}
+	}
+	return Filter{}, fmt.Errorf("invalid filter: %q: unknown operator", s)
+}
+
+// Match reports whether the row satisfies the condition.
+func (f Filter) Match(row []string) bool {
+	v := ""
+	if f.Column < len(row) {
+		v = row[f.Column]
+	}
+
+	var cmp int
+	x, xerr := ParseNumber(v)
+	y, yerr := ParseNumber(f.Value)
+	if xerr == nil && yerr == nil {
+		switch {
+		case x < y:
+			cmp = -1
+		case x > y:
+			cmp = 1
+		}
+	} else {
+		cmp = strings.Compare(v, f.Value)
+	}
+
+	switch f.Operator {
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">=":
+		return cmp >= 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	default:
+		return cmp < 0
+	}
+}
+
+// MatchFilters reports whether the row satisfies all filters.
+func MatchFilters(row []string) bool {
+	for _, f := range filters {
+		if !f.Match(row) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseNumber parses a number that formatted with decimalSeparator and thousandsSeparator, like "1.234,56".
+func ParseNumber(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if thousandsSeparator != "" {
+		s = strings.ReplaceAll(s, thousandsSeparator, "")
+	}
+	if decimalSeparator != "." {
+		s = strings.ReplaceAll(s, decimalSeparator, ".")
+	}
+	return strconv.ParseFloat(s, 64)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		Input  string
+		Output Filter
+	}{
+		{"3>=1000", Filter{Column: 2, Operator: ">=", Value: "1000"}},
+		{"1==abc", Filter{Column: 0, Operator: "==", Value: "abc"}},
+		{"2!=", Filter{Column: 1, Operator: "!=", Value: ""}},
+		{"10<=-1", Filter{Column: 9, Operator: "<=", Value: "-1"}},
+		{"4>a=b", Filter{Column: 3, Operator: ">", Value: "a=b"}},
+		{"5<x", Filter{Column: 4, Operator: "<", Value: "x"}},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseFilter(tt.Input)
+		if err != nil {
+			t.Errorf("%q: failed to parse: %s", tt.Input, err)
+			continue
+		}
+		if got != tt.Output {
+			t.Errorf("%q: expected %+v but got %+v", tt.Input, tt.Output, got)
+		}
+	}
+
+	for _, s := range []string{">=1", "0==1", "1=1", "1"} {
+		if _, err := ParseFilter(s); err == nil {
+			t.Errorf("%q: expected error but got nil", s)
+		}
+	}
+}
+
+func TestFilter_Match(t *testing.T) {
+	tests := []struct {
+		Name      string
+		Filter    string
+		Decimal   string
+		Thousands string
+		Row       []string
+		Match     bool
+	}{
+		{"number", "2>=1000", ".", ",", []string{"20230401", "1000"}, true},
+		{"number is not string", "2>=1000", ".", ",", []string{"20230401", "999"}, false},
+		{"thousands separator", "2>1000", ".", ",", []string{"20230401", "1,000.5"}, true},
+		{"european separators", "2>1000", ",", ".", []string{"20230401", "1.000,5"}, true},
+		{"european separators equal", "2==1000", ",", ".", []string{"20230401", "1.000,0"}, true},
+		{"no thousands separator", "2==1000", ".", "", []string{"20230401", "1,000"}, false},
+		{"string", "2<b", ".", ",", []string{"20230401", "abc"}, true},
+		{"string not equal", "2!=abc", ".", ",", []string{"20230401", "abc"}, false},
+		{"missing column", "3==", ".", ",", []string{"20230401", "abc"}, true},
+	}
+
+	origDecimal, origThousands := decimalSeparator, thousandsSeparator
+	defer func() { decimalSeparator, thousandsSeparator = origDecimal, origThousands }()
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			decimalSeparator, thousandsSeparator = tt.Decimal, tt.Thousands
+
+			f, err := ParseFilter(tt.Filter)
+			if err != nil {
+				t.Fatalf("failed to parse: %s", err)
+			}
+			if got := f.Match(tt.Row); got != tt.Match {
+				t.Errorf("expected %v but got %v", tt.Match, got)
+			}
+		})
+	}
+}
+
+func TestMatchFilters(t *testing.T) {
+	orig := filters
+	defer func() { filters = orig }()
+
+	filters = nil
+	for _, s := range []string{"2>=10", "2<20"} {
+		f, err := ParseFilter(s)
+		if err != nil {
+			t.Fatalf("failed to parse: %s", err)
+		}
+		filters = append(filters, f)
+	}
+
+	for value, want := range map[string]bool{"9": false, "10": true, "19": true, "20": false} {
+		if got := MatchFilters([]string{"20230401", value}); got != want {
+			t.Errorf("%s: expected %v but got %v", value, want, got)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"strings"
+)
+
+// stringList is a flag.Value that can be specified multiple times.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+)
+
+// followPollInterval is the interval to check if the following file has grown.
+const followPollInterval = time.Second
+
+// followReader is an io.ReadCloser that behaves like `tail -F`.
+//
+// It waits for new data instead of returning io.EOF, and reopens the file when it was rotated or truncated.
+type followReader struct {
+	ctx    context.Context // returns io.EOF instead of waiting when canceled
+	path   string
+	f      *os.File
+	offset int64
+
+	// idle is called when the reader reached the end of the file and waiting for new data.
+	idle func()
+}
+
+func openFollow(ctx context.Context, path string, idle func()) (*followReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &followReader{ctx: ctx, path: path, f: f, idle: idle}, nil
+}
+
+func (r *followReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.f.Read(p)
+		r.offset += int64(n)
+		if n > 0 {
+			return n, nil
+		}
+		if err != io.EOF {
+			return 0, err
+		}
+
+		if r.reopen() {
+			continue
+		}
+		if r.ctx.Err() != nil {
+			return 0, io.EOF
+		}
+
+		r.idle()
+		select {
+		case <-r.ctx.Done():
+		case <-time.After(followPollInterval):
+		}
+	}
+}
+
+// reopen reopens the file if it was rotated or truncated, and reports whether reopened.
+func (r *followReader) reopen() bool {
+	cur, err := r.f.Stat()
+	if err != nil {
+		return false
+	}
+
+	s, err := os.Stat(r.path)
+	if err != nil {
+		// The file is not exists while rotating.
+		return false
+	}
+
+	if !os.SameFile(cur, s) {
+		f, err := os.Open(r.path)
+		if err != nil {
+			return false
+		}
+		logger.With("input", r.path).Infof("%s was rotated, reopen it", r.path)
+		r.f.Close()
+		r.f = f
+		r.offset = 0
+		return true
+	}
+
+	if s.Size() < r.offset {
+		logger.With("input", r.path).Infof("%s was truncated, read from the beginning", r.path)
+		if _, err := r.f.Seek(0, io.SeekStart); err != nil {
+			return false
+		}
+		r.offset = 0
+		return true
+	}
+
+	return false
+}
+
+func (r *followReader) Close() error {
+	return r.f.Close()
+}
+
+// Follow chops a growing file like `tail -F`.
+// The output files are flushed every flushInterval while waiting for new rows.
+//
+// This function never returns until ctx is canceled.
+//
+// WARNING: this method can stop program with log.Fatal.
+func Follow(ctx context.Context, inputPath string, flushInterval time.Duration) {
+	logger.With("input", inputPath).Infof("follow input file: %s", inputPath)
+
+	csvName, err := outputName(inputPath)
+	if err != nil {
+		fatalf(ExitError, "failed to resolve input file path: %s", err)
+	}
+	w := NewPartitionWriter(csvName)
+
+	// The idle function is called while chopping, so it can add the statistics so far into summary.
+	var stats Summary
+
+	lastFlush := SystemClock.Now()
+	f, err := openFollow(ctx, inputPath, func() {
+		if now := SystemClock.Now(); now.Sub(lastFlush) >= flushInterval {
+			if err := w.Flush(); err != nil {
+				fatalf(ExitOutputError, "%s", err)
+			}
+			addSummary(&stats)
+			if err := history.Update(); err != nil {
+				logger.With("error", err).Warnf("failed to record history: %s", err)
+			}
+			lastFlush = now
+		}
+	})
+	if err != nil {
+		fatalf(ExitInputError, "failed to open file: %s", err)
+	}
+
+	r := NewReader(f)
+	defer r.Close()
+
+	if _, err := chop(ctx, r, inputPath, w, &stats); err != nil {
+		fatalf(inputExitCode(err), "%s", err)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFollowReader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "input.csv")
+	if err := os.WriteFile(path, []byte("a\n"), 0644); err != nil {
+		t.Fatalf("failed to prepare input: %s", err)
+	}
+
+	// The file is appended, rotated, and truncated while waiting for new data.
+	idles := []func() error{
+		func() error {
+			f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = f.WriteString("b\n")
+			return err
+		},
+		func() error {
+			if err := os.Rename(path, path+".1"); err != nil {
+				return err
+			}
+			return os.WriteFile(path, []byte("cc\n"), 0644)
+		},
+		func() error {
+			return os.WriteFile(path, []byte("d\n"), 0644)
+		},
+	}
+	idle := 0
+
+	r, err := openFollow(context.Background(), path, func() {
+		if idle >= len(idles) {
+			t.Fatalf("unexpected idle")
+		}
+		if err := idles[idle](); err != nil {
+			t.Fatalf("failed to update input: %s", err)
+		}
+		idle++
+	})
+	if err != nil {
+		t.Fatalf("failed to open: %s", err)
+	}
+	defer r.Close()
+
+	buf := make([]byte, 16)
+	for _, want := range []string{"a\n", "b\n", "cc\n", "d\n"} {
+		n, err := r.Read(buf)
+		if err != nil {
+			t.Fatalf("failed to read: %s", err)
+		}
+		if got := string(buf[:n]); got != want {
+			t.Errorf("expected %q but got %q", want, got)
+		}
+	}
+}
+
+func TestFollowReader_canceled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "input.csv")
+	if err := os.WriteFile(path, []byte("a\n"), 0644); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r, err := openFollow(ctx, path, func() {
+		cancel()
+	})
+	if err != nil {
+		t.Fatalf("failed to open: %s", err)
+	}
+	defer r.Close()
+
+	// The data written before canceled is still read, and then io.EOF is returned instead of waiting.
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("failed to read: %s", err)
+	}
+	if string(b) != "a\n" {
+		t.Errorf("expected %q but got %q", "a\n", string(b))
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/transform"
+)
+
+// CP932 is Shift_JIS that maps the user-defined area (0xF040-0xF9FC) into the private use area (U+E000-U+E757), like Microsoft's code page 932.
+//
+// japanese.ShiftJIS decodes the user-defined area as U+FFFD, so the vendor-specific gaiji can not be distinguished from each other.
+var CP932 encoding.Encoding = cp932{}
+
+type cp932 struct{}
+
+func (cp932) NewDecoder() *encoding.Decoder {
+	return &encoding.Decoder{Transformer: &cp932Decoder{base: japanese.ShiftJIS.NewDecoder()}}
+}
+
+func (cp932) NewEncoder() *encoding.Encoder {
+	return &encoding.Encoder{Transformer: &cp932Encoder{base: japanese.ShiftJIS.NewEncoder()}}
+}
+
+func (cp932) String() string {
+	return "CP932"
+}
+
+const (
+	cp932UserDefinedFirst = 0xE000
+	cp932UserDefinedLast  = 0xE757
+)
+
+func isSJISLead(c byte) bool {
+	return (0x81 <= c && c <= 0x9F) || (0xE0 <= c && c <= 0xFC)
+}
+
+func isSJISTrail(c byte) bool {
+	return (0x40 <= c && c <= 0x7E) || (0x80 <= c && c <= 0xFC)
+}
+
+type cp932Decoder struct {
+	base transform.Transformer
+}
+
+func (d *cp932Decoder) Reset() {
+	d.base.Reset()
+}
+
+func (d *cp932Decoder) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for nSrc < len(src) {
+		// Find the next user-defined character, or the incomplete character at the end.
+		i := nSrc
+		for i < len(src) {
+			if !isSJISLead(src[i]) {
+				i++
+			} else if i+1 >= len(src) || (0xF0 <= src[i] && src[i] <= 0xF9 && isSJISTrail(src[i+1])) {
+				break
+			} else {
+				i += 2
+			}
+		}
+
+		// Decode the other characters with the base decoder.
+		if i > nSrc {
+			nd, ns, err := d.base.Transform(dst[nDst:], src[nSrc:i], atEOF && i == len(src))
+			nDst += nd
+			nSrc += ns
+			if err != nil {
+				return nDst, nSrc, err
+			}
+			continue
+		}
+
+		if i+1 >= len(src) {
+			if !atEOF {
+				return nDst, nSrc, transform.ErrShortSrc
+			}
+			nd, ns, err := d.base.Transform(dst[nDst:], src[nSrc:], true)
+			return nDst + nd, nSrc + ns, err
+		}
+
+		lead, trail := int(src[i]), int(src[i+1])
+		if trail < 0x80 {
+			trail -= 0x40
+		} else {
+			trail -= 0x41
+		}
+		r := rune(cp932UserDefinedFirst + (lead-0xF0)*188 + trail)
+
+		if nDst+utf8.RuneLen(r) > len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		nDst += utf8.EncodeRune(dst[nDst:], r)
+		nSrc += 2
+	}
+	return nDst, nSrc, nil
+}
+
+type cp932Encoder struct {
+	base transform.Transformer
+}
+
+func (e *cp932Encoder) Reset() {
+	e.base.Reset()
+}
+
+func (e *cp932Encoder) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for nSrc < len(src) {
+		// Find the next user-defined character.
+		i := nSrc
+		for i < len(src) {
+			if !utf8.FullRune(src[i:]) {
+				break
+			}
+			r, size := utf8.DecodeRune(src[i:])
+			if cp932UserDefinedFirst <= r && r <= cp932UserDefinedLast {
+				break
+			}
+			i += size
+		}
+
+		// Encode the other characters with the base encoder.
+		if i > nSrc {
+			nd, ns, err := e.base.Transform(dst[nDst:], src[nSrc:i], atEOF && i == len(src))
+			nDst += nd
+			nSrc += ns
+			if err != nil {
+				return nDst, nSrc, err
+			}
+			continue
+		}
+
+		if !utf8.FullRune(src[i:]) {
+			if !atEOF {
+				return nDst, nSrc, transform.ErrShortSrc
+			}
+			nd, ns, err := e.base.Transform(dst[nDst:], src[nSrc:], true)
+			return nDst + nd, nSrc + ns, err
+		}
+
+		r, size := utf8.DecodeRune(src[i:])
+		n := int(r - cp932UserDefinedFirst)
+		lead, trail := 0xF0+n/188, n%188
+		if trail < 0x3F {
+			trail += 0x40
+		} else {
+			trail += 0x41
+		}
+
+		if nDst+2 > len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		dst[nDst] = byte(lead)
+		dst[nDst+1] = byte(trail)
+		nDst += 2
+		nSrc += size
+	}
+	return nDst, nSrc, nil
+}
+
+// GaijiMap is a mapping table to replace vendor-specific characters.
+type GaijiMap map[rune]string
+
+// gaijiMap is the GaijiMap for -gaiji-map.
+var gaijiMap GaijiMap
+
+// LoadGaijiMap loads a mapping table from CSV file.
+//
+// Each row of the file has two columns; the character to replace, and the replacement.
+// The character is a code point like "U+E000", or hex bytes in the input encoding like "F040".
+func LoadGaijiMap(path string, enc encoding.Encoding) (GaijiMap, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	c := csv.NewReader(f)
+	c.FieldsPerRecord = 2
+	rows, err := c.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(GaijiMap)
+	for i, row := range rows {
+		r, err := parseGaijiCode(strings.TrimSpace(row[0]), enc)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, i+1, err)
+		}
+		m[r] = row[1]
+	}
+	return m, nil
+}
+
+func parseGaijiCode(s string, enc encoding.Encoding) (rune, error) {
+	if strings.HasPrefix(s, "U+") || strings.HasPrefix(s, "u+") {
+		n, err := strconv.ParseUint(s[2:], 16, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid code point: %s", s)
+		}
+		return rune(n), nil
+	}
+
+	b, err := hex.DecodeString(strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid code: %s", s)
+	}
+	d, err := enc.NewDecoder().Bytes(b)
+	if err != nil {
+		return 0, fmt.Errorf("invalid code: %s: %w", s, err)
+	}
+	if utf8.RuneCount(d) != 1 {
+		return 0, fmt.Errorf("invalid code: %s: not a single character", s)
+	}
+	r, _ := utf8.DecodeRune(d)
+	if r == utf8.RuneError {
+		return 0, fmt.Errorf("invalid code: %s: can not decode", s)
+	}
+	return r, nil
+}
+
+// Replace replaces the characters in the record, and counts the replaced characters into counts.
+func (m GaijiMap) Replace(record []string, counts map[string]int) {
+	if len(m) == 0 {
+		return
+	}
+
+	for i, field := range record {
+		var b *strings.Builder
+		for j, r := range field {
+			rep, ok := m[r]
+			if !ok {
+				if b != nil {
+					b.WriteRune(r)
+				}
+				continue
+			}
+
+			if b == nil {
+				b = &strings.Builder{}
+				b.WriteString(field[:j])
+			}
+			b.WriteString(rep)
+			counts[fmt.Sprintf("U+%04X", r)]++
+		}
+		if b != nil {
+			record[i] = b.String()
+		}
+	}
+}
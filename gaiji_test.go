@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCP932(t *testing.T) {
+	tests := []struct {
+		Name    string
+		Encoded string
+		Decoded string
+	}{
+		{"normal characters", "a\x93\xfa\x96\x7b\x8c\xea", "a日本語"},
+		{"first user-defined character", "\xf0\x40", "\ue000"},
+		{"user-defined character after 0x7F", "\xf0\x80", "\ue03f"},
+		{"last user-defined character", "\xf9\xfc", "\ue757"},
+		{"mixed", "\x93\xfa\xf0\x41\x96\x7b", "日\ue001本"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			d, err := CP932.NewDecoder().String(tt.Encoded)
+			if err != nil {
+				t.Fatalf("failed to decode: %s", err)
+			}
+			if d != tt.Decoded {
+				t.Errorf("expected to decode into %q but got %q", tt.Decoded, d)
+			}
+
+			e, err := CP932.NewEncoder().String(tt.Decoded)
+			if err != nil {
+				t.Fatalf("failed to encode: %s", err)
+			}
+			if e != tt.Encoded {
+				t.Errorf("expected to encode into %q but got %q", tt.Encoded, e)
+			}
+		})
+	}
+}
+
+func TestGaijiMap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gaiji.csv")
+	if err := os.WriteFile(path, []byte("U+E000,髙\nF041,﨑\n"), 0644); err != nil {
+		t.Fatalf("failed to prepare gaiji map: %s", err)
+	}
+
+	m, err := LoadGaijiMap(path, CP932)
+	if err != nil {
+		t.Fatalf("failed to load: %s", err)
+	}
+	if want := (GaijiMap{0xE000: "髙", 0xE001: "﨑"}); !reflect.DeepEqual(m, want) {
+		t.Errorf("expected %q but got %q", want, m)
+	}
+
+	counts := make(map[string]int)
+	record := []string{"20230401", "\ue000橋", "山\ue001\ue000", "\ue002"}
+	m.Replace(record, counts)
+
+	if want := []string{"20230401", "髙橋", "山﨑髙", "\ue002"}; !reflect.DeepEqual(record, want) {
+		t.Errorf("expected %q but got %q", want, record)
+	}
+	if want := map[string]int{"U+E000": 2, "U+E001": 1}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("expected counts %v but got %v", want, counts)
+	}
+}
+
+func TestLoadGaijiMap_error(t *testing.T) {
+	tests := []struct {
+		Name  string
+		Input string
+	}{
+		{"invalid code point", "U+XYZ,a\n"},
+		{"invalid hex", "F0G0,a\n"},
+		{"multiple characters", "8140F040,a\n"},
+		{"missing column", "U+E000\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "gaiji.csv")
+			if err := os.WriteFile(path, []byte(tt.Input), 0644); err != nil {
+				t.Fatalf("failed to prepare gaiji map: %s", err)
+			}
+			if _, err := LoadGaijiMap(path, CP932); err == nil {
+				t.Errorf("expected error but got nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gcsScope is the OAuth 2.0 scope to write objects into GCS.
+const gcsScope = "https://www.googleapis.com/auth/devstorage.read_write"
+
+// gcsSink is the Sink for URLs like gs://bucket/key.
+//
+// It uses the XML API of GCS, that compatible with the multipart upload of S3.
+// The credentials are read from the environment variables:
+// GOOGLE_OAUTH_ACCESS_TOKEN for an access token, or GOOGLE_APPLICATION_CREDENTIALS for a service account key file.
+// STORAGE_EMULATOR_HOST overrides the endpoint without authentication, like the official client libraries.
+type gcsSink struct {
+	endpoint string
+	account  *gcsServiceAccount
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// gcsServiceAccount is the service account key file of Google Cloud.
+type gcsServiceAccount struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+
+	key *rsa.PrivateKey
+}
+
+func (s *gcsSink) Setup() error {
+	if host := os.Getenv("STORAGE_EMULATOR_HOST"); host != "" {
+		if !strings.Contains(host, "://") {
+			host = "http://" + host
+		}
+		s.endpoint = strings.TrimSuffix(host, "/")
+		return nil
+	}
+	s.endpoint = "https://storage.googleapis.com"
+
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		s.token = token
+		return nil
+	}
+
+	path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if path == "" {
+		return fmt.Errorf("GOOGLE_OAUTH_ACCESS_TOKEN or GOOGLE_APPLICATION_CREDENTIALS is required")
+	}
+	account, err := loadGCSServiceAccount(path)
+	if err != nil {
+		return err
+	}
+	s.account = account
+	return nil
+}
+
+func loadGCSServiceAccount(path string) (*gcsServiceAccount, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var a gcsServiceAccount
+	if err := json.Unmarshal(b, &a); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if a.ClientEmail == "" || a.PrivateKey == "" {
+		return nil, fmt.Errorf("%s: not a service account key file", path)
+	}
+	if a.TokenURI == "" {
+		a.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+
+	block, _ := pem.Decode([]byte(a.PrivateKey))
+	if block == nil {
+		return nil, fmt.Errorf("%s: invalid private key", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: private key is not RSA", path)
+	}
+	a.key = rsaKey
+
+	return &a, nil
+}
+
+// accessToken returns the access token, and refreshes it if expired.
+func (s *gcsSink) accessToken() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.account == nil {
+		return s.token, nil
+	}
+
+	// The token must be requested with the real time even if -now is set.
+	now := SystemClock.Now()
+	if s.token != "" && now.Before(s.expires) {
+		return s.token, nil
+	}
+
+	assertion, err := s.account.jwt(now)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := http.PostForm(s.account.TokenURI, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get access token: %s: %s", resp.Status, bytes.TrimSpace(b))
+	}
+
+	var r struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(b, &r); err != nil {
+		return "", err
+	}
+
+	s.token = r.AccessToken
+	// Refresh a minute earlier, to avoid expiring while uploading.
+	s.expires = now.Add(time.Duration(r.ExpiresIn)*time.Second - time.Minute)
+	return s.token, nil
+}
+
+// jwt makes a signed JWT to request an access token.
+func (a *gcsServiceAccount) jwt(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":   a.ClientEmail,
+		"scope": gcsScope,
+		"aud":   a.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+	payload := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+
+	h := sha256.Sum256([]byte(payload))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, h[:])
+	if err != nil {
+		return "", err
+	}
+	return payload + "." + enc.EncodeToString(sig), nil
+}
+
+func (s *gcsSink) Create(u string) (RemoteObject, error) {
+	bucket, key, err := parseBucketURL(u)
+	if err != nil {
+		return nil, err
+	}
+	api := s3API{func(method string, query url.Values, body []byte) (*http.Response, []byte, error) {
+		return s.request(method, bucket, key, query, body)
+	}}
+	return newMultipartObject(api, u), nil
+}
+
+// request calls an XML API of GCS.
+func (s *gcsSink) request(method, bucket, key string, query url.Values, body []byte) (*http.Response, []byte, error) {
+	u := fmt.Sprintf("%s/%s/%s", s.endpoint, bucket, escapeKey(key))
+	if len(query) > 0 {
+		u += "?" + canonicalQuery(query)
+	}
+
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	token, err := s.accessToken()
+	if err != nil {
+		return nil, nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return doXMLRequest(req, "gs://"+bucket+"/"+key)
+}
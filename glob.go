@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// inputExtensions is the lower-cased extensions of the input files to chop in directories when no -include specified, that set by -extensions.
+	inputExtensions = []string{".csv"}
+
+	// includePatterns is the patterns of the input files to chop in directories, that set by -include.
+	includePatterns stringList
+
+	// excludePatterns is the patterns of the input files and directories to skip, that set by -exclude.
+	excludePatterns stringList
+)
+
+// parseExtensions parses a comma separated list of extensions like ".csv,.txt".
+// The leading "." can be omitted.
+func parseExtensions(s string) ([]string, error) {
+	var exts []string
+	for _, e := range strings.Split(s, ",") {
+		e = strings.ToLower(strings.TrimSpace(e))
+		if e == "" {
+			continue
+		}
+		if !strings.HasPrefix(e, ".") {
+			e = "." + e
+		}
+		exts = append(exts, e)
+	}
+	if len(exts) == 0 {
+		return nil, fmt.Errorf("no extension")
+	}
+	return exts, nil
+}
+
+// hasInputExtension reports whether the name has any extension of -extensions, ignoring case.
+func hasInputExtension(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	for _, e := range inputExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// validateGlob checks the syntax of a pattern for matchGlob.
+func validateGlob(pattern string) error {
+	for _, s := range strings.Split(pattern, "/") {
+		if _, err := path.Match(s, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matchGlob reports whether the slash separated name matches the pattern.
+// The pattern is the same as path.Match for each part between slashes, and "**" matches zero or more directories.
+func matchGlob(pattern, name string) bool {
+	return matchGlobParts(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchGlobParts(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchGlobParts(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// relativeInputPath returns the slash separated path of the file from the directory, to match with -include and -exclude.
+func relativeInputPath(dir, file string) string {
+	rel, err := filepath.Rel(dir, file)
+	if err != nil {
+		return filepath.ToSlash(file)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// isExcluded reports whether the relative path matches any pattern of -exclude.
+// A directory that excluded is not walked.
+func isExcluded(rel string) bool {
+	for _, p := range excludePatterns {
+		if matchGlob(p, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// isInputFile reports whether the file at the relative path in a directory should be chopped, by -include, -exclude, and -extensions.
+// -extensions is used only if no -include specified.
+func isInputFile(rel string) bool {
+	if isExcluded(rel) {
+		return false
+	}
+
+	if len(includePatterns) == 0 {
+		return hasInputExtension(rel)
+	}
+	for _, p := range includePatterns {
+		if matchGlob(p, rel) {
+			return true
+		}
+	}
+	return false
+}
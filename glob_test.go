@@ -0,0 +1,124 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		Pattern string
+		Name    string
+		Output  bool
+	}{
+		{"*.csv", "a.csv", true},
+		{"*.csv", "dir/a.csv", false},
+		{"**/*.csv", "a.csv", true},
+		{"**/*.csv", "dir/sub/a.csv", true},
+		{"**/*.csv", "dir/a.tsv", false},
+		{"dir/**", "dir/a.csv", true},
+		{"dir/**", "other/a.csv", false},
+		{"**/backup/**", "x/backup/a.csv", true},
+		{"**/backup/**", "x/backups/a.csv", false},
+		{"a/**/b/*.csv", "a/b/c.csv", true},
+		{"a/**/b/*.csv", "a/x/y/b/c.csv", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Pattern+" "+tt.Name, func(t *testing.T) {
+			if got := matchGlob(tt.Pattern, tt.Name); got != tt.Output {
+				t.Errorf("expected %v but got %v", tt.Output, got)
+			}
+		})
+	}
+}
+
+func TestValidateGlob(t *testing.T) {
+	if err := validateGlob("**/[ab]*.csv"); err != nil {
+		t.Errorf("failed to validate: %s", err)
+	}
+	if err := validateGlob("**/[ab.csv"); err == nil {
+		t.Errorf("expected error but got nil")
+	}
+}
+
+func TestIsInputFile(t *testing.T) {
+	origInclude, origExclude := includePatterns, excludePatterns
+	defer func() { includePatterns, excludePatterns = origInclude, origExclude }()
+
+	tests := []struct {
+		Name    string
+		Include stringList
+		Exclude stringList
+		Path    string
+		Output  bool
+	}{
+		{"default", nil, nil, "dir/a.csv", true},
+		{"default not csv", nil, nil, "dir/a.tsv", false},
+		{"default upper case", nil, nil, "DIR/A.CSV", true},
+		{"include", stringList{"**/*.tsv"}, nil, "dir/a.tsv", true},
+		{"include not match", stringList{"**/*.tsv"}, nil, "dir/a.csv", false},
+		{"exclude", nil, stringList{"dir/**"}, "dir/a.csv", false},
+		{"exclude not match", nil, stringList{"dir/**"}, "other/a.csv", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			includePatterns, excludePatterns = tt.Include, tt.Exclude
+			if got := isInputFile(tt.Path); got != tt.Output {
+				t.Errorf("expected %v but got %v", tt.Output, got)
+			}
+		})
+	}
+}
+
+func TestParseExtensions(t *testing.T) {
+	tests := []struct {
+		Input  string
+		Output []string
+	}{
+		{".csv", []string{".csv"}},
+		{"csv, .TXT", []string{".csv", ".txt"}},
+		{".csv,,", []string{".csv"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Input, func(t *testing.T) {
+			got, err := parseExtensions(tt.Input)
+			if err != nil {
+				t.Fatalf("failed to parse: %s", err)
+			}
+			if !reflect.DeepEqual(got, tt.Output) {
+				t.Errorf("expected %q but got %q", tt.Output, got)
+			}
+		})
+	}
+
+	if _, err := parseExtensions(" , "); err == nil {
+		t.Errorf("expected error but got nil")
+	}
+}
+
+func TestHasInputExtension(t *testing.T) {
+	orig := inputExtensions
+	inputExtensions = []string{".csv", ".txt"}
+	defer func() { inputExtensions = orig }()
+
+	tests := []struct {
+		Name   string
+		Output bool
+	}{
+		{"dir/a.csv", true},
+		{"dir/a.TXT", true},
+		{"dir/a.tsv", false},
+		{"dir.csv/a", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			if got := hasInputExtension(tt.Name); got != tt.Output {
+				t.Errorf("expected %v but got %v", tt.Output, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// glueBatchSize is the maximum number of partitions in a BatchCreatePartition request.
+const glueBatchSize = 100
+
+// splitGlueTable splits table name like "db.table" into the database name and the table name.
+func splitGlueTable(name string) (string, string, error) {
+	i := strings.Index(name, ".")
+	if i <= 0 || i == len(name)-1 {
+		return "", "", fmt.Errorf("invalid glue table name: %q: should be like db.table", name)
+	}
+	return name[:i], name[i+1:], nil
+}
+
+// RegisterGluePartitions adds the partitions into the table of AWS Glue Data Catalog.
+// Each partition is a directory path relative to the output directory, like "year=2023/month=4/day=1".
+//
+// The storage descriptor of the table is copied into the partitions, and the location of each partition is the location of the table with the partition directory.
+// The partitions that already exist are ignored.
+func RegisterGluePartitions(cfg AWSConfig, table string, partitions []string) (created int, err error) {
+	db, tbl, err := splitGlueTable(table)
+	if err != nil {
+		return 0, err
+	}
+
+	var t struct {
+		Table struct {
+			StorageDescriptor map[string]interface{}
+		}
+	}
+	err = cfg.CallJSON("glue", "AWSGlue.GetTable", map[string]string{"DatabaseName": db, "Name": tbl}, &t)
+	if err != nil {
+		return 0, err
+	}
+	location, _ := t.Table.StorageDescriptor["Location"].(string)
+	if location == "" {
+		return 0, fmt.Errorf("%s has no location", table)
+	}
+
+	for len(partitions) > 0 {
+		n := len(partitions)
+		if n > glueBatchSize {
+			n = glueBatchSize
+		}
+		batch := partitions[:n]
+		partitions = partitions[n:]
+
+		inputs := make([]interface{}, len(batch))
+		for i, p := range batch {
+			sd := make(map[string]interface{})
+			for k, v := range t.Table.StorageDescriptor {
+				sd[k] = v
+			}
+			sd["Location"] = strings.TrimSuffix(location, "/") + "/" + p + "/"
+
+			inputs[i] = map[string]interface{}{
+				"Values":            partitionValues(p),
+				"StorageDescriptor": sd,
+			}
+		}
+
+		var resp struct {
+			Errors []struct {
+				PartitionValues []string
+				ErrorDetail     struct {
+					ErrorCode    string
+					ErrorMessage string
+				}
+			}
+		}
+		err := cfg.CallJSON("glue", "AWSGlue.BatchCreatePartition", map[string]interface{}{
+			"DatabaseName":       db,
+			"TableName":          tbl,
+			"PartitionInputList": inputs,
+		}, &resp)
+		if err != nil {
+			return created, err
+		}
+
+		created += len(batch)
+		for _, e := range resp.Errors {
+			created--
+			if e.ErrorDetail.ErrorCode != "AlreadyExistsException" {
+				return created, fmt.Errorf("failed to create partition %s: %s: %s", strings.Join(e.PartitionValues, "/"), e.ErrorDetail.ErrorCode, e.ErrorDetail.ErrorMessage)
+			}
+		}
+	}
+	return created, nil
+}
+
+// partitionValues returns the values of the partition directory, like ["2023", "4", "1"] for "year=2023/month=4/day=1".
+func partitionValues(dir string) []string {
+	xs := strings.Split(dir, "/")
+	for i, x := range xs {
+		if j := strings.Index(x, "="); j >= 0 {
+			xs[i] = UnescapePartitionValue(x[j+1:])
+		}
+	}
+	return xs
+}
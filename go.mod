@@ -4,5 +4,7 @@ go 1.17
 
 require (
 	github.com/dsnet/compress v0.0.1
+	github.com/golang/snappy v0.0.4
+	github.com/klauspost/compress v1.17.9
 	golang.org/x/text v0.3.7
 )
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// RunRecord is a record of a run in the history file.
+type RunRecord struct {
+	Start   time.Time `json:"start"`
+	PID     int       `json:"pid"`
+	Updated time.Time `json:"updated"`
+	Status  string    `json:"status"` // "running", "success", "partial", or "interrupted"
+	Inputs  []string  `json:"inputs"`
+	Summary Summary   `json:"summary"`
+}
+
+// Duration returns how long the run took, or has been running until the last update.
+func (r RunRecord) Duration() time.Duration {
+	return r.Updated.Sub(r.Start)
+}
+
+func (r RunRecord) same(x RunRecord) bool {
+	return r.Start.Equal(x.Start) && r.PID == x.PID
+}
+
+// ReadHistory reads the history file that written by HistoryRecorder, in the order of start.
+//
+// The history file is JSON Lines. A run is recorded in multiple lines as it progresses, and the last line of each run is used.
+// A run that remains "running" while the process is not running, is a run failed in the middle.
+func ReadHistory(path string) ([]RunRecord, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rs []RunRecord
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 16*1024*1024)
+	for s.Scan() {
+		var r RunRecord
+		if err := json.Unmarshal(s.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		found := false
+		for i := len(rs) - 1; i >= 0; i-- {
+			if rs[i].same(r) {
+				rs[i] = r
+				found = true
+				break
+			}
+		}
+		if !found {
+			rs = append(rs, r)
+		}
+	}
+	return rs, s.Err()
+}
+
+// LastSuccess returns the start time of the last successful run with the same inputs, or zero time if not found.
+func LastSuccess(path string, inputs []string) (time.Time, error) {
+	rs, err := ReadHistory(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	for i := len(rs) - 1; i >= 0; i-- {
+		if rs[i].Status == "success" && sameStrings(rs[i].Inputs, inputs) {
+			return rs[i].Start, nil
+		}
+	}
+	return time.Time{}, nil
+}
+
+func sameStrings(xs, ys []string) bool {
+	if len(xs) != len(ys) {
+		return false
+	}
+	for i := range xs {
+		if xs[i] != ys[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// HistoryRecorder records the current run into the history file.
+// All methods of nil HistoryRecorder do nothing.
+type HistoryRecorder struct {
+	path  string
+	limit int
+	rec   RunRecord
+}
+
+// history is the HistoryRecorder for -history.
+var history *HistoryRecorder
+
+// NewHistoryRecorder makes a new HistoryRecorder that records into path, and keeps the last limit runs.
+func NewHistoryRecorder(path string, limit int) *HistoryRecorder {
+	return &HistoryRecorder{path: path, limit: limit}
+}
+
+// Start records that the run started.
+func (h *HistoryRecorder) Start(inputs []string) error {
+	if h == nil {
+		return nil
+	}
+	h.rec = RunRecord{
+		Start:  SystemClock.Now(),
+		PID:    os.Getpid(),
+		Status: "running",
+		Inputs: inputs,
+	}
+	return h.Update()
+}
+
+// Update records the progress of the run.
+func (h *HistoryRecorder) Update() error {
+	if h == nil {
+		return nil
+	}
+	h.rec.Updated = SystemClock.Now()
+	h.rec.Summary = summary
+
+	b, err := json.Marshal(h.rec)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(h.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Finish records that the run finished, and removes the old runs from the history file.
+// The run is recorded as "partial" if some input files could not be read or failed with -keep-going, or "interrupted" if stopped by a signal.
+func (h *HistoryRecorder) Finish() error {
+	if h == nil {
+		return nil
+	}
+	h.rec.Status = "success"
+	if IsInterrupted() {
+		h.rec.Status = "interrupted"
+	} else if len(summary.UnreadableFiles) > 0 || len(summary.FailedFiles) > 0 {
+		h.rec.Status = "partial"
+	}
+	if err := h.Update(); err != nil {
+		return err
+	}
+
+	rs, err := ReadHistory(h.path)
+	if err != nil {
+		return err
+	}
+	if h.limit > 0 && len(rs) > h.limit {
+		rs = rs[len(rs)-h.limit:]
+	}
+
+	var b strings.Builder
+	for _, r := range rs {
+		j, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		b.Write(j)
+		b.WriteByte('\n')
+	}
+
+	tmp := filepath.Join(filepath.Dir(h.path), "."+filepath.Base(h.path)+".tmp")
+	if err := os.WriteFile(tmp, []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, h.path)
+}
+
+var statusTemplate = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>chop-csv status</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: right; }
+td.text { text-align: left; }
+.running { background: #ffd; }
+.partial, .interrupted { background: #fdd; }
+</style>
+</head>
+<body>
+<h1>chop-csv status</h1>
+<p><a href="status.json">JSON</a></p>
+<table>
+<tr><th>start</th><th>duration</th><th>status</th><th>inputs</th><th>files</th><th>read</th><th>written</th><th>ignored</th><th>filtered</th><th>decode errors</th><th>hook failures</th></tr>
+{{range .}}<tr class="{{.Status}}"><td class="text">{{.Start.Format "2006-01-02 15:04:05 MST"}}</td><td>{{.Duration}}</td><td class="text">{{.Status}}</td><td class="text">{{range .Inputs}}{{.}}<br>{{end}}</td><td>{{.Summary.InputFiles}}</td><td>{{.Summary.ReadRows}}</td><td>{{.Summary.WrittenRows}}</td><td>{{.Summary.IgnoredRows}}</td><td>{{.Summary.FilteredRows}}</td><td>{{.Summary.DecodeErrorRows}}</td><td>{{.Summary.HookFailures}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// runStatus runs status subcommand.
+func runStatus(args []string) {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	listen := fs.String("listen", "", `Serve the status page on this address, like ":8080". The page is at "/", and JSON is at "/status.json".`)
+	fs.Usage = func() {
+		fmt.Println("Usage: chop-csv status -history FILE [OPTIONS] [STATUS OPTIONS]")
+		fmt.Println()
+		fmt.Println("Show the history of past runs that recorded by -history.")
+		fmt.Println()
+		fmt.Println("STATUS OPTIONS:")
+		printCommandDefaults(fs)
+	}
+	parseCommand(fs, args)
+
+	if history == nil {
+		fatalf(ExitUsage, "-history is required for status subcommand")
+	}
+
+	if *listen == "" {
+		rs, err := ReadHistory(history.path)
+		if err != nil {
+			fatalf(ExitInputError, "failed to read history: %s", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "START\tDURATION\tSTATUS\tREAD\tWRITTEN\tIGNORED\tFILTERED\tINPUTS")
+		for _, r := range rs {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\t%d\t%s\n", r.Start.Format(time.RFC3339), r.Duration(), r.Status, r.Summary.ReadRows, r.Summary.WrittenRows, r.Summary.IgnoredRows, r.Summary.FilteredRows, strings.Join(r.Inputs, " "))
+		}
+		w.Flush()
+		return
+	}
+
+	// Show the latest run first.
+	read := func(w http.ResponseWriter) ([]RunRecord, bool) {
+		rs, err := ReadHistory(history.path)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return nil, false
+		}
+		for i, j := 0, len(rs)-1; i < j; i, j = i+1, j-1 {
+			rs[i], rs[j] = rs[j], rs[i]
+		}
+		return rs, true
+	}
+
+	// Use own mux, so that the handlers of net/http/pprof are not served.
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		if rs, ok := read(w); ok {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			statusTemplate.Execute(w, rs)
+		}
+	})
+	mux.HandleFunc("/status.json", func(w http.ResponseWriter, r *http.Request) {
+		if rs, ok := read(w); ok {
+			if rs == nil {
+				rs = []RunRecord{}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(rs)
+		}
+	})
+
+	logger.With("addr", *listen).Infof("serve status page on %s", *listen)
+	err := http.ListenAndServe(*listen, mux)
+	fatalf(ExitError, "failed to serve status page: %s", err)
+}
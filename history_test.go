@@ -0,0 +1,137 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHistoryRecorder(t *testing.T) {
+	// Each call of the clock advances a minute, so that each run has a different start.
+	now := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+	orig := SystemClock
+	SystemClock = ClockFunc(func() time.Time {
+		now = now.Add(time.Minute)
+		return now
+	})
+	defer func() { SystemClock = orig }()
+
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	for i := 0; i < 3; i++ {
+		h := NewHistoryRecorder(path, 2)
+		if err := h.Start([]string{"input.csv"}); err != nil {
+			t.Fatalf("failed to start: %s", err)
+		}
+		if err := h.Update(); err != nil {
+			t.Fatalf("failed to update: %s", err)
+		}
+		if err := h.Finish(); err != nil {
+			t.Fatalf("failed to finish: %s", err)
+		}
+	}
+
+	// A run that does not finish remains as running.
+	if err := NewHistoryRecorder(path, 2).Start([]string{"input.csv"}); err != nil {
+		t.Fatalf("failed to start: %s", err)
+	}
+
+	rs, err := ReadHistory(path)
+	if err != nil {
+		t.Fatalf("failed to read history: %s", err)
+	}
+	if len(rs) != 3 {
+		t.Fatalf("expected 3 runs but got %d: %v", len(rs), rs)
+	}
+
+	for i, want := range []string{"success", "success", "running"} {
+		if rs[i].Status != want {
+			t.Errorf("run %d: expected status %s but got %s", i, want, rs[i].Status)
+		}
+	}
+	if !rs[0].Start.Before(rs[1].Start) || !rs[1].Start.Before(rs[2].Start) {
+		t.Errorf("expected runs in the order of start but got %v", rs)
+	}
+	if d := rs[0].Duration(); d != 3*time.Minute {
+		t.Errorf("expected duration of 3m but got %s", d)
+	}
+}
+
+func TestReadHistory_notExist(t *testing.T) {
+	rs, err := ReadHistory(filepath.Join(t.TempDir(), "history.jsonl"))
+	if err != nil || rs != nil {
+		t.Errorf("expected no runs and no error but got %v and %v", rs, err)
+	}
+}
+
+func TestLastSuccess(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	day := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	orig := SystemClock
+	defer func() { SystemClock = orig }()
+
+	runs := []struct {
+		Start  time.Time
+		Inputs []string
+		Finish bool
+	}{
+		{day, []string{"a"}, true},
+		{day.Add(time.Hour), []string{"a", "b"}, true},
+		{day.Add(2 * time.Hour), []string{"a"}, false},
+	}
+	for _, r := range runs {
+		SystemClock = FixedClock(r.Start)
+		h := NewHistoryRecorder(path, 0)
+		if err := h.Start(r.Inputs); err != nil {
+			t.Fatalf("failed to start: %s", err)
+		}
+		if r.Finish {
+			if err := h.Finish(); err != nil {
+				t.Fatalf("failed to finish: %s", err)
+			}
+		}
+	}
+
+	tests := []struct {
+		Inputs []string
+		Output time.Time
+	}{
+		{[]string{"a"}, day},
+		{[]string{"a", "b"}, day.Add(time.Hour)},
+		{[]string{"b"}, time.Time{}},
+	}
+	for _, tt := range tests {
+		got, err := LastSuccess(path, tt.Inputs)
+		if err != nil {
+			t.Fatalf("failed to find last success: %s", err)
+		}
+		if !got.Equal(tt.Output) {
+			t.Errorf("%q: expected %s but got %s", tt.Inputs, tt.Output, got)
+		}
+	}
+}
+
+func TestHistoryRecorder_fixedNow(t *testing.T) {
+	// -now fixes only the time to write into the output, and the history has the real time.
+	orig := DefaultClock
+	DefaultClock = FixedClock(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))
+	defer func() { DefaultClock = orig }()
+
+	before := time.Now()
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	h := NewHistoryRecorder(path, 0)
+	if err := h.Start([]string{"input.csv"}); err != nil {
+		t.Fatalf("failed to start: %s", err)
+	}
+	if err := h.Finish(); err != nil {
+		t.Fatalf("failed to finish: %s", err)
+	}
+
+	rs, err := ReadHistory(path)
+	if err != nil {
+		t.Fatalf("failed to read history: %s", err)
+	}
+	if len(rs) != 1 || rs[0].Start.Before(before.Truncate(time.Second)) {
+		t.Errorf("expected the run started after %s but got %v", before, rs)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// HookRunner runs an external command for each finished partition file.
+type HookRunner struct {
+	command string
+	sem     chan struct{}
+	wg      sync.WaitGroup
+
+	mu       sync.Mutex
+	runs     int
+	failures int
+}
+
+// NewHookRunner makes a HookRunner that runs command with at most jobs commands at once.
+// The "{path}" in command is replaced with the path of the file.
+func NewHookRunner(command string, jobs int) *HookRunner {
+	return &HookRunner{
+		command: command,
+		sem:     make(chan struct{}, jobs),
+	}
+}
+
+// Run starts the command for path in background.
+func (h *HookRunner) Run(path string) {
+	if h == nil {
+		return
+	}
+
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+
+		h.sem <- struct{}{}
+		defer func() { <-h.sem }()
+
+		cmd := shellCommand(strings.ReplaceAll(h.command, "{path}", shellQuote(path)))
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		cmd.Env = append(os.Environ(), "CHOPCSV_PATH="+path)
+		err := cmd.Run()
+
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.runs++
+		if err != nil {
+			h.failures++
+			logger.With("file", path, "error", err).Warnf("hook command failed for %s: %s", path, err)
+		}
+	}()
+}
+
+// Wait waits for all commands, and reports the number of runs and failures into summary.
+func (h *HookRunner) Wait() {
+	if h == nil {
+		return
+	}
+
+	h.wg.Wait()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	addSummary(&Summary{HookRuns: h.runs, HookFailures: h.failures})
+	h.runs, h.failures = 0, 0
+}
+
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("sh", "-c", command)
+}
+
+func shellQuote(s string) string {
+	if runtime.GOOS == "windows" {
+		return `"` + s + `"`
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// partitionHook is the HookRunner for -on-partition-complete.
+var partitionHook *HookRunner
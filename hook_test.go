@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestHookRunner(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test command is for sh")
+	}
+
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	// The path with a quote checks that the path is quoted for the shell.
+	paths := []string{filepath.Join(dir, "a.csv.bz2"), filepath.Join(dir, "b's.csv.bz2"), filepath.Join(dir, "c-fail")}
+
+	origSummary := summary
+	defer func() { summary = origSummary }()
+	summary = Summary{}
+
+	h := NewHookRunner(`echo {path} "$CHOPCSV_PATH" >> `+shellQuote(out)+`; test {path} != `+shellQuote(paths[2]), 1)
+	for _, path := range paths {
+		h.Run(path)
+	}
+	h.Wait()
+
+	if summary.HookRuns != 3 || summary.HookFailures != 1 {
+		t.Errorf("expected 3 runs and 1 failure but got %d runs and %d failures", summary.HookRuns, summary.HookFailures)
+	}
+
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("failed to read the output: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	sort.Strings(lines)
+	for i, path := range paths {
+		if want := path + " " + path; i >= len(lines) || lines[i] != want {
+			t.Errorf("expected %q in the output but got %q", want, lines)
+		}
+	}
+}
+
+func TestHookRunner_nil(t *testing.T) {
+	// -on-partition-complete is not set.
+	var h *HookRunner
+	h.Run("a.csv.bz2")
+	h.Wait()
+}
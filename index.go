@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// IndexEntry is an entry of seek index.
+//
+// Each entry points the beginning of a bzip2 stream in the output file, and the number of rows before that stream.
+type IndexEntry struct {
+	Row    int64
+	Offset int64
+}
+
+// WriteIndex writes seek index into path as CSV.
+func WriteIndex(path string, index []IndexEntry) error {
+	var b bytes.Buffer
+	c := csv.NewWriter(&b)
+	c.Write([]string{"row", "offset"})
+	for _, e := range index {
+		c.Write([]string{strconv.FormatInt(e.Row, 10), strconv.FormatInt(e.Offset, 10)})
+	}
+	c.Flush()
+
+	if err := c.Error(); err != nil {
+		return err
+	}
+	return writeOutput(path, b.Bytes())
+}
+
+// ReadIndex reads seek index that written by WriteIndex.
+func ReadIndex(path string) ([]IndexEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%s: empty index", path)
+	}
+
+	index := make([]IndexEntry, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		r, err := strconv.ParseInt(row[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		o, err := strconv.ParseInt(row[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		index = append(index, IndexEntry{Row: r, Offset: o})
+	}
+	return index, nil
+}
+
+// PartitionReader is a reader for the files that chop-csv wrote.
+//
+// WARNING: this struct reads commandline flags directly.
+type PartitionReader struct {
+	f *os.File
+	c *csv.Reader
+}
+
+// OpenPartition opens a file that chop-csv wrote.
+func OpenPartition(path string) (*PartitionReader, error) {
+	return OpenPartitionAt(path, 0)
+}
+
+// OpenPartitionAt opens a file that chop-csv wrote, and skips to the row-th row (0-origin).
+//
+// If there is the seek index file, OpenPartitionAt uses it to skip decompressing the unnecessary streams.
+func OpenPartitionAt(path string, row int64) (*PartitionReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var skip IndexEntry
+	if row > 0 {
+		if index, err := ReadIndex(path + ".idx"); err == nil {
+			for _, e := range index {
+				if e.Row > row {
+					break
+				}
+				skip = e
+			}
+		}
+	}
+	if _, err := f.Seek(skip.Offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	b, err := newDecompressor(path, f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	var r io.Reader = b
+	if outputEncoding != unicode.UTF8 {
+		r = transform.NewReader(b, outputEncoding.NewDecoder())
+	}
+
+	c := csv.NewReader(r)
+	c.FieldsPerRecord = -1
+
+	pr := &PartitionReader{f, c}
+	for i := skip.Row; i < row; i++ {
+		if _, err := pr.Read(); err != nil {
+			pr.Close()
+			return nil, err
+		}
+	}
+	return pr, nil
+}
+
+func (r *PartitionReader) Close() {
+	r.f.Close()
+}
+
+func (r *PartitionReader) Read() ([]string, error) {
+	return r.c.Read()
+}
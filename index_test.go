@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestIndex_roundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.csv.idx")
+	index := []IndexEntry{{Row: 0, Offset: 0}, {Row: 100, Offset: 1234}, {Row: 200, Offset: 5678}}
+
+	if err := WriteIndex(path, index); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+	got, err := ReadIndex(path)
+	if err != nil {
+		t.Fatalf("failed to read: %s", err)
+	}
+	if !reflect.DeepEqual(got, index) {
+		t.Errorf("expected %v but got %v", index, got)
+	}
+}
+
+func TestOpenPartitionAt(t *testing.T) {
+	orig := *indexInterval
+	*indexInterval = 3
+	defer func() { *indexInterval = orig }()
+
+	path := filepath.Join(t.TempDir(), "test.csv.bz2")
+	w, err := Create(path)
+	if err != nil {
+		t.Fatalf("failed to create: %s", err)
+	}
+	var rows [][]string
+	for i := 0; i < 10; i++ {
+		row := []string{"20230401", fmt.Sprint(i)}
+		rows = append(rows, row)
+		if err := w.Write(row); err != nil {
+			t.Fatalf("failed to write: %s", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+	if err := CompleteUploads(); err != nil {
+		t.Fatalf("failed to complete: %s", err)
+	}
+
+	index, err := ReadIndex(path + ".idx")
+	if err != nil {
+		t.Fatalf("failed to read index: %s", err)
+	}
+	// The streams start at every 3 rows, and the last entry points the end of the file.
+	var starts []int64
+	for _, e := range index {
+		starts = append(starts, e.Row)
+	}
+	if want := []int64{0, 3, 6, 9, 10}; !reflect.DeepEqual(starts, want) {
+		t.Errorf("expected the entries at rows %v but got %v", want, index)
+	}
+
+	// The file is still a valid bzip2 file that contains multiple streams.
+	if got := readBzip2CSV(t, path); !reflect.DeepEqual(got, rows) {
+		t.Errorf("expected %q but got %q", rows, got)
+	}
+
+	for _, start := range []int64{0, 2, 3, 7, 9} {
+		t.Run(fmt.Sprint(start), func(t *testing.T) {
+			r, err := OpenPartitionAt(path, start)
+			if err != nil {
+				t.Fatalf("failed to open: %s", err)
+			}
+			defer r.Close()
+
+			var got [][]string
+			for {
+				row, err := r.Read()
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatalf("failed to read: %s", err)
+				}
+				got = append(got, row)
+			}
+			if !reflect.DeepEqual(got, rows[start:]) {
+				t.Errorf("expected %q but got %q", rows[start:], got)
+			}
+		})
+	}
+}
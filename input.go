@@ -0,0 +1,131 @@
+package main
+
+import (
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// modifiedAfter is the start time of the last successful run for -since-last-run.
+var modifiedAfter time.Time
+
+// isModified reports whether the input file modified after the last successful run.
+// Zero time means unknown, and it is treated as modified.
+func isModified(t time.Time) bool {
+	return t.IsZero() || t.After(modifiedAfter)
+}
+
+// isInputURL reports whether path is a URL of remote input, like https://host/path or s3://bucket/key.
+func isInputURL(path string) bool {
+	switch urlScheme(path) {
+	case "http", "https", "s3":
+		return true
+	}
+	return false
+}
+
+// openInput opens the input file, that can be a local file or a URL like https://host/path or s3://bucket/key.
+// The remote objects are streamed without temporary files.
+// It returns the size of the file too, or -1 if unknown.
+//
+// The local file can be a named pipe or a process substitution like <(zcat input.csv.gz) too.
+// They are read as a stream, and the size is unknown.
+func openInput(path string) (io.ReadCloser, int64, error) {
+	switch urlScheme(path) {
+	case "http", "https":
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			return nil, 0, err
+		}
+		return openHTTP(req, path)
+	case "s3":
+		cfg, err := LoadAWSConfig()
+		if err != nil {
+			return nil, 0, err
+		}
+		bucket, key, err := parseBucketURL(path)
+		if err != nil {
+			return nil, 0, err
+		}
+		req, err := cfg.newS3Request("GET", bucket, key, nil, nil)
+		if err != nil {
+			return nil, 0, err
+		}
+		return openHTTP(req, path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	s, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	if !s.Mode().IsRegular() {
+		return f, -1, nil
+	}
+	return f, s.Size(), nil
+}
+
+func openHTTP(req *http.Request, name string) (io.ReadCloser, int64, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		return nil, 0, xmlError(name, resp.Status, b)
+	}
+	return resp.Body, resp.ContentLength, nil
+}
+
+// listS3Inputs lists the input files that match -include and -exclude under the URL like s3://bucket/prefix/.
+func listS3Inputs(prefix string) ([]string, error) {
+	cfg, err := LoadAWSConfig()
+	if err != nil {
+		return nil, err
+	}
+	bucket, key, err := parseBucketURL(prefix)
+	if err != nil {
+		return nil, err
+	}
+	objs, err := cfg.ListS3Objects(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	var urls []string
+	for _, o := range objs {
+		if !isInputFile(strings.TrimPrefix(o.Key, key)) {
+			continue
+		}
+		if !isModified(o.LastModified) {
+			addSummary(&Summary{SkippedFiles: 1})
+			continue
+		}
+		urls = append(urls, "s3://"+bucket+"/"+o.Key)
+	}
+	return urls, nil
+}
+
+// isStreamInput reports whether the local input file is not a regular file, like a named pipe or a process substitution.
+// It can be read only once, so it is not recorded in -state, and not moved by -archive-dir or -delete-input.
+func isStreamInput(info fs.FileInfo) bool {
+	return !info.Mode().IsRegular()
+}
+
+// countingReadCloser is an io.ReadCloser that counts the bytes read, for the input that the size is unknown.
+type countingReadCloser struct {
+	byteCounter
+	c io.Closer
+}
+
+func (c *countingReadCloser) Close() error {
+	return c.c.Close()
+}
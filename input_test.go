@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestOpen_http(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/input.csv" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, "20230401,a\n20230402,b\n")
+	}))
+	defer srv.Close()
+
+	r, err := Open(srv.URL + "/input.csv")
+	if err != nil {
+		t.Fatalf("failed to open: %s", err)
+	}
+	defer r.Close()
+
+	var rows [][]string
+	for {
+		row, err := r.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("failed to read: %s", err)
+		}
+		rows = append(rows, append([]string(nil), row...))
+	}
+	if want := [][]string{{"20230401", "a"}, {"20230402", "b"}}; !reflect.DeepEqual(rows, want) {
+		t.Errorf("expected %q but got %q", want, rows)
+	}
+	if r.size != 22 {
+		t.Errorf("expected size 22 but got %d", r.size)
+	}
+
+	if _, err := Open(srv.URL + "/missing.csv"); err == nil || err.Error() != srv.URL+"/missing.csv: 404 Not Found" {
+		t.Errorf("expected not found error but got %v", err)
+	}
+}
+
+func TestOpen_pipe(t *testing.T) {
+	if _, err := os.Stat("/dev/fd/0"); err != nil {
+		t.Skip("/dev/fd is not available")
+	}
+
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to make pipe: %s", err)
+	}
+	defer pr.Close()
+	go func() {
+		io.WriteString(pw, "20230401,a\n20230402,b\n")
+		pw.Close()
+	}()
+
+	// The same as a process substitution like <(cat input.csv).
+	path := fmt.Sprintf("/dev/fd/%d", pr.Fd())
+	if info, err := os.Stat(path); err != nil {
+		t.Fatalf("failed to stat pipe: %s", err)
+	} else if !isStreamInput(info) {
+		t.Errorf("expected a pipe is a stream input")
+	}
+
+	r, err := Open(path)
+	if err != nil {
+		t.Fatalf("failed to open: %s", err)
+	}
+	defer r.Close()
+
+	var rows [][]string
+	for {
+		row, err := r.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("failed to read: %s", err)
+		}
+		rows = append(rows, append([]string(nil), row...))
+	}
+	if want := [][]string{{"20230401", "a"}, {"20230402", "b"}}; !reflect.DeepEqual(rows, want) {
+		t.Errorf("expected %q but got %q", want, rows)
+	}
+	if r.size != -1 || r.read == nil || r.read.n != 22 {
+		t.Errorf("expected unknown size and 22 bytes read but got %d and %v", r.size, r.read)
+	}
+
+	regular := filepath.Join(t.TempDir(), "a.csv")
+	if err := os.WriteFile(regular, nil, 0644); err != nil {
+		t.Fatalf("failed to prepare input: %s", err)
+	}
+	if info, err := os.Stat(regular); err != nil {
+		t.Fatalf("failed to stat: %s", err)
+	} else if isStreamInput(info) {
+		t.Errorf("expected a regular file is not a stream input")
+	}
+}
+
+func TestIsInputURL(t *testing.T) {
+	tests := []struct {
+		Input  string
+		Output bool
+	}{
+		{"https://example.com/a.csv", true},
+		{"http://example.com/a.csv", true},
+		{"s3://bucket/a.csv", true},
+		{"gs://bucket/a.csv", false},
+		{"/path/to/a.csv", false},
+		{`C:\path\to\a.csv`, false},
+	}
+
+	for _, tt := range tests {
+		if got := isInputURL(tt.Input); got != tt.Output {
+			t.Errorf("%s: expected %v but got %v", tt.Input, tt.Output, got)
+		}
+	}
+}
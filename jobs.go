@@ -0,0 +1,51 @@
+package main
+
+import (
+	"sync"
+)
+
+// chopMu guards the state that shared between the input files chopped in parallel by -jobs,
+// such as summary, the header of the first file, and the maps of the written files and partitions.
+var chopMu sync.Mutex
+
+// JobRunner runs functions in background with at most jobs functions at once.
+// All methods run the function synchronously if the JobRunner is nil.
+type JobRunner struct {
+	sem chan struct{}
+	wg  sync.WaitGroup
+}
+
+// chopJobs is the JobRunner to chop input files in parallel by -jobs, or nil to chop one by one.
+var chopJobs *JobRunner
+
+// NewJobRunner makes a JobRunner that runs at most jobs functions at once.
+func NewJobRunner(jobs int) *JobRunner {
+	return &JobRunner{
+		sem: make(chan struct{}, jobs),
+	}
+}
+
+// Run runs f in background.
+// It blocks until a slot is available, so that the caller does not go ahead too much.
+func (j *JobRunner) Run(f func()) {
+	if j == nil {
+		f()
+		return
+	}
+
+	j.sem <- struct{}{}
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		defer func() { <-j.sem }()
+		f()
+	}()
+}
+
+// Wait waits for all functions that started by Run.
+func (j *JobRunner) Wait() {
+	if j == nil {
+		return
+	}
+	j.wg.Wait()
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestJobRunner(t *testing.T) {
+	j := NewJobRunner(2)
+
+	var running, peak, done int32
+	for i := 0; i < 6; i++ {
+		j.Run(func() {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			atomic.AddInt32(&done, 1)
+		})
+	}
+	j.Wait()
+
+	if done != 6 {
+		t.Errorf("expected 6 jobs done but got %d", done)
+	}
+	if peak > 2 {
+		t.Errorf("expected at most 2 jobs at once but got %d", peak)
+	}
+}
+
+func TestJobRunner_nil(t *testing.T) {
+	var j *JobRunner
+	ran := false
+	j.Run(func() { ran = true })
+	if !ran {
+		t.Errorf("expected nil JobRunner to run the function synchronously")
+	}
+	j.Wait()
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// LintProblem is a problem found in an input file by Lint.
+type LintProblem struct {
+	Line    int
+	Message string
+}
+
+func (p LintProblem) String() string {
+	return fmt.Sprintf("line %d: %s", p.Line, p.Message)
+}
+
+// LintReport is the result of Lint for an input file.
+type LintReport struct {
+	Rows              int // the number of data rows, without the header
+	Columns           int // the number of columns of the header or the first row
+	ParseErrors       int // the number of records that are not valid CSV
+	InvalidChars      int // the number of rows that have characters can not be decoded with -encoding
+	InvalidTimestamps int // the number of rows that the first column can not be parsed as a timestamp
+	RaggedRows        int // the number of rows that have a different number of columns from Columns
+
+	// Problems is the first problems found, up to the limit passed to Lint.
+	Problems []LintProblem
+}
+
+// ProblemCount returns the number of all problems, including the ones not in Problems.
+func (r LintReport) ProblemCount() int {
+	return r.ParseErrors + r.InvalidChars + r.InvalidTimestamps + r.RaggedRows
+}
+
+// Lint reads all records from r, and checks them in the same way as chopping, without writing anything.
+// Up to limit problems are kept in the report as examples.
+//
+// WARNING: this function reads commandline flags directly.
+func Lint(r *Reader, limit int) (LintReport, error) {
+	var report LintReport
+
+	// The number of columns is always checked by Lint, to report all ragged rows instead of stopping at the first one.
+	r.c.FieldsPerRecord = -1
+
+	report.Columns = -1
+	add := func(line int, format string, args ...interface{}) {
+		if len(report.Problems) < limit {
+			report.Problems = append(report.Problems, LintProblem{Line: line + *skipLines, Message: fmt.Sprintf(format, args...)})
+		}
+	}
+
+	header := *hasHeader
+	for {
+		row, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		var perr *csv.ParseError
+		if errors.As(err, &perr) {
+			report.ParseErrors++
+			add(perr.Line, "%s", perr.Err)
+			continue
+		} else if err != nil {
+			return report, err
+		}
+		line, _ := r.c.FieldPos(0)
+
+		if report.Columns < 0 {
+			report.Columns = len(row)
+		} else if len(row) != report.Columns {
+			report.RaggedRows++
+			add(line, "%d columns, but expected %d columns", len(row), report.Columns)
+		}
+
+		if header {
+			header = false
+			continue
+		}
+		report.Rows++
+
+		if ReplaceInvalidChars(row) > 0 {
+			report.InvalidChars++
+			add(line, "invalid character for %s", *encodingName)
+		}
+
+		NormalizeRecord(row)
+		CleanRecord(row)
+		if _, err := ParseTimestamp(row[0]); err != nil {
+			report.InvalidTimestamps++
+			add(line, "invalid timestamp: %s: %s", row[0], err)
+		}
+	}
+
+	if report.Columns < 0 {
+		report.Columns = 0
+	}
+	return report, nil
+}
+
+// runLint runs lint subcommand.
+func runLint(args []string) {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	examples := fs.Int("examples", 5, "The number of problems to show for each file.")
+	fs.Usage = func() {
+		fmt.Println("Usage: chop-csv lint [OPTIONS] [LINT OPTIONS] FILE...")
+		fmt.Println()
+		fmt.Println("Check if FILEs can be chopped with OPTIONS, and print the problems of each file.")
+		fmt.Println("The encoding, the CSV syntax, the timestamps in the first column, and the number of columns are checked.")
+		fmt.Println("Nothing is written into the output directory.")
+		fmt.Println()
+		fmt.Println("Exit code is 3 if a file can not be read, or 4 if any problem found.")
+		fmt.Println()
+		fmt.Println("LINT OPTIONS:")
+		printCommandDefaults(fs)
+	}
+	parseCommand(fs, args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(ExitUsage)
+	}
+
+	code := ExitOK
+	for _, path := range fs.Args() {
+		r, err := Open(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+			code = ExitInputError
+			continue
+		}
+		report, err := Lint(r, *examples)
+		r.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+			code = ExitInputError
+			continue
+		}
+
+		if report.ProblemCount() == 0 {
+			fmt.Printf("%s: ok (%d rows, %d columns)\n", path, report.Rows, report.Columns)
+			continue
+		}
+
+		if code == ExitOK {
+			code = ExitDecodeError
+		}
+		fmt.Printf("%s: %d problems in %d rows\n", path, report.ProblemCount(), report.Rows)
+		fmt.Printf("  parse errors: %d, invalid characters: %d, invalid timestamps: %d, wrong number of columns: %d\n", report.ParseErrors, report.InvalidChars, report.InvalidTimestamps, report.RaggedRows)
+		for _, p := range report.Problems {
+			fmt.Printf("  %s\n", p)
+		}
+		if n := report.ProblemCount() - len(report.Problems); n > 0 {
+			fmt.Printf("  ... and %d more\n", n)
+		}
+	}
+
+	os.Exit(code)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	input := strings.Join([]string{
+		"20230401,a",
+		"invalid,b",
+		"20230401,c,extra",
+		`20230401,d"e`,
+		"20230401,f",
+	}, "\n") + "\n"
+
+	tests := []struct {
+		Name     string
+		Limit    int
+		Report   LintReport
+		Problems []string
+	}{
+		{
+			"all problems",
+			10,
+			LintReport{Rows: 4, Columns: 2, ParseErrors: 1, InvalidTimestamps: 1, RaggedRows: 1},
+			[]string{
+				`line 2: invalid timestamp: invalid: parsing time "invalid" as "20060102": cannot parse "invalid" as "2006"`,
+				"line 3: 3 columns, but expected 2 columns",
+				`line 4: bare " in non-quoted-field`,
+			},
+		},
+		{
+			"limited",
+			1,
+			LintReport{Rows: 4, Columns: 2, ParseErrors: 1, InvalidTimestamps: 1, RaggedRows: 1},
+			[]string{
+				`line 2: invalid timestamp: invalid: parsing time "invalid" as "20060102": cannot parse "invalid" as "2006"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			r := NewReader(io.NopCloser(strings.NewReader(input)))
+			defer r.Close()
+
+			report, err := Lint(r, tt.Limit)
+			if err != nil {
+				t.Fatalf("failed to lint: %s", err)
+			}
+
+			var problems []string
+			for _, p := range report.Problems {
+				problems = append(problems, p.String())
+			}
+			if !reflect.DeepEqual(problems, tt.Problems) {
+				t.Errorf("unexpected problems\nexpected: %q\n but got: %q", tt.Problems, problems)
+			}
+
+			report.Problems = nil
+			if !reflect.DeepEqual(report, tt.Report) {
+				t.Errorf("expected %+v but got %+v", tt.Report, report)
+			}
+			if report.ProblemCount() != 3 {
+				t.Errorf("expected 3 problems but got %d", report.ProblemCount())
+			}
+		})
+	}
+}
+
+func TestLint_header(t *testing.T) {
+	orig := *hasHeader
+	*hasHeader = true
+	defer func() { *hasHeader = orig }()
+
+	r := NewReader(io.NopCloser(strings.NewReader("timestamp,value\n20230401,a\n")))
+	defer r.Close()
+
+	report, err := Lint(r, 10)
+	if err != nil {
+		t.Fatalf("failed to lint: %s", err)
+	}
+	if report.Rows != 1 || report.Columns != 2 || report.ProblemCount() != 0 {
+		t.Errorf("expected 1 row, 2 columns and no problem but got %+v", report)
+	}
+}
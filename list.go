@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"text/tabwriter"
+
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// PartitionInfo is the information of a partition that shown by list subcommand.
+type PartitionInfo struct {
+	Partition         string `json:"partition"`
+	Files             int    `json:"files"`
+	CompressedBytes   int64  `json:"compressed_bytes"`
+	UncompressedBytes int64  `json:"uncompressed_bytes"`
+	Rows              *int64 `json:"rows,omitempty"`
+}
+
+// byteCounter is an io.Reader that counts the bytes read through it.
+type byteCounter struct {
+	r io.Reader
+	n int64
+}
+
+func (c *byteCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// inspectFile decompresses the file, and returns the uncompressed size.
+// The rows are counted too if count is true, otherwise rows is 0.
+func inspectFile(path string, count bool) (size, rows int64, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	b, err := newDecompressor(path, f)
+	if err != nil {
+		return 0, 0, err
+	}
+	c := &byteCounter{r: b}
+
+	if !count {
+		if _, err := io.Copy(io.Discard, c); err != nil {
+			return 0, 0, fmt.Errorf("%s: %w", path, err)
+		}
+		return c.n, 0, nil
+	}
+
+	var r io.Reader = c
+	if outputEncoding != unicode.UTF8 {
+		r = transform.NewReader(c, outputEncoding.NewDecoder())
+	}
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	for {
+		if _, err := cr.Read(); err == io.EOF {
+			return c.n, rows, nil
+		} else if err != nil {
+			return 0, 0, fmt.Errorf("%s: %w", path, err)
+		}
+		rows++
+	}
+}
+
+// InspectPartition collects the information of the partition in dir.
+// The files are decompressed in parallel.
+func InspectPartition(dir string, p Partition, count bool, jobs int) (PartitionInfo, error) {
+	rel, err := filepath.Rel(dir, p.Dir)
+	if err != nil {
+		return PartitionInfo{}, err
+	}
+	info := PartitionInfo{Partition: filepath.ToSlash(rel), Files: len(p.Files)}
+
+	sizes := make([]int64, len(p.Files))
+	rows := make([]int64, len(p.Files))
+	errs := make([]error, len(p.Files))
+
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for i, f := range p.Files {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, f string) {
+			defer wg.Done()
+			sizes[i], rows[i], errs[i] = inspectFile(f, count)
+			<-sem
+		}(i, f)
+	}
+	wg.Wait()
+
+	var total int64
+	for i, f := range p.Files {
+		if errs[i] != nil {
+			return info, errs[i]
+		}
+		s, err := os.Stat(f)
+		if err != nil {
+			return info, err
+		}
+		info.CompressedBytes += s.Size()
+		info.UncompressedBytes += sizes[i]
+		total += rows[i]
+	}
+	if count {
+		info.Rows = &total
+	}
+	return info, nil
+}
+
+// runList runs list subcommand.
+func runList(args []string) {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	count := fs.Bool("count", false, "Count the rows in each partition.")
+	asJSON := fs.Bool("json", false, "Print as JSON instead of a table.")
+	jobs := fs.Int("jobs", 4, "The number of files to read in parallel.")
+	fs.Usage = func() {
+		fmt.Println("Usage: chop-csv list [OPTIONS] [LIST OPTIONS] OUTDIR")
+		fmt.Println()
+		fmt.Println("Print each partition in OUTDIR with the number of files, the compressed and uncompressed size, and the number of rows.")
+		fmt.Println("The granularity of the partitions is detected from the directory names.")
+		fmt.Println()
+		fmt.Println("LIST OPTIONS:")
+		printCommandDefaults(fs)
+	}
+	parseCommand(fs, args)
+
+	if fs.NArg() != 1 || *jobs < 1 {
+		fs.Usage()
+		os.Exit(ExitUsage)
+	}
+	dir := fs.Arg(0)
+
+	layout, err := DetectPartitionLayout(dir)
+	if err != nil {
+		layout = partitionLayout
+	}
+	ps, err := ListPartitionsWithLayout(dir, layout)
+	if err != nil {
+		fatalf(ExitInputError, "failed to list partitions: %s", err)
+	}
+
+	infos := make([]PartitionInfo, 0, len(ps))
+	for _, p := range ps {
+		info, err := InspectPartition(dir, p, *count, *jobs)
+		if err != nil {
+			fatalf(ExitInputError, "failed to inspect partition: %s", err)
+		}
+		infos = append(infos, info)
+	}
+
+	if *asJSON {
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		if err := e.Encode(infos); err != nil {
+			fatalf(ExitOutputError, "failed to write: %s", err)
+		}
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if *count {
+		fmt.Fprintln(w, "PARTITION\tFILES\tCOMPRESSED\tUNCOMPRESSED\tROWS")
+	} else {
+		fmt.Fprintln(w, "PARTITION\tFILES\tCOMPRESSED\tUNCOMPRESSED")
+	}
+	var total PartitionInfo
+	var totalRows int64
+	for _, i := range infos {
+		total.Files += i.Files
+		total.CompressedBytes += i.CompressedBytes
+		total.UncompressedBytes += i.UncompressedBytes
+		if *count {
+			totalRows += *i.Rows
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\n", i.Partition, i.Files, i.CompressedBytes, i.UncompressedBytes, *i.Rows)
+		} else {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", i.Partition, i.Files, i.CompressedBytes, i.UncompressedBytes)
+		}
+	}
+	if *count {
+		fmt.Fprintf(w, "TOTAL\t%d\t%d\t%d\t%d\n", total.Files, total.CompressedBytes, total.UncompressedBytes, totalRows)
+	} else {
+		fmt.Fprintf(w, "TOTAL\t%d\t%d\t%d\n", total.Files, total.CompressedBytes, total.UncompressedBytes)
+	}
+	w.Flush()
+}
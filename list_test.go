@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInspectPartition(t *testing.T) {
+	dir := t.TempDir()
+	day := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+	writePartitionFile(t, dir, day, "a.csv.bz2", [][]string{{"20230401", "a1"}, {"20230401", "a2"}})
+	writePartitionFile(t, dir, day, "b.csv.bz2", [][]string{{"20230401", "b1"}})
+
+	ps, err := ListPartitions(dir)
+	if err != nil {
+		t.Fatalf("failed to list partitions: %s", err)
+	}
+	if len(ps) != 1 {
+		t.Fatalf("expected 1 partition but got %v", ps)
+	}
+
+	var compressed int64
+	for _, f := range ps[0].Files {
+		s, err := os.Stat(f)
+		if err != nil {
+			t.Fatalf("failed to stat: %s", err)
+		}
+		compressed += s.Size()
+	}
+
+	for _, count := range []bool{false, true} {
+		info, err := InspectPartition(dir, ps[0], count, 2)
+		if err != nil {
+			t.Fatalf("failed to inspect: %s", err)
+		}
+
+		if want := filepath.ToSlash(PartitionDir(day)); info.Partition != want {
+			t.Errorf("expected partition %s but got %s", want, info.Partition)
+		}
+		if info.Files != 2 {
+			t.Errorf("expected 2 files but got %d", info.Files)
+		}
+		if info.CompressedBytes != compressed {
+			t.Errorf("expected %d compressed bytes but got %d", compressed, info.CompressedBytes)
+		}
+		if want := int64(len("20230401,a1\n") * 3); info.UncompressedBytes != want {
+			t.Errorf("expected %d uncompressed bytes but got %d", want, info.UncompressedBytes)
+		}
+
+		if !count && info.Rows != nil {
+			t.Errorf("expected no rows without count but got %d", *info.Rows)
+		} else if count && (info.Rows == nil || *info.Rows != 3) {
+			t.Errorf("expected 3 rows but got %v", info.Rows)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// listenNetwork parses the address of -listen, like "tcp://:9000", ":9000", or "unix:///run/chop-csv.sock".
+func listenNetwork(addr string) (network, address string, err error) {
+	switch {
+	case strings.HasPrefix(addr, "tcp://"):
+		return "tcp", strings.TrimPrefix(addr, "tcp://"), nil
+	case strings.HasPrefix(addr, "unix://"):
+		return "unix", strings.TrimPrefix(addr, "unix://"), nil
+	case strings.Contains(addr, "://"):
+		return "", "", fmt.Errorf("unsupported address: %s", addr)
+	}
+	return "tcp", addr, nil
+}
+
+// listenSource is a RecordSource that reads the records received from all connections of -listen.
+//
+// Next returns io.EOF when the segment reached the rotation time or ctx is canceled,
+// so that the output files of the segment are completed and the next segment is started.
+type listenSource struct {
+	ctx     context.Context
+	first   []string // the first record of the segment, that received before starting the segment
+	records <-chan []string
+	rotate  <-chan time.Time
+
+	flushInterval time.Duration
+	idle          func() // called every flushInterval while waiting for new records
+}
+
+func (s *listenSource) Next() ([]string, error) {
+	if s.first != nil {
+		r := s.first
+		s.first = nil
+		return r, nil
+	}
+
+	flush := time.NewTicker(s.flushInterval)
+	defer flush.Stop()
+
+	for {
+		select {
+		case r := <-s.records:
+			return r, nil
+		case <-s.rotate:
+			return nil, io.EOF
+		case <-s.ctx.Done():
+			// Write the records already received before stopping.
+			select {
+			case r := <-s.records:
+				return r, nil
+			default:
+				return nil, io.EOF
+			}
+		case <-flush.C:
+			s.idle()
+		}
+	}
+}
+
+// receiveRecords reads CSV from the connection, and sends the records into records.
+// The connection is closed when it reached the end or an invalid record.
+//
+// WARNING: this function reads commandline flags directly.
+func receiveRecords(ctx context.Context, conn net.Conn, records chan<- []string) {
+	remote := conn.RemoteAddr().String()
+	logger.With("remote", remote).Infof("accept connection from %s", remote)
+
+	r := NewReader(conn)
+	defer r.Close()
+
+	for {
+		row, err := r.Next()
+		if err == io.EOF {
+			logger.With("remote", remote).Infof("connection from %s closed", remote)
+			return
+		} else if err != nil {
+			logger.With("remote", remote, "error", err).Warnf("close connection from %s because invalid record: %s", remote, err)
+			return
+		}
+
+		select {
+		case records <- append([]string(nil), row...):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Listen chops the CSV records that sent into the TCP or unix socket.
+// Each connection sends CSV lines without the header, and the records from all connections are written into the same partitions.
+//
+// The output files are completed every rotateInterval, and the next rows are written into new files.
+// While waiting for new rows, the output files are flushed every flushInterval.
+//
+// This function never returns until ctx is canceled. The rows that already received are written before returning.
+//
+// WARNING: this method can stop program with log.Fatal.
+func Listen(ctx context.Context, addr string, rotateInterval, flushInterval time.Duration) {
+	network, address, err := listenNetwork(addr)
+	if err != nil {
+		fatalf(ExitUsage, "invalid -listen: %s", err)
+	}
+	if network == "unix" {
+		// Remove the socket that left by the previous run.
+		if err := os.Remove(address); err != nil && !os.IsNotExist(err) {
+			fatalf(ExitError, "failed to listen %s: %s", addr, err)
+		}
+	}
+
+	l, err := net.Listen(network, address)
+	if err != nil {
+		fatalf(ExitError, "failed to listen %s: %s", addr, err)
+	}
+	logger.With("listen", addr).Infof("listen on %s", addr)
+
+	records := make(chan []string, 1024)
+	var conns sync.WaitGroup
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				if ctx.Err() == nil {
+					logger.With("error", err).Errorf("failed to accept connection: %s", err)
+				}
+				return
+			}
+			conns.Add(1)
+			go func() {
+				defer conns.Done()
+				done := make(chan struct{})
+				defer close(done)
+				go func() {
+					select {
+					case <-ctx.Done():
+						conn.Close()
+					case <-done:
+					}
+				}()
+				receiveRecords(ctx, conn, records)
+			}()
+		}
+	}()
+
+	for {
+		// Wait for the first record before starting a segment, so that no empty segment is made while no one sends.
+		var first []string
+		select {
+		case first = <-records:
+		case <-ctx.Done():
+			select {
+			case first = <-records:
+			default:
+			}
+		}
+		if first == nil {
+			break
+		}
+
+		start := SystemClock.Now()
+		inputPath := fmt.Sprintf("%s#%s", addr, start.Format(time.RFC3339Nano))
+
+		csvName, err := outputName(inputPath)
+		if err != nil {
+			fatalf(ExitError, "failed to decide output file name: %s", err)
+		}
+		w := NewPartitionWriter(csvName)
+		var stats Summary
+
+		rotate := time.NewTimer(rotateInterval)
+		src := &listenSource{
+			ctx:           ctx,
+			first:         first,
+			records:       records,
+			rotate:        rotate.C,
+			flushInterval: flushInterval,
+			idle: func() {
+				if err := w.Flush(); err != nil {
+					fatalf(ExitOutputError, "%s", err)
+				}
+				addSummary(&stats)
+				if err := history.Update(); err != nil {
+					logger.With("error", err).Warnf("failed to record history: %s", err)
+				}
+			},
+		}
+
+		// chop is not canceled by ctx, because src stops at the end of the segment to complete the output files.
+		if _, err := chop(context.Background(), src, inputPath, w, &stats); err != nil {
+			fatalf(inputExitCode(err), "%s", err)
+		}
+		rotate.Stop()
+	}
+
+	conns.Wait()
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestListenNetwork(t *testing.T) {
+	tests := []struct {
+		Addr    string
+		Network string
+		Address string
+	}{
+		{":9000", "tcp", ":9000"},
+		{"tcp://localhost:9000", "tcp", "localhost:9000"},
+		{"unix:///run/chop-csv.sock", "unix", "/run/chop-csv.sock"},
+	}
+
+	for _, tt := range tests {
+		network, address, err := listenNetwork(tt.Addr)
+		if err != nil {
+			t.Errorf("%s: failed to parse: %s", tt.Addr, err)
+		} else if network != tt.Network || address != tt.Address {
+			t.Errorf("%s: expected %s %s but got %s %s", tt.Addr, tt.Network, tt.Address, network, address)
+		}
+	}
+
+	if _, _, err := listenNetwork("udp://:9000"); err == nil {
+		t.Errorf("expected error but got nil")
+	}
+}
+
+func TestListenSource(t *testing.T) {
+	records := make(chan []string, 2)
+	rotate := make(chan time.Time, 1)
+	idles := 0
+
+	src := &listenSource{
+		ctx:           context.Background(),
+		first:         []string{"20230401", "first"},
+		records:       records,
+		rotate:        rotate,
+		flushInterval: time.Millisecond,
+		idle:          func() { idles++ },
+	}
+
+	records <- []string{"20230401", "second"}
+	for _, want := range [][]string{{"20230401", "first"}, {"20230401", "second"}} {
+		if got, err := src.Next(); err != nil {
+			t.Fatalf("failed to read: %s", err)
+		} else if !reflect.DeepEqual(got, want) {
+			t.Errorf("expected %q but got %q", want, got)
+		}
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		rotate <- time.Now()
+	}()
+	if _, err := src.Next(); err != io.EOF {
+		t.Errorf("expected EOF by rotation but got %v", err)
+	}
+	if idles == 0 {
+		t.Errorf("expected idle is called while waiting")
+	}
+}
+
+func TestListenSource_canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	records := make(chan []string, 1)
+	records <- []string{"20230401", "received"}
+	src := &listenSource{
+		ctx:           ctx,
+		records:       records,
+		rotate:        make(chan time.Time),
+		flushInterval: time.Hour,
+		idle:          func() {},
+	}
+
+	// The record already received is read even after canceled.
+	if got, err := src.Next(); err != nil {
+		t.Fatalf("failed to read: %s", err)
+	} else if want := []string{"20230401", "received"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+	if _, err := src.Next(); err != io.EOF {
+		t.Errorf("expected EOF but got %v", err)
+	}
+}
+
+func TestReceiveRecords(t *testing.T) {
+	server, client := net.Pipe()
+	records := make(chan []string, 10)
+
+	done := make(chan struct{})
+	go func() {
+		receiveRecords(context.Background(), server, records)
+		close(done)
+	}()
+
+	if _, err := client.Write([]byte("20230401,a\n20230402,b\n")); err != nil {
+		t.Fatalf("failed to send: %s", err)
+	}
+	client.Close()
+	<-done
+	close(records)
+
+	var got [][]string
+	for r := range records {
+		got = append(got, r)
+	}
+	if want := [][]string{{"20230401", "a"}, {"20230402", "b"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lockFileName is the name of the lock file in the output directory.
+const lockFileName = ".chop-csv.lock"
+
+// errLocked means that the lock file is locked by another process.
+var errLocked = errors.New("locked by another process")
+
+// OutputLock is a lock of an output directory, to prevent two chop-csv from writing into the same directory at the same time.
+//
+// The lock file is removed by Unlock when the process exits.
+// The lock itself is released by the OS even if the process crashed, so the left lock file does not block the next run.
+type OutputLock struct {
+	path string
+	f    *os.File
+}
+
+// outputLocks is the locks of the output directories.
+// They are kept until the process exits, otherwise the file would be closed by GC and the lock would be released.
+var outputLocks []*OutputLock
+
+// UnlockOutputDirs releases all locks in outputLocks, and removes the lock files.
+// It is called before the process exits, even if by fatalf.
+func UnlockOutputDirs() {
+	for _, l := range outputLocks {
+		if l == nil {
+			continue
+		}
+		if err := l.Unlock(); err != nil {
+			logger.With("file", l.path, "error", err).Warnf("failed to remove lock file: %s", err)
+		}
+	}
+	outputLocks = nil
+}
+
+// Unlock releases the lock, and removes the lock file.
+func (l *OutputLock) Unlock() error {
+	return unlockFile(l.f, l.path)
+}
+
+// LockOutputDir locks dir, and makes dir if not exists.
+// If another chop-csv is writing into dir, it waits up to wait for the lock, and returns an error if still locked.
+// It does nothing and returns nil if dir is a URL.
+func LockOutputDir(dir string, wait time.Duration) (*OutputLock, error) {
+	if isRemoteURL(dir) {
+		return nil, nil
+	}
+	if err := makeOutputDir(dir); err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(dir, lockFileName)
+	deadline := SystemClock.Now().Add(wait)
+	waiting := false
+	for {
+		f, err := lockFile(path)
+		if err == nil {
+			// The PID is only for the error message of the other processes.
+			// It is not written with -deterministic, because the lock file is left in the output directory if the process crashed.
+			f.Truncate(0)
+			if !deterministic {
+				f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+			}
+			return &OutputLock{path: path, f: f}, nil
+		}
+		if err != errLocked {
+			return nil, err
+		}
+
+		holder := "another chop-csv"
+		if b, err := os.ReadFile(path); err == nil && len(strings.TrimSpace(string(b))) > 0 {
+			holder = fmt.Sprintf("another chop-csv (pid %s)", strings.TrimSpace(string(b)))
+		}
+		remain := deadline.Sub(SystemClock.Now())
+		if remain <= 0 {
+			return nil, fmt.Errorf("%s is writing into %s", holder, dir)
+		}
+		if !waiting {
+			logger.With("dir", dir).Infof("%s is writing into %s. wait for it to finish", holder, dir)
+			waiting = true
+		}
+
+		if remain > time.Second {
+			remain = time.Second
+		}
+		time.Sleep(remain)
+	}
+}
@@ -0,0 +1,50 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile opens the lock file and locks it with flock.
+func lockFile(path string) (*os.File, error) {
+	for {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+		if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+			f.Close()
+			if err == syscall.EWOULDBLOCK {
+				return nil, errLocked
+			}
+			return nil, err
+		}
+
+		// The file may be removed by unlockFile of another process between opening and locking.
+		// The lock of the removed file locks nothing, so open the new one again.
+		opened, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if current, err := os.Stat(path); err == nil && os.SameFile(opened, current) {
+			return f, nil
+		} else if err != nil && !os.IsNotExist(err) {
+			f.Close()
+			return nil, err
+		}
+		f.Close()
+	}
+}
+
+// unlockFile removes the lock file before releasing the lock, so that the other processes never lock the removed file after it.
+func unlockFile(f *os.File, path string) error {
+	err := os.Remove(path)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
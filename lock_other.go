@@ -0,0 +1,23 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !windows
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!windows
+
+package main
+
+import (
+	"os"
+)
+
+// lockFile opens the lock file without locking, because this platform has no flock.
+func lockFile(path string) (*os.File, error) {
+	logger.Warnf("locking output directory is not supported on this platform")
+	return os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+}
+
+// unlockFile removes the lock file and closes it.
+func unlockFile(f *os.File, path string) error {
+	err := os.Remove(path)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,82 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows
+// +build darwin dragonfly freebsd linux netbsd openbsd windows
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLockOutputDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "out")
+
+	l, err := LockOutputDir(dir, 0)
+	if err != nil {
+		t.Fatalf("failed to lock: %s", err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, lockFileName))
+	if err != nil {
+		t.Fatalf("failed to read lock file: %s", err)
+	}
+	if want := strconv.Itoa(os.Getpid()); strings.TrimSpace(string(b)) != want {
+		t.Errorf("expected pid %s in the lock file but got %q", want, string(b))
+	}
+
+	start := time.Now()
+	_, err = LockOutputDir(dir, 1500*time.Millisecond)
+	if err == nil {
+		t.Fatalf("expected error but got nil")
+	}
+	if !strings.Contains(err.Error(), "pid "+strconv.Itoa(os.Getpid())) {
+		t.Errorf("expected the error tells the pid but got %q", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("expected to wait for the lock but returned in %s", elapsed)
+	}
+
+	if err := l.Unlock(); err != nil {
+		t.Fatalf("failed to unlock: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, lockFileName)); !os.IsNotExist(err) {
+		t.Errorf("expected the lock file is removed but got %v", err)
+	}
+
+	l2, err := LockOutputDir(dir, 0)
+	if err != nil {
+		t.Fatalf("failed to lock after released: %s", err)
+	}
+	l2.Unlock()
+}
+
+func TestUnlockOutputDirs(t *testing.T) {
+	orig := outputLocks
+	defer func() { outputLocks = orig }()
+
+	dir := t.TempDir()
+	l, err := LockOutputDir(dir, 0)
+	if err != nil {
+		t.Fatalf("failed to lock: %s", err)
+	}
+	outputLocks = []*OutputLock{nil, l}
+
+	UnlockOutputDirs()
+
+	if outputLocks != nil {
+		t.Errorf("expected no locks but got %v", outputLocks)
+	}
+	if _, err := os.Stat(filepath.Join(dir, lockFileName)); !os.IsNotExist(err) {
+		t.Errorf("expected the lock file is removed but got %v", err)
+	}
+}
+
+func TestLockOutputDir_remote(t *testing.T) {
+	if l, err := LockOutputDir("s3://bucket/prefix", 0); l != nil || err != nil {
+		t.Errorf("expected nil but got %v and %v", l, err)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// errorSharingViolation is ERROR_SHARING_VIOLATION, that returned when the file is opened by another process without sharing.
+const errorSharingViolation syscall.Errno = 32
+
+// lockFile opens the lock file without sharing, so that no other process can open it until closed.
+func lockFile(path string) (*os.File, error) {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	h, err := syscall.CreateFile(name, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil, syscall.OPEN_ALWAYS, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if err == errorSharingViolation {
+		return nil, errLocked
+	} else if err != nil {
+		return nil, err
+	}
+	return os.NewFile(uintptr(h), path), nil
+}
+
+// unlockFile releases the lock before removing the lock file, because Windows can not remove the file that opened without sharing.
+// If another process locked the file in the meantime, the file is left for it.
+func unlockFile(f *os.File, path string) error {
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) && !errors.Is(err, errorSharingViolation) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log message.
+type Level int
+
+const (
+	LevelInfo Level = iota
+	LevelWarn
+	LevelError
+)
+
+// levelNames is the names of Level for -log-level and the level field of JSON logs.
+var levelNames = []string{"info", "warn", "error"}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// ParseLevel parses the name of Level.
+func ParseLevel(s string) (Level, error) {
+	for i, n := range levelNames {
+		if s == n {
+			return Level(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown level: %s", s)
+}
+
+var (
+	// logLevel is the minimum level of the messages to write, that set by -log-level.
+	logLevel = LevelInfo
+
+	// jsonLog is true if -log-format=json.
+	jsonLog = false
+
+	// textLog writes the messages in -log-format=text, in the same format as the standard logger.
+	textLog = log.New(os.Stderr, "", log.LstdFlags)
+
+	// jsonLogMu serializes JSON messages from goroutines.
+	jsonLogMu sync.Mutex
+)
+
+// SetupLogger sets the format and the minimum level of log messages.
+// In JSON format, the messages of the standard logger like log.Fatal are written as JSON in error level too.
+func SetupLogger(format, level string) error {
+	l, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	logLevel = l
+
+	switch format {
+	case "text":
+		jsonLog = false
+	case "json":
+		jsonLog = true
+		log.SetFlags(0)
+		log.SetOutput(stdLogWriter{})
+	default:
+		return fmt.Errorf("unknown format: %s", format)
+	}
+	return nil
+}
+
+// Logger writes leveled log messages with structured fields.
+// The fields are written only in JSON format. In text format, the messages are written as is, like the standard logger.
+type Logger struct {
+	fields []interface{} // the pairs of a key and a value
+}
+
+// logger is the root Logger that has no field.
+var logger Logger
+
+// With returns a Logger that adds the fields into the messages.
+// The arguments are the pairs of a key and a value, like With("input", path, "row", 10).
+func (l Logger) With(keysAndValues ...interface{}) Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keysAndValues))
+	fields = append(fields, l.fields...)
+	fields = append(fields, keysAndValues...)
+	return Logger{fields}
+}
+
+func (l Logger) Infof(format string, args ...interface{}) {
+	l.output(LevelInfo, fmt.Sprintf(format, args...))
+}
+
+func (l Logger) Warnf(format string, args ...interface{}) {
+	l.output(LevelWarn, fmt.Sprintf(format, args...))
+}
+
+func (l Logger) Errorf(format string, args ...interface{}) {
+	l.output(LevelError, fmt.Sprintf(format, args...))
+}
+
+func (l Logger) output(level Level, msg string) {
+	if level < logLevel {
+		return
+	}
+	if !jsonLog {
+		textLog.Print(msg)
+		return
+	}
+
+	var b bytes.Buffer
+	b.WriteString(`{"time":`)
+	writeJSONValue(&b, SystemClock.Now().Format(time.RFC3339Nano))
+	b.WriteString(`,"level":`)
+	writeJSONValue(&b, level.String())
+	b.WriteString(`,"msg":`)
+	writeJSONValue(&b, msg)
+	for i := 0; i+1 < len(l.fields); i += 2 {
+		b.WriteByte(',')
+		writeJSONValue(&b, fmt.Sprint(l.fields[i]))
+		b.WriteByte(':')
+		writeJSONValue(&b, l.fields[i+1])
+	}
+	b.WriteString("}\n")
+
+	jsonLogMu.Lock()
+	defer jsonLogMu.Unlock()
+	os.Stderr.Write(b.Bytes())
+}
+
+// writeJSONValue writes v as JSON.
+// The errors and the durations are written as strings, and the values that can not be marshaled are written as fmt.Sprint.
+func writeJSONValue(b *bytes.Buffer, v interface{}) {
+	switch x := v.(type) {
+	case error:
+		v = x.Error()
+	case time.Duration:
+		v = x.String()
+	}
+
+	j, err := json.Marshal(v)
+	if err != nil {
+		j, _ = json.Marshal(fmt.Sprint(v))
+	}
+	b.Write(j)
+}
+
+// stdLogWriter writes the messages of the standard logger as JSON in error level.
+type stdLogWriter struct{}
+
+func (stdLogWriter) Write(p []byte) (int, error) {
+	logger.output(LevelError, strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
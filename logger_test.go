@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestParseLevel(t *testing.T) {
+	for i, name := range levelNames {
+		l, err := ParseLevel(name)
+		if err != nil {
+			t.Errorf("failed to parse %s: %s", name, err)
+		} else if l != Level(i) || l.String() != name {
+			t.Errorf("expected %s but got %s", name, l)
+		}
+	}
+
+	if _, err := ParseLevel("debug"); err == nil {
+		t.Errorf("expected error but got nil")
+	}
+}
+
+func TestWriteJSONValue(t *testing.T) {
+	tests := []struct {
+		Name   string
+		Input  interface{}
+		Output string
+	}{
+		{"string", "hello\n", `"hello\n"`},
+		{"int", 10, `10`},
+		{"error", errors.New("oops"), `"oops"`},
+		{"duration", 1500 * time.Millisecond, `"1.5s"`},
+		{"unsupported", make(chan int), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			var b bytes.Buffer
+			writeJSONValue(&b, tt.Input)
+			if tt.Output == "" {
+				// The channel is written as its address, so only check that it is a string.
+				if s := b.String(); len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+					t.Errorf("expected a string but got %s", s)
+				}
+			} else if b.String() != tt.Output {
+				t.Errorf("expected %s but got %s", tt.Output, b.String())
+			}
+		})
+	}
+}
+
+func TestLogger_level(t *testing.T) {
+	var buf bytes.Buffer
+	origLog, origLevel := textLog, logLevel
+	textLog = log.New(&buf, "", 0)
+	logLevel = LevelWarn
+	defer func() { textLog, logLevel = origLog, origLevel }()
+
+	l := logger.With("input", "a.csv")
+	l.Infof("hidden")
+	l.Warnf("warn %d", 1)
+	l.Errorf("error %d", 2)
+
+	if want := "warn 1\nerror 2\n"; buf.String() != want {
+		t.Errorf("expected %q but got %q", want, buf.String())
+	}
+}
+
+func TestLogger_With(t *testing.T) {
+	base := logger.With("input", "a.csv")
+	a := base.With("row", 1)
+	b := base.With("row", 2)
+
+	if len(base.fields) != 2 {
+		t.Errorf("expected the base fields are not modified but got %v", base.fields)
+	}
+	if a.fields[3] != 1 || b.fields[3] != 2 {
+		t.Errorf("expected the fields are not shared but got %v and %v", a.fields, b.fields)
+	}
+}
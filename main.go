@@ -1,29 +1,188 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"crypto/md5"
 	"encoding/csv"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"io/fs"
-	"log"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/dsnet/compress/bzip2"
-	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
 )
 
 var (
 	version = "0.2.1"
 
-	dateFormat = flag.String("date-format", "20060102", "Date format of the first column. See also https://pkg.go.dev/time#pkg-constants")
-	outputDir  = flag.String("out-dir", "chopped", "The output directory.")
-	utf8Mode   = flag.Bool("utf8", false, "Enable UTF-8 decoding. In default, decode as Shift-JIS.")
+	timezoneName    = flag.String("timezone", "", "Timezone to interpret timestamps and to decide partitions, such as Asia/Tokyo. In default, use UTC if the timestamp has no zone.")
+	dateParserSpec  = flag.String("date-parser", "", `Parse the first column with an external command like "exec:./parse" instead of -date-format. The command reads a value per line from stdin, and writes a timestamp in RFC3339 or an empty line for invalid value into stdout.`)
+	sinceTime       = flag.String("since", "", "Write only rows whose timestamp is equal or after this time, like 2023-04-01 or 2023-04-01T09:00:00+09:00.")
+	untilTime       = flag.String("until", "", "Write only rows whose timestamp is before this time. The same formats as -since are available.")
+	outputDir       = flag.String("out-dir", "chopped", "The output directory.")
+	granularity     = flag.String("granularity", "day", "The unit of partitions: year, month, day, or hour.")
+	layoutStyle     = flag.String("layout", "hive", `The style of partition directories: hive (like "year=2023/month=4/day=1") or plain (like "2023/04/01").`)
+	padPartitions   = flag.Bool("pad-partitions", false, `Zero-pad the month, day, and hour of Hive style partitions, like "year=2023/month=04/day=01", so that they are sorted in the order of time.`)
+	outputFormat    = flag.String("format", "csv", "Format of output files: csv (bzip2 compressed CSV), parquet (Snappy compressed Parquet), sqlite (SQLite database), or duckdb (a table in -out-db).")
+	compressLevel   = flag.Int("compression-level", 0, "Compression level of bzip2 for -format=csv, from 1 (fastest) to 9 (smallest). 0 means 9. The level is the block size by 100KB. With -zstd-dict, it is the level of zstd from 1 (fastest) to 22 (smallest), and 0 means 3. Snappy of Parquet has no level.")
+	zstdDict        = flag.Bool("zstd-dict", false, `Compress -format=csv files by zstd with a dictionary trained from the first rows of the inputs, instead of bzip2. It makes small files much smaller. The dictionary is written as "_zstd.dict" in -out-dir and reused in the next runs. The files can be decompressed by "zstd -d -D _zstd.dict".`)
+	zstdDictRows    = flag.Int("zstd-dict-rows", 10000, "The number of rows to sample from the inputs to train the dictionary of -zstd-dict.")
+	parquetSchemaS  = flag.String("parquet-schema", "", `Types of columns in Parquet output, like "price:double,count:int64", or a JSON file of -emit-schema. Available types are string, int64, double, and boolean. The other columns are written as string.`)
+	outputDB        = flag.String("out-db", "chopped.duckdb", "DuckDB database file to write for -format=duckdb. The rows are appended into -duckdb-table with year, month, and day columns.")
+	duckdbTable     = flag.String("duckdb-table", "chopped", "Table name of -format=duckdb. The table is created if not exists.")
+	duckdbCLI       = flag.String("duckdb-cli", "duckdb", "DuckDB CLI command to load the rows into -out-db for -format=duckdb.")
+	sqliteTable     = flag.String("sqlite-table", "", "Table name of SQLite output. The default is the input file name without extension.")
+	teeOutputDir    = flag.String("tee-out-dir", "", "Write the same output into this directory as well as -out-dir.")
+	waitLock        = flag.Duration("wait-lock", 0, "Wait up to this duration if another chop-csv is writing into the same output directory. 0 means to exit with an error immediately.")
+	noLock          = flag.Bool("no-lock", false, "Do not lock the output directory. Use this only if the other runs that write into the same directory never write the same files.")
+	keepGoing       = flag.Bool("keep-going", false, "Continue with the other files if an input file could not be chopped, like an invalid CSV or a missing file. The failed files are reported at the end, and the exit code is of the first failed file.")
+	outputRetries   = flag.Int("retries", 3, "The number of retries for the failed operations to write output files, like network filesystem errors or Sink API errors.")
+	retryBackoff    = flag.Duration("retry-backoff", time.Second, "The wait before the first retry of -retries. It doubles for each retry, up to 1 minute.")
+	fsyncOutput     = flag.Bool("fsync", false, "Call fsync for each output file and its directory when renaming it into place, so that the file survives power loss.")
+	windowsSafe     = flag.Bool("windows-safe-names", runtime.GOOS == "windows", "Escape the characters that can not be used in file names on Windows, such as \"<\" and \"|\", in the partition directories. Enabled in default on Windows.")
+	reproducible    = flag.Bool("deterministic", false, "Make byte-identical output for identical input and options on any environment. The output file names are made from the input paths as given instead of the absolute paths, and the timestamps in the metadata are fixed to $SOURCE_DATE_EPOCH or the UNIX epoch.")
+	s3Concurrency   = flag.Int("s3-concurrency", 4, "The number of parts to upload in parallel when -out-dir or -tee-out-dir is s3://, gs://, or az:// URL.")
+	encodingName    = flag.String("encoding", "sjis", "Character encoding of input files. For example: sjis, eucjp, utf8, utf16le, utf16be, or any name in https://encoding.spec.whatwg.org/#names-and-labels")
+	outputEncode    = flag.String("output-encoding", "utf8", "Character encoding of output files. The same names as -encoding are available.")
+	rfc4180         = flag.Bool("rfc4180", false, "Write strictly RFC 4180 compliant CSV: use CRLF as the line terminator, and convert all line breaks in fields into CRLF.")
+	quotePolicy     = flag.String("quote", "minimal", "Quoting policy of output CSV: minimal (quote only fields that need quotes), all (quote all fields), or non-numeric (quote all fields except numbers).")
+	utf8Mode        = flag.Bool("utf8", false, "Same as -encoding=utf8. (deprecated)")
+	gaijiMapPath    = flag.String("gaiji-map", "", `CSV file of the mapping table to replace vendor-specific characters (gaiji). Each row is like "U+E000,髙" or "F040,髙" (hex bytes in -encoding).`)
+	onEmpty         = flag.String("on-empty", "warn", "What to do when an input file has no rows: warn, ignore, or error.")
+	decodeError     = flag.String("on-decode-error", "replace", "What to do when found invalid characters in input: fail, replace, or skip-row.")
+	maxRows         = flag.Int("max-rows", 0, "Stop reading each input file after this number of rows, to try the options on a part of large files. 0 means unlimited.")
+	maxTotalRows    = flag.Int64("max-total-rows", 0, "Stop reading input files after this number of rows in total. 0 means unlimited.")
+	maxPartitions   = flag.Int("max-partitions", 0, "Warn if this run writes into more than this number of partitions, that is usually caused by wrong -date-format. 0 means unlimited.")
+	strictMode      = flag.Bool("strict", false, "Stop the program instead of warning, when exceeded -max-partitions.")
+	skipLines       = flag.Int("skip-lines", 0, "Skip this number of lines at the beginning of each input file, like a preamble before the header. The lines are skipped before parsed as CSV.")
+	commentChar     = flag.String("comment", "", `Ignore the lines that start with this character, like "#".`)
+	onRagged        = flag.String("on-ragged", "fail", "What to do when a row has a different number of columns from the header or the first row: fail, pad (fill missing columns with empty and drop extra columns), truncate (drop extra columns), or skip.")
+	hasHeader       = flag.Bool("header", false, "Treat the first row of each input file as a header. The header is not written into output files.")
+	schemaEvolution = flag.String("schema-evolution", "none", "What to do when the header of an input file is different from the first file: none, align (reorder columns by name, fill missing columns with empty, and ignore extra columns), or error. Requires -header.")
+	columnsS        = flag.String("columns", "", `Write only these columns in this order, like "1,3,5". Column names are also available with -header.`)
+	cleanColumnsS   = flag.String("clean-columns", "", `Remove padding spaces and surrounding quotes from these columns, like "1,3,5" or "all".`)
+	normalizeName   = flag.String("normalize", "", `Normalize the timestamp column by Unicode normalization before parsing: nfc or nfkc. "nfkc" converts full-width digits into ASCII, for example.`)
+	trimFields      = flag.Bool("trim", false, "Trim the spaces around the timestamp column before parsing, including full-width spaces and CR.")
+	normalizeAll    = flag.Bool("normalize-all", false, "Apply -normalize and -trim to all columns, not only the timestamp column.")
+	decimalSep      = flag.String("decimal-separator", ".", "Decimal separator of numbers in -filter, such as \",\" for European numbers like 1.234,56.")
+	thousandsSep    = flag.String("thousands-separator", ",", "Thousands separator of numbers in -filter. Empty means no separator.")
+	maskColumnsS    = flag.String("mask-columns", "", `Mask these columns before writing, like "2:sha256,5:redact". "sha256" replaces the value with its SHA-256 hash, and "redact" replaces with empty.`)
+	maskKeyS        = flag.String("mask-key", "", "Secret key for sha256 masking. If specified, HMAC-SHA256 is used instead of plain SHA-256, so the hash can not be reversed by brute force. (also available as $CHOPCSV_MASK_KEY)")
+	indexInterval   = flag.Int("index-interval", 0, "Write a seek index file (.idx) next to each output file, with an entry every this number of rows. 0 means disabled.")
+	maxFieldSize    = flag.Int64("max-field-size", 0, "Do not read fields larger than this size in bytes into memory. What to do with the rows is decided by -on-oversize. 0 means unlimited.")
+	maxRecordBytes  = flag.Int64("max-record-bytes", 0, "Do not read rows larger than this size in bytes into memory. What to do with the rows is decided by -on-oversize. 0 means unlimited.")
+	onOversize      = flag.String("on-oversize", "fail", "What to do when a row exceeds -max-field-size or -max-record-bytes: fail, skip, or truncate (cut the fields to -max-field-size, and skip the rows larger than -max-record-bytes).")
+	maxRowSize      = flag.Int("max-row-size", 0, "Divert rows larger than this size in bytes into the overflow directory, and leave a stub row that refers to it. 0 means unlimited.")
+	successMarkers  = flag.String("success-markers", "", `Write _SUCCESS marker files when finished. "partition" for each written partition, "run" for the output directory, or "partition,run" for both.`)
+	manifestPath    = flag.String("manifest", "", "Write the list of output files with the size, SHA-256, the number of rows, and the inputs into this file. The format is CSV if the name ends with .csv, otherwise JSON.")
+	partitionMeta   = flag.Bool("partition-metadata", false, "Write _metadata.json into each written partition, with the number of rows, the oldest and the newest timestamp, the input files, and the SHA-256 of the files.")
+	bundlePath      = flag.String("bundle", "", "Write a tar file that includes the output files of this run, the manifest, the checksums, and the verification script, to transfer into an air-gapped environment.")
+	outputTar       = flag.String("out-tar", "", `Write the whole partition tree into this tar file instead of -out-dir. It is compressed by gzip if the name ends with ".tar.gz" or ".tgz". The files are written into a temporary directory until finished.`)
+	emitSchema      = flag.String("emit-schema", "", "Infer the type (int, float, date, or string) and the nullability of each column from the rows that written, and write them into this JSON file. The file can be passed to -parquet-schema.")
+	schemaPath      = flag.String("schema", "", "Check the types and the required values of each row against this JSON file in the format of -emit-schema. The invalid rows are not written.")
+	rejectPath      = flag.String("reject-file", "", "Write the rows that rejected by -schema into this CSV file, with the reason, the input file, and the line number.")
+	statsCSV        = flag.String("stats-csv", "", "Append statistics of the run into this CSV file, for capacity planning.")
+	followPath      = flag.String("follow", "", "Keep chopping rows appended to this file like `tail -F`, instead of chopping FILE arguments.")
+	flushInterval   = flag.Duration("flush-interval", 10*time.Second, "The interval to flush output files in -follow mode and -listen mode.")
+	watchDir        = flag.String("watch", "", "Keep chopping new or updated CSV files in this directory, instead of chopping FILE arguments. A file is chopped after its size and modification time are unchanged for -watch-interval.")
+	watchInterval   = flag.Duration("watch-interval", 10*time.Second, "The interval to scan the directory in -watch mode.")
+	maxOpenFiles    = flag.Int("max-open-files", 8, "Keep up to this number of output files open for each input file, so that the rows not sorted by the timestamp are written without reopening the files. The least recently written file is closed when more files are needed.")
+	listenAddr      = flag.String("listen", "", `Keep chopping CSV lines that sent into this TCP or unix socket, like ":9000" or "unix:///run/chop-csv.sock", instead of chopping FILE arguments.`)
+	rotateInterval  = flag.Duration("rotate-interval", time.Hour, "The interval to complete the output files and start new ones in -listen mode.")
+	historyPath     = flag.String("history", "", "Record the history of runs into this file as JSON Lines. The history can be shown by status subcommand.")
+	historyLimit    = flag.Int("history-limit", 100, "The number of runs to keep in -history file.")
+	sinceLastRun    = flag.Bool("since-last-run", false, "Chop only the files that modified after the last successful run with the same inputs in -history.")
+	statePath       = flag.String("state", "", "Record the size, the modification time, and the SHA-256 of the chopped input files into this JSON file, and skip the unchanged files in the next run.")
+	checkpointPath  = flag.String("checkpoint", "", "Save the progress into this file periodically, to resume the interrupted run with -resume. The file is removed when the run finished.")
+	checkpointRows  = flag.Int("checkpoint-interval", 1000000, "The number of rows of an input file between checkpoints.")
+	resumeRun       = flag.Bool("resume", false, "Resume the interrupted run from -checkpoint. The FILE arguments must be the same as the interrupted run.")
+	hookCommand     = flag.String("on-partition-complete", "", `Run this command after each output file is finished, like "upload {path}". The "{path}" is replaced with the path of the file. (also available as $CHOPCSV_PATH)`)
+	quietLog        = flag.Bool("q", false, `Do not log "write to ..." for each output file.`)
+	verboseLog      = flag.Bool("v", false, "Log each row that ignored because of invalid timestamp or character. In default, only the number of ignored rows is logged for each input file.")
+	logFormat       = flag.String("log-format", "text", "The format of log messages: text, or json that has the fields like the input file and the partition.")
+	logLevelName    = flag.String("log-level", "info", "The minimum level of log messages to write: info, warn, or error.")
+	metricsListen   = flag.String("metrics", "", `Serve Prometheus metrics on /metrics of this address, like ":9100". It is useful to monitor -watch and -follow mode.`)
+	cpuProfilePath  = flag.String("cpuprofile", "", "Write CPU profile into this file.")
+	memProfilePath  = flag.String("memprofile", "", "Write memory profile into this file when finished.")
+	tracePath       = flag.String("trace", "", "Write execution trace into this file.")
+	pprofListen     = flag.String("pprof", "", `Serve the profiles of net/http/pprof on this address, like "localhost:6060". It is useful to diagnose -watch and -follow mode.`)
+	readBuffer      = flag.Int("read-buffer", 256*1024, "The size in bytes of the buffer to read each input file.")
+	writeBuffer     = flag.Int("write-buffer", 256*1024, "The size in bytes of the buffer to write each output file.")
+	inputJobs       = flag.Int("jobs", 1, "The number of input files to chop in parallel.")
+	hookJobs        = flag.Int("hook-jobs", 1, "The maximum number of -on-partition-complete commands to run at once.")
+	notifyURL       = flag.String("notify-url", "", "POST the result of the run as JSON into this URL at the end of the run, including failures and interruptions.")
+	notifyCommand   = flag.String("notify-command", "", "Run this command at the end of the run with the result as JSON in stdin, including failures and interruptions. The status and the exit code are also available as $CHOPCSV_STATUS and $CHOPCSV_EXIT_CODE.")
+	notifyTimeout   = flag.Duration("notify-timeout", 30*time.Second, "The timeout of -notify-url and -notify-command.")
+	dbtManifest     = flag.String("dbt-manifest", "", "Write dbt sources manifest for dbt-external-tables into this file after chopped.")
+	dbtSource       = flag.String("dbt-source", "chopped", "The source name in the dbt manifest.")
+	dbtTable        = flag.String("dbt-table", "chopped", "The table name in the dbt manifest.")
+	dbtLocation     = flag.String("dbt-location", "", "The location in the dbt manifest, such as s3://bucket/prefix. In default, the absolute path of -out-dir.")
+	glueTable       = flag.String("glue-table", "", `Register the written partitions into this table of AWS Glue Data Catalog, like "db.table". The credentials and the region are read from the environment variables like AWS CLI.`)
+	fixedNow        = flag.String("now", "", "Use this time (RFC3339) as the current time instead of the system clock. It is useful for replaying a past run.")
+	configPath      = flag.String("config", "", "Read the options from this YAML file, like chop-csv.yaml. The options are also read from the environment variables like CHOPCSV_OUT_DIR for -out-dir. The commandline flags take precedence over the environment variables, and the environment variables take precedence over the file.")
+	followSymlinks  = flag.Bool("follow-symlinks", false, "Follow symbolic links in the input directories. The directories that already searched are skipped, to avoid loops.")
+	maxDepth        = flag.Int("max-depth", 0, "The maximum depth of directories to search in the input directories. 1 means only the files directly in the input directory. 0 means unlimited.")
+	dirModeS        = flag.String("dir-mode", "", `The permission of the directories that made in the output directory, in octal like "2775". It is set regardless of umask. In default, 0755 masked by umask.`)
+	fileModeS       = flag.String("file-mode", "", `The permission of the files that written in the output directory, in octal like "664". It is set regardless of umask. In default, 0666 masked by umask.`)
+	stampMtime      = flag.String("stamp-mtime", "", `Set the modification time of the output files: "partition" for the start of the partition, or "latest-row" for the latest timestamp of the rows in the file. It is useful for the sync tools that copy the files modified after the last sync.`)
+	nameScheme      = flag.String("name-scheme", "input-hash", "How to name the output files: input-hash (the MD5 of the absolute path of the input file), or content-hash (the SHA-256 of the content of the output file). content-hash is available only for local -out-dir.")
+	onExist         = flag.String("on-exist", "overwrite", "What to do when an output file already made by a previous run: overwrite, append (write the rows as a new compressed stream after the existing data), or fail. append is available only for local -out-dir.")
+	archiveDir      = flag.String("archive-dir", "", "Move each input file into this directory after chopped completely. The directory is not searched as an input.")
+	deleteInput     = flag.Bool("delete-input", false, "Remove each input file after chopped completely.")
+	dedupeRows      = flag.Bool("dedupe", false, "Drop the rows that are the same as a row already written into the same partition in this run, even if they are in different input files.")
+	dedupeKeyS      = flag.String("dedupe-key", "", `Compare only these columns for -dedupe, like "1,3" or "id". Column names are also available with -header. Implies -dedupe.`)
+	maxRowsPerFile  = flag.Int64("max-rows-per-file", 0, `Split the file of each partition into parts like "name.part-00000.csv.bz2" when it has this number of rows. 0 means unlimited.`)
+	maxFileSize     = flag.Int64("max-file-size", 0, `Split the file of each partition into parts like "name.part-00000.csv.bz2" when it reached about this size in bytes. The size is checked after compressed, so the file can be a bit larger than this. 0 means unlimited.`)
+
+	inputEncoding  encoding.Encoding
+	outputEncoding encoding.Encoding
 )
 
+func init() {
+	flag.Func("filter", `Write only rows that satisfy this condition, like "3>=1000" (3rd column is equal or greater than 1000). Available operators are ==, !=, >=, <=, >, and <. Can be specified multiple times.`, func(s string) error {
+		f, err := ParseFilter(s)
+		if err != nil {
+			return err
+		}
+		filters = append(filters, f)
+		return nil
+	})
+	flag.Var(&dateFormats, "date-format", `Date format of the first column. "unix" and "unixmilli" are available for epoch seconds and milliseconds. Can be specified multiple times to try each format in order. (default "`+defaultDateFormat+`") See also https://pkg.go.dev/time#pkg-constants`)
+	flag.Func("include", `Chop only the files that match this pattern in the input directories, like "**/*.csv". The pattern is matched with the path from the input directory, and "**" matches any number of directories. Can be specified multiple times. In default, the files that have -extensions are chopped.`, func(s string) error {
+		if err := validateGlob(s); err != nil {
+			return err
+		}
+		return includePatterns.Set(s)
+	})
+	flag.Func("extensions", `Chop the files that have these extensions in the input directories, like ".csv,.txt". The extensions are matched ignoring case, so ".csv" matches DATA.CSV too. Ignored if -include specified. (default ".csv")`, func(s string) error {
+		exts, err := parseExtensions(s)
+		if err != nil {
+			return err
+		}
+		inputExtensions = exts
+		return nil
+	})
+	flag.Func("exclude", `Skip the files and directories that match this pattern in the input directories, like "**/backup/**". The syntax is the same as -include. Can be specified multiple times.`, func(s string) error {
+		if err := validateGlob(s); err != nil {
+			return err
+		}
+		return excludePatterns.Set(s)
+	})
+}
+
 func md5sum(s string) string {
 	return fmt.Sprintf("%x", md5.Sum([]byte(s)))
 }
@@ -32,27 +191,172 @@ func md5sum(s string) string {
 //
 // WARNING: this struct reads commandline flags directly.
 type Writer struct {
-	f *os.File
-	b *bzip2.Writer
-	c *csv.Writer
+	fs []outputFile
+	w  *bufio.Writer // buffers the compressed data to fs
+	n  *countWriter  // counts the compressed data written into fs
+	b  streamCompressor
+	p  *asyncWriter // compresses in another goroutine
+	e  *transform.Writer
+	c  *CSVWriter
+
+	rows       int64 // the number of rows in the file
+	streamRows int64 // the number of rows in the current bzip2 stream
+	offset     int64 // the size of finished bzip2 streams
+	base       int64 // the size of the file when opened
+	finished   bool  // true if the current bzip2 stream is finished
+	index      []IndexEntry
 }
 
-func Create(path string) (*Writer, error) {
-	f, err := os.Create(path)
+// writtenIndexes is the seek indexes that written in this run, to append into the files that not uploaded yet.
+var writtenIndexes = map[string][]IndexEntry{}
+
+// Create creates a new Writer.
+// If passed multiple paths, the Writer writes the same content into all of them.
+func Create(paths ...string) (*Writer, error) {
+	w, err := openWriter(false, paths)
 	if err != nil {
 		return nil, err
 	}
 
-	b, err := bzip2.NewWriter(f, &bzip2.WriterConfig{
-		Level: bzip2.BestCompression,
-	})
+	if *indexInterval > 0 {
+		w.index = []IndexEntry{{Row: 0, Offset: 0}}
+	}
+
+	return w, nil
+}
+
+// Append opens Writer to append into existing files.
+// The appended rows are written as a new bzip2 stream, so the file is still a valid bzip2 file.
+func Append(paths ...string) (*Writer, error) {
+	w, err := openWriter(true, paths)
+	if err != nil {
+		return nil, err
+	}
+
+	w.offset, err = w.fs[0].Size()
+	if err != nil {
+		w.Close()
+		return nil, err
+	}
+	w.base = w.offset
+
+	if *indexInterval > 0 {
+		// The last entry of the existing index points the end of the file.
+		index, ok := writtenIndexes[w.fs[0].Name()]
+		if !ok {
+			index, err = ReadIndex(localOutputPath(w.fs[0].Name() + ".idx"))
+		}
+		if err != nil {
+			logger.With("file", w.fs[0].Name(), "error", err).Warnf("failed to read seek index, so stop updating it: %s", err)
+		} else if len(index) > 0 && index[len(index)-1].Offset == w.offset {
+			w.index = append([]IndexEntry{}, index...)
+			w.rows = index[len(index)-1].Row
+		} else {
+			logger.With("file", w.fs[0].Name()).Warnf("seek index of %s is outdated, so stop updating it", w.fs[0].Name())
+		}
+	}
+
+	return w, nil
+}
+
+// bzip2Level returns the compression level of bzip2 by -compression-level.
+//
+// WARNING: this function reads commandline flags directly.
+func bzip2Level() int {
+	if *compressLevel == 0 {
+		return bzip2.BestCompression
+	}
+	return *compressLevel
+}
+
+func openWriter(appending bool, paths []string) (*Writer, error) {
+	fs := make([]outputFile, 0, len(paths))
+	ws := make([]io.Writer, 0, len(paths))
+	for _, path := range paths {
+		f, err := openOutput(path, appending)
+		if err != nil {
+			for _, f := range fs {
+				f.Close()
+			}
+			return nil, err
+		}
+		fs = append(fs, f)
+		ws = append(ws, f)
+	}
+	n := &countWriter{w: io.MultiWriter(ws...)}
+	w := bufio.NewWriterSize(n, *writeBuffer)
+
+	b, err := newCompressor(w)
 	if err != nil {
+		for _, f := range fs {
+			f.Close()
+		}
 		return nil, err
 	}
 
-	c := csv.NewWriter(b)
+	cw := &Writer{fs: fs, w: w, n: n, b: b, p: newAsyncWriter(b)}
+	cw.setupEncoder()
+	return cw, nil
+}
+
+func (w *Writer) setupEncoder() {
+	var enc transform.Transformer = transform.Nop
+	if outputEncoding != unicode.UTF8 {
+		enc = outputEncoding.NewEncoder()
+	}
+	w.e = transform.NewWriter(w.p, enc)
+	w.c = NewOutputCSVWriter(w.e)
+}
+
+// finishStream closes the current bzip2 stream.
+func (w *Writer) finishStream() error {
+	w.c.Flush()
+	err := w.c.Error()
+	if e := w.e.Close(); err == nil {
+		err = e
+	}
+	if e := w.p.Flush(); err == nil {
+		err = e
+	}
+	if e := w.b.Close(); err == nil {
+		err = e
+	}
+	if e := w.w.Flush(); err == nil {
+		err = e
+	}
+	w.offset = w.base + w.n.Count()
+	return err
+}
+
+// nextStream finishes the current bzip2 stream.
+// The next stream will be started when the next row is written.
+func (w *Writer) nextStream() error {
+	w.finished = true
+	return w.finishStream()
+}
+
+// startStream starts a new bzip2 stream after the finished stream.
+// bzip2 can concatenate streams, so the output is still a valid bzip2 file.
+func (w *Writer) startStream() error {
+	if err := w.b.Reset(w.w); err != nil {
+		return err
+	}
+	w.setupEncoder()
+
+	w.finished = false
+	w.streamRows = 0
+	if w.index != nil {
+		w.index = append(w.index, IndexEntry{Row: w.rows, Offset: w.offset})
+	}
+	return nil
+}
 
-	return &Writer{f, b, c}, nil
+// Flush writes out all rows that written so far into the file, by finishing the current bzip2 stream.
+func (w *Writer) Flush() error {
+	if w == nil || w.finished || w.streamRows == 0 {
+		return nil
+	}
+	return w.nextStream()
 }
 
 func (w *Writer) Close() error {
@@ -60,14 +364,48 @@ func (w *Writer) Close() error {
 		return nil
 	}
 
-	w.c.Flush()
-	if err := w.b.Close(); err != nil {
-		return err
+	var err error
+	if !w.finished {
+		err = w.finishStream()
+	}
+	if e := w.p.Close(); err == nil {
+		err = e
+	}
+	if err == nil && w.index != nil {
+		index := append(w.index, IndexEntry{Row: w.rows, Offset: w.offset})
+		writtenIndexes[w.fs[0].Name()] = index
+		for _, f := range w.fs {
+			path := f.Name() + ".idx"
+			if pendingFiles[f.Name()] {
+				// The index is renamed into place together with the file.
+				pendingFiles[path] = true
+			}
+			if err = WriteIndex(localOutputPath(path), index); err != nil {
+				break
+			}
+		}
+	}
+	for _, f := range w.fs {
+		if e := f.Close(); err == nil {
+			err = e
+		}
 	}
-	return w.f.Close()
+	return err
 }
 
 func (w *Writer) Write(record []string) error {
+	if w.index != nil && w.streamRows >= int64(*indexInterval) {
+		if err := w.nextStream(); err != nil {
+			return err
+		}
+	}
+	if w.finished {
+		if err := w.startStream(); err != nil {
+			return err
+		}
+	}
+	w.rows++
+	w.streamRows++
 	return w.c.Write(record)
 }
 
@@ -75,146 +413,1484 @@ func (w *Writer) Name() string {
 	if w == nil {
 		return ""
 	}
-	return w.f.Name()
+	return w.fs[0].Name()
+}
+
+// Size returns the size of the file, excluding the current bzip2 stream that not finished yet.
+func (w *Writer) Size() int64 {
+	if w == nil {
+		return 0
+	}
+	return w.offset
+}
+
+// Written returns the approximate size of the file, including the current bzip2 stream that written so far.
+// The data still in the buffers of bzip2 and -write-buffer is not counted.
+func (w *Writer) Written() int64 {
+	if w == nil {
+		return 0
+	}
+	return w.base + w.n.Count()
 }
 
 // Reader is a CSV reader.
 //
 // WARNING: this struct reads commandline flags directly.
 type Reader struct {
-	f *os.File
-	c *csv.Reader
+	f     io.Closer
+	c     *csv.Reader
+	limit *sizeLimiter // nil if -max-field-size and -max-record-bytes are not set
+	size  int64        // the size of the input file, or -1 if unknown
+	read  *byteCounter // counts the read bytes if the size is unknown, or nil
 }
 
+// Open opens the input file, that can be a local file or a URL like https://host/path or s3://bucket/key.
 func Open(path string) (*Reader, error) {
-	f, err := os.Open(path)
+	f, size, err := openInput(path)
 	if err != nil {
 		return nil, err
 	}
+	if size >= 0 {
+		r := NewReader(f)
+		r.size = size
+		return r, nil
+	}
+	c := &countingReadCloser{byteCounter{r: f}, f}
+	r := NewReader(c)
+	r.size = size
+	r.read = &c.byteCounter
+	return r, nil
+}
+
+// NewReader makes a new Reader that reads from f.
+func NewReader(f io.ReadCloser) *Reader {
+	var dec transform.Transformer = transform.Nop
+	if inputEncoding != unicode.UTF8 {
+		dec = inputEncoding.NewDecoder()
+	}
+	// BOMOverride strips BOM, and uses UTF-8 or UTF-16 instead of dec if BOM found.
+	var r io.Reader = transform.NewReader(bufio.NewReaderSize(f, *readBuffer), unicode.BOMOverride(dec))
+	if *skipLines > 0 {
+		r = &lineSkipper{r: bufio.NewReader(r), n: *skipLines}
+	}
+
+	var limit *sizeLimiter
+	if *maxFieldSize > 0 || *maxRecordBytes > 0 {
+		limit = newSizeLimiter(r, *maxFieldSize, *maxRecordBytes, *onOversize == "truncate", *commentChar)
+		r = limit
+	}
 
-	var r io.Reader = f
-	if !*utf8Mode {
-		r = japanese.ShiftJIS.NewDecoder().Reader(f)
+	c := csv.NewReader(r)
+	c.ReuseRecord = true
+	if *commentChar != "" {
+		c.Comment = []rune(*commentChar)[0]
 	}
+	if *onRagged != "fail" {
+		// The number of columns is checked by chop instead.
+		c.FieldsPerRecord = -1
+	}
+
+	// Quotes in the middle of a field are garbage that should be removed by CleanField.
+	c.LazyQuotes = !cleanColumns.Empty()
+
+	return &Reader{f: f, c: c, limit: limit, size: -1}
+}
 
-	return &Reader{f, csv.NewReader(r)}, nil
+// lineSkipper is an io.Reader that skips the first n lines of r, for -skip-lines.
+type lineSkipper struct {
+	r *bufio.Reader
+	n int
+}
+
+func (s *lineSkipper) Read(p []byte) (int, error) {
+	for s.n > 0 {
+		_, err := s.r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+		s.n--
+	}
+	return s.r.Read(p)
 }
 
 func (r *Reader) Close() {
 	r.f.Close()
 }
 
-func (r *Reader) Read() ([]string, error) {
-	return r.c.Read()
+// Next reads the next record. Reader implements RecordSource.
+// The returned record is reused by the next call.
+//
+// The records larger than -max-field-size or -max-record-bytes are handled here by -on-oversize, and counted into summary.
+func (r *Reader) Next() ([]string, error) {
+	for {
+		row, err := r.c.Read()
+		if err != nil || r.limit == nil {
+			return row, err
+		}
+
+		line, _ := r.c.FieldPos(0)
+		o, ok := r.limit.Oversized(line)
+		if !ok {
+			return row, nil
+		}
+		if *onOversize == "fail" {
+			return nil, &csv.ParseError{StartLine: line, Line: line, Err: o.Err}
+		}
+
+		addSummary(&Summary{OversizeRows: 1})
+		if *onOversize == "truncate" && o.Err == errFieldTooLarge {
+			if *verboseLog {
+				logger.With("line", line+*skipLines).Warnf("truncate fields in row at line %d: %s", line+*skipLines, o.Err)
+			}
+			return row, nil
+		}
+		if *verboseLog {
+			logger.With("line", line+*skipLines).Warnf("skip row at line %d: %s", line+*skipLines, o.Err)
+		}
+	}
+}
+
+// outputName decides the name of output file from the input file path.
+func outputName(inputPath string) (string, error) {
+	abs := inputPath
+	if deterministic && !isInputURL(inputPath) {
+		// The absolute path is different on each environment.
+		abs = filepath.ToSlash(filepath.Clean(inputPath))
+	} else if !isInputURL(inputPath) {
+		var err error
+		abs, err = filepath.Abs(inputPath)
+		if err != nil {
+			return "", err
+		}
+	}
+	switch *outputFormat {
+	case "parquet", "duckdb":
+		return fmt.Sprintf("%s.parquet", md5sum(abs)), nil
+	case "sqlite":
+		return fmt.Sprintf("%s.sqlite", md5sum(abs)), nil
+	}
+	return md5sum(abs) + csvExtension(), nil
+}
+
+// fileStem returns the file name without directory and extension.
+func fileStem(path string) string {
+	name := filepath.Base(path)
+	return strings.TrimSuffix(name, filepath.Ext(name))
 }
 
-// Chop chops input file.
+// Chop chops input file, and reports whether the file was chopped completely.
+// If the file is not readable because of permission, it is recorded in summary and skipped.
+// If the file could not be chopped, the program stops, or the file is recorded in summary and skipped with -keep-going.
+// If ctx is canceled, Chop stops chopping and returns false.
 //
 // WARNING: this method can stop program with log.Fatal.
-func Chop(inputPath string) {
-	log.Printf("open input file: %s", inputPath)
+func Chop(ctx context.Context, inputPath string) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if checkpoint.Done(inputPath) {
+		logger.With("input", inputPath).Infof("skip input file that chopped before interrupted: %s", inputPath)
+		return true
+	}
+	if totalRowsReached() {
+		logger.With("input", inputPath).Infof("skip %s because -max-total-rows reached", inputPath)
+		return false
+	}
+
+	logger.With("input", inputPath).Infof("open input file: %s", inputPath)
 
 	r, err := Open(inputPath)
-	if err != nil {
-		log.Fatalf("failed to open file: %s", err)
+	if os.IsPermission(err) {
+		addUnreadable(err)
+		return false
+	} else if err != nil {
+		failInput(inputPath, inputErrorf(ExitInputError, "failed to open file: %w", err))
+		return false
 	}
 	defer r.Close()
 
-	abs, err := filepath.Abs(inputPath)
+	if r.size > 0 {
+		addSummary(&Summary{InputBytes: r.size})
+	}
+
+	startAt := SystemClock.Now()
+	complete, err := ChopSource(ctx, r, inputPath)
+	if r.read != nil {
+		addSummary(&Summary{InputBytes: r.read.n})
+	}
 	if err != nil {
-		log.Fatalf("failed to resolve input file path: %s", err)
+		failInput(inputPath, err)
+		return false
 	}
-	csvName := fmt.Sprintf("%s.csv.bz2", md5sum(abs))
+	if ctx.Err() == nil {
+		metrics.ObserveFile(SystemClock.Now().Sub(startAt))
+	}
+	return complete
+}
 
-	var w *Writer
+// stopChop closes the output files of the canceled input, and saves the checkpoint to resume from the next row.
+// The output files are not renamed into place, because they are incomplete.
+//
+// WARNING: this method can stop program with log.Fatal.
+func stopChop(inputPath string, read int, w, overflow *PartitionWriter, stats *Summary) {
+	if err := w.Close(); err != nil {
+		fatalf(ExitOutputError, "%s", err)
+	}
+	if overflow != nil {
+		if err := overflow.Close(); err != nil {
+			fatalf(ExitOutputError, "%s", err)
+		}
+	}
+	addSummary(stats)
+	if err := checkpoint.Save(inputPath, read, w, overflow); err != nil {
+		fatalf(ExitError, "failed to save checkpoint: %s", err)
+	}
+	logger.With("input", inputPath, "row", read).Infof("stop chopping %s at row %d", inputPath, read)
+}
 
-	for line := 0; ; line++ {
-		row, err := r.Read()
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			w.Close()
-			log.Fatal(err)
+// ChopLocal chops a local input file, unless it is not modified since -since-last-run or unchanged from -state.
+//
+// WARNING: this method can stop program with log.Fatal.
+func ChopLocal(ctx context.Context, path string, info fs.FileInfo) {
+	if isStreamInput(info) {
+		// A named pipe or a process substitution is always read, and can not be read again for -state or moved by -archive-dir.
+		Chop(ctx, path)
+		return
+	}
+	if !isModified(info.ModTime()) || inputState.Unchanged(path, info) {
+		addSummary(&Summary{SkippedFiles: 1})
+		return
+	}
+	if Chop(ctx, path) {
+		if err := inputState.Record(path, info); err != nil {
+			fatalf(ExitError, "failed to record state: %s", err)
 		}
+		if err := FinishInput(path); err != nil {
+			logger.With("input", path, "error", err).Warnf("%s", err)
+		}
+	}
+}
 
-		t, err := time.Parse(*dateFormat, row[0])
-		if err != nil {
-			log.Printf("ignore row %d because invalid timestamp: %s: %s", line+1, row[0], err)
-			continue
+// totalRows is the number of rows that read in this run, for -max-total-rows.
+// It is updated atomically, because the files are chopped in parallel by -jobs.
+var totalRows int64
+
+// totalRowsReached reports whether -max-total-rows rows were already read.
+//
+// WARNING: this function reads commandline flags directly.
+func totalRowsReached() bool {
+	return *maxTotalRows > 0 && atomic.LoadInt64(&totalRows) >= *maxTotalRows
+}
+
+// reserveRow counts a row to read for -max-total-rows, and reports whether the row can be read.
+//
+// WARNING: this function reads commandline flags directly.
+func reserveRow() bool {
+	if *maxTotalRows <= 0 {
+		return true
+	}
+	if atomic.AddInt64(&totalRows, 1) > *maxTotalRows {
+		atomic.AddInt64(&totalRows, -1)
+		return false
+	}
+	return true
+}
+
+// releaseRow cancels reserveRow when there was no row to read.
+//
+// WARNING: this function reads commandline flags directly.
+func releaseRow() {
+	if *maxTotalRows > 0 {
+		atomic.AddInt64(&totalRows, -1)
+	}
+}
+
+// chop reads all rows from r, and writes them into w.
+// It reports whether all rows were read, that is false if stopped by ctx, -max-rows, or -max-total-rows.
+// If the input is invalid, it discards the output files that not completed yet, and returns an InputError.
+//
+// The statistics are counted into stats, and added into summary when finished or checkpointed.
+// They are counted separately, so that the files can be chopped in parallel.
+//
+// WARNING: this method can stop program with log.Fatal.
+func chop(ctx context.Context, r RecordSource, inputPath string, w *PartitionWriter, stats *Summary) (bool, error) {
+	var err error
+	var overflow *PartitionWriter
+
+	stats.InputFiles++
+	if len(gaijiMap) > 0 && stats.ReplacedGaiji == nil {
+		stats.ReplacedGaiji = make(map[string]int)
+	}
+
+	empty := true
+	line := 0
+
+	fail := func(err error) (bool, error) {
+		w.Discard()
+		if overflow != nil {
+			overflow.Discard()
+		}
+		// The rows of the failed file are not written, so only the file is counted.
+		addSummary(&Summary{InputFiles: stats.InputFiles})
+		return false, err
+	}
+
+	var header []string
+	var alignment, projection, dedupeColumns []int
+	fields := -1 // the number of columns of the header or the first row, for -on-ragged
+	if *hasHeader {
+		header, err = r.Next()
+		if err != nil && err != io.EOF {
+			return fail(inputErrorf(ExitDecodeError, "%w", err))
 		}
+		header = append([]string(nil), header...) // keep it after reading the next record
+		if err == nil {
+			fields = len(header)
+		}
+		gaijiMap.Replace(header, stats.ReplacedGaiji)
+		ReplaceInvalidChars(header)
+		line++
 
-		fpath := filepath.Join(*outputDir, filepath.FromSlash(t.Format("year=2006/month=1/day=2")))
-		fname := filepath.Join(fpath, csvName)
-		if w.Name() != fname {
-			if w != nil {
-				w.Close()
+		if err == nil {
+			alignment, err = AlignHeader(inputPath, header)
+			if err != nil {
+				return fail(inputErrorf(ExitError, "%w", err))
 			}
+			if alignment != nil {
+				header = referenceHeader
+			}
+		}
 
-			log.Printf("write to %s", fname)
-			os.MkdirAll(fpath, 0755)
+		if len(outputColumns) > 0 && err == nil {
+			projection, err = outputColumns.Resolve(header)
+			if err != nil {
+				return fail(inputErrorf(ExitError, "%s: %w", inputPath, err))
+			}
+		}
 
-			w, err = Create(fname)
+		if len(dedupeKey) > 0 && err == nil {
+			dedupeColumns, err = dedupeKey.Resolve(header)
+			if err != nil {
+				return fail(inputErrorf(ExitError, "%s: %w", inputPath, err))
+			}
+		}
+	} else {
+		if len(outputColumns) > 0 {
+			projection, err = outputColumns.Resolve(nil)
 			if err != nil {
-				log.Fatal(err)
+				return fail(inputErrorf(ExitError, "%s: %w", inputPath, err))
 			}
 		}
+		if len(dedupeKey) > 0 {
+			dedupeColumns, err = dedupeKey.Resolve(nil)
+			if err != nil {
+				return fail(inputErrorf(ExitError, "%s: %w", inputPath, err))
+			}
+		}
+	}
 
-		w.Write(row)
+	// The index of the timestamp column in the output, or -1 if projected out.
+	timestampColumn := 0
+	if projection != nil {
+		timestampColumn = -1
+		for i, c := range projection {
+			if c == 0 {
+				timestampColumn = i
+				break
+			}
+		}
 	}
 
-	w.Close()
-}
+	w.SetTable(SQLiteTableName(inputPath))
+	if *hasHeader {
+		if projection != nil {
+			w.SetHeader(Project(header, projection))
+		} else {
+			w.SetHeader(header)
+		}
+	}
 
-// ChopRecursive is a directory recursive version of Chop function.
-func ChopRecursive(inputPath string) {
-	s, err := os.Stat(inputPath)
+	schemaColumns, err := schemaValidator.Resolve(w.header)
 	if err != nil {
-		log.Fatalf("failed to get file information: %s", err)
+		return fail(inputErrorf(ExitError, "%s: -schema: %w", inputPath, err))
 	}
 
-	if !s.IsDir() {
-		Chop(inputPath)
-		return
+	if *maxRowSize > 0 {
+		overflow = w.Overflow()
 	}
 
-	log.Printf("search CSV files from %s", inputPath)
-
-	err = filepath.Walk(inputPath, func(path string, info fs.FileInfo, err error) error {
-		if !info.IsDir() && filepath.Ext(path) == ".csv" {
-			Chop(path)
-		}
-		return nil
-	})
+	skip, err := checkpoint.Begin(inputPath, w, overflow)
 	if err != nil {
-		log.Fatal(err)
+		fatalf(ExitError, "failed to resume: %s", err)
 	}
-}
-
-func main() {
-	flag.Usage = func() {
-		fmt.Println("Usage: chop-csv [OPTIONS] help|version|FILE...")
-		fmt.Println()
-		fmt.Println("OPTIONS:")
-		flag.PrintDefaults()
+	read := 0
+	complete := true
+	ignored := 0  // the number of rows ignored because of invalid timestamp or character, to log when finished
+	rejected := 0 // the number of rows rejected by -schema, to log when finished
+	for ; read < skip; read++ {
+		if _, err := r.Next(); err != nil {
+			fatalf(ExitDecodeError, "failed to resume: %s: %s", inputPath, err)
+		}
+		empty = false
+		line++
 	}
 
-	flag.Parse()
+	for ; ; line++ {
+		if ctx.Err() != nil {
+			stopChop(inputPath, read, w, overflow, stats)
+			return false, nil
+		}
+		if (*maxRows > 0 && read >= *maxRows) || !reserveRow() {
+			logger.With("input", inputPath, "row", read).Infof("stop reading %s at row %d by -max-rows or -max-total-rows", inputPath, read)
+			complete = false
+			break
+		}
+		if checkpoint.Due(read) {
+			addSummary(stats)
+			if err := checkpoint.Save(inputPath, read, w, overflow); err != nil {
+				fatalf(ExitError, "failed to save checkpoint: %s", err)
+			}
+		}
 
-	if flag.NArg() == 0 {
-		flag.Usage()
-		os.Exit(2)
-	}
+		row, err := r.Next()
+		if err == io.EOF {
+			releaseRow()
+			break
+		} else if err != nil {
+			return fail(inputErrorf(ExitDecodeError, "%w", err))
+		}
+		stats.ReadRows++
+		read++
+		empty = false
 
-	if flag.Arg(0) == "version" {
-		fmt.Printf("chop-csv %s\n", version)
-		return
-	}
-	if flag.Arg(0) == "help" {
-		flag.Usage()
-		return
-	}
+		if fields < 0 {
+			fields = len(row)
+		}
+		if len(row) != fields && *onRagged != "fail" {
+			stats.RaggedRows++
+			if *verboseLog {
+				logger.With("input", inputPath, "line", line+1).Warnf("row %d has %d columns, but expected %d columns", line+1, len(row), fields)
+			}
+			switch {
+			case *onRagged == "skip":
+				continue
+			case len(row) > fields:
+				row = row[:fields]
+			case *onRagged == "pad":
+				row = append(row, make([]string, fields-len(row))...)
+			}
+		}
 
-	for _, f := range flag.Args() {
-		ChopRecursive(f)
+		if alignment != nil {
+			row = Project(row, alignment)
+		}
+
+		gaijiMap.Replace(row, stats.ReplacedGaiji)
+
+		if n := ReplaceInvalidChars(row); n > 0 {
+			switch *decodeError {
+			case "fail":
+				return fail(inputErrorf(ExitDecodeError, "invalid character at row %d of %s", line+1, inputPath))
+			case "skip-row":
+				if *verboseLog {
+					logger.With("input", inputPath, "line", line+1).Warnf("ignore row %d because invalid character", line+1)
+				}
+				ignored++
+				stats.DecodeErrorRows++
+				continue
+			default:
+				stats.ReplacedChars += n
+			}
+		}
+
+		NormalizeRecord(row)
+		CleanRecord(row)
+
+		t, err := ParseTimestamp(row[0])
+		if err != nil {
+			if *verboseLog {
+				logger.With("input", inputPath, "line", line+1, "error", err).Warnf("ignore row %d because invalid timestamp: %s: %s", line+1, row[0], err)
+			}
+			ignored++
+			stats.IgnoredRows++
+			continue
+		}
+
+		if !timeRange.Contains(t) || !MatchFilters(row) {
+			stats.FilteredRows++
+			continue
+		}
+
+		if dedupe.Duplicated(PartitionDir(t), row, dedupeColumns) {
+			stats.DuplicateRows++
+			continue
+		}
+
+		MaskRecord(row)
+
+		if projection != nil {
+			row = Project(row, projection)
+		}
+
+		if err := schemaValidator.Validate(row, schemaColumns); err != nil {
+			if *verboseLog {
+				logger.With("input", inputPath, "line", line+1, "error", err).Warnf("reject row %d by -schema: %s", line+1, err)
+			}
+			if err := rejects.Write(err.Error(), inputPath, line+1, row); err != nil {
+				fatalf(ExitOutputError, "failed to write -reject-file: %s", err)
+			}
+			rejected++
+			stats.SchemaRejected++
+			continue
+		}
+
+		schema.Observe(w.header, row, timestampColumn)
+
+		if overflow != nil && RowSize(row) > *maxRowSize {
+			row, err = DivertRow(overflow, t, row, line+1, *maxRowSize)
+			if errors.Is(err, errTooManyPartitions) {
+				return fail(inputErrorf(ExitError, "%s: %w", inputPath, err))
+			} else if err != nil {
+				fatalf(ExitOutputError, "%s", err)
+			}
+			stats.OverflowRows++
+		}
+
+		if err := w.Write(t, row); errors.Is(err, errTooManyPartitions) {
+			return fail(inputErrorf(ExitError, "%s: %w", inputPath, err))
+		} else if err != nil {
+			fatalf(ExitOutputError, "%s", err)
+		}
+		stats.WrittenRows++
+	}
+
+	if err := w.Close(); err != nil {
+		fatalf(ExitOutputError, "%s", err)
+	}
+	if ignored > 0 && !*verboseLog {
+		logger.With("input", inputPath, "rows", ignored).Warnf("ignore %d rows in %s because invalid timestamp or character. specify -v to log each row", ignored, inputPath)
+	}
+	if rejected > 0 && !*verboseLog {
+		logger.With("input", inputPath, "rows", rejected).Warnf("reject %d rows in %s by -schema. specify -v to log each row", rejected, inputPath)
+	}
+	files := w.Files()
+	if overflow != nil {
+		if err := overflow.Close(); err != nil {
+			fatalf(ExitOutputError, "%s", err)
+		}
+		files = append(files, overflow.Files()...)
+	}
+	if err := w.Complete(); err != nil {
+		fatalf(ExitOutputError, "failed to upload: %s", err)
+	}
+
+	RecordManifest(inputPath, w)
+	if overflow != nil {
+		RecordManifest(inputPath, overflow)
+	}
+
+	for _, f := range files {
+		partitionHook.Run(f)
+	}
+
+	if empty && complete {
+		stats.EmptyFiles++
+		switch *onEmpty {
+		case "error":
+			return fail(inputErrorf(ExitError, "input file is empty: %s", inputPath))
+		case "warn":
+			logger.With("input", inputPath).Warnf("skip empty file: %s", inputPath)
+		}
+	}
+
+	addSummary(stats)
+	if err := checkpoint.Finish(inputPath); err != nil {
+		fatalf(ExitError, "failed to save checkpoint: %s", err)
+	}
+	return complete, nil
+}
+
+// ChopRecursive is a directory recursive version of Chop function.
+//
+// The URLs are chopped without searching, except that s3://bucket/prefix/ is searched for the CSV files under the prefix.
+// If ctx is canceled, the rest of files are not chopped.
+//
+// The files are chopped in parallel by chopJobs if -jobs is more than 1, so call chopJobs.Wait to wait for them.
+func ChopRecursive(ctx context.Context, inputPath string) {
+	if isInputURL(inputPath) {
+		if urlScheme(inputPath) != "s3" || !strings.HasSuffix(inputPath, "/") {
+			chopJobs.Run(func() { Chop(ctx, inputPath) })
+			return
+		}
+
+		logger.With("input", inputPath).Infof("search CSV files from %s", inputPath)
+		urls, err := listS3Inputs(inputPath)
+		if err != nil {
+			failInput(inputPath, inputErrorf(ExitInputError, "failed to list files: %w", err))
+			return
+		}
+		for _, u := range urls {
+			u := u
+			chopJobs.Run(func() { Chop(ctx, u) })
+		}
+		return
+	}
+
+	s, err := os.Stat(inputPath)
+	if os.IsPermission(err) {
+		addUnreadable(err)
+		return
+	} else if err != nil {
+		failInput(inputPath, inputErrorf(ExitInputError, "failed to get file information: %w", err))
+		return
+	}
+
+	if !s.IsDir() {
+		chopJobs.Run(func() { ChopLocal(ctx, inputPath, s) })
+		return
+	}
+
+	logger.With("input", inputPath).Infof("search CSV files from %s", inputPath)
+
+	err = walkInputs(inputPath, func(path string, info fs.FileInfo, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if os.IsPermission(err) {
+			// The unreadable directory is skipped, and the others are still walked.
+			addUnreadable(err)
+			return nil
+		} else if err != nil && *keepGoing {
+			failInput(path, inputErrorf(ExitInputError, "failed to search CSV files: %w", err))
+			return nil
+		} else if err != nil {
+			return err
+		}
+		rel := relativeInputPath(inputPath, path)
+		if info.IsDir() {
+			if path != inputPath && isExcluded(rel) {
+				return filepath.SkipDir
+			}
+		} else if isInputFile(rel) {
+			chopJobs.Run(func() { ChopLocal(ctx, path, info) })
+		}
+		return nil
+	})
+	if err != nil && err != ctx.Err() {
+		fatalf(ExitInputError, "failed to search CSV files: %s", err)
+	}
+}
+
+// exitInterrupted waits for the running hooks, records the history and the summary, and exits with InterruptedExitCode.
+//
+// WARNING: this function reads commandline flags directly.
+func exitInterrupted(startAt time.Time) {
+	partitionHook.Wait()
+	addRetries()
+	if err := inputState.Save(); err != nil {
+		logger.With("error", err).Errorf("failed to save state: %s", err)
+	}
+	if err := history.Finish(); err != nil {
+		logger.With("error", err).Warnf("failed to record history: %s", err)
+	}
+	summary.Print()
+	d := SystemClock.Now().Sub(startAt)
+	logger.With("duration", d).Warnf("interrupted in %s", d)
+	UnlockOutputDirs()
+	notifier.Notify("interrupted", InterruptedExitCode(), "")
+	StopProfiling()
+	os.Exit(InterruptedExitCode())
+}
+
+// setupOptions validates OPTIONS, and prepares the global states for them, like the encodings and the output directories.
+// It is called after all OPTIONS parsed, including the ones after the subcommand name.
+//
+// WARNING: this function reads commandline flags directly.
+// WARNING: this method can stop program with log.Fatal.
+func setupOptions() {
+	if *utf8Mode {
+		*encodingName = "utf8"
+	}
+	var err error
+	inputEncoding, err = LookupEncoding(*encodingName)
+	if err != nil {
+		fatalf(ExitUsage, "%s", err)
+	}
+	if *gaijiMapPath != "" {
+		gaijiMap, err = LoadGaijiMap(*gaijiMapPath, inputEncoding)
+		if err != nil {
+			fatalf(ExitError, "failed to load gaiji map: %s", err)
+		}
+		summary.ReplacedGaiji = make(map[string]int)
+	}
+	outputEncoding, err = LookupEncoding(*outputEncode)
+	if err != nil {
+		fatalf(ExitUsage, "%s", err)
+	}
+
+	switch *decodeError {
+	case "fail", "replace", "skip-row":
+	default:
+		fatalf(ExitUsage, "invalid -on-decode-error: %s", *decodeError)
+	}
+
+	if *maxRows < 0 {
+		fatalf(ExitUsage, "invalid -max-rows: %d", *maxRows)
+	}
+	if *maxTotalRows < 0 {
+		fatalf(ExitUsage, "invalid -max-total-rows: %d", *maxTotalRows)
+	}
+	if *maxPartitions < 0 {
+		fatalf(ExitUsage, "invalid -max-partitions: %d", *maxPartitions)
+	}
+
+	if *skipLines < 0 {
+		fatalf(ExitUsage, "invalid -skip-lines: %d", *skipLines)
+	}
+	if *commentChar != "" {
+		c := []rune(*commentChar)
+		if len(c) != 1 || c[0] == ',' || c[0] == '"' || c[0] == '\r' || c[0] == '\n' || c[0] == utf8.RuneError {
+			fatalf(ExitUsage, "invalid -comment: %q", *commentChar)
+		}
+	}
+
+	switch *onRagged {
+	case "fail", "pad", "truncate", "skip":
+	default:
+		fatalf(ExitUsage, "invalid -on-ragged: %s", *onRagged)
+	}
+
+	switch *onOversize {
+	case "fail", "skip", "truncate":
+	default:
+		fatalf(ExitUsage, "invalid -on-oversize: %s", *onOversize)
+	}
+	if *maxFieldSize < 0 {
+		fatalf(ExitUsage, "invalid -max-field-size: %d", *maxFieldSize)
+	}
+	if *maxRecordBytes < 0 {
+		fatalf(ExitUsage, "invalid -max-record-bytes: %d", *maxRecordBytes)
+	}
+
+	switch *onEmpty {
+	case "warn", "ignore", "error":
+	default:
+		fatalf(ExitUsage, "invalid -on-empty: %s", *onEmpty)
+	}
+
+	switch *schemaEvolution {
+	case "none", "align", "error":
+	default:
+		fatalf(ExitUsage, "invalid -schema-evolution: %s", *schemaEvolution)
+	}
+
+	if *maxDepth < 0 {
+		fatalf(ExitUsage, "invalid -max-depth: %d", *maxDepth)
+	}
+	if *maxRowsPerFile < 0 {
+		fatalf(ExitUsage, "invalid -max-rows-per-file: %d", *maxRowsPerFile)
+	}
+	if *maxFileSize < 0 {
+		fatalf(ExitUsage, "invalid -max-file-size: %d", *maxFileSize)
+	}
+	if *maxOpenFiles < 1 {
+		fatalf(ExitUsage, "invalid -max-open-files: %d", *maxOpenFiles)
+	}
+
+	switch *nameScheme {
+	case "input-hash":
+	case "content-hash":
+		if *followPath != "" {
+			fatalf(ExitUsage, "-name-scheme=content-hash can not be used with -follow")
+		}
+		for _, dir := range outputDirs() {
+			if isRemoteURL(dir) {
+				fatalf(ExitUsage, "-name-scheme=content-hash can not write into %s", dir)
+			}
+		}
+	default:
+		fatalf(ExitUsage, "invalid -name-scheme: %s", *nameScheme)
+	}
+
+	switch *onExist {
+	case "overwrite", "fail":
+	case "append":
+		if *nameScheme == "content-hash" {
+			fatalf(ExitUsage, "-on-exist=append can not be used with -name-scheme=content-hash")
+		}
+		for _, dir := range outputDirs() {
+			if isRemoteURL(dir) {
+				fatalf(ExitUsage, "-on-exist=append can not write into %s", dir)
+			}
+		}
+	default:
+		fatalf(ExitUsage, "invalid -on-exist: %s", *onExist)
+	}
+
+	if *archiveDir != "" && *deleteInput {
+		fatalf(ExitUsage, "-archive-dir and -delete-input can not be used together")
+	}
+	if (*archiveDir != "" || *deleteInput) && *followPath != "" {
+		fatalf(ExitUsage, "-archive-dir and -delete-input can not be used with -follow")
+	}
+
+	switch *stampMtime {
+	case "", "partition", "latest-row":
+	default:
+		fatalf(ExitUsage, "invalid -stamp-mtime: %s", *stampMtime)
+	}
+
+	if *dirModeS != "" {
+		if outputDirMode, err = ParseFileMode(*dirModeS); err != nil {
+			fatalf(ExitUsage, "invalid -dir-mode: %s", err)
+		}
+	}
+	if *fileModeS != "" {
+		if outputFileMode, err = ParseFileMode(*fileModeS); err != nil {
+			fatalf(ExitUsage, "invalid -file-mode: %s", err)
+		}
+	}
+
+	if *reproducible {
+		if *followPath != "" || *watchDir != "" || *listenAddr != "" {
+			fatalf(ExitUsage, "-deterministic can not be used with -follow, -watch, or -listen")
+		}
+		// The files are chopped in the order of arguments, because the shared outputs like -reject-file and -emit-schema depend on the order.
+		if *inputJobs > 1 {
+			fatalf(ExitUsage, "-deterministic can not be used with -jobs")
+		}
+		if deterministicTime, err = SourceDateEpoch(); err != nil {
+			fatalf(ExitUsage, "invalid $SOURCE_DATE_EPOCH: %s", err)
+		}
+		deterministic = true
+
+		// Escape the partition directories on all platforms, so that the output is the same as on Windows.
+		explicit := false
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "windows-safe-names" {
+				explicit = true
+			}
+		})
+		if !explicit {
+			*windowsSafe = true
+		}
+	}
+
+	windowsSafeNames = *windowsSafe
+	for _, dir := range []*string{outputDir, teeOutputDir} {
+		if *dir == "" {
+			continue
+		}
+		if *dir, err = LongPath(*dir); err != nil {
+			fatalf(ExitUsage, "invalid output directory: %s", err)
+		}
+	}
+
+	uploadSlots = make(chan struct{}, *s3Concurrency)
+	for _, dir := range []string{*outputDir, *teeOutputDir} {
+		if err := SetupSink(dir); err != nil {
+			fatalf(ExitError, "failed to set up output directory: %s", err)
+		}
+		if isRemoteURL(dir) {
+			if *outputFormat != "csv" {
+				fatalf(ExitUsage, "-format=%s can not write into %s", *outputFormat, dir)
+			}
+			if *followPath != "" {
+				fatalf(ExitUsage, "-follow can not write into %s", dir)
+			}
+		}
+	}
+
+	markerScopes, err = ParseSuccessMarkers(*successMarkers)
+	if err != nil {
+		fatalf(ExitUsage, "invalid -success-markers: %s", err)
+	}
+	if *followPath != "" && *watchDir != "" {
+		fatalf(ExitUsage, "-follow can not be used with -watch")
+	}
+	if *followPath != "" {
+		atomicOutput = false
+	}
+	if *listenAddr != "" {
+		if *followPath != "" || *watchDir != "" {
+			fatalf(ExitUsage, "-listen can not be used with -follow or -watch")
+		}
+		if *hasHeader {
+			fatalf(ExitUsage, "-listen can not be used with -header")
+		}
+		if *checkpointPath != "" || *manifestPath != "" || *bundlePath != "" || *outputTar != "" || *emitSchema != "" {
+			fatalf(ExitUsage, "-listen can not be used with -checkpoint, -manifest, -bundle, -out-tar, or -emit-schema")
+		}
+		if _, _, err := listenNetwork(*listenAddr); err != nil {
+			fatalf(ExitUsage, "invalid -listen: %s", err)
+		}
+		if *rotateInterval <= 0 {
+			fatalf(ExitUsage, "invalid -rotate-interval: %s", *rotateInterval)
+		}
+	}
+	if *resumeRun && *checkpointPath == "" {
+		fatalf(ExitUsage, "-resume requires -checkpoint")
+	}
+	if *readBuffer < 1 {
+		fatalf(ExitUsage, "invalid -read-buffer: %d", *readBuffer)
+	}
+	if *writeBuffer < 1 {
+		fatalf(ExitUsage, "invalid -write-buffer: %d", *writeBuffer)
+	}
+	if *inputJobs < 1 {
+		fatalf(ExitUsage, "invalid -jobs: %d", *inputJobs)
+	}
+	if *inputJobs > 1 {
+		chopJobs = NewJobRunner(*inputJobs)
+	}
+	if *checkpointPath != "" {
+		if *followPath != "" || *watchDir != "" {
+			fatalf(ExitUsage, "-checkpoint can not be used with -follow or -watch")
+		}
+		if *inputJobs > 1 {
+			fatalf(ExitUsage, "-checkpoint can not be used with -jobs")
+		}
+		if *manifestPath != "" || *bundlePath != "" {
+			fatalf(ExitUsage, "-checkpoint can not be used with -manifest or -bundle")
+		}
+		if *outputFormat != "csv" || isRemoteURL(*outputDir) || isRemoteURL(*teeOutputDir) {
+			fatalf(ExitUsage, "-checkpoint can be used only with -format=csv and local -out-dir")
+		}
+		if *checkpointRows < 1 {
+			fatalf(ExitUsage, "invalid -checkpoint-interval: %d", *checkpointRows)
+		}
+	}
+	if *statePath != "" {
+		if *followPath != "" {
+			fatalf(ExitUsage, "-state can not be used with -follow")
+		}
+		inputState, err = LoadState(*statePath)
+		if err != nil {
+			fatalf(ExitError, "failed to load state: %s", err)
+		}
+	}
+	if *watchInterval <= 0 {
+		fatalf(ExitUsage, "invalid -watch-interval: %s", *watchInterval)
+	}
+	if len(markerScopes) > 0 && (*followPath != "" || *watchDir != "") {
+		fatalf(ExitUsage, "-success-markers can not be used with -follow or -watch")
+	}
+	if *manifestPath != "" && (*followPath != "" || *watchDir != "") {
+		fatalf(ExitUsage, "-manifest can not be used with -follow or -watch")
+	}
+	if *partitionMeta && (*followPath != "" || *watchDir != "" || *listenAddr != "" || *checkpointPath != "") {
+		fatalf(ExitUsage, "-partition-metadata can not be used with -follow, -watch, -listen, or -checkpoint")
+	}
+	if *outputTar != "" {
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "out-dir" {
+				fatalf(ExitUsage, "-out-tar can not be used with -out-dir")
+			}
+		})
+		if *followPath != "" || *watchDir != "" || *checkpointPath != "" {
+			fatalf(ExitUsage, "-out-tar can not be used with -follow, -watch, or -checkpoint")
+		}
+		if isRemoteURL(*outputTar) || isRemoteURL(*teeOutputDir) {
+			fatalf(ExitUsage, "-out-tar can be used only with local files")
+		}
+	}
+	if *bundlePath != "" && (*followPath != "" || *watchDir != "" || isRemoteURL(*outputDir)) {
+		fatalf(ExitUsage, "-bundle can not be used with -follow, -watch, or remote -out-dir")
+	}
+	if err := SetupSink(*manifestPath); err != nil {
+		fatalf(ExitError, "failed to set up -manifest: %s", err)
+	}
+	if *schemaPath != "" {
+		sc, err := LoadSchema(*schemaPath)
+		if err != nil {
+			fatalf(ExitUsage, "invalid -schema: %s", err)
+		}
+		schemaValidator = NewSchemaValidator(sc)
+	}
+	if *rejectPath != "" && *schemaPath == "" {
+		fatalf(ExitUsage, "-reject-file requires -schema")
+	}
+	if *emitSchema != "" {
+		if *followPath != "" || *watchDir != "" {
+			fatalf(ExitUsage, "-emit-schema can not be used with -follow or -watch")
+		}
+		if err := SetupSink(*emitSchema); err != nil {
+			fatalf(ExitError, "failed to set up -emit-schema: %s", err)
+		}
+		schema = NewSchemaInferrer()
+	}
+
+	switch *quotePolicy {
+	case QuoteMinimal, QuoteAll, QuoteNonNumeric:
+	default:
+		fatalf(ExitUsage, "invalid -quote: %s", *quotePolicy)
+	}
+
+	switch *outputFormat {
+	case "csv", "parquet", "sqlite":
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "out-db" || f.Name == "duckdb-table" || f.Name == "duckdb-cli" {
+				fatalf(ExitUsage, "-%s requires -format=duckdb", f.Name)
+			}
+		})
+	case "duckdb":
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "out-dir" {
+				fatalf(ExitUsage, "-format=duckdb can not be used with -out-dir")
+			}
+		})
+		if *followPath != "" || *watchDir != "" || *listenAddr != "" || *checkpointPath != "" || *outputTar != "" {
+			fatalf(ExitUsage, "-format=duckdb can not be used with -follow, -watch, -listen, -checkpoint, or -out-tar")
+		}
+		if *maxRowSize > 0 || *dbtManifest != "" {
+			fatalf(ExitUsage, "-format=duckdb can not be used with -max-row-size or -dbt-manifest")
+		}
+		if *layoutStyle != "hive" {
+			fatalf(ExitUsage, "-format=duckdb requires -layout=hive")
+		}
+		if *duckdbTable == "" || isRemoteURL(*outputDB) {
+			fatalf(ExitUsage, "invalid -out-db or -duckdb-table: -out-db must be a local file and -duckdb-table must not be empty")
+		}
+		if _, err := exec.LookPath(*duckdbCLI); err != nil {
+			fatalf(ExitUsage, "-format=duckdb requires DuckDB CLI: %s", err)
+		}
+		// The rows are written as Parquet files in a temporary directory, and loaded by DuckDB at the end.
+		duckdbOutput = true
+	default:
+		fatalf(ExitUsage, "invalid -format: %s", *outputFormat)
+	}
+	if *compressLevel != 0 {
+		if *outputFormat != "csv" {
+			fatalf(ExitUsage, "-compression-level can not be used with -format=%s", *outputFormat)
+		}
+		min, max := bzip2.BestSpeed, bzip2.BestCompression
+		if *zstdDict {
+			min, max = zstdMinLevel, zstdMaxLevel
+		}
+		if *compressLevel < min || *compressLevel > max {
+			fatalf(ExitUsage, "invalid -compression-level: %d: must be between %d and %d", *compressLevel, min, max)
+		}
+	}
+	if *zstdDict {
+		if *outputFormat != "csv" {
+			fatalf(ExitUsage, "-zstd-dict can not be used with -format=%s", *outputFormat)
+		}
+		if isRemoteURL(*outputDir) || *outputTar != "" {
+			fatalf(ExitUsage, "-zstd-dict can not be used with URL -out-dir or -out-tar")
+		}
+		if *dbtManifest != "" {
+			fatalf(ExitUsage, "-zstd-dict can not be used with -dbt-manifest, because Hive can not decompress zstd with a dictionary")
+		}
+		if *zstdDictRows < 1 {
+			fatalf(ExitUsage, "invalid -zstd-dict-rows: %d", *zstdDictRows)
+		}
+	}
+	if strings.HasSuffix(*parquetSchemaS, ".json") {
+		parquetTypes, err = LoadParquetSchema(*parquetSchemaS)
+	} else {
+		parquetTypes, err = ParseParquetSchema(*parquetSchemaS)
+	}
+	if err != nil {
+		fatalf(ExitUsage, "invalid -parquet-schema: %s", err)
+	}
+
+	outputColumns = ParseColumnList(*columnsS)
+
+	dedupeKey = ParseColumnList(*dedupeKeyS)
+	if *dedupeRows || len(dedupeKey) > 0 {
+		dedupe = NewDeduplicator()
+	}
+
+	masks, err = ParseMasks(*maskColumnsS)
+	if err != nil {
+		fatalf(ExitUsage, "invalid -mask-columns: %s", err)
+	}
+	if *maskKeyS == "" {
+		*maskKeyS = os.Getenv("CHOPCSV_MASK_KEY")
+	}
+	maskKey = []byte(*maskKeyS)
+
+	cleanColumns, err = ParseColumnSet(*cleanColumnsS)
+	if err != nil {
+		fatalf(ExitUsage, "invalid -clean-columns: %s", err)
+	}
+
+	if *normalizeName != "" {
+		f, ok := normalizeForms[strings.ToLower(*normalizeName)]
+		if !ok {
+			fatalf(ExitUsage, "invalid -normalize: %s", *normalizeName)
+		}
+		normalizeForm = &f
+	}
+
+	decimalSeparator = *decimalSep
+	thousandsSeparator = *thousandsSep
+	if decimalSeparator == "" || decimalSeparator == thousandsSeparator {
+		fatalf(ExitUsage, "invalid -decimal-separator: %q", decimalSeparator)
+	}
+
+	if *timezoneName != "" {
+		timezone, err = time.LoadLocation(*timezoneName)
+		if err != nil {
+			fatalf(ExitError, "failed to load timezone: %s", err)
+		}
+	}
+
+	if err := SetLayout(*layoutStyle, *padPartitions); err != nil {
+		fatalf(ExitUsage, "invalid -layout: %s", err)
+	}
+	if err := SetGranularity(*granularity); err != nil {
+		fatalf(ExitUsage, "invalid -granularity: %s", err)
+	}
+
+	if *dateParserSpec != "" {
+		if len(dateFormats) > 0 {
+			fatalf(ExitUsage, "-date-parser can not be used with -date-format")
+		}
+		DefaultTimestampParser, err = ParseDateParser(*dateParserSpec)
+		if err != nil {
+			fatalf(ExitError, "failed to set up -date-parser: %s", err)
+		}
+	}
+
+	if *outputRetries < 0 {
+		fatalf(ExitUsage, "invalid -retries: %d", *outputRetries)
+	}
+	if *retryBackoff < 0 {
+		fatalf(ExitUsage, "invalid -retry-backoff: %s", *retryBackoff)
+	}
+
+	if *hookCommand != "" {
+		if *hookJobs < 1 {
+			fatalf(ExitUsage, "invalid -hook-jobs: %d", *hookJobs)
+		}
+		partitionHook = NewHookRunner(*hookCommand, *hookJobs)
+	}
+
+	if *sinceTime != "" {
+		timeRange.Since, err = ParseTimeFlag(*sinceTime)
+		if err != nil {
+			fatalf(ExitUsage, "failed to parse -since: %s", err)
+		}
+	}
+	if *untilTime != "" {
+		timeRange.Until, err = ParseTimeFlag(*untilTime)
+		if err != nil {
+			fatalf(ExitUsage, "failed to parse -until: %s", err)
+		}
+	}
+
+	if *fixedNow != "" {
+		t, err := time.Parse(time.RFC3339, *fixedNow)
+		if err != nil {
+			fatalf(ExitUsage, "failed to parse -now: %s", err)
+		}
+		DefaultClock = FixedClock(t)
+	}
+
+	if *historyPath != "" {
+		history = NewHistoryRecorder(*historyPath, *historyLimit)
+	}
+
+}
+
+func main() {
+	flag.Usage = printUsage
+
+	flag.Parse()
+
+	if flag.Arg(0) == "chop" {
+		// "chop-csv chop [OPTIONS] FILE..." is the same as "chop-csv [OPTIONS] FILE...".
+		flag.CommandLine.Parse(flag.Args()[1:])
+	} else if cmd := findCommand(flag.Arg(0)); cmd != nil {
+		cmd.Run(flag.Args()[1:])
+		UnlockOutputDirs()
+		StopProfiling()
+		return
+	}
+
+	loadConfig()
+
+	if err := SetupLogger(*logFormat, *logLevelName); err != nil {
+		fatalf(ExitUsage, "invalid -log-format or -log-level: %s", err)
+	}
+
+	if flag.NArg() == 0 && *followPath == "" && *watchDir == "" && *listenAddr == "" {
+		flag.Usage()
+		os.Exit(ExitUsage)
+	}
+
+	StartProfiling()
+	defer StopProfiling()
+
+	setupOptions()
+
+	var err error
+	startAt := SystemClock.Now()
+	ctx := HandleSignals(context.Background())
+
+	if *notifyURL != "" || *notifyCommand != "" {
+		if *notifyTimeout <= 0 {
+			fatalf(ExitUsage, "invalid -notify-timeout: %s", *notifyTimeout)
+		}
+		inputs := flag.Args()
+		switch {
+		case *followPath != "":
+			inputs = []string{*followPath}
+		case *listenAddr != "":
+			inputs = []string{*listenAddr}
+		case *watchDir != "":
+			inputs = []string{*watchDir}
+		}
+		notifier = NewNotifier(*notifyURL, *notifyCommand, *notifyTimeout, startAt, inputs)
+	}
+
+	if *metricsListen != "" {
+		metrics = NewMetrics()
+		ServeMetrics(metrics, *metricsListen)
+	}
+
+	if *rejectPath != "" {
+		rejects, err = CreateRejectWriter(*rejectPath)
+		if err != nil {
+			fatalf(ExitOutputError, "failed to create -reject-file: %s", err)
+		}
+	}
+
+	if !*noLock && *outputTar == "" && !duckdbOutput {
+		for _, dir := range outputDirs() {
+			l, err := LockOutputDir(dir, *waitLock)
+			if err != nil {
+				fatalf(ExitError, "failed to lock output directory: %s", err)
+			}
+			outputLocks = append(outputLocks, l)
+		}
+	}
+
+	if *zstdDict {
+		inputs := flag.Args()
+		switch {
+		case *followPath != "":
+			inputs = []string{*followPath}
+		case *watchDir != "":
+			inputs = []string{*watchDir}
+		}
+		if err := SetupZstdDict(inputs); err != nil {
+			fatalf(ExitError, "failed to set up -zstd-dict: %s", err)
+		}
+	}
+
+	if *followPath != "" {
+		if err := history.Start([]string{*followPath}); err != nil {
+			fatalf(ExitError, "failed to record history: %s", err)
+		}
+		Follow(ctx, *followPath, *flushInterval)
+		exitInterrupted(startAt)
+	}
+
+	if *listenAddr != "" {
+		if err := history.Start([]string{*listenAddr}); err != nil {
+			fatalf(ExitError, "failed to record history: %s", err)
+		}
+		Listen(ctx, *listenAddr, *rotateInterval, *flushInterval)
+		exitInterrupted(startAt)
+	}
+
+	if *watchDir != "" {
+		if err := history.Start([]string{*watchDir}); err != nil {
+			fatalf(ExitError, "failed to record history: %s", err)
+		}
+		Watch(ctx, *watchDir, *watchInterval)
+		exitInterrupted(startAt)
+	}
+
+	if *outputTar != "" {
+		dir, err := os.MkdirTemp(filepath.Dir(*outputTar), ".chop-csv-")
+		if err != nil {
+			fatalf(ExitOutputError, "failed to make temporary directory for -out-tar: %s", err)
+		}
+		// os.MkdirTemp makes the directory only for the owner, but it is the root of the tar file.
+		mode := outputDirMode
+		if mode == 0 {
+			mode = 0755
+		}
+		if err := os.Chmod(dir, mode); err != nil {
+			fatalf(ExitOutputError, "failed to make temporary directory for -out-tar: %s", err)
+		}
+		if *outputDir, err = LongPath(dir); err != nil {
+			fatalf(ExitOutputError, "failed to make temporary directory for -out-tar: %s", err)
+		}
+	}
+
+	if duckdbOutput {
+		dir, err := os.MkdirTemp(filepath.Dir(*outputDB), ".chop-csv-")
+		if err != nil {
+			fatalf(ExitOutputError, "failed to make temporary directory for -format=duckdb: %s", err)
+		}
+		if *outputDir, err = LongPath(dir); err != nil {
+			fatalf(ExitOutputError, "failed to make temporary directory for -format=duckdb: %s", err)
+		}
+	}
+
+	if *sinceLastRun {
+		if *historyPath == "" {
+			fatalf(ExitUsage, "-since-last-run requires -history")
+		}
+		modifiedAfter, err = LastSuccess(*historyPath, flag.Args())
+		if err != nil {
+			fatalf(ExitError, "failed to read history: %s", err)
+		}
+		if modifiedAfter.IsZero() {
+			logger.Infof("no successful run found in history. chop all files")
+		} else {
+			logger.With("since", modifiedAfter).Infof("chop files that modified after %s", modifiedAfter.Format(time.RFC3339))
+		}
+	}
+
+	if *checkpointPath != "" {
+		if *resumeRun {
+			checkpoint, err = ResumeCheckpointer(*checkpointPath, *checkpointRows, flag.Args())
+			if err != nil {
+				fatalf(ExitError, "failed to load checkpoint: %s", err)
+			}
+		} else {
+			checkpoint = NewCheckpointer(*checkpointPath, *checkpointRows, flag.Args())
+		}
+	}
+
+	if err := history.Start(flag.Args()); err != nil {
+		fatalf(ExitError, "failed to record history: %s", err)
+	}
+
+	if err := RemoveRunMarker(); err != nil {
+		fatalf(ExitOutputError, "failed to remove success marker: %s", err)
+	}
+
+	for _, f := range flag.Args() {
+		ChopRecursive(ctx, f)
+	}
+	chopJobs.Wait()
+
+	if ctx.Err() != nil {
+		exitInterrupted(startAt)
+	}
+
+	if err := inputState.Save(); err != nil {
+		fatalf(ExitError, "failed to save state: %s", err)
+	}
+	if err := rejects.Close(); err != nil {
+		fatalf(ExitOutputError, "failed to write -reject-file: %s", err)
+	}
+	if err := checkpoint.Remove(); err != nil {
+		fatalf(ExitError, "failed to remove checkpoint: %s", err)
+	}
+
+	partitionHook.Wait()
+
+	if *manifestPath != "" || *bundlePath != "" {
+		m, err := MakeManifest()
+		if err != nil {
+			fatalf(ExitError, "failed to make manifest: %s", err)
+		}
+		if *manifestPath != "" {
+			if err := WriteManifest(*manifestPath, m); err != nil {
+				fatalf(ExitOutputError, "failed to write manifest: %s", err)
+			}
+			logger.With("files", len(m.Files), "file", *manifestPath).Infof("write manifest of %d files to %s", len(m.Files), *manifestPath)
+		}
+		if *bundlePath != "" {
+			if err := WriteBundle(*bundlePath, m); err != nil {
+				fatalf(ExitOutputError, "failed to write bundle: %s", err)
+			}
+			logger.With("files", len(m.Files), "file", *bundlePath).Infof("write bundle of %d files to %s", len(m.Files), *bundlePath)
+		}
+	}
+
+	if *emitSchema != "" {
+		sc := schema.Schema()
+		if err := WriteSchema(*emitSchema, sc); err != nil {
+			fatalf(ExitOutputError, "failed to write schema: %s", err)
+		}
+		logger.With("columns", len(sc.Columns), "file", *emitSchema).Infof("write schema of %d columns to %s", len(sc.Columns), *emitSchema)
+	}
+
+	if *partitionMeta {
+		if err := WritePartitionMetadata(); err != nil {
+			fatalf(ExitOutputError, "failed to write partition metadata: %s", err)
+		}
+	}
+
+	if err := WriteSuccessMarkers(); err != nil {
+		fatalf(ExitOutputError, "failed to write success markers: %s", err)
+	}
+
+	if *outputTar != "" {
+		if err := WriteOutputTar(*outputTar, *outputDir); err != nil {
+			fatalf(ExitOutputError, "failed to write -out-tar: %s", err)
+		}
+		if err := os.RemoveAll(*outputDir); err != nil {
+			logger.With("error", err).Warnf("failed to remove temporary directory: %s", err)
+		}
+		logger.With("file", *outputTar).Infof("write output files into %s", *outputTar)
+	}
+
+	if duckdbOutput {
+		if err := LoadDuckDB(*outputDB, *duckdbTable, *outputDir); err != nil {
+			fatalf(ExitOutputError, "failed to write -out-db: %s", err)
+		}
+		if err := os.RemoveAll(*outputDir); err != nil {
+			logger.With("error", err).Warnf("failed to remove temporary directory: %s", err)
+		}
+		logger.With("file", *outputDB, "table", *duckdbTable).Infof("write rows into %s of %s", *duckdbTable, *outputDB)
+	}
+
+	if *dbtManifest != "" {
+		if err := WriteDBTManifest(*dbtManifest, *dbtSource, *dbtTable, *dbtLocation); err != nil {
+			fatalf(ExitOutputError, "failed to write dbt manifest: %s", err)
+		}
+		logger.With("file", *dbtManifest).Infof("write dbt manifest to %s", *dbtManifest)
+	}
+
+	if *glueTable != "" {
+		cfg, err := LoadAWSConfig()
+		if err != nil {
+			fatalf(ExitError, "failed to register partitions into glue: %s", err)
+		}
+		n, err := RegisterGluePartitions(cfg, *glueTable, WrittenPartitions())
+		if err != nil {
+			fatalf(ExitError, "failed to register partitions into glue: %s", err)
+		}
+		logger.With("partitions", n, "table", *glueTable).Infof("register %d partitions into glue table %s", n, *glueTable)
+	}
+
+	addRetries()
+
+	if err := history.Finish(); err != nil {
+		logger.With("error", err).Warnf("failed to record history: %s", err)
+	}
+
+	if *statsCSV != "" {
+		if err := AppendStatsCSV(*statsCSV, startAt, SystemClock.Now()); err != nil {
+			logger.With("error", err).Warnf("failed to write statistics: %s", err)
+		}
+	}
+
+	summary.Print()
+	d := SystemClock.Now().Sub(startAt)
+	logger.With("duration", d).Infof("done in %s", d)
+	UnlockOutputDirs()
+
+	if failedExitCode != ExitOK {
+		notifier.Notify("partial", failedExitCode, fmt.Sprintf("failed to chop %d files", len(summary.FailedFiles)))
+		StopProfiling()
+		os.Exit(failedExitCode)
+	}
+	if len(summary.UnreadableFiles) > 0 || summary.IgnoredRows > 0 || summary.DecodeErrorRows > 0 || summary.SchemaRejected > 0 || (summary.RaggedRows > 0 && *onRagged == "skip") || (summary.OversizeRows > 0 && *onOversize != "fail") {
+		notifier.Notify("partial", ExitPartial, "")
+		StopProfiling()
+		os.Exit(ExitPartial)
 	}
+	notifier.Notify("success", ExitOK, "")
 }
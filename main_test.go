@@ -0,0 +1,477 @@
+package main
+
+import (
+	"compress/bzip2"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+func TestMain(m *testing.M) {
+	// The encodings are set from the flags in main, so set the defaults of the flags here.
+	inputEncoding = CP932
+	outputEncoding = unicode.UTF8
+
+	os.Exit(m.Run())
+}
+
+// readBzip2CSV reads all rows in the bzip2 compressed CSV file at path.
+func readBzip2CSV(t *testing.T, path string) [][]string {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open: %s", err)
+	}
+	defer f.Close()
+
+	rows, err := csv.NewReader(bzip2.NewReader(f)).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to read %s: %s", path, err)
+	}
+	return rows
+}
+
+func TestCreate_tee(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "a.csv.bz2"), filepath.Join(dir, "b.csv.bz2")}
+	rows := [][]string{{"20230401", "hello"}, {"20230401", "world"}}
+
+	w, err := Create(paths...)
+	if err != nil {
+		t.Fatalf("failed to create: %s", err)
+	}
+	for _, row := range rows {
+		if err := w.Write(row); err != nil {
+			t.Fatalf("failed to write: %s", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+	if err := CompleteUploads(); err != nil {
+		t.Fatalf("failed to complete: %s", err)
+	}
+
+	if w.Name() != paths[0] {
+		t.Errorf("expected name %s but got %s", paths[0], w.Name())
+	}
+	for _, path := range paths {
+		if got := readBzip2CSV(t, path); !reflect.DeepEqual(got, rows) {
+			t.Errorf("%s: expected %q but got %q", path, rows, got)
+		}
+	}
+}
+
+func TestCreate_outputEncoding(t *testing.T) {
+	orig := outputEncoding
+	outputEncoding = japanese.ShiftJIS
+	defer func() { outputEncoding = orig }()
+
+	path := filepath.Join(t.TempDir(), "a.csv.bz2")
+	w, err := Create(path)
+	if err != nil {
+		t.Fatalf("failed to create: %s", err)
+	}
+	if err := w.Write([]string{"20230401", "日本語"}); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+	if err := CompleteUploads(); err != nil {
+		t.Fatalf("failed to complete: %s", err)
+	}
+
+	got := readBzip2CSV(t, path)
+	if want := [][]string{{"20230401", "\x93\xfa\x96\x7b\x8c\xea"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+}
+
+func TestChop_empty(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "empty.csv")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatalf("failed to prepare input: %s", err)
+	}
+
+	origOutputDir, origOnEmpty, origSummary := *outputDir, *onEmpty, summary
+	*outputDir, *onEmpty, summary = filepath.Join(dir, "out"), "ignore", Summary{}
+	defer func() { *outputDir, *onEmpty, summary = origOutputDir, origOnEmpty, origSummary }()
+
+	Chop(context.Background(), path)
+
+	if summary.InputFiles != 1 || summary.EmptyFiles != 1 {
+		t.Errorf("expected 1 input file and 1 empty file but got %d input files and %d empty files", summary.InputFiles, summary.EmptyFiles)
+	}
+	if _, err := os.Stat(*outputDir); !os.IsNotExist(err) {
+		t.Errorf("expected no output but got %v", err)
+	}
+}
+
+func TestChopRecursive_unreadable(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.csv"), []byte("20230401,a\n"), 0644); err != nil {
+		t.Fatalf("failed to prepare input: %s", err)
+	}
+	unreadable := filepath.Join(dir, "b.csv")
+	if err := os.WriteFile(unreadable, []byte("20230401,b\n"), 0000); err != nil {
+		t.Fatalf("failed to prepare input: %s", err)
+	}
+	if f, err := os.Open(unreadable); err == nil {
+		f.Close()
+		t.Skip("the permission is not enforced, for example running as root")
+	}
+
+	origOutputDir, origSummary := *outputDir, summary
+	*outputDir, summary = filepath.Join(dir, "out"), Summary{}
+	defer func() { *outputDir, summary = origOutputDir, origSummary }()
+
+	ChopRecursive(context.Background(), dir)
+
+	if summary.InputFiles != 1 || summary.WrittenRows != 1 {
+		t.Errorf("expected 1 input file and 1 written row but got %d input files and %d written rows", summary.InputFiles, summary.WrittenRows)
+	}
+	if len(summary.UnreadableFiles) != 1 || !strings.Contains(summary.UnreadableFiles[0], unreadable) {
+		t.Errorf("expected %s is reported as unreadable but got %q", unreadable, summary.UnreadableFiles)
+	}
+}
+
+func TestChopRecursive_sinceLastRun(t *testing.T) {
+	dir := t.TempDir()
+	old, updated := filepath.Join(dir, "old.csv"), filepath.Join(dir, "updated.csv")
+	for _, path := range []string{old, updated} {
+		if err := os.WriteFile(path, []byte("20230401,a\n"), 0644); err != nil {
+			t.Fatalf("failed to prepare input: %s", err)
+		}
+	}
+
+	lastRun := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(old, lastRun.Add(-time.Hour), lastRun.Add(-time.Hour)); err != nil {
+		t.Fatalf("failed to change modification time: %s", err)
+	}
+
+	origOutputDir, origSummary, origModifiedAfter := *outputDir, summary, modifiedAfter
+	*outputDir, summary, modifiedAfter = filepath.Join(dir, "out"), Summary{}, lastRun
+	defer func() { *outputDir, summary, modifiedAfter = origOutputDir, origSummary, origModifiedAfter }()
+
+	ChopRecursive(context.Background(), dir)
+
+	if summary.InputFiles != 1 || summary.SkippedFiles != 1 {
+		t.Errorf("expected 1 input file and 1 skipped file but got %d input files and %d skipped files", summary.InputFiles, summary.SkippedFiles)
+	}
+}
+
+func TestChopRecursive_jobs(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 4; i++ {
+		data := fmt.Sprintf("20230401,%d\n20230402,%d\n20230401,%d\n", i, i, i)
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("in%d.csv", i)), []byte(data), 0644); err != nil {
+			t.Fatalf("failed to prepare input: %s", err)
+		}
+	}
+
+	origOutputDir, origSummary, origJobs := *outputDir, summary, chopJobs
+	*outputDir, summary, chopJobs = filepath.Join(dir, "out"), Summary{}, NewJobRunner(2)
+	defer func() { *outputDir, summary, chopJobs = origOutputDir, origSummary, origJobs }()
+
+	ChopRecursive(context.Background(), dir)
+	chopJobs.Wait()
+
+	if summary.InputFiles != 4 || summary.WrittenRows != 12 {
+		t.Errorf("expected 4 input files and 12 written rows but got %d input files and %d written rows", summary.InputFiles, summary.WrittenRows)
+	}
+	for i := 0; i < 4; i++ {
+		name, err := outputName(filepath.Join(dir, fmt.Sprintf("in%d.csv", i)))
+		if err != nil {
+			t.Fatalf("failed to resolve output name: %s", err)
+		}
+		path := filepath.Join(*outputDir, PartitionDir(time.Date(2023, 4, 1, 0, 0, 0, 0, time.Local)), name)
+		if got, want := readBzip2CSV(t, path), [][]string{{"20230401", fmt.Sprint(i)}, {"20230401", fmt.Sprint(i)}}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected %q but got %q", path, want, got)
+		}
+	}
+}
+
+func TestChop_verbosity(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "input.csv")
+	if err := os.WriteFile(path, []byte("20230401,a\ninvalid,b\ninvalid,c\n"), 0644); err != nil {
+		t.Fatalf("failed to prepare input: %s", err)
+	}
+
+	tests := []struct {
+		Name    string
+		Quiet   bool
+		Verbose bool
+		Logs    []string
+	}{
+		{"default", false, false, []string{"open input file", "write to", "ignore 2 rows in"}},
+		{"quiet", true, false, []string{"open input file", "ignore 2 rows in"}},
+		{"verbose", false, true, []string{"open input file", "write to", "ignore row 2", "ignore row 3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			setOutputDir(t)
+
+			var buf strings.Builder
+			origLog, origQuiet, origVerbose, origSummary := textLog, *quietLog, *verboseLog, summary
+			textLog = log.New(&buf, "", 0)
+			*quietLog, *verboseLog, summary = tt.Quiet, tt.Verbose, Summary{}
+			defer func() { textLog, *quietLog, *verboseLog, summary = origLog, origQuiet, origVerbose, origSummary }()
+
+			Chop(context.Background(), path)
+
+			var logs []string
+			for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+				for _, prefix := range []string{"open input file", "write to", "ignore row 2", "ignore row 3", "ignore 2 rows in"} {
+					if strings.HasPrefix(line, prefix) {
+						logs = append(logs, prefix)
+					}
+				}
+			}
+			if !reflect.DeepEqual(logs, tt.Logs) {
+				t.Errorf("unexpected logs\nexpected: %q\n but got: %q\n\n%s", tt.Logs, logs, buf.String())
+			}
+		})
+	}
+}
+
+func TestChop_onRagged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "input.csv")
+	if err := os.WriteFile(path, []byte("20230401,a,b\n20230401,c\n20230401,d,e,f\n"), 0644); err != nil {
+		t.Fatalf("failed to prepare input: %s", err)
+	}
+	day := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		Policy string
+		Output [][]string
+	}{
+		{"pad", [][]string{{"20230401", "a", "b"}, {"20230401", "c", ""}, {"20230401", "d", "e"}}},
+		{"truncate", [][]string{{"20230401", "a", "b"}, {"20230401", "c"}, {"20230401", "d", "e"}}},
+		{"skip", [][]string{{"20230401", "a", "b"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Policy, func(t *testing.T) {
+			dir := setOutputDir(t)
+
+			orig, origSummary := *onRagged, summary
+			*onRagged, summary = tt.Policy, Summary{}
+			defer func() { *onRagged, summary = orig, origSummary }()
+
+			Chop(context.Background(), path)
+
+			if summary.RaggedRows != 2 {
+				t.Errorf("expected 2 ragged rows but got %d", summary.RaggedRows)
+			}
+
+			entries, err := os.ReadDir(filepath.Join(dir, PartitionDir(day)))
+			if err != nil || len(entries) != 1 {
+				t.Fatalf("expected 1 output file but got %v and %v", entries, err)
+			}
+
+			// The rows have different number of columns, so read it without checking the number of fields.
+			f, err := os.Open(filepath.Join(dir, PartitionDir(day), entries[0].Name()))
+			if err != nil {
+				t.Fatalf("failed to open: %s", err)
+			}
+			defer f.Close()
+			r := csv.NewReader(bzip2.NewReader(f))
+			r.FieldsPerRecord = -1
+			got, err := r.ReadAll()
+			if err != nil {
+				t.Fatalf("failed to read: %s", err)
+			}
+			if !reflect.DeepEqual(got, tt.Output) {
+				t.Errorf("expected %q but got %q", tt.Output, got)
+			}
+		})
+	}
+}
+
+func TestNewReader_skipLines(t *testing.T) {
+	long := strings.Repeat("x", 10000) // longer than the buffer of bufio.Reader
+	input := "preamble\n" + long + "\n" + "# comment\n20230401,a\n#20230401,b\n20230401,c\n"
+
+	tests := []struct {
+		Name      string
+		SkipLines int
+		Comment   string
+		Output    [][]string
+	}{
+		{"skip", 2, "", [][]string{{"# comment"}, {"20230401", "a"}, {"#20230401", "b"}, {"20230401", "c"}}},
+		{"skip and comment", 2, "#", [][]string{{"20230401", "a"}, {"20230401", "c"}}},
+		{"skip all", 10, "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			origSkip, origComment, origRagged := *skipLines, *commentChar, *onRagged
+			*skipLines, *commentChar, *onRagged = tt.SkipLines, tt.Comment, "pad"
+			defer func() { *skipLines, *commentChar, *onRagged = origSkip, origComment, origRagged }()
+
+			r := NewReader(io.NopCloser(strings.NewReader(input)))
+			defer r.Close()
+
+			var got [][]string
+			for {
+				row, err := r.Next()
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatalf("failed to read: %s", err)
+				}
+				got = append(got, append([]string(nil), row...))
+			}
+			if !reflect.DeepEqual(got, tt.Output) {
+				t.Errorf("expected %q but got %q", tt.Output, got)
+			}
+		})
+	}
+}
+
+func TestChop_maxRows(t *testing.T) {
+	dir := t.TempDir()
+	var inputs []string
+	for _, name := range []string{"a", "b", "c"} {
+		path := filepath.Join(dir, name+".csv")
+		if err := os.WriteFile(path, []byte(fmt.Sprintf("20230401,%[1]s1\n20230401,%[1]s2\n20230401,%[1]s3\n", name)), 0644); err != nil {
+			t.Fatalf("failed to prepare input: %s", err)
+		}
+		inputs = append(inputs, path)
+	}
+
+	tests := []struct {
+		Name      string
+		MaxRows   int
+		MaxTotal  int64
+		Completes []bool
+		Rows      int
+	}{
+		{"unlimited", 0, 0, []bool{true, true, true}, 9},
+		{"max-rows", 2, 0, []bool{false, false, false}, 6},
+		{"max-total-rows", 0, 4, []bool{true, false, false}, 4},
+		{"both", 2, 3, []bool{false, false, false}, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			setOutputDir(t)
+
+			origMax, origTotal, origSummary := *maxRows, *maxTotalRows, summary
+			*maxRows, *maxTotalRows, summary, totalRows = tt.MaxRows, tt.MaxTotal, Summary{}, 0
+			defer func() { *maxRows, *maxTotalRows, summary, totalRows = origMax, origTotal, origSummary, 0 }()
+
+			var completes []bool
+			for _, input := range inputs {
+				completes = append(completes, Chop(context.Background(), input))
+			}
+
+			if !reflect.DeepEqual(completes, tt.Completes) {
+				t.Errorf("expected %v but got %v", tt.Completes, completes)
+			}
+			if summary.WrittenRows != tt.Rows {
+				t.Errorf("expected %d rows but got %d", tt.Rows, summary.WrittenRows)
+			}
+		})
+	}
+}
+
+func TestCreate_compressionLevel(t *testing.T) {
+	tests := []struct {
+		Level  int
+		Header string
+	}{
+		{0, "BZh9"},
+		{1, "BZh1"},
+		{5, "BZh5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.Level), func(t *testing.T) {
+			orig := *compressLevel
+			*compressLevel = tt.Level
+			defer func() { *compressLevel = orig }()
+
+			path := filepath.Join(t.TempDir(), "a.csv.bz2")
+			w, err := Create(path)
+			if err != nil {
+				t.Fatalf("failed to create: %s", err)
+			}
+			if err := w.Write([]string{"20230401", "hello"}); err != nil {
+				t.Fatalf("failed to write: %s", err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("failed to close: %s", err)
+			}
+			if err := CompleteUploads(); err != nil {
+				t.Fatalf("failed to complete: %s", err)
+			}
+
+			b, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("failed to read: %s", err)
+			}
+			if !strings.HasPrefix(string(b), tt.Header) {
+				t.Errorf("expected header %q but got %q", tt.Header, b[:4])
+			}
+			if got := readBzip2CSV(t, path); !reflect.DeepEqual(got, [][]string{{"20230401", "hello"}}) {
+				t.Errorf("unexpected output: %q", got)
+			}
+		})
+	}
+}
+
+func TestChop_keepGoing(t *testing.T) {
+	dir := setOutputDir(t)
+
+	origKeep, origSummary, origCode := *keepGoing, summary, failedExitCode
+	*keepGoing, summary, failedExitCode = true, Summary{}, ExitOK
+	defer func() { *keepGoing, summary, failedExitCode = origKeep, origSummary, origCode }()
+
+	input := t.TempDir()
+	broken := filepath.Join(input, "broken.csv")
+	if err := os.WriteFile(broken, []byte("20230401,a\n20230401,\"b\n"), 0644); err != nil {
+		t.Fatalf("failed to prepare input: %s", err)
+	}
+
+	if Chop(context.Background(), broken) {
+		t.Errorf("expected the broken file is not completed")
+	}
+	if Chop(context.Background(), filepath.Join(input, "missing.csv")) {
+		t.Errorf("expected the missing file is not completed")
+	}
+
+	if len(summary.FailedFiles) != 2 {
+		t.Fatalf("expected 2 failed files but got %q", summary.FailedFiles)
+	}
+	if failedExitCode != ExitDecodeError {
+		t.Errorf("expected exit code of the first failure %d but got %d", ExitDecodeError, failedExitCode)
+	}
+	if err := CompleteUploads(); err != nil {
+		t.Fatalf("failed to complete: %s", err)
+	}
+
+	// The rows before the broken row are discarded.
+	entries, err := os.ReadDir(filepath.Join(dir, "year=2023", "month=4", "day=1"))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("failed to read output directory: %s", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected no output files but got %v", entries)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ManifestEntry is an output file in the manifest of -manifest.
+type ManifestEntry struct {
+	Path   string   `json:"path"` // relative to the output directory, and slash separated
+	Size   int64    `json:"size"`
+	SHA256 string   `json:"sha256"`
+	Rows   int64    `json:"rows"`
+	Inputs []string `json:"inputs"`
+
+	span     TimeRange // the timestamps of the rows, for -partition-metadata
+	appended bool      // the rows are appended into the file of the other run
+}
+
+// Manifest is the list of the output files that written in a run, for data-lineage audits and to detect bit-rot.
+type Manifest struct {
+	Created time.Time       `json:"created"`
+	Files   []ManifestEntry `json:"files"`
+}
+
+// manifestFiles is the output files that written in this run, with the number of rows and the input.
+var manifestFiles = map[string]*ManifestEntry{}
+
+// RecordManifest records the files that written by w from the input, to write the manifest later.
+// The file written from the same input again in this run is replaced.
+func RecordManifest(inputPath string, w *PartitionWriter) {
+	chopMu.Lock()
+	defer chopMu.Unlock()
+
+	for _, f := range w.Files() {
+		manifestFiles[f] = &ManifestEntry{
+			Rows:     w.Rows(f),
+			Inputs:   []string{inputPath},
+			span:     w.Span(f),
+			appended: w.Appended(f),
+		}
+	}
+}
+
+// relOutputPath returns the path relative to the output directory, and slash separated.
+func relOutputPath(dir, path string) string {
+	if isRemoteURL(dir) {
+		return strings.TrimPrefix(path, strings.TrimSuffix(dir, "/")+"/")
+	}
+	if rel, err := filepath.Rel(dir, path); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.ToSlash(path)
+}
+
+// fileDigest returns the size and the SHA-256 hash of the output file.
+func fileDigest(path string) (int64, string, error) {
+	if o, ok := uploadedObjects[path]; ok {
+		size, err := o.Size()
+		return size, hex.EncodeToString(o.SHA256()), err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// MakeManifest makes the Manifest of the files that written in this run.
+//
+// WARNING: this function reads commandline flags directly.
+func MakeManifest() (Manifest, error) {
+	m := Manifest{Created: outputTime(), Files: []ManifestEntry{}}
+
+	paths := make([]string, 0, len(manifestFiles))
+	for p := range manifestFiles {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		e := *manifestFiles[p]
+		e.Path = relOutputPath(*outputDir, p)
+
+		var err error
+		e.Size, e.SHA256, err = fileDigest(p)
+		if err != nil {
+			return m, err
+		}
+		m.Files = append(m.Files, e)
+	}
+	return m, nil
+}
+
+// WriteManifest writes the Manifest into path.
+// The format is CSV if path ends with ".csv", otherwise JSON.
+func WriteManifest(path string, m Manifest) error {
+	var b bytes.Buffer
+	if strings.HasSuffix(path, ".csv") {
+		w := NewCSVWriter(&b)
+		w.Write([]string{"path", "size", "sha256", "rows", "inputs"})
+		for _, e := range m.Files {
+			w.Write([]string{
+				e.Path,
+				strconv.FormatInt(e.Size, 10),
+				e.SHA256,
+				strconv.FormatInt(e.Rows, 10),
+				strings.Join(e.Inputs, ";"),
+			})
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return err
+		}
+	} else {
+		enc := json.NewEncoder(&b)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(m); err != nil {
+			return err
+		}
+	}
+	return writeOutput(path, b.Bytes())
+}
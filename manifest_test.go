@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestManifest(t *testing.T) {
+	dir := setOutputDir(t)
+
+	orig := manifestFiles
+	manifestFiles = map[string]*ManifestEntry{}
+	defer func() { manifestFiles = orig }()
+
+	day1 := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+	day2 := time.Date(2023, 4, 2, 0, 0, 0, 0, time.UTC)
+
+	w := NewPartitionWriter("a.csv.bz2")
+	for _, d := range []time.Time{day1, day2, day1} {
+		if err := w.Write(d, []string{d.Format("20060102"), "x"}); err != nil {
+			t.Fatalf("failed to write: %s", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+	if err := CompleteUploads(); err != nil {
+		t.Fatalf("failed to complete: %s", err)
+	}
+	RecordManifest("input.csv", w)
+
+	m, err := MakeManifest()
+	if err != nil {
+		t.Fatalf("failed to make manifest: %s", err)
+	}
+
+	expected := []struct {
+		Path string
+		Rows int64
+		Day  time.Time
+	}{
+		{"year=2023/month=4/day=1/a.csv.bz2", 2, day1},
+		{"year=2023/month=4/day=2/a.csv.bz2", 1, day2},
+	}
+	if len(m.Files) != len(expected) {
+		t.Fatalf("expected %d files but got %v", len(expected), m.Files)
+	}
+	for i, e := range expected {
+		b, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(e.Path)))
+		if err != nil {
+			t.Fatalf("failed to read output: %s", err)
+		}
+		sum := sha256.Sum256(b)
+
+		want := ManifestEntry{Path: e.Path, Size: int64(len(b)), SHA256: hex.EncodeToString(sum[:]), Rows: e.Rows, Inputs: []string{"input.csv"}, span: TimeRange{Since: e.Day, Until: e.Day}}
+		if !reflect.DeepEqual(m.Files[i], want) {
+			t.Errorf("expected %v but got %v", want, m.Files[i])
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "manifest.csv")
+	if err := WriteManifest(path, m); err != nil {
+		t.Fatalf("failed to write manifest: %s", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open manifest: %s", err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to read manifest: %s", err)
+	}
+	want := [][]string{
+		{"path", "size", "sha256", "rows", "inputs"},
+		{m.Files[0].Path, strconv.FormatInt(m.Files[0].Size, 10), m.Files[0].SHA256, "2", "input.csv"},
+		{m.Files[1].Path, strconv.FormatInt(m.Files[1].Size, 10), m.Files[1].SHA256, "1", "input.csv"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("unexpected manifest\nexpected: %q\n but got: %q", want, rows)
+	}
+}
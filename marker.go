@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// successMarker is the name of the marker file that Spark and Hadoop use to know the directory is completely written.
+const successMarker = "_SUCCESS"
+
+// markerScopes is the scopes to write the marker files for -success-markers.
+var markerScopes = map[string]bool{}
+
+// ParseSuccessMarkers parses -success-markers, that is a comma separated list of "partition" and "run".
+func ParseSuccessMarkers(s string) (map[string]bool, error) {
+	scopes := make(map[string]bool)
+	for _, x := range strings.Split(s, ",") {
+		switch x = strings.TrimSpace(x); x {
+		case "":
+		case "partition", "run":
+			scopes[x] = true
+		default:
+			return nil, fmt.Errorf("invalid scope: %s", x)
+		}
+	}
+	return scopes, nil
+}
+
+// RemoveSuccessMarker removes the marker file in the partition before writing, so that the readers do not see the partition that being written.
+// Sinks have nothing to remove, because the objects become visible at once when completed.
+//
+// WARNING: this function reads commandline flags directly.
+func RemoveSuccessMarker(partition string) error {
+	if !markerScopes["partition"] {
+		return nil
+	}
+	for _, d := range outputDirs() {
+		if err := removeMarker(outputPath(d, partition, successMarker)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveRunMarker removes the marker file in the output directory before writing.
+//
+// WARNING: this function reads commandline flags directly.
+func RemoveRunMarker() error {
+	if !markerScopes["run"] {
+		return nil
+	}
+	for _, d := range outputDirs() {
+		if err := removeMarker(outputPath(d, successMarker)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func removeMarker(path string) error {
+	if isRemoteURL(path) {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// WriteSuccessMarkers writes the marker files into the partitions that written in this run, and into the output directory.
+//
+// WARNING: this function reads commandline flags directly.
+func WriteSuccessMarkers() error {
+	for _, d := range outputDirs() {
+		if markerScopes["partition"] {
+			for _, p := range WrittenPartitions() {
+				if err := writeOutput(outputPath(d, filepath.FromSlash(p), successMarker), nil); err != nil {
+					return err
+				}
+			}
+		}
+		if markerScopes["run"] {
+			if err := makeOutputDir(d); err != nil {
+				return err
+			}
+			if err := writeOutput(outputPath(d, successMarker), nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
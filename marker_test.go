@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSuccessMarkers(t *testing.T) {
+	tests := []struct {
+		Input  string
+		Output map[string]bool
+	}{
+		{"", map[string]bool{}},
+		{"partition", map[string]bool{"partition": true}},
+		{"partition, run", map[string]bool{"partition": true, "run": true}},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseSuccessMarkers(tt.Input)
+		if err != nil {
+			t.Fatalf("%q: failed to parse: %s", tt.Input, err)
+		}
+		if !reflect.DeepEqual(got, tt.Output) {
+			t.Errorf("%q: expected %v but got %v", tt.Input, tt.Output, got)
+		}
+	}
+
+	if _, err := ParseSuccessMarkers("partition,table"); err == nil || err.Error() != "invalid scope: table" {
+		t.Errorf("expected invalid scope error but got %v", err)
+	}
+}
+
+func TestSuccessMarkers(t *testing.T) {
+	dir := setOutputDir(t)
+
+	origScopes, origPartitions := markerScopes, writtenPartitions
+	markerScopes = map[string]bool{"partition": true, "run": true}
+	writtenPartitions = make(map[string]bool)
+	defer func() { markerScopes, writtenPartitions = origScopes, origPartitions }()
+
+	day := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+	partitionMarker := filepath.Join(dir, PartitionDir(day), successMarker)
+	runMarker := filepath.Join(dir, successMarker)
+
+	write := func() {
+		t.Helper()
+		w := NewPartitionWriter("a.csv.bz2")
+		if err := w.Write(day, []string{"20230401", "a"}); err != nil {
+			t.Fatalf("failed to write: %s", err)
+		}
+		if _, err := os.Stat(partitionMarker); !os.IsNotExist(err) {
+			t.Errorf("expected the marker is removed while writing but got %v", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("failed to close: %s", err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := RemoveRunMarker(); err != nil {
+			t.Fatalf("failed to remove run marker: %s", err)
+		}
+		if _, err := os.Stat(runMarker); !os.IsNotExist(err) {
+			t.Errorf("expected the run marker is removed but got %v", err)
+		}
+
+		write()
+
+		if err := WriteSuccessMarkers(); err != nil {
+			t.Fatalf("failed to write markers: %s", err)
+		}
+		for _, path := range []string{partitionMarker, runMarker} {
+			if _, err := os.Stat(path); err != nil {
+				t.Errorf("expected %s exists but got %s", path, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// masks is the masking methods for each column (0-origin).
+var masks map[int]string
+
+// maskKey is the secret key for the sha256 masking.
+// If it is not empty, sha256 masking uses HMAC-SHA256 instead of plain SHA-256.
+var maskKey []byte
+
+// ParseMasks parses -mask-columns flag like "2:sha256,5:redact".
+func ParseMasks(s string) (map[int]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	ms := make(map[int]string)
+	for _, x := range strings.Split(s, ",") {
+		xs := strings.SplitN(strings.TrimSpace(x), ":", 2)
+		if len(xs) != 2 {
+			return nil, fmt.Errorf("invalid mask: %q: the method is missing", x)
+		}
+
+		n, err := strconv.Atoi(xs[0])
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid mask: %q: invalid column number", x)
+		}
+
+		switch xs[1] {
+		case "sha256", "redact":
+		default:
+			return nil, fmt.Errorf("invalid mask: %q: unknown method", x)
+		}
+
+		ms[n-1] = xs[1]
+	}
+	return ms, nil
+}
+
+// MaskRecord masks the columns in masks.
+func MaskRecord(record []string) {
+	for i, m := range masks {
+		if i >= len(record) {
+			continue
+		}
+
+		switch m {
+		case "sha256":
+			record[i] = hashValue(record[i])
+		case "redact":
+			record[i] = ""
+		}
+	}
+}
+
+func hashValue(s string) string {
+	if len(maskKey) == 0 {
+		h := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(h[:])
+	}
+
+	m := hmac.New(sha256.New, maskKey)
+	m.Write([]byte(s))
+	return hex.EncodeToString(m.Sum(nil))
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMasks(t *testing.T) {
+	got, err := ParseMasks("2:sha256, 5:redact")
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+	if want := map[int]string{1: "sha256", 4: "redact"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v but got %v", want, got)
+	}
+
+	for _, s := range []string{"2", "0:sha256", "a:sha256", "2:md5"} {
+		if _, err := ParseMasks(s); err == nil {
+			t.Errorf("%q: expected error but got nil", s)
+		}
+	}
+}
+
+func TestMaskRecord(t *testing.T) {
+	origMasks, origKey := masks, maskKey
+	defer func() { masks, maskKey = origMasks, origKey }()
+
+	masks = map[int]string{1: "sha256", 2: "redact", 10: "redact"}
+
+	maskKey = nil
+	record := []string{"20230401", "abc", "secret", "keep"}
+	MaskRecord(record)
+	if want := []string{"20230401", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", "", "keep"}; !reflect.DeepEqual(record, want) {
+		t.Errorf("expected %q but got %q", want, record)
+	}
+
+	// With -mask-key, the value is hashed by HMAC-SHA256.
+	maskKey = []byte("key")
+	record = []string{"20230401", "The quick brown fox jumps over the lazy dog"}
+	MaskRecord(record)
+	if want := []string{"20230401", "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"}; !reflect.DeepEqual(record, want) {
+		t.Errorf("expected %q but got %q", want, record)
+	}
+}
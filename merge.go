@@ -0,0 +1,276 @@
+package main
+
+import (
+	"container/heap"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// timedRow is a row with its parsed timestamp.
+type timedRow struct {
+	Time time.Time
+	Row  []string
+}
+
+// readSortedRows reads all rows in a partition file, and sorts them by timestamp.
+func readSortedRows(path string) ([]timedRow, error) {
+	r, err := OpenPartition(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var rows []timedRow
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		t, err := ParseTimestamp(row[0])
+		if err != nil {
+			logger.With("file", path, "error", err).Warnf("ignore a row in %s because invalid timestamp: %s: %s", path, row[0], err)
+			continue
+		}
+		rows = append(rows, timedRow{t, row})
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].Time.Before(rows[j].Time)
+	})
+
+	return rows, nil
+}
+
+// readPartition reads all files in the partition in parallel.
+// Each result is sorted by timestamp.
+func readPartition(p Partition, jobs int) ([][]timedRow, error) {
+	results := make([][]timedRow, len(p.Files))
+	errs := make([]error, len(p.Files))
+
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for i, f := range p.Files {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, f string) {
+			defer wg.Done()
+			results[i], errs[i] = readSortedRows(f)
+			<-sem
+		}(i, f)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// mergeCursor points a row in a sorted list of rows.
+type mergeCursor struct {
+	rows []timedRow
+	src  int
+	pos  int
+}
+
+// mergeHeap is a min-heap of mergeCursor, for k-way merge.
+type mergeHeap []*mergeCursor
+
+func (h mergeHeap) Len() int {
+	return len(h)
+}
+
+func (h mergeHeap) Less(i, j int) bool {
+	a, b := h[i].rows[h[i].pos], h[j].rows[h[j].pos]
+	if a.Time.Equal(b.Time) {
+		return h[i].src < h[j].src
+	}
+	return a.Time.Before(b.Time)
+}
+
+func (h mergeHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *mergeHeap) Push(x interface{}) {
+	*h = append(*h, x.(*mergeCursor))
+}
+
+func (h *mergeHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// mergeSorted merges sorted lists of rows, and writes them by write in the order of timestamp.
+// The rows that have the same timestamp are written in the order of sources.
+func mergeSorted(sources [][]timedRow, write func([]string) error) error {
+	h := make(mergeHeap, 0, len(sources))
+	for i, rows := range sources {
+		if len(rows) > 0 {
+			h = append(h, &mergeCursor{rows: rows, src: i})
+		}
+	}
+	heap.Init(&h)
+
+	for h.Len() > 0 {
+		c := h[0]
+		if err := write(c.rows[c.pos].Row); err != nil {
+			return err
+		}
+
+		c.pos++
+		if c.pos < len(c.rows) {
+			heap.Fix(&h, 0)
+		} else {
+			heap.Pop(&h)
+		}
+	}
+
+	return nil
+}
+
+// filterTimedRows returns the rows in r.
+func filterTimedRows(rows []timedRow, r TimeRange) []timedRow {
+	filtered := rows[:0]
+	for _, row := range rows {
+		if r.Contains(row.Time) {
+			filtered = append(filtered, row)
+		}
+	}
+	return filtered
+}
+
+// Merge reads all partitions in dir, and writes the rows in r into w in the order of timestamp.
+//
+// Partitions never overlap, so Merge processes them one by one in the order of time.
+// The files in a partition are read in parallel, and merged with k-way merge.
+// The next partition is read while merging the current one.
+func Merge(dir string, w *CSVWriter, jobs int, r TimeRange) error {
+	all, err := ListPartitions(dir)
+	if err != nil {
+		return err
+	}
+
+	// The partition directories have no timezone, so the range is widened by a day to keep the partitions in any timezone.
+	ps := make([]Partition, 0, len(all))
+	for _, p := range all {
+		if !r.Until.IsZero() && !p.Time.AddDate(0, 0, -1).Before(r.Until) {
+			continue
+		}
+		if !r.Since.IsZero() && !PartitionEnd(p.Time).AddDate(0, 0, 1).After(r.Since) {
+			continue
+		}
+		ps = append(ps, p)
+	}
+
+	type loaded struct {
+		sources [][]timedRow
+		err     error
+	}
+	ch := make(chan loaded, 1)
+	go func() {
+		defer close(ch)
+		for _, p := range ps {
+			sources, err := readPartition(p, jobs)
+			ch <- loaded{sources, err}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	for l := range ch {
+		if l.err != nil {
+			return l.err
+		}
+		for i, rows := range l.sources {
+			l.sources[i] = filterTimedRows(rows, r)
+		}
+		if err := mergeSorted(l.sources, w.Write); err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+	return w.Error()
+}
+
+// runMerge runs merge subcommand.
+func runMerge(args []string) {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	jobs := fs.Int("jobs", 4, "The number of files to read in parallel.")
+	since := fs.String("since", *sinceTime, "Merge only rows whose timestamp is equal or after this time, like 2023-03-01.")
+	until := fs.String("until", *untilTime, "Merge only rows whose timestamp is before this time, like 2023-04-01.")
+	output := fs.String("o", "", "Write the merged CSV into this file instead of stdout.")
+	fs.Usage = func() {
+		fmt.Println("Usage: chop-csv merge [OPTIONS] [MERGE OPTIONS] OUTDIR")
+		fmt.Println()
+		fmt.Println("Merge all partitions in OUTDIR into a CSV in the order of timestamp, and write it to stdout.")
+		fmt.Println("The partitions out of -since and -until are not read.")
+		fmt.Println()
+		fmt.Println("MERGE OPTIONS:")
+		printCommandDefaults(fs)
+	}
+	parseCommand(fs, args)
+
+	if fs.NArg() != 1 || *jobs < 1 {
+		fs.Usage()
+		os.Exit(ExitUsage)
+	}
+
+	var r TimeRange
+	var err error
+	if *since != "" {
+		if r.Since, err = ParseTimeFlag(*since); err != nil {
+			fatalf(ExitUsage, "failed to parse -since: %s", err)
+		}
+	}
+	if *until != "" {
+		if r.Until, err = ParseTimeFlag(*until); err != nil {
+			fatalf(ExitUsage, "failed to parse -until: %s", err)
+		}
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fatalf(ExitOutputError, "failed to create output: %s", err)
+		}
+		defer func() {
+			if err := f.Close(); err != nil {
+				fatalf(ExitOutputError, "failed to write output: %s", err)
+			}
+		}()
+		out = f
+	}
+	var enc *transform.Writer
+	if outputEncoding != unicode.UTF8 {
+		enc = transform.NewWriter(out, outputEncoding.NewEncoder())
+		out = enc
+	}
+
+	if err := Merge(fs.Arg(0), NewOutputCSVWriter(out), *jobs, r); err != nil {
+		fatalf(ExitInputError, "failed to merge: %s", err)
+	}
+	if enc != nil {
+		if err := enc.Close(); err != nil {
+			fatalf(ExitInputError, "failed to merge: %s", err)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writePartitionFile writes rows into the file named name in the partition of t under dir.
+func writePartitionFile(t *testing.T, dir string, day time.Time, name string, rows [][]string) {
+	t.Helper()
+
+	path := filepath.Join(dir, PartitionDir(day), name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("failed to make directory: %s", err)
+	}
+	w, err := Create(path)
+	if err != nil {
+		t.Fatalf("failed to create: %s", err)
+	}
+	for _, row := range rows {
+		if err := w.Write(row); err != nil {
+			t.Fatalf("failed to write: %s", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+	if err := CompleteUploads(); err != nil {
+		t.Fatalf("failed to rename into place: %s", err)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	origFormats := dateFormats
+	dateFormats = stringList{"2006-01-02 15:04"}
+	defer func() { dateFormats = origFormats }()
+
+	dir := t.TempDir()
+	day1 := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+	day2 := time.Date(2023, 4, 2, 0, 0, 0, 0, time.UTC)
+
+	writePartitionFile(t, dir, day2, "a.csv.bz2", [][]string{
+		{"2023-04-02 10:00", "a3"},
+	})
+	writePartitionFile(t, dir, day1, "a.csv.bz2", [][]string{
+		{"2023-04-01 12:00", "a2"},
+		{"2023-04-01 09:00", "a1"},
+	})
+	writePartitionFile(t, dir, day1, "b.csv.bz2", [][]string{
+		{"2023-04-01 10:00", "b1"},
+		{"invalid", "ignored"},
+		{"2023-04-01 12:00", "b2"},
+	})
+	writePartitionFile(t, dir, day2, "b.csv.bz2", [][]string{
+		{"2023-04-02 11:00", "b4"},
+		{"2023-04-02 09:00", "b3"},
+	})
+
+	ps, err := ListPartitions(dir)
+	if err != nil {
+		t.Fatalf("failed to list partitions: %s", err)
+	}
+	if len(ps) != 2 || !ps[0].Time.Equal(day1) || !ps[1].Time.Equal(day2) || len(ps[0].Files) != 2 {
+		t.Fatalf("unexpected partitions: %+v", ps)
+	}
+
+	var buf bytes.Buffer
+	if err := Merge(dir, NewCSVWriter(&buf), 2, TimeRange{}); err != nil {
+		t.Fatalf("failed to merge: %s", err)
+	}
+
+	got, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to read the output: %s", err)
+	}
+	// The rows at the same time are in the order of the files.
+	want := [][]string{
+		{"2023-04-01 09:00", "a1"},
+		{"2023-04-01 10:00", "b1"},
+		{"2023-04-01 12:00", "a2"},
+		{"2023-04-01 12:00", "b2"},
+		{"2023-04-02 09:00", "b3"},
+		{"2023-04-02 10:00", "a3"},
+		{"2023-04-02 11:00", "b4"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected output\nexpected: %q\n but got: %q", want, got)
+	}
+}
+
+func TestMerge_timeRange(t *testing.T) {
+	origFormats := dateFormats
+	dateFormats = stringList{"2006-01-02 15:04"}
+	defer func() { dateFormats = origFormats }()
+
+	dir := t.TempDir()
+	for _, d := range []int{1, 2, 3} {
+		day := time.Date(2023, 4, d, 0, 0, 0, 0, time.UTC)
+		writePartitionFile(t, dir, day, "a.csv.bz2", [][]string{
+			{day.Add(9 * time.Hour).Format("2006-01-02 15:04"), "morning"},
+			{day.Add(21 * time.Hour).Format("2006-01-02 15:04"), "night"},
+		})
+	}
+
+	// The partitions far out of the range are not read, so the broken file does not matter.
+	broken := filepath.Join(dir, PartitionDir(time.Date(2023, 4, 10, 0, 0, 0, 0, time.UTC)), "a.csv.bz2")
+	if err := os.MkdirAll(filepath.Dir(broken), 0755); err != nil {
+		t.Fatalf("failed to make directory: %s", err)
+	}
+	if err := os.WriteFile(broken, []byte("broken"), 0644); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+
+	r := TimeRange{
+		Since: time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC),
+		Until: time.Date(2023, 4, 3, 12, 0, 0, 0, time.UTC),
+	}
+	var buf bytes.Buffer
+	if err := Merge(dir, NewCSVWriter(&buf), 2, r); err != nil {
+		t.Fatalf("failed to merge: %s", err)
+	}
+
+	got, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to read the output: %s", err)
+	}
+	want := [][]string{
+		{"2023-04-01 21:00", "night"},
+		{"2023-04-02 09:00", "morning"},
+		{"2023-04-02 21:00", "night"},
+		{"2023-04-03 09:00", "morning"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected output\nexpected: %q\n but got: %q", want, got)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// metadataFile is the name of the metadata file in each partition, for -partition-metadata.
+const metadataFile = "_metadata.json"
+
+// MetadataFile is an output file in the metadata of a partition.
+type MetadataFile struct {
+	Name         string    `json:"name"`
+	Size         int64     `json:"size"`
+	SHA256       string    `json:"sha256"`
+	Rows         int64     `json:"rows"`
+	MinTimestamp time.Time `json:"min_timestamp"`
+	MaxTimestamp time.Time `json:"max_timestamp"`
+	Sources      []string  `json:"sources"`
+}
+
+// PartitionMetadata is the content of the metadata file in each partition, for partition pruning and checking completeness.
+type PartitionMetadata struct {
+	Partition    string         `json:"partition"` // relative to the output directory, and slash separated
+	Rows         int64          `json:"rows"`
+	MinTimestamp time.Time      `json:"min_timestamp"`
+	MaxTimestamp time.Time      `json:"max_timestamp"`
+	Sources      []string       `json:"sources"`
+	Files        []MetadataFile `json:"files"`
+}
+
+// readPartitionMetadata reads the metadata file that written by the previous run.
+// It returns empty metadata if the file does not exist or is on a Sink.
+func readPartitionMetadata(path string) (PartitionMetadata, error) {
+	var m PartitionMetadata
+	if isRemoteURL(path) {
+		return m, nil
+	}
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	} else if err != nil {
+		return m, err
+	}
+	return m, json.Unmarshal(b, &m)
+}
+
+// mergeSources returns the sorted union of xs and ys.
+func mergeSources(xs, ys []string) []string {
+	set := make(map[string]bool)
+	for _, x := range xs {
+		set[x] = true
+	}
+	for _, y := range ys {
+		set[y] = true
+	}
+	ss := make([]string, 0, len(set))
+	for s := range set {
+		ss = append(ss, s)
+	}
+	sort.Strings(ss)
+	return ss
+}
+
+// MakePartitionMetadata makes the metadata of the partition dir, from the files that written in this run and the metadata of the previous runs.
+// The files of the previous runs are kept in the metadata if they still exist.
+//
+// WARNING: this function reads commandline flags directly.
+func MakePartitionMetadata(dir string, paths []string) (PartitionMetadata, error) {
+	old, err := readPartitionMetadata(outputPath(*outputDir, filepath.FromSlash(dir), metadataFile))
+	if err != nil {
+		return PartitionMetadata{}, err
+	}
+
+	files := make(map[string]MetadataFile)
+	for _, f := range old.Files {
+		if _, err := os.Stat(outputPath(*outputDir, filepath.FromSlash(dir), f.Name)); err == nil {
+			files[f.Name] = f
+		}
+	}
+
+	for _, p := range paths {
+		e := manifestFiles[p]
+		f := MetadataFile{
+			Name:         path.Base(relOutputPath(*outputDir, p)),
+			Rows:         e.Rows,
+			MinTimestamp: e.span.Since,
+			MaxTimestamp: e.span.Until,
+			Sources:      mergeSources(e.Inputs, nil),
+		}
+		if f.Size, f.SHA256, err = fileDigest(p); err != nil {
+			return PartitionMetadata{}, err
+		}
+
+		if prev, ok := files[f.Name]; ok && e.appended {
+			f.Rows += prev.Rows
+			if prev.MinTimestamp.Before(f.MinTimestamp) {
+				f.MinTimestamp = prev.MinTimestamp
+			}
+			if prev.MaxTimestamp.After(f.MaxTimestamp) {
+				f.MaxTimestamp = prev.MaxTimestamp
+			}
+			f.Sources = mergeSources(prev.Sources, f.Sources)
+		}
+		files[f.Name] = f
+	}
+
+	m := PartitionMetadata{Partition: dir, Sources: []string{}, Files: make([]MetadataFile, 0, len(files))}
+	for _, f := range files {
+		m.Files = append(m.Files, f)
+	}
+	sort.Slice(m.Files, func(i, j int) bool {
+		return m.Files[i].Name < m.Files[j].Name
+	})
+
+	for i, f := range m.Files {
+		m.Rows += f.Rows
+		if i == 0 || f.MinTimestamp.Before(m.MinTimestamp) {
+			m.MinTimestamp = f.MinTimestamp
+		}
+		if i == 0 || f.MaxTimestamp.After(m.MaxTimestamp) {
+			m.MaxTimestamp = f.MaxTimestamp
+		}
+		m.Sources = mergeSources(m.Sources, f.Sources)
+	}
+	return m, nil
+}
+
+// WritePartitionMetadata writes the metadata file into each partition that written in this run, in all output directories.
+//
+// WARNING: this function reads commandline flags directly.
+func WritePartitionMetadata() error {
+	dirs := make(map[string][]string)
+	for p := range manifestFiles {
+		dir := path.Dir(relOutputPath(*outputDir, p))
+		dirs[dir] = append(dirs[dir], p)
+	}
+
+	names := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		names = append(names, dir)
+	}
+	sort.Strings(names)
+
+	for _, dir := range names {
+		m, err := MakePartitionMetadata(dir, dirs[dir])
+		if err != nil {
+			return err
+		}
+		b, err := json.MarshalIndent(m, "", "  ")
+		if err != nil {
+			return err
+		}
+		for _, d := range outputDirs() {
+			if err := writeOutput(outputPath(d, filepath.FromSlash(dir), metadataFile), append(b, '\n')); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
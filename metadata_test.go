@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWritePartitionMetadata(t *testing.T) {
+	dir := setOutputDir(t)
+
+	orig := manifestFiles
+	manifestFiles = map[string]*ManifestEntry{}
+	defer func() { manifestFiles = orig }()
+
+	times := []time.Time{
+		time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC),
+		time.Date(2023, 4, 1, 9, 0, 0, 0, time.UTC),
+		time.Date(2023, 4, 1, 18, 0, 0, 0, time.UTC),
+	}
+
+	for _, input := range []string{"b.csv", "a.csv"} {
+		w := NewPartitionWriter(input + ".bz2")
+		for _, ts := range times {
+			if err := w.Write(ts, []string{ts.Format(time.RFC3339), input}); err != nil {
+				t.Fatalf("failed to write: %s", err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("failed to close: %s", err)
+		}
+		if err := CompleteUploads(); err != nil {
+			t.Fatalf("failed to complete: %s", err)
+		}
+		RecordManifest(input, w)
+	}
+
+	if err := WritePartitionMetadata(); err != nil {
+		t.Fatalf("failed to write metadata: %s", err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "year=2023", "month=4", "day=1", metadataFile))
+	if err != nil {
+		t.Fatalf("failed to read metadata: %s", err)
+	}
+	var m PartitionMetadata
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatalf("failed to parse metadata: %s", err)
+	}
+
+	if m.Partition != "year=2023/month=4/day=1" {
+		t.Errorf("unexpected partition: %s", m.Partition)
+	}
+	if m.Rows != 6 {
+		t.Errorf("expected 6 rows but got %d", m.Rows)
+	}
+	if !m.MinTimestamp.Equal(times[1]) || !m.MaxTimestamp.Equal(times[2]) {
+		t.Errorf("expected timestamps from %s to %s but got from %s to %s", times[1], times[2], m.MinTimestamp, m.MaxTimestamp)
+	}
+	if want := []string{"a.csv", "b.csv"}; !reflect.DeepEqual(m.Sources, want) {
+		t.Errorf("expected sources %q but got %q", want, m.Sources)
+	}
+
+	var names []string
+	for _, f := range m.Files {
+		names = append(names, f.Name)
+		if f.Rows != 3 || len(f.SHA256) != 64 || f.Size == 0 {
+			t.Errorf("unexpected file: %+v", f)
+		}
+	}
+	if want := []string{"a.csv.bz2", "b.csv.bz2"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("expected files %q but got %q", want, names)
+	}
+}
+
+func TestMergeSources(t *testing.T) {
+	got := mergeSources([]string{"b", "a"}, []string{"c", "a"})
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+}
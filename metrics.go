@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// fileDurationBuckets is the upper bounds in seconds of the histogram of the time to chop an input file.
+var fileDurationBuckets = []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 600, 1800}
+
+// Metrics collects the metrics that served by -metrics in Prometheus format.
+// The counters of rows and files are read from summary.
+// All methods do nothing if the Metrics is nil.
+type Metrics struct {
+	startAt time.Time
+
+	mu        sync.Mutex
+	buckets   []int64 // the number of files in each bucket of fileDurationBuckets, not cumulative
+	durations float64 // the sum of durations in seconds
+	files     int64
+	lastFile  time.Time // the time that the last file was chopped
+}
+
+// metrics is the Metrics of -metrics, or nil if disabled.
+var metrics *Metrics
+
+// NewMetrics makes a new Metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		startAt: SystemClock.Now(),
+		buckets: make([]int64, len(fileDurationBuckets)),
+	}
+}
+
+// ObserveFile records that an input file was chopped in d.
+func (m *Metrics) ObserveFile(d time.Duration) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sec := d.Seconds()
+	for i, le := range fileDurationBuckets {
+		if sec <= le {
+			m.buckets[i]++
+			break
+		}
+	}
+	m.durations += sec
+	m.files++
+	m.lastFile = SystemClock.Now()
+}
+
+// metricsWriter writes metrics in Prometheus text format.
+type metricsWriter struct {
+	w io.Writer
+}
+
+func (w metricsWriter) header(name, typ, help string) {
+	fmt.Fprintf(w.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func (w metricsWriter) value(name string, v float64) {
+	fmt.Fprintf(w.w, "%s %s\n", name, strconv.FormatFloat(v, 'g', -1, 64))
+}
+
+func (w metricsWriter) counter(name, help string, v float64) {
+	w.header(name, "counter", help)
+	w.value(name, v)
+}
+
+func (w metricsWriter) gauge(name, help string, v float64) {
+	w.header(name, "gauge", help)
+	w.value(name, v)
+}
+
+// timestamp returns t in seconds since Unix epoch, or 0 if t is zero.
+func timestamp(t time.Time) float64 {
+	if t.IsZero() {
+		return 0
+	}
+	return float64(t.UnixNano()) / 1e9
+}
+
+// ServeHTTP writes the metrics in Prometheus text format.
+func (m *Metrics) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	chopMu.Lock()
+	s := summary
+	s.UnreadableFiles = append([]string(nil), s.UnreadableFiles...)
+	chopMu.Unlock()
+
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w := metricsWriter{rw}
+
+	w.counter("chopcsv_input_files_total", "The number of input files that chopped.", float64(s.InputFiles))
+	w.counter("chopcsv_empty_files_total", "The number of input files that had no rows.", float64(s.EmptyFiles))
+	w.counter("chopcsv_skipped_files_total", "The number of input files that skipped because not modified.", float64(s.SkippedFiles))
+	w.counter("chopcsv_unreadable_files_total", "The number of input files that skipped because not readable.", float64(len(s.UnreadableFiles)))
+	w.counter("chopcsv_read_rows_total", "The number of rows that read from the input files.", float64(s.ReadRows))
+	w.counter("chopcsv_written_rows_total", "The number of rows that written into the output files.", float64(s.WrittenRows))
+
+	w.header("chopcsv_rejected_rows_total", "counter", "The number of rows that not written into the output files.")
+	fmt.Fprintf(rw, "chopcsv_rejected_rows_total{reason=\"invalid_timestamp\"} %d\n", s.IgnoredRows)
+	fmt.Fprintf(rw, "chopcsv_rejected_rows_total{reason=\"decode_error\"} %d\n", s.DecodeErrorRows)
+	fmt.Fprintf(rw, "chopcsv_rejected_rows_total{reason=\"filtered\"} %d\n", s.FilteredRows)
+	fmt.Fprintf(rw, "chopcsv_rejected_rows_total{reason=\"duplicate\"} %d\n", s.DuplicateRows)
+	fmt.Fprintf(rw, "chopcsv_rejected_rows_total{reason=\"schema\"} %d\n", s.SchemaRejected)
+
+	w.counter("chopcsv_ragged_rows_total", "The number of rows that had a different number of columns, and handled by -on-ragged.", float64(s.RaggedRows))
+	w.counter("chopcsv_overflow_rows_total", "The number of rows that diverted into the overflow directory.", float64(s.OverflowRows))
+	w.counter("chopcsv_input_bytes_total", "The size of the input files.", float64(s.InputBytes))
+	w.counter("chopcsv_output_bytes_total", "The size of the compressed output files.", float64(s.OutputBytes))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name := "chopcsv_file_duration_seconds"
+	w.header(name, "histogram", "The time to chop an input file.")
+	var n int64
+	for i, le := range fileDurationBuckets {
+		n += m.buckets[i]
+		fmt.Fprintf(rw, "%s_bucket{le=\"%s\"} %d\n", name, strconv.FormatFloat(le, 'g', -1, 64), n)
+	}
+	fmt.Fprintf(rw, "%s_bucket{le=\"+Inf\"} %d\n", name, m.files)
+	w.value(name+"_sum", m.durations)
+	w.value(name+"_count", float64(m.files))
+
+	w.gauge("chopcsv_last_file_timestamp_seconds", "The time that the last input file was chopped, or 0 if not yet.", timestamp(m.lastFile))
+	w.gauge("chopcsv_start_timestamp_seconds", "The time that chop-csv started.", timestamp(m.startAt))
+}
+
+// ServeMetrics serves the metrics on /metrics of addr in background.
+func ServeMetrics(m *Metrics, addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+
+	logger.With("addr", addr).Infof("serve metrics on %s", addr)
+	go func() {
+		// The chopping goes on even if failed to serve, because monitoring is not the main work.
+		err := http.ListenAndServe(addr, mux)
+		logger.With("addr", addr, "error", err).Errorf("failed to serve metrics: %s", err)
+	}()
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	orig := summary
+	summary = Summary{InputFiles: 2, ReadRows: 10, WrittenRows: 8, IgnoredRows: 2}
+	defer func() { summary = orig }()
+
+	m := NewMetrics()
+	m.ObserveFile(300 * time.Millisecond)
+	m.ObserveFile(2 * time.Second)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+
+	for _, line := range []string{
+		"chopcsv_input_files_total 2",
+		"chopcsv_read_rows_total 10",
+		"chopcsv_written_rows_total 8",
+		`chopcsv_rejected_rows_total{reason="invalid_timestamp"} 2`,
+		`chopcsv_file_duration_seconds_bucket{le="0.1"} 0`,
+		`chopcsv_file_duration_seconds_bucket{le="0.5"} 1`,
+		`chopcsv_file_duration_seconds_bucket{le="5"} 2`,
+		`chopcsv_file_duration_seconds_bucket{le="+Inf"} 2`,
+		"chopcsv_file_duration_seconds_sum 2.3",
+		"chopcsv_file_duration_seconds_count 2",
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("expected %q in the metrics but not found:\n%s", line, body)
+		}
+	}
+}
+
+func TestMetrics_nil(t *testing.T) {
+	var m *Metrics
+	m.ObserveFile(time.Second)
+}
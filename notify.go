@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Notification is the JSON document that sent by -notify-url and -notify-command at the end of a run.
+type Notification struct {
+	Status   string    `json:"status"` // "success", "partial", "interrupted", or "failed"
+	ExitCode int       `json:"exit_code"`
+	Error    string    `json:"error,omitempty"` // the error message if failed
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Duration float64   `json:"duration_seconds"`
+	Inputs   []string  `json:"inputs"`
+	Summary  Summary   `json:"summary"`
+}
+
+// Notifier tells the result of the run to -notify-url and -notify-command.
+// All methods of nil Notifier do nothing.
+type Notifier struct {
+	url     string
+	command string
+	timeout time.Duration
+	start   time.Time
+	inputs  []string
+
+	mu   sync.Mutex
+	sent bool
+}
+
+// notifier is the Notifier for -notify-url and -notify-command.
+var notifier *Notifier
+
+// NewNotifier makes a new Notifier for the run that started at start.
+// url or command can be empty to disable it.
+func NewNotifier(url, command string, timeout time.Duration, start time.Time, inputs []string) *Notifier {
+	return &Notifier{
+		url:     url,
+		command: command,
+		timeout: timeout,
+		start:   start,
+		inputs:  inputs,
+	}
+}
+
+// Notify sends the result with the current summary.
+// The result is sent only once even if called multiple times, because a failure can happen while finishing the run.
+// Failures of the notification are only logged, and do not change the exit code.
+func (n *Notifier) Notify(status string, code int, message string) {
+	if n == nil {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.sent {
+		return
+	}
+	n.sent = true
+
+	end := SystemClock.Now()
+	b, err := json.Marshal(Notification{
+		Status:   status,
+		ExitCode: code,
+		Error:    message,
+		Start:    n.start,
+		End:      end,
+		Duration: end.Sub(n.start).Seconds(),
+		Inputs:   n.inputs,
+		Summary:  summary,
+	})
+	if err != nil {
+		logger.With("error", err).Warnf("failed to make notification: %s", err)
+		return
+	}
+
+	if n.url != "" {
+		if err := n.post(b); err != nil {
+			logger.With("url", n.url, "error", err).Warnf("failed to notify %s: %s", n.url, err)
+		}
+	}
+	if n.command != "" {
+		if err := n.run(b, status, code); err != nil {
+			logger.With("error", err).Warnf("notify command failed: %s", err)
+		}
+	}
+}
+
+func (n *Notifier) post(body []byte) error {
+	client := &http.Client{Timeout: n.timeout}
+	resp, err := client.Post(n.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || 300 <= resp.StatusCode {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return nil
+}
+
+func (n *Notifier) run(body []byte, status string, code int) error {
+	cmd := shellCommand(n.command)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), "CHOPCSV_STATUS="+status, "CHOPCSV_EXIT_CODE="+strconv.Itoa(code))
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(n.timeout):
+		cmd.Process.Kill()
+		<-done
+		return fmt.Errorf("timed out after %s", n.timeout)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestNotifier_url(t *testing.T) {
+	var got []Notification
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n Notification
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			t.Errorf("failed to decode notification: %s", err)
+		}
+		got = append(got, n)
+	}))
+	defer server.Close()
+
+	start := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+	n := NewNotifier(server.URL, "", time.Second, start, []string{"a.csv"})
+	n.Notify("failed", ExitError, "something wrong")
+	n.Notify("success", ExitOK, "")
+
+	if len(got) != 1 {
+		t.Fatalf("expected notified once but got %d times", len(got))
+	}
+	if got[0].Status != "failed" || got[0].ExitCode != ExitError || got[0].Error != "something wrong" {
+		t.Errorf("unexpected notification: %+v", got[0])
+	}
+	if !got[0].Start.Equal(start) || len(got[0].Inputs) != 1 || got[0].Inputs[0] != "a.csv" {
+		t.Errorf("unexpected notification: %+v", got[0])
+	}
+}
+
+func TestNotifier_command(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test command is for sh")
+	}
+
+	dir := t.TempDir()
+	command := "cat > " + filepath.Join(dir, "body.json") + `; echo "$CHOPCSV_STATUS $CHOPCSV_EXIT_CODE" > ` + filepath.Join(dir, "env.txt")
+
+	NewNotifier("", command, time.Second, time.Now(), nil).Notify("interrupted", 130, "")
+
+	b, err := os.ReadFile(filepath.Join(dir, "body.json"))
+	if err != nil {
+		t.Fatalf("failed to read stdin of the command: %s", err)
+	}
+	var n Notification
+	if err := json.Unmarshal(b, &n); err != nil {
+		t.Fatalf("failed to decode notification: %s", err)
+	}
+	if n.Status != "interrupted" {
+		t.Errorf("expected status %q but got %q", "interrupted", n.Status)
+	}
+
+	env, err := os.ReadFile(filepath.Join(dir, "env.txt"))
+	if err != nil {
+		t.Fatalf("failed to read environment of the command: %s", err)
+	}
+	if want := "interrupted 130\n"; string(env) != want {
+		t.Errorf("expected %q but got %q", want, string(env))
+	}
+}
+
+func TestNotifier_nil(t *testing.T) {
+	var n *Notifier
+	n.Notify("success", ExitOK, "")
+}
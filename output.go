@@ -0,0 +1,498 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// outputFile is a file in the output directory, that can be on local disk or a Sink.
+type outputFile interface {
+	io.Writer
+	Close() error
+	Name() string
+	Size() (int64, error)
+}
+
+// localFile is a file on local disk.
+// The data is written into a temporary file until renamed into place by CompleteUploads.
+type localFile struct {
+	*os.File
+	name string
+}
+
+// Write writes p into the file, and retries the rest of p if failed.
+func (f localFile) Write(p []byte) (int, error) {
+	n := 0
+	err := retryOutput("write", f.name, func() error {
+		m, err := f.File.Write(p[n:])
+		n += m
+		return err
+	})
+	return n, err
+}
+
+func (f localFile) Name() string {
+	return f.name
+}
+
+func (f localFile) Size() (int64, error) {
+	s, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return s.Size(), nil
+}
+
+// Sink is a cloud storage that the output files can be written into directly, like S3.
+type Sink interface {
+	// Setup prepares to write, like loading the credentials.
+	Setup() error
+
+	// Create starts uploading a new object into the URL.
+	Create(url string) (RemoteObject, error)
+}
+
+// RemoteObject is an object that being uploaded into a Sink.
+//
+// The object becomes visible when Complete is called.
+// Close does not complete the upload, so that the rows can be appended later in this run.
+type RemoteObject interface {
+	outputFile
+	Complete() error
+
+	// Abort cancels the upload, and removes the parts that uploaded so far from the Sink.
+	Abort()
+
+	// SHA256 returns the SHA-256 hash of the data that written so far.
+	SHA256() []byte
+}
+
+// sinks is the Sinks for each URL scheme.
+var sinks = map[string]Sink{
+	"s3": &s3Sink{},
+	"gs": &gcsSink{},
+	"az": &azureSink{},
+}
+
+// urlScheme returns the scheme of URL like "s3" for s3://bucket/key, or empty string if path is not a URL.
+func urlScheme(path string) string {
+	i := strings.Index(path, "://")
+	if i <= 0 {
+		return ""
+	}
+	return path[:i]
+}
+
+// isRemoteURL reports whether path is a URL of a Sink, like s3://bucket/key.
+func isRemoteURL(path string) bool {
+	_, ok := sinks[urlScheme(path)]
+	return ok
+}
+
+// SetupSink prepares the Sink to write into dir.
+// It does nothing if dir is a local path.
+func SetupSink(dir string) error {
+	scheme := urlScheme(dir)
+	if scheme == "" {
+		return nil
+	}
+	s, ok := sinks[scheme]
+	if !ok {
+		return fmt.Errorf("unsupported URL: %s", dir)
+	}
+	return s.Setup()
+}
+
+// outputDirs returns -out-dir and -tee-out-dir.
+//
+// WARNING: this function reads commandline flags directly.
+func outputDirs() []string {
+	dirs := []string{*outputDir}
+	if *teeOutputDir != "" {
+		dirs = append(dirs, *teeOutputDir)
+	}
+	return dirs
+}
+
+// outputPath joins the output directory and the elements, like filepath.Join but also supports URLs.
+func outputPath(dir string, elem ...string) string {
+	if isRemoteURL(dir) {
+		for i, e := range elem {
+			elem[i] = filepath.ToSlash(e)
+		}
+		return strings.TrimSuffix(dir, "/") + "/" + path.Join(elem...)
+	}
+	return filepath.Join(append([]string{dir}, elem...)...)
+}
+
+// longPathPrefix is the prefix of the extended-length paths on Windows.
+const longPathPrefix = `\\?\`
+
+// LongPath converts a local path into the extended-length path like `\\?\C:\chopped` on Windows,
+// so that the files deep in the output directory can be made beyond the limit of 260 characters.
+// It returns the path as is on the other platforms, or if the path is a URL.
+func LongPath(p string) (string, error) {
+	if runtime.GOOS != "windows" || isRemoteURL(p) || strings.HasPrefix(p, longPathPrefix) {
+		return p, nil
+	}
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		// UNC path like \\server\share.
+		return longPathPrefix + `UNC\` + abs[2:], nil
+	}
+	return longPathPrefix + abs, nil
+}
+
+// shortPath reverses LongPath, to show the path to users or the other tools.
+func shortPath(p string) string {
+	if strings.HasPrefix(p, longPathPrefix+`UNC\`) {
+		return `\\` + p[len(longPathPrefix)+4:]
+	}
+	return strings.TrimPrefix(p, longPathPrefix)
+}
+
+// outputLocation returns the absolute location of the output directory.
+func outputLocation(dir string) (string, error) {
+	if isRemoteURL(dir) {
+		return strings.TrimSuffix(dir, "/"), nil
+	}
+	abs, err := filepath.Abs(shortPath(dir))
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(abs), nil
+}
+
+// outputDirMode and outputFileMode are the permissions of the directories and the files that made in the output directory, that set by -dir-mode and -file-mode.
+// Zero means the default permissions that masked by umask.
+var outputDirMode, outputFileMode os.FileMode
+
+// ParseFileMode parses an octal permission like "2775".
+// The setuid, setgid, and sticky bits are converted into os.FileMode.
+func ParseFileMode(s string) (os.FileMode, error) {
+	n, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || n > 07777 {
+		return 0, fmt.Errorf("invalid permission: %s", s)
+	}
+
+	mode := os.FileMode(n & 0777)
+	if n&04000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if n&02000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if n&01000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode, nil
+}
+
+// makeOutputDir makes a directory in the output directory.
+// Sinks have no directory, so this function does nothing for them.
+func makeOutputDir(dir string) error {
+	if isRemoteURL(dir) {
+		return nil
+	}
+	if outputDirMode == 0 {
+		return os.MkdirAll(dir, 0755)
+	}
+	return mkdirAllMode(filepath.Clean(dir), outputDirMode)
+}
+
+// mkdirAllMode makes the directory and its parents like os.MkdirAll,
+// and sets mode into the directories that made regardless of umask.
+// The directories that already exist are kept as is.
+func mkdirAllMode(dir string, mode os.FileMode) error {
+	if info, err := os.Stat(dir); err == nil {
+		if !info.IsDir() {
+			return fmt.Errorf("%s: not a directory", dir)
+		}
+		return nil
+	}
+
+	if parent := filepath.Dir(dir); parent != dir {
+		if err := mkdirAllMode(parent, mode); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Mkdir(dir, mode); os.IsExist(err) {
+		// Made by another goroutine of -jobs.
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return os.Chmod(dir, mode)
+}
+
+// openOutput opens a file in the output directory.
+//
+// The files on Sinks are uploaded until CompleteUploads is called, and can be opened again to append in this run.
+func openOutput(path string, appending bool) (outputFile, error) {
+	if s, ok := sinks[urlScheme(path)]; ok {
+		uploadsMu.Lock()
+		defer uploadsMu.Unlock()
+
+		if appending {
+			o, ok := pendingUploads[path]
+			if !ok {
+				return nil, fmt.Errorf("%s: can not append to object that made by the other run", path)
+			}
+			return o, nil
+		}
+
+		o, err := s.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		pendingUploads[path] = o
+		return o, nil
+	}
+
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if appending {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	f, err := openLocalOutput(path, flag)
+	if err != nil {
+		return nil, err
+	}
+	return localFile{f, path}, nil
+}
+
+// atomicOutput is true if the local output files are written into temporary files and renamed into place when completed.
+// It is false in -follow mode, so that the rows can be read while following.
+var atomicOutput = true
+
+// pendingFiles is the local files that opened in this run and not renamed into place yet.
+var pendingFiles = map[string]bool{}
+
+// tempOutputPath returns the temporary path to write the local output file.
+// The name starts with a dot and does not end with the extension, so that it is not treated as an output file.
+func tempOutputPath(path string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+}
+
+// localOutputPath returns the path that the local output file is actually written now.
+func localOutputPath(path string) string {
+	if pendingFiles[path] {
+		return tempOutputPath(path)
+	}
+	return path
+}
+
+// prepareAppend prepares to append into the local output file that made by the other run.
+//
+// If atomicOutput is true, the file is copied into the temporary file and appended there,
+// so that the existing file is kept as is until renamed into place by CompleteUploads.
+// The compressed data is copied as is, so it is much faster than decompressing and compressing again.
+func prepareAppend(path string) error {
+	if !atomicOutput || pendingFiles[path] {
+		return nil
+	}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	tmp := tempOutputPath(path)
+	err = retryOutput("copy", path, func() error {
+		if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return copyFile(path, tmp, info)
+	})
+	if err != nil {
+		return err
+	}
+	pendingFiles[path] = true
+	return nil
+}
+
+// openLocalOutput opens a local output file with os.OpenFile.
+//
+// If atomicOutput is true, a new file is made as a temporary file, and renamed into place when CompleteUploads is called.
+// The file that opened again in this run is still the temporary file, but the file that made by the other run is opened in place.
+func openLocalOutput(path string, flag int) (*os.File, error) {
+	if atomicOutput && flag&os.O_TRUNC != 0 {
+		pendingFiles[path] = true
+	}
+	var f *os.File
+	err := retryOutput("open", path, func() (err error) {
+		f, err = os.OpenFile(localOutputPath(path), flag, 0666)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if outputFileMode != 0 && flag&os.O_TRUNC != 0 {
+		if err := f.Chmod(outputFileMode); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// syncFile calls fsync for the file.
+func syncFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+// renameOutput renames the temporary file into place.
+// If -fsync is set, the file and the directory are synced, so that the file survives power loss.
+//
+// WARNING: this function reads commandline flags directly.
+func renameOutput(tmp, path string) error {
+	if *fsyncOutput {
+		if err := retryOutput("sync", tmp, func() error { return syncFile(tmp) }); err != nil {
+			return err
+		}
+	}
+	if err := retryOutput("rename", path, func() error { return os.Rename(tmp, path) }); err != nil {
+		return err
+	}
+	if *fsyncOutput {
+		dir := filepath.Dir(path)
+		return retryOutput("sync", dir, func() error { return syncFile(dir) })
+	}
+	return nil
+}
+
+// writeOutput writes a whole file in the output directory.
+func writeOutput(path string, data []byte) error {
+	if s, ok := sinks[urlScheme(path)]; ok {
+		o, err := s.Create(path)
+		if err != nil {
+			return err
+		}
+		if _, err := o.Write(data); err != nil {
+			return err
+		}
+		return o.Complete()
+	}
+
+	tmp := tempOutputPath(path)
+	err := retryOutput("write", path, func() error {
+		return os.WriteFile(tmp, data, 0644)
+	})
+	if err != nil {
+		return err
+	}
+	if outputFileMode != 0 {
+		if err := os.Chmod(tmp, outputFileMode); err != nil {
+			return err
+		}
+	}
+	return renameOutput(tmp, path)
+}
+
+// uploadsMu guards pendingUploads.
+// It is separated from chopMu, so that abortUploads can be called by fatalf even while chopMu is locked.
+var uploadsMu sync.Mutex
+
+// pendingUploads is the objects on Sinks that opened in this run and not completed yet.
+var pendingUploads = map[string]RemoteObject{}
+
+// uploadedObjects is the objects on Sinks that completed in this run.
+var uploadedObjects = map[string]RemoteObject{}
+
+// CompleteUploads completes all uploads of the objects that opened in this run,
+// and renames the local files that opened in this run into place.
+func CompleteUploads() error {
+	chopMu.Lock()
+	defer chopMu.Unlock()
+
+	return completeUploads(func(string) bool { return true })
+}
+
+// completeUploads completes the uploads and renames the local files like CompleteUploads, but only the paths that match reports true.
+func completeUploads(match func(path string) bool) error {
+	paths := make([]string, 0, len(pendingFiles))
+	for path := range pendingFiles {
+		if match(path) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if err := renameOutput(tempOutputPath(path), path); err != nil {
+			return err
+		}
+		delete(pendingFiles, path)
+	}
+
+	uploadsMu.Lock()
+	defer uploadsMu.Unlock()
+
+	names := make([]string, 0, len(pendingUploads))
+	for name := range pendingUploads {
+		if match(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var err error
+	for _, name := range names {
+		if e := pendingUploads[name].Complete(); e != nil && err == nil {
+			err = e
+		}
+		uploadedObjects[name] = pendingUploads[name]
+		delete(pendingUploads, name)
+	}
+	return err
+}
+
+// discardUploads removes the temporary files of the local files that opened in this run, and aborts the uploads of the objects, but only the paths that match reports true.
+func discardUploads(match func(path string) bool) {
+	for path := range pendingFiles {
+		if match(path) {
+			os.Remove(tempOutputPath(path))
+			os.Remove(tempOutputPath(path + ".idx"))
+			delete(pendingFiles, path)
+		}
+	}
+
+	uploadsMu.Lock()
+	defer uploadsMu.Unlock()
+
+	for name, o := range pendingUploads {
+		if match(name) {
+			o.Abort()
+			delete(pendingUploads, name)
+		}
+	}
+}
+
+// abortUploads aborts all uploads that not completed yet, so that the uploaded parts are not left on the Sinks.
+// It is called by fatalf before exiting.
+func abortUploads() {
+	uploadsMu.Lock()
+	defer uploadsMu.Unlock()
+
+	for name, o := range pendingUploads {
+		o.Abort()
+		delete(pendingUploads, name)
+	}
+}
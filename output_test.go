@@ -0,0 +1,157 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCompleteUploads_local(t *testing.T) {
+	dir := setOutputDir(t)
+
+	orig := *indexInterval
+	*indexInterval = 1
+	defer func() { *indexInterval = orig }()
+
+	path := filepath.Join(dir, "a.csv.bz2")
+	w, err := Create(path)
+	if err != nil {
+		t.Fatalf("failed to create: %s", err)
+	}
+	if err := w.Write([]string{"20230401", "a"}); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+
+	// The files are not visible until completed.
+	for _, p := range []string{path, path + ".idx"} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s: expected not to exist yet but got %v", p, err)
+		}
+		if _, err := os.Stat(tempOutputPath(p)); err != nil {
+			t.Errorf("%s: expected the temporary file but got %s", p, err)
+		}
+	}
+
+	if err := CompleteUploads(); err != nil {
+		t.Fatalf("failed to complete: %s", err)
+	}
+	for _, p := range []string{path, path + ".idx"} {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("%s: expected to be renamed into place but got %s", p, err)
+		}
+		if _, err := os.Stat(tempOutputPath(p)); !os.IsNotExist(err) {
+			t.Errorf("%s: expected the temporary file to be removed but got %v", p, err)
+		}
+	}
+
+	// The file that made before is appended in place.
+	w, err = Append(path)
+	if err != nil {
+		t.Fatalf("failed to open to append: %s", err)
+	}
+	if err := w.Write([]string{"20230401", "b"}); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+	if len(pendingFiles) != 0 {
+		t.Errorf("expected no pending files but got %v", pendingFiles)
+	}
+	if got, want := readBzip2CSV(t, path), [][]string{{"20230401", "a"}, {"20230401", "b"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+}
+
+func TestParseFileMode(t *testing.T) {
+	tests := []struct {
+		Input  string
+		Output os.FileMode
+	}{
+		{"664", 0664},
+		{"0755", 0755},
+		{"2775", 0775 | os.ModeSetgid},
+		{"7000", os.ModeSetuid | os.ModeSetgid | os.ModeSticky},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Input, func(t *testing.T) {
+			got, err := ParseFileMode(tt.Input)
+			if err != nil {
+				t.Fatalf("failed to parse: %s", err)
+			}
+			if got != tt.Output {
+				t.Errorf("expected %s but got %s", tt.Output, got)
+			}
+		})
+	}
+
+	for _, s := range []string{"", "888", "10000", "rwx"} {
+		if _, err := ParseFileMode(s); err == nil {
+			t.Errorf("%q: expected error but got nil", s)
+		}
+	}
+}
+
+func TestOutputMode(t *testing.T) {
+	dir := setOutputDir(t)
+
+	origDir, origFile := outputDirMode, outputFileMode
+	outputDirMode, outputFileMode = 0750, 0640
+	defer func() { outputDirMode, outputFileMode = origDir, origFile }()
+
+	sub := filepath.Join(dir, "a", "b")
+	if err := makeOutputDir(sub); err != nil {
+		t.Fatalf("failed to make directory: %s", err)
+	}
+	for _, d := range []string{filepath.Join(dir, "a"), sub} {
+		if info, err := os.Stat(d); err != nil {
+			t.Errorf("failed to stat %s: %s", d, err)
+		} else if info.Mode().Perm() != 0750 {
+			t.Errorf("%s: expected mode %s but got %s", d, os.FileMode(0750), info.Mode().Perm())
+		}
+	}
+	if info, err := os.Stat(dir); err != nil {
+		t.Errorf("failed to stat %s: %s", dir, err)
+	} else if info.Mode().Perm() == 0750 {
+		t.Errorf("expected the existing directory is kept as is")
+	}
+
+	path := filepath.Join(sub, "a.txt")
+	if err := writeOutput(path, []byte("hello")); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+	if info, err := os.Stat(path); err != nil {
+		t.Errorf("failed to stat %s: %s", path, err)
+	} else if info.Mode().Perm() != 0640 {
+		t.Errorf("%s: expected mode %s but got %s", path, os.FileMode(0640), info.Mode().Perm())
+	}
+}
+
+func TestShortPath(t *testing.T) {
+	tests := []struct {
+		Input  string
+		Output string
+	}{
+		{`\\?\C:\chopped`, `C:\chopped`},
+		{`\\?\UNC\server\share\chopped`, `\\server\share\chopped`},
+		{`C:\chopped`, `C:\chopped`},
+		{"/tmp/chopped", "/tmp/chopped"},
+	}
+
+	for _, tt := range tests {
+		if got := shortPath(tt.Input); got != tt.Output {
+			t.Errorf("%s: expected %s but got %s", tt.Input, tt.Output, got)
+		}
+	}
+}
+
+func TestLongPath_url(t *testing.T) {
+	if got, err := LongPath("s3://bucket/prefix"); err != nil || got != "s3://bucket/prefix" {
+		t.Errorf("expected the URL as is but got %q and %v", got, err)
+	}
+}
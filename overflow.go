@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// overflowDir is the directory for the rows that exceed -max-row-size, relative to the output directory.
+const overflowDir = "overflow"
+
+// RowSize returns the size of the row in CSV, without quotes.
+func RowSize(row []string) int {
+	size := len(row) - 1
+	for _, f := range row {
+		size += len(f)
+	}
+	return size
+}
+
+// DivertRow writes the oversized row into the overflow area, and returns a stub row that refers to it.
+//
+// The overflow files have the row number in the input file as the first column, followed by the original row.
+// In the stub row, the largest fields are replaced with a reference like "overflow/year=2023/month=4/day=1/xxx.csv.bz2#row=12", until the row fits in maxSize.
+// The first column is always kept, because it is the timestamp.
+func DivertRow(overflow *PartitionWriter, t time.Time, row []string, rowNum int, maxSize int) ([]string, error) {
+	if err := overflow.Write(t, append([]string{strconv.Itoa(rowNum)}, row...)); err != nil {
+		return nil, err
+	}
+
+	ref := fmt.Sprintf("%s/%s/%s#row=%d", overflowDir, filepath.ToSlash(PartitionDir(t)), overflow.name, rowNum)
+
+	stub := append([]string{}, row...)
+	replaced := make([]bool, len(stub))
+	diverted := false
+	for {
+		largest := 0
+		for i := 1; i < len(stub); i++ {
+			if !replaced[i] && (largest == 0 || len(stub[i]) > len(stub[largest])) {
+				largest = i
+			}
+		}
+		// Replace at least one field, but do not replace fields that are shorter than the reference.
+		if largest == 0 || (len(stub[largest]) <= len(ref) && diverted) {
+			break
+		}
+		stub[largest] = ref
+		replaced[largest] = true
+		diverted = true
+
+		if RowSize(stub) <= maxSize {
+			break
+		}
+	}
+	return stub, nil
+}
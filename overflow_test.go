@@ -0,0 +1,72 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRowSize(t *testing.T) {
+	if got := RowSize([]string{"20230401", "abc", ""}); got != 13 {
+		t.Errorf("expected 13 but got %d", got)
+	}
+}
+
+func TestDivertRow(t *testing.T) {
+	dir := setOutputDir(t)
+	day := time.Date(2023, 4, 1, 0, 0, 0, 0, time.Local)
+	ref := "overflow/year=2023/month=4/day=1/a.csv.bz2#row=12"
+
+	tests := []struct {
+		Name    string
+		MaxSize int
+		Row     []string
+		Stub    []string
+	}{
+		{
+			"largest field",
+			100,
+			[]string{"20230401", "short", strings.Repeat("x", 200)},
+			[]string{"20230401", "short", ref},
+		},
+		{
+			"multiple fields",
+			60,
+			[]string{"20230401", strings.Repeat("y", 80), strings.Repeat("x", 100)},
+			[]string{"20230401", ref, ref},
+		},
+		{
+			"shorter than reference",
+			10,
+			[]string{"20230401", "short", strings.Repeat("x", 100)},
+			[]string{"20230401", "short", ref},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			overflow := NewPartitionWriter("a.csv.bz2").Overflow()
+			stub, err := DivertRow(overflow, day, tt.Row, 12, tt.MaxSize)
+			if err != nil {
+				t.Fatalf("failed to divert: %s", err)
+			}
+			if err := overflow.Close(); err != nil {
+				t.Fatalf("failed to close: %s", err)
+			}
+			if err := CompleteUploads(); err != nil {
+				t.Fatalf("failed to complete: %s", err)
+			}
+
+			if !reflect.DeepEqual(stub, tt.Stub) {
+				t.Errorf("expected stub %q but got %q", tt.Stub, stub)
+			}
+
+			got := readBzip2CSV(t, filepath.Join(dir, overflowDir, PartitionDir(day), "a.csv.bz2"))
+			if want := [][]string{append([]string{"12"}, tt.Row...)}; !reflect.DeepEqual(got, want) {
+				t.Errorf("expected overflow %q but got %q", want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,489 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/golang/snappy"
+)
+
+// parquetRowGroupRows is the maximum number of rows in a row group of Parquet output.
+const parquetRowGroupRows = 100000
+
+// parquetTypes is the column types for -parquet-schema.
+var parquetTypes = map[string]string{}
+
+// ParseParquetSchema parses -parquet-schema flag like "price:double,count:int64".
+func ParseParquetSchema(s string) (map[string]string, error) {
+	types := make(map[string]string)
+	if s == "" {
+		return types, nil
+	}
+
+	for _, x := range strings.Split(s, ",") {
+		i := strings.LastIndex(x, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid parquet schema: %s: type is missing", x)
+		}
+		name, typ := strings.TrimSpace(x[:i]), strings.ToLower(strings.TrimSpace(x[i+1:]))
+		if _, ok := parquetPhysicalTypes[typ]; !ok {
+			return nil, fmt.Errorf("invalid parquet schema: %s: unsupported type: %s", x, typ)
+		}
+		types[name] = typ
+	}
+	return types, nil
+}
+
+// Parquet physical types.
+const (
+	parquetBoolean   = 0
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+)
+
+var parquetPhysicalTypes = map[string]int32{
+	"string":  parquetByteArray,
+	"int64":   parquetInt64,
+	"double":  parquetDouble,
+	"boolean": parquetBoolean,
+}
+
+type parquetColumn struct {
+	Name string
+	Type string
+}
+
+type parquetChunk struct {
+	Offset       int64
+	Values       int64
+	Uncompressed int64
+	Compressed   int64
+}
+
+type parquetRowGroup struct {
+	Chunks []parquetChunk
+	Rows   int64
+}
+
+// ParquetWriter writes rows into Snappy compressed Parquet files.
+//
+// The rows are buffered, and written as a row group when the buffer is full or flushed.
+// The file footer is rewritten at every flush, so the file is always readable after flushed.
+//
+// WARNING: this struct reads commandline flags directly.
+type ParquetWriter struct {
+	fs      []*os.File
+	names   []string // the paths of fs, that can be different from the actual names while writing into temporary files
+	columns []parquetColumn
+	rows    [][]string
+	groups  []parquetRowGroup
+	offset  int64 // the end of the last row group, and the beginning of the footer
+	size    int64 // the size of the file including the footer
+	dirty   bool  // true if the footer is outdated
+}
+
+// parquetFiles is the Parquet files closed in this run, to append rows with AppendParquet.
+var parquetFiles = map[string]*ParquetWriter{}
+
+// CreateParquet creates a new ParquetWriter with the column names.
+// If passed multiple paths, the ParquetWriter writes the same content into all of them.
+func CreateParquet(columns []string, paths ...string) (*ParquetWriter, error) {
+	cs := make([]parquetColumn, len(columns))
+	known := make(map[string]bool)
+	for i, name := range columns {
+		cs[i] = parquetColumn{Name: name, Type: "string"}
+		if t, ok := parquetTypes[name]; ok {
+			cs[i].Type = t
+		}
+		known[name] = true
+	}
+	for name := range parquetTypes {
+		if !known[name] {
+			return nil, fmt.Errorf("no such column in parquet schema: %s", name)
+		}
+	}
+
+	w := &ParquetWriter{columns: cs, offset: 4, dirty: true}
+	if err := w.open(os.O_RDWR|os.O_CREATE|os.O_TRUNC, paths); err != nil {
+		return nil, err
+	}
+	if err := w.writeAt([]byte("PAR1"), 0); err != nil {
+		w.closeFiles()
+		return nil, err
+	}
+	return w, nil
+}
+
+// AppendParquet opens ParquetWriter to append rows into the file that closed in this run.
+func AppendParquet(paths ...string) (*ParquetWriter, error) {
+	prev, ok := parquetFiles[paths[0]]
+	if !ok {
+		return nil, fmt.Errorf("%s: can not append to parquet file that made by the other run", paths[0])
+	}
+
+	w := &ParquetWriter{columns: prev.columns, groups: prev.groups, offset: prev.offset, size: prev.size}
+	if err := w.open(os.O_RDWR, paths); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *ParquetWriter) open(flag int, paths []string) error {
+	w.names = paths
+	for _, path := range paths {
+		f, err := openLocalOutput(path, flag)
+		if err != nil {
+			w.closeFiles()
+			return err
+		}
+		w.fs = append(w.fs, f)
+	}
+	return nil
+}
+
+func (w *ParquetWriter) closeFiles() error {
+	var err error
+	for _, f := range w.fs {
+		if e := f.Close(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (w *ParquetWriter) writeAt(b []byte, offset int64) error {
+	for _, f := range w.fs {
+		if _, err := f.WriteAt(b, offset); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *ParquetWriter) Write(record []string) error {
+	if len(record) != len(w.columns) {
+		return fmt.Errorf("row has %d columns, but parquet file has %d columns", len(record), len(w.columns))
+	}
+
+	w.rows = append(w.rows, append([]string{}, record...))
+	if len(w.rows) >= parquetRowGroupRows {
+		return w.writeRowGroup()
+	}
+	return nil
+}
+
+// writeRowGroup writes the buffered rows as a row group.
+func (w *ParquetWriter) writeRowGroup() error {
+	var b []byte
+	g := parquetRowGroup{Rows: int64(len(w.rows))}
+	for i, c := range w.columns {
+		page, err := c.encodePage(w.rows, i)
+		if err != nil {
+			return err
+		}
+		compressed := snappy.Encode(nil, page)
+
+		var h thriftStruct
+		h.i32(1, 0) // type = DATA_PAGE
+		h.i32(2, int32(len(page)))
+		h.i32(3, int32(len(compressed)))
+		var d thriftStruct
+		d.i32(1, int32(len(w.rows)))
+		d.i32(2, 0) // encoding = PLAIN
+		d.i32(3, 3) // definition_level_encoding = RLE
+		d.i32(4, 3) // repetition_level_encoding = RLE
+		h.structure(5, d.end())
+		header := h.end()
+
+		g.Chunks = append(g.Chunks, parquetChunk{
+			Offset:       w.offset + int64(len(b)),
+			Values:       int64(len(w.rows)),
+			Uncompressed: int64(len(header) + len(page)),
+			Compressed:   int64(len(header) + len(compressed)),
+		})
+		b = append(b, header...)
+		b = append(b, compressed...)
+	}
+
+	if err := w.writeAt(b, w.offset); err != nil {
+		return err
+	}
+	w.offset += int64(len(b))
+	w.groups = append(w.groups, g)
+	w.rows = w.rows[:0]
+	w.dirty = true
+	return nil
+}
+
+// encodePage encodes the i-th column of rows as a data page.
+// Empty values of non-string columns are written as null.
+func (c parquetColumn) encodePage(rows [][]string, i int) ([]byte, error) {
+	defined := make([]bool, len(rows))
+	var vs []byte
+	var bits uint
+	for j, row := range rows {
+		v := row[i]
+		if v == "" && c.Type != "string" {
+			continue
+		}
+		defined[j] = true
+
+		switch c.Type {
+		case "string":
+			vs = appendUint32(vs, uint32(len(v)))
+			vs = append(vs, v...)
+		case "int64":
+			n, err := strconv.ParseInt(strings.ReplaceAll(strings.TrimSpace(v), thousandsSeparator, ""), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %w", c.Name, err)
+			}
+			vs = appendUint64(vs, uint64(n))
+		case "double":
+			n, err := ParseNumber(v)
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %w", c.Name, err)
+			}
+			vs = appendUint64(vs, math.Float64bits(n))
+		case "boolean":
+			t, err := strconv.ParseBool(strings.TrimSpace(v))
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %w", c.Name, err)
+			}
+			if bits%8 == 0 {
+				vs = append(vs, 0)
+			}
+			if t {
+				vs[len(vs)-1] |= 1 << (bits % 8)
+			}
+			bits++
+		}
+	}
+
+	levels := appendRLE(nil, defined)
+	page := appendUint32(nil, uint32(len(levels)))
+	page = append(page, levels...)
+	page = append(page, vs...)
+	return page, nil
+}
+
+// appendRLE encodes the definition levels as RLE runs of the RLE/bit-packing hybrid encoding, with bit width 1.
+func appendRLE(b []byte, levels []bool) []byte {
+	for i := 0; i < len(levels); {
+		j := i
+		for j < len(levels) && levels[j] == levels[i] {
+			j++
+		}
+		b = appendUvarint(b, uint64(j-i)<<1)
+		if levels[i] {
+			b = append(b, 1)
+		} else {
+			b = append(b, 0)
+		}
+		i = j
+	}
+	return b
+}
+
+// writeFooter writes the file metadata after the last row group.
+func (w *ParquetWriter) writeFooter() error {
+	var numRows int64
+	groups := make([][]byte, len(w.groups))
+	for i, g := range w.groups {
+		numRows += g.Rows
+
+		var size int64
+		chunks := make([][]byte, len(g.Chunks))
+		for j, c := range g.Chunks {
+			var m thriftStruct
+			m.i32(1, parquetPhysicalTypes[w.columns[j].Type])
+			m.list(2, thriftI32, [][]byte{appendZigzag(nil, 0), appendZigzag(nil, 3)}) // PLAIN, RLE
+			m.list(3, thriftBinary, [][]byte{thriftString(w.columns[j].Name)})
+			m.i32(4, 1) // codec = SNAPPY
+			m.i64(5, c.Values)
+			m.i64(6, c.Uncompressed)
+			m.i64(7, c.Compressed)
+			m.i64(9, c.Offset)
+
+			var cc thriftStruct
+			cc.i64(2, c.Offset)
+			cc.structure(3, m.end())
+			chunks[j] = cc.end()
+
+			size += c.Uncompressed
+		}
+
+		var rg thriftStruct
+		rg.list(1, thriftStructType, chunks)
+		rg.i64(2, size)
+		rg.i64(3, g.Rows)
+		groups[i] = rg.end()
+	}
+
+	schema := make([][]byte, 0, len(w.columns)+1)
+	var root thriftStruct
+	root.binary(4, "schema")
+	root.i32(5, int32(len(w.columns)))
+	schema = append(schema, root.end())
+	for _, c := range w.columns {
+		var e thriftStruct
+		e.i32(1, parquetPhysicalTypes[c.Type])
+		e.i32(3, 1) // repetition_type = OPTIONAL
+		e.binary(4, c.Name)
+		if c.Type == "string" {
+			e.i32(6, 0) // converted_type = UTF8
+		}
+		schema = append(schema, e.end())
+	}
+
+	var meta thriftStruct
+	meta.i32(1, 1)
+	meta.list(2, thriftStructType, schema)
+	meta.i64(3, numRows)
+	meta.list(4, thriftStructType, groups)
+	meta.binary(6, "chop-csv version "+version)
+	footer := meta.end()
+
+	footer = appendUint32(footer, uint32(len(footer)))
+	footer = append(footer, "PAR1"...)
+	if err := w.writeAt(footer, w.offset); err != nil {
+		return err
+	}
+	for _, f := range w.fs {
+		if err := f.Truncate(w.offset + int64(len(footer))); err != nil {
+			return err
+		}
+	}
+	w.size = w.offset + int64(len(footer))
+	w.dirty = false
+	return nil
+}
+
+// Flush writes out all rows that written so far into the file, as a new row group.
+func (w *ParquetWriter) Flush() error {
+	if len(w.rows) > 0 {
+		if err := w.writeRowGroup(); err != nil {
+			return err
+		}
+	}
+	if w.dirty {
+		return w.writeFooter()
+	}
+	return nil
+}
+
+func (w *ParquetWriter) Close() error {
+	err := w.Flush()
+	if e := w.closeFiles(); err == nil {
+		err = e
+	}
+	parquetFiles[w.Name()] = w
+	return err
+}
+
+func (w *ParquetWriter) Name() string {
+	return w.names[0]
+}
+
+// Size returns the size of the file that flushed so far.
+func (w *ParquetWriter) Size() int64 {
+	return w.size
+}
+
+// Written returns the approximate size of the file, including the row groups that written after the last flush.
+// The rows that not written as a row group yet are not counted.
+func (w *ParquetWriter) Written() int64 {
+	return w.offset
+}
+
+// Thrift compact protocol types.
+const (
+	thriftI32        = 5
+	thriftI64        = 6
+	thriftBinary     = 8
+	thriftList       = 9
+	thriftStructType = 12
+)
+
+// thriftStruct is an encoder of a struct in Thrift compact protocol, that used in Parquet metadata.
+type thriftStruct struct {
+	b    []byte
+	last int16
+}
+
+func (s *thriftStruct) field(id int16, typ byte) {
+	if d := id - s.last; 0 < d && d <= 15 {
+		s.b = append(s.b, byte(d)<<4|typ)
+	} else {
+		s.b = append(s.b, typ)
+		s.b = appendZigzag(s.b, int64(id))
+	}
+	s.last = id
+}
+
+func (s *thriftStruct) i32(id int16, v int32) {
+	s.field(id, thriftI32)
+	s.b = appendZigzag(s.b, int64(v))
+}
+
+func (s *thriftStruct) i64(id int16, v int64) {
+	s.field(id, thriftI64)
+	s.b = appendZigzag(s.b, v)
+}
+
+func (s *thriftStruct) binary(id int16, v string) {
+	s.field(id, thriftBinary)
+	s.b = append(s.b, thriftString(v)...)
+}
+
+func (s *thriftStruct) structure(id int16, v []byte) {
+	s.field(id, thriftStructType)
+	s.b = append(s.b, v...)
+}
+
+func (s *thriftStruct) list(id int16, typ byte, elems [][]byte) {
+	s.field(id, thriftList)
+	if len(elems) < 15 {
+		s.b = append(s.b, byte(len(elems))<<4|typ)
+	} else {
+		s.b = append(s.b, 0xF0|typ)
+		s.b = appendUvarint(s.b, uint64(len(elems)))
+	}
+	for _, e := range elems {
+		s.b = append(s.b, e...)
+	}
+}
+
+// end returns the encoded struct.
+func (s *thriftStruct) end() []byte {
+	return append(s.b, 0)
+}
+
+func thriftString(s string) []byte {
+	return append(appendUvarint(nil, uint64(len(s))), s...)
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+func appendZigzag(b []byte, v int64) []byte {
+	return appendUvarint(b, uint64(v<<1)^uint64(v>>63))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
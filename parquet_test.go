@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// parquetResult is the output of testdata/parquetreader.
+type parquetResult struct {
+	RowGroups int        `json:"row_groups"`
+	Columns   []string   `json:"columns"`
+	Rows      [][]string `json:"rows"`
+}
+
+// buildParquetReader builds testdata/parquetreader, that reads Parquet files by parquet-go.
+// The test is skipped if it can not be built, for example the modules can not be downloaded.
+func buildParquetReader(t *testing.T) string {
+	t.Helper()
+
+	exe := filepath.Join(t.TempDir(), "parquetreader")
+	if runtime.GOOS == "windows" {
+		exe += ".exe"
+	}
+	cmd := exec.Command("go", "build", "-o", exe, ".")
+	cmd.Dir = filepath.Join("testdata", "parquetreader")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Skipf("failed to build the Parquet reader: %s\n%s", err, out)
+	}
+	return exe
+}
+
+func readParquet(t *testing.T, reader, path string) parquetResult {
+	t.Helper()
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(reader, path)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("failed to read %s: %s: %s", path, err, stderr.String())
+	}
+	var r parquetResult
+	if err := json.Unmarshal(out, &r); err != nil {
+		t.Fatalf("failed to parse the output of the Parquet reader: %s", err)
+	}
+	return r
+}
+
+func TestParquetWriter_roundTrip(t *testing.T) {
+	reader := buildParquetReader(t)
+
+	orig := parquetTypes
+	parquetTypes = map[string]string{"count": "int64", "price": "double", "ok": "boolean"}
+	defer func() { parquetTypes = orig }()
+
+	rows := [][]string{
+		{"apple", "1", "1.5", "true"},
+		{"", "", "", ""},
+		{"日本語, \"quoted\"\nnewline", "-42", "0.25", "false"},
+		{"banana", "9223372036854775807", "-3", "true"},
+	}
+
+	path := filepath.Join(t.TempDir(), "test.parquet")
+	w, err := CreateParquet([]string{"name", "count", "price", "ok"}, path)
+	if err != nil {
+		t.Fatalf("failed to create: %s", err)
+	}
+	for _, row := range rows {
+		if err := w.Write(row); err != nil {
+			t.Fatalf("failed to write: %s", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+	if err := CompleteUploads(); err != nil {
+		t.Fatalf("failed to complete: %s", err)
+	}
+
+	r := readParquet(t, reader, path)
+	if want := []string{"name", "count", "price", "ok"}; !reflect.DeepEqual(r.Columns, want) {
+		t.Errorf("expected columns %q but got %q", want, r.Columns)
+	}
+	if !reflect.DeepEqual(r.Rows, rows) {
+		t.Errorf("unexpected rows\nexpected: %q\n but got: %q", rows, r.Rows)
+	}
+}
+
+func TestParquetWriter_flushAndAppend(t *testing.T) {
+	reader := buildParquetReader(t)
+
+	path := filepath.Join(t.TempDir(), "test.parquet")
+	w, err := CreateParquet([]string{"a", "b"}, path)
+	if err != nil {
+		t.Fatalf("failed to create: %s", err)
+	}
+	if err := w.Write([]string{"1", "x"}); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("failed to flush: %s", err)
+	}
+
+	// The file is readable after flushed, even if not closed yet.
+	if r := readParquet(t, reader, localOutputPath(path)); r.RowGroups != 1 || len(r.Rows) != 1 {
+		t.Errorf("expected 1 row group and 1 row after flushed but got %d row groups and %d rows", r.RowGroups, len(r.Rows))
+	}
+
+	if err := w.Write([]string{"2", "y"}); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+
+	w, err = AppendParquet(path)
+	if err != nil {
+		t.Fatalf("failed to open to append: %s", err)
+	}
+	if err := w.Write([]string{"3", "z"}); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+	if err := CompleteUploads(); err != nil {
+		t.Fatalf("failed to complete: %s", err)
+	}
+
+	r := readParquet(t, reader, path)
+	if r.RowGroups != 3 {
+		t.Errorf("expected 3 row groups but got %d", r.RowGroups)
+	}
+	if want := [][]string{{"1", "x"}, {"2", "y"}, {"3", "z"}}; !reflect.DeepEqual(r.Rows, want) {
+		t.Errorf("unexpected rows\nexpected: %q\n but got: %q", want, r.Rows)
+	}
+}
+
+func TestPartitionWriter_parquetInterleaved(t *testing.T) {
+	reader := buildParquetReader(t)
+	dir := setOutputDir(t)
+
+	origFormat := *outputFormat
+	*outputFormat = "parquet"
+	defer func() { *outputFormat = origFormat }()
+
+	// The rows switch the partition at every row, like the input that not sorted by the timestamp.
+	days := []time.Time{
+		time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2023, 4, 2, 0, 0, 0, 0, time.UTC),
+		time.Date(2023, 4, 3, 0, 0, 0, 0, time.UTC),
+	}
+	const rows = 3000
+
+	w := NewPartitionWriter("test.parquet")
+	w.SetHeader([]string{"n"})
+	for i := 0; i < rows; i++ {
+		if err := w.Write(days[i%len(days)], []string{"x"}); err != nil {
+			t.Fatalf("failed to write: %s", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+	if err := CompleteUploads(); err != nil {
+		t.Fatalf("failed to complete: %s", err)
+	}
+
+	files := w.Files()
+	if len(files) != len(days) {
+		t.Fatalf("expected %d files but got %d files: %q", len(days), len(files), files)
+	}
+	for i, f := range files {
+		if want := filepath.Join(dir, PartitionDir(days[i]), "test.parquet"); f != want {
+			t.Errorf("expected file %s but got %s", want, f)
+		}
+
+		r := readParquet(t, reader, f)
+		if r.RowGroups != 1 {
+			t.Errorf("%s: expected 1 row group but got %d", f, r.RowGroups)
+		}
+		if len(r.Rows) != rows/len(days) {
+			t.Errorf("%s: expected %d rows but got %d", f, rows/len(days), len(r.Rows))
+		}
+	}
+}
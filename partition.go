@@ -0,0 +1,875 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// partitionGranularities is the time layouts of the partition directories for each -granularity.
+var partitionGranularities = map[string]string{
+	"year":  "year=2006",
+	"month": "year=2006/month=1",
+	"day":   "year=2006/month=1/day=2",
+	"hour":  "year=2006/month=1/day=2/hour=15",
+}
+
+// paddedPartitionGranularities is the time layouts of the partition directories for each -granularity with -pad-partitions.
+var paddedPartitionGranularities = map[string]string{
+	"year":  "year=2006",
+	"month": "year=2006/month=01",
+	"day":   "year=2006/month=01/day=02",
+	"hour":  "year=2006/month=01/day=02/hour=15",
+}
+
+// plainPartitionGranularities is the time layouts of the partition directories for each -granularity in -layout=plain.
+// The values are zero-padded, so that the directories are sorted in the order of time.
+var plainPartitionGranularities = map[string]string{
+	"year":  "2006",
+	"month": "2006/01",
+	"day":   "2006/01/02",
+	"hour":  "2006/01/02/15",
+}
+
+// partitionStyle is the style of the partition directories, "hive" or "plain", that decided by -layout.
+var partitionStyle = "hive"
+
+// partitionPadding is true if the values of Hive style partitions are zero-padded, that decided by -pad-partitions.
+var partitionPadding = false
+
+// partitionGranularity is the unit of the partitions, that decided by -granularity.
+var partitionGranularity = "day"
+
+// partitionLayout is the time layout of the partition directories, that decided by -layout and -granularity.
+var partitionLayout = partitionGranularities[partitionGranularity]
+
+// partitionLayouts returns the time layouts for each granularity in the style of -layout and -pad-partitions.
+func partitionLayouts() map[string]string {
+	switch {
+	case partitionStyle == "plain":
+		return plainPartitionGranularities
+	case partitionPadding:
+		return paddedPartitionGranularities
+	}
+	return partitionGranularities
+}
+
+// SetLayout sets the style of the partition directories.
+// "hive" makes directories like "year=2023/month=4/day=1", or "year=2023/month=04/day=01" if pad is true.
+// "plain" makes directories like "2023/04/01", that are always zero-padded.
+func SetLayout(style string, pad bool) error {
+	switch style {
+	case "hive", "plain":
+	default:
+		return fmt.Errorf("unknown layout: %s", style)
+	}
+	partitionStyle = style
+	partitionPadding = pad
+	partitionLayout = partitionLayouts()[partitionGranularity]
+	return nil
+}
+
+// SetGranularity sets the granularity of the partitions, such as "day" or "month".
+func SetGranularity(name string) error {
+	layout, ok := partitionLayouts()[name]
+	if !ok {
+		return fmt.Errorf("unknown granularity: %s", name)
+	}
+	partitionGranularity = name
+	partitionLayout = layout
+	return nil
+}
+
+// PartitionEnd returns the end of the partition that starts at t.
+func PartitionEnd(t time.Time) time.Time {
+	switch partitionGranularity {
+	case "year":
+		return t.AddDate(1, 0, 0)
+	case "month":
+		return t.AddDate(0, 1, 0)
+	case "hour":
+		return t.Add(time.Hour)
+	}
+	return t.AddDate(0, 0, 1)
+}
+
+// PartitionStart returns the start of the partition that has t.
+func PartitionStart(t time.Time) time.Time {
+	s, err := time.ParseInLocation(partitionLayout, t.Format(partitionLayout), t.Location())
+	if err != nil {
+		return t
+	}
+	return s
+}
+
+// PartitionKeys returns the keys of the partition directories, like ["year", "month", "day"].
+// The keys are the same in -layout=plain, even though they do not appear in the directory names.
+func PartitionKeys() []string {
+	segments := strings.Split(partitionGranularities[partitionGranularity], "/")
+	for i, s := range segments {
+		segments[i] = strings.SplitN(s, "=", 2)[0]
+	}
+	return segments
+}
+
+// PartitionDir returns the directory path of the partition, relative to the output directory.
+// The keys and the values are escaped by EscapePartitionValue.
+func PartitionDir(t time.Time) string {
+	segments := strings.Split(partitionLayout, "/")
+	for i, s := range segments {
+		kv := strings.SplitN(s, "=", 2)
+		if len(kv) != 2 {
+			// -layout=plain has no key.
+			segments[i] = EscapePartitionValue(t.Format(s))
+			continue
+		}
+		segments[i] = EscapePartitionValue(kv[0]) + "=" + EscapePartitionValue(t.Format(kv[1]))
+	}
+	return filepath.Join(segments...)
+}
+
+// windowsSafeNames is true if the partition directories are escaped to be valid on Windows too, that set by -windows-safe-names.
+var windowsSafeNames = runtime.GOOS == "windows"
+
+// windowsReservedNames is the device names that can not be used as a file name on Windows, even with an extension.
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// EscapePartitionValue escapes s for a key or a value of Hive style partition, in the same way as Hive and Spark.
+// The special characters are escaped like "%3A", and empty string is "__HIVE_DEFAULT_PARTITION__".
+//
+// If windowsSafeNames is true, the characters that Hive escapes on Windows (" ", "<", ">", and "|") are escaped too.
+// The trailing dot and space, and the first character of the device names like "CON" or "NUL.2023", are also escaped, because Windows can not make such files.
+func EscapePartitionValue(s string) string {
+	if s == "" {
+		return "__HIVE_DEFAULT_PARTITION__"
+	}
+
+	special := "\"#%'*/:=?\\{[]^"
+	if windowsSafeNames {
+		special += " <>|"
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c == 0x7F || strings.IndexByte(special, c) >= 0 {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else if windowsSafeNames && ((i == 0 && isWindowsReservedName(s)) || (i == len(s)-1 && c == '.')) {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// isWindowsReservedName reports whether the name is a device name on Windows, like "CON" or "nul.txt".
+func isWindowsReservedName(name string) bool {
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		name = name[:i]
+	}
+	return windowsReservedNames[strings.ToUpper(strings.TrimRight(name, " "))]
+}
+
+// UnescapePartitionValue reverses EscapePartitionValue.
+func UnescapePartitionValue(s string) string {
+	if s == "__HIVE_DEFAULT_PARTITION__" {
+		return ""
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+3], 16, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// unescapePartitionDir unescapes each key and value in the slash separated partition directory like "year=2023/month=4".
+// They are unescaped separately, so that an escaped "/" or "=" in a value is not confused with the separators before unescaped.
+func unescapePartitionDir(dir string) string {
+	segments := strings.Split(dir, "/")
+	for i, s := range segments {
+		kv := strings.SplitN(s, "=", 2)
+		if len(kv) != 2 {
+			segments[i] = UnescapePartitionValue(s)
+		} else {
+			segments[i] = UnescapePartitionValue(kv[0]) + "=" + UnescapePartitionValue(kv[1])
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// Partition is a partition directory in the output directory.
+type Partition struct {
+	Time  time.Time
+	Dir   string
+	Files []string
+}
+
+// ListPartitions finds partitions in the output directory, and returns them in the order of time.
+func ListPartitions(dir string) ([]Partition, error) {
+	return ListPartitionsWithLayout(dir, partitionLayout)
+}
+
+// ListPartitionsWithLayout is the same as ListPartitions, but finds the partition directories in the layout instead of -granularity.
+func ListPartitionsWithLayout(dir, layout string) ([]Partition, error) {
+	found := make(map[string]*Partition)
+
+	err := filepath.Walk(dir, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !isCSVFile(path) {
+			return nil
+		}
+
+		pdir := filepath.Dir(path)
+		p, ok := found[pdir]
+		if !ok {
+			rel, err := filepath.Rel(dir, pdir)
+			if err != nil {
+				return err
+			}
+			t, err := time.Parse(layout, unescapePartitionDir(filepath.ToSlash(rel)))
+			if err != nil {
+				// This is not a partition directory.
+				return nil
+			}
+			p = &Partition{Time: t, Dir: pdir}
+			found[pdir] = p
+		}
+		p.Files = append(p.Files, path)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ps := make([]Partition, 0, len(found))
+	for _, p := range found {
+		sort.Strings(p.Files)
+		ps = append(ps, *p)
+	}
+	sort.Slice(ps, func(i, j int) bool {
+		return ps[i].Time.Before(ps[j].Time)
+	})
+
+	return ps, nil
+}
+
+// DetectPartitionLayout finds the time layout of the partition directories in dir, from the layouts of -granularity in all styles of -layout and -pad-partitions.
+func DetectPartitionLayout(dir string) (string, error) {
+	errFound := errors.New("found")
+
+	var layout string
+	err := filepath.Walk(dir, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !isCSVFile(path) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		rel = unescapePartitionDir(filepath.ToSlash(rel))
+		for _, ls := range []map[string]string{partitionGranularities, paddedPartitionGranularities, plainPartitionGranularities} {
+			for _, l := range ls {
+				if _, err := time.Parse(l, rel); err == nil {
+					layout = l
+					return errFound
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil && err != errFound {
+		return "", err
+	}
+	if layout == "" {
+		return "", fmt.Errorf("%s: no partition found", dir)
+	}
+	return layout, nil
+}
+
+// writtenPartitions is the partition directories that written in this run, relative to the output directory and slash separated.
+var writtenPartitions = map[string]bool{}
+
+// partitionsWarned is whether warned that this run exceeded -max-partitions.
+var partitionsWarned bool
+
+// errTooManyPartitions means that the run exceeded -max-partitions with -strict.
+var errTooManyPartitions = errors.New("too many partitions")
+
+// checkPartitions checks -max-partitions before writing into partition, that is relative to the output directory and slash separated.
+// It warns only once, or returns errTooManyPartitions with -strict.
+//
+// WARNING: this function reads commandline flags directly.
+func checkPartitions(partition string) error {
+	if *maxPartitions <= 0 || writtenPartitions[partition] || len(writtenPartitions) < *maxPartitions {
+		return nil
+	}
+	if *strictMode {
+		return fmt.Errorf("%w: more than %d partitions by -max-partitions, at %s. check -date-format", errTooManyPartitions, *maxPartitions, partition)
+	}
+	if !partitionsWarned {
+		partitionsWarned = true
+		logger.With("partition", partition, "max", *maxPartitions).Warnf("too many partitions: more than %d partitions by -max-partitions, at %s. check -date-format", *maxPartitions, partition)
+	}
+	return nil
+}
+
+// WrittenPartitions returns the partition directories that written in this run, in sorted order.
+func WrittenPartitions() []string {
+	ps := make([]string, 0, len(writtenPartitions))
+	for p := range writtenPartitions {
+		ps = append(ps, p)
+	}
+	sort.Strings(ps)
+	return ps
+}
+
+// FileWriter is a writer of an output file.
+type FileWriter interface {
+	Write(record []string) error
+	Flush() error
+	Close() error
+	Name() string
+	Size() int64
+	Written() int64
+}
+
+// openFile is an output file that kept open by PartitionWriter.
+type openFile struct {
+	w      FileWriter
+	fnames []string // the paths of w in all output directories
+	size   int64    // the size of w when opened
+	used   int64    // the time of the last write in the counter of PartitionWriter, to close the least recently used file
+}
+
+// PartitionWriter writes rows into the partition files.
+// Up to -max-open-files files are kept open, so that the rows not sorted by the timestamp do not reopen the files for each row.
+//
+// WARNING: this struct reads commandline flags directly.
+type PartitionWriter struct {
+	name    string
+	prefix  string // the sub directory in the output directory
+	header  []string
+	table   string
+	files   map[string]*openFile // the open files by the path in -out-dir
+	used    int64                // the counter of writes, for openFile.used
+	created map[string]bool
+	rows    map[string]int64     // the number of rows written into each file
+	sizes   map[string]int64     // the size of each file when closed
+	parts   map[string]int       // the current part number of -max-rows-per-file and -max-file-size, for each path of the file without the part
+	mtimes  map[string]time.Time // the modification time of each file for -stamp-mtime
+	spans   map[string]TimeRange // the oldest and the newest timestamp written into each file
+	appends map[string]bool      // the files that made by the other run and appended by -on-exist=append
+	written int64                // the bytes that written by this PartitionWriter, that counted into summary
+}
+
+// NewPartitionWriter makes a new PartitionWriter that writes into files named name.
+func NewPartitionWriter(name string) *PartitionWriter {
+	return &PartitionWriter{
+		name:    name,
+		files:   make(map[string]*openFile),
+		created: make(map[string]bool),
+		rows:    make(map[string]int64),
+		sizes:   make(map[string]int64),
+		parts:   make(map[string]int),
+		mtimes:  make(map[string]time.Time),
+		spans:   make(map[string]TimeRange),
+		appends: make(map[string]bool),
+	}
+}
+
+// splitFiles reports whether the files are split by -max-rows-per-file or -max-file-size.
+//
+// WARNING: this function reads commandline flags directly.
+func splitFiles() bool {
+	return *maxRowsPerFile > 0 || *maxFileSize > 0
+}
+
+// partName returns the file name of the n-th part, like "name.part-00001.csv.bz2" for "name.csv.bz2".
+func partName(name string, n int) string {
+	stem, ext := name, ""
+	if i := strings.Index(name, "."); i >= 0 {
+		stem, ext = name[:i], name[i:]
+	}
+	return fmt.Sprintf("%s.part-%05d%s", stem, n, ext)
+}
+
+// parsePartName splits the file name that made by partName into the original name and the part number.
+// ok is false if the name is not a part.
+func parsePartName(name string) (orig string, n int, ok bool) {
+	i := strings.Index(name, ".part-")
+	if i < 0 {
+		return name, 0, false
+	}
+	num, ext := name[i+len(".part-"):], ""
+	if j := strings.Index(num, "."); j >= 0 {
+		num, ext = num[:j], num[j:]
+	}
+	n, err := strconv.Atoi(num)
+	if err != nil || len(num) < 5 {
+		return name, 0, false
+	}
+	return name[:i] + ext, n, true
+}
+
+// fileName returns the name of the current file in the partition.
+func (p *PartitionWriter) fileName(partition string) string {
+	if !splitFiles() {
+		return p.name
+	}
+	return partName(p.name, p.parts[outputPath(*outputDir, p.prefix, partition, p.name)])
+}
+
+// full reports whether the file reached -max-rows-per-file or -max-file-size.
+func (p *PartitionWriter) full(fname string) bool {
+	if *maxRowsPerFile > 0 && p.rows[fname] >= *maxRowsPerFile {
+		return true
+	}
+	if *maxFileSize > 0 {
+		size := p.sizes[fname]
+		if f, ok := p.files[fname]; ok {
+			size = f.w.Written()
+		}
+		return size >= *maxFileSize
+	}
+	return false
+}
+
+// SetHeader sets the column names of the output files.
+// The names are used as the column names of Parquet and SQLite output. If not set, the columns are named like "col1", "col2", and so on.
+func (p *PartitionWriter) SetHeader(header []string) {
+	p.header = header
+}
+
+// Overflow makes a PartitionWriter for the overflow area of -max-row-size.
+// The rows have the row number as the first column.
+func (p *PartitionWriter) Overflow() *PartitionWriter {
+	o := NewPartitionWriter(p.name)
+	o.prefix = overflowDir
+	o.table = p.table
+	if p.header != nil {
+		o.header = append([]string{"row"}, p.header...)
+	}
+	return o
+}
+
+// SetTable sets the table name of SQLite output.
+func (p *PartitionWriter) SetTable(table string) {
+	p.table = table
+}
+
+// Write writes a row into the partition of t.
+func (p *PartitionWriter) Write(t time.Time, row []string) error {
+	partition := PartitionDir(t)
+	name := p.fileName(partition)
+	fname := outputPath(*outputDir, p.prefix, partition, name)
+
+	if splitFiles() && p.full(fname) {
+		// The full part is never written again, so it is closed without waiting to be the least recently used.
+		if err := p.closeFile(fname); err != nil {
+			return err
+		}
+		p.parts[outputPath(*outputDir, p.prefix, partition, p.name)]++
+		name = p.fileName(partition)
+		fname = outputPath(*outputDir, p.prefix, partition, name)
+	}
+
+	f, ok := p.files[fname]
+	if !ok {
+		var err error
+		if f, err = p.openFile(row, partition, name, fname); err != nil {
+			return err
+		}
+	}
+
+	p.used++
+	f.used = p.used
+	if err := f.w.Write(row); err != nil {
+		return fmt.Errorf("failed to write %s: %w", fname, err)
+	}
+	p.rows[fname]++
+
+	if span, ok := p.spans[fname]; !ok {
+		p.spans[fname] = TimeRange{Since: t, Until: t}
+	} else if t.Before(span.Since) {
+		p.spans[fname] = TimeRange{Since: t, Until: span.Until}
+	} else if t.After(span.Until) {
+		p.spans[fname] = TimeRange{Since: span.Since, Until: t}
+	}
+
+	switch *stampMtime {
+	case "partition":
+		if _, ok := p.mtimes[fname]; !ok {
+			p.mtimes[fname] = PartitionStart(t)
+		}
+	case "latest-row":
+		if cur, ok := p.mtimes[fname]; !ok || t.After(cur) {
+			p.mtimes[fname] = t
+		}
+	}
+	return nil
+}
+
+// openFile opens the file named name in the partition, that is at fname in -out-dir.
+// If -max-open-files files are already open, the least recently used one is closed before opening.
+//
+// WARNING: this method reads commandline flags directly.
+func (p *PartitionWriter) openFile(row []string, partition, name, fname string) (*openFile, error) {
+	chopMu.Lock()
+	defer chopMu.Unlock()
+
+	if err := checkPartitions(filepath.ToSlash(partition)); err != nil {
+		return nil, err
+	}
+
+	if len(p.files) >= *maxOpenFiles {
+		lru := ""
+		for n, f := range p.files {
+			if lru == "" || f.used < p.files[lru].used {
+				lru = n
+			}
+		}
+		if err := p.closeLocked(lru); err != nil {
+			return nil, err
+		}
+	}
+
+	dirs := outputDirs()
+	fnames := make([]string, len(dirs))
+	for i, d := range dirs {
+		fnames[i] = outputPath(d, p.prefix, partition, name)
+		if !*quietLog {
+			logger.With("partition", filepath.ToSlash(partition), "file", fnames[i]).Infof("write to %s", fnames[i])
+		}
+		if err := makeOutputDir(outputPath(d, p.prefix, partition)); err != nil {
+			return nil, err
+		}
+	}
+	if p.prefix == "" {
+		if err := RemoveSuccessMarker(partition); err != nil {
+			return nil, err
+		}
+	}
+
+	// Always append to the file that made by this run, and handle the file that made by the previous run by -on-exist.
+	appending := p.created[fname]
+	if !appending {
+		var err error
+		if appending, err = checkExistingOutput(fnames); err != nil {
+			return nil, err
+		}
+		p.appends[fname] = appending
+	}
+
+	w, err := p.open(row, appending, fnames)
+	if err != nil {
+		return nil, err
+	}
+	p.created[fname] = true
+	writtenPartitions[filepath.ToSlash(partition)] = true
+
+	f := &openFile{w: w, fnames: fnames, size: w.Size()}
+	p.files[fname] = f
+	return f, nil
+}
+
+// checkExistingOutput handles the output files that made by the previous run, by -on-exist.
+// It reports whether to append into the files.
+//
+// WARNING: this function reads commandline flags directly.
+func checkExistingOutput(fnames []string) (bool, error) {
+	if *onExist == "overwrite" {
+		return false, nil
+	}
+
+	exists := false
+	for _, f := range fnames {
+		if isRemoteURL(f) {
+			continue
+		}
+		if _, err := os.Stat(f); err == nil {
+			exists = true
+		} else if !os.IsNotExist(err) {
+			return false, err
+		}
+	}
+	if !exists {
+		return false, nil
+	}
+
+	if *onExist == "fail" {
+		return false, fmt.Errorf("%s: already exists", fnames[0])
+	}
+	for _, f := range fnames {
+		if err := prepareAppend(f); err != nil {
+			return false, fmt.Errorf("failed to prepare to append into %s: %w", f, err)
+		}
+	}
+	logger.With("file", fnames[0]).Infof("append to existing file: %s", fnames[0])
+	return true, nil
+}
+
+// open opens the output files in the format of -format.
+func (p *PartitionWriter) open(row []string, appending bool, fnames []string) (FileWriter, error) {
+	header := p.header
+	if header == nil {
+		header = make([]string, len(row))
+		for i := range header {
+			header[i] = fmt.Sprintf("col%d", i+1)
+		}
+	}
+
+	switch *outputFormat {
+	case "parquet", "duckdb":
+		if appending {
+			return AppendParquet(fnames...)
+		}
+		return CreateParquet(header, fnames...)
+	case "sqlite":
+		if appending {
+			return AppendSQLite(fnames...)
+		}
+		return CreateSQLite(p.table, header, fnames...)
+	default:
+		if appending {
+			return Append(fnames...)
+		}
+		return Create(fnames...)
+	}
+}
+
+// Flush writes out all rows that written so far into the open files.
+func (p *PartitionWriter) Flush() error {
+	for _, fname := range p.openFiles() {
+		if err := p.files[fname].w.Flush(); err != nil {
+			return fmt.Errorf("failed to write %s: %w", fname, err)
+		}
+	}
+	return nil
+}
+
+// openFiles returns the paths of the open files, in sorted order.
+func (p *PartitionWriter) openFiles() []string {
+	fs := make([]string, 0, len(p.files))
+	for f := range p.files {
+		fs = append(fs, f)
+	}
+	sort.Strings(fs)
+	return fs
+}
+
+// Files returns the paths of all files that written by this PartitionWriter, in sorted order.
+func (p *PartitionWriter) Files() []string {
+	fs := make([]string, 0, len(p.created))
+	for f := range p.created {
+		fs = append(fs, f)
+	}
+	sort.Strings(fs)
+	return fs
+}
+
+// Resume marks the file as written by this PartitionWriter with the rows, so that the next rows are appended into it.
+// It is used to resume an interrupted run from a checkpoint.
+func (p *PartitionWriter) Resume(path string, rows int64) {
+	p.created[path] = true
+	p.rows[path] = rows
+
+	dir, name := filepath.Split(path)
+	if orig, n, ok := parsePartName(name); ok && orig == p.name {
+		key := filepath.Join(dir, orig)
+		if n > p.parts[key] {
+			p.parts[key] = n
+		}
+	}
+}
+
+// Rows returns the number of rows that written into the file by this PartitionWriter.
+func (p *PartitionWriter) Rows(path string) int64 {
+	return p.rows[path]
+}
+
+// Span returns the oldest and the newest timestamp of the rows that written into the file by this PartitionWriter.
+// The rows that written before resumed from a checkpoint are not included.
+func (p *PartitionWriter) Span(path string) TimeRange {
+	return p.spans[path]
+}
+
+// Appended reports whether the file was made by the other run, and the rows were appended into it.
+func (p *PartitionWriter) Appended(path string) bool {
+	return p.appends[path]
+}
+
+// Close closes all open files.
+func (p *PartitionWriter) Close() error {
+	chopMu.Lock()
+	defer chopMu.Unlock()
+	return p.close()
+}
+
+// close closes all open files while chopMu is locked.
+// All files are closed even if failed, and the first error is returned.
+func (p *PartitionWriter) close() error {
+	var err error
+	for _, fname := range p.openFiles() {
+		if e := p.closeLocked(fname); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// closeFile closes the file at fname in -out-dir if open.
+func (p *PartitionWriter) closeFile(fname string) error {
+	if _, ok := p.files[fname]; !ok {
+		return nil
+	}
+	chopMu.Lock()
+	defer chopMu.Unlock()
+	return p.closeLocked(fname)
+}
+
+// closeLocked closes the file at fname in -out-dir while chopMu is locked.
+func (p *PartitionWriter) closeLocked(fname string) error {
+	f := p.files[fname]
+	delete(p.files, fname)
+
+	err := f.w.Close()
+	if err != nil {
+		err = fmt.Errorf("failed to write %s: %w", fname, err)
+	}
+	summary.OutputBytes += f.w.Size() - f.size
+	p.written += f.w.Size() - f.size
+	p.sizes[fname] = f.w.Size()
+
+	if t, ok := p.mtimes[fname]; ok && err == nil {
+		for _, path := range f.fnames {
+			if err = stampOutput(path, t); err != nil {
+				break
+			}
+		}
+	}
+	return err
+}
+
+// stampOutput sets the modification time of the local output file and its seek index for -stamp-mtime.
+// The files on Sinks are not changed.
+func stampOutput(path string, t time.Time) error {
+	if isRemoteURL(path) {
+		return nil
+	}
+	if err := os.Chtimes(localOutputPath(path), t, t); err != nil {
+		return err
+	}
+	idx := localOutputPath(path + ".idx")
+	if _, err := os.Stat(idx); err == nil {
+		return os.Chtimes(idx, t, t)
+	}
+	return nil
+}
+
+// Complete renames the local files that written by this PartitionWriter into place, and completes the uploads of them.
+// Unlike CompleteUploads, the files of the other PartitionWriters that still writing in parallel are kept.
+func (p *PartitionWriter) Complete() error {
+	chopMu.Lock()
+	defer chopMu.Unlock()
+
+	err := completeUploads(p.owns)
+	if err != nil || *nameScheme != "content-hash" {
+		return err
+	}
+	return p.renameByContent()
+}
+
+// owns reports whether the output file f is written by this PartitionWriter.
+func (p *PartitionWriter) owns(f string) bool {
+	name := strings.TrimSuffix(path.Base(filepath.ToSlash(f)), ".idx")
+	orig, _, _ := parsePartName(name)
+	return orig == p.name
+}
+
+// Discard closes all open files, and removes the files that written by this PartitionWriter and not completed yet.
+// It is used when the input file failed in the middle, so that the partial output is not left.
+// The files that written in place in -follow mode are kept as is.
+func (p *PartitionWriter) Discard() {
+	chopMu.Lock()
+	defer chopMu.Unlock()
+
+	p.close()
+	discardUploads(p.owns)
+	summary.OutputBytes -= p.written
+	p.written = 0
+}
+
+// contentName returns the file name for -name-scheme=content-hash, that made from the SHA-256 of the content and the extension of name.
+func contentName(name, sum string) string {
+	orig, _, _ := parsePartName(name)
+	ext := ""
+	if i := strings.Index(orig, "."); i >= 0 {
+		ext = orig[i:]
+	}
+	return sum[:32] + ext
+}
+
+// renameByContent renames the files that written by this PartitionWriter by the SHA-256 of their contents, for -name-scheme=content-hash.
+// The same content always has the same name, so the file is just overwritten when the same input chopped again into the same directory.
+//
+// It must be called while chopMu is locked, after the files renamed into place.
+func (p *PartitionWriter) renameByContent() error {
+	for _, f := range p.Files() {
+		_, sum, err := fileDigest(f)
+		if err != nil {
+			return err
+		}
+		name := contentName(filepath.Base(f), sum)
+
+		rel := filepath.FromSlash(relOutputPath(*outputDir, f))
+		for _, d := range outputDirs() {
+			src := outputPath(d, rel)
+			dst := filepath.Join(filepath.Dir(src), name)
+			if err := renameOutput(src, dst); err != nil {
+				return err
+			}
+			if _, err := os.Stat(src + ".idx"); err == nil {
+				if err := renameOutput(src+".idx", dst+".idx"); err != nil {
+					return err
+				}
+			}
+		}
+
+		renamed := filepath.Join(filepath.Dir(f), name)
+		p.created[renamed] = true
+		p.rows[renamed] += p.rows[f]
+		p.spans[renamed] = p.spans[f]
+		delete(p.created, f)
+		delete(p.rows, f)
+		delete(p.spans, f)
+	}
+	return nil
+}
@@ -0,0 +1,599 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setOutputDir sets -out-dir to a temporary directory until the test finished, and returns it.
+// The files not renamed into place yet are forgotten after the test.
+func setOutputDir(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	orig, pending := *outputDir, pendingFiles
+	*outputDir, pendingFiles = dir, map[string]bool{}
+	t.Cleanup(func() {
+		*outputDir, pendingFiles = orig, pending
+	})
+	return dir
+}
+
+// countBzip2Streams counts the bzip2 streams in the file at path, by the stream header and the magic of the first block.
+func countBzip2Streams(t *testing.T, path string) int {
+	t.Helper()
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read: %s", err)
+	}
+	n := 0
+	for c := '1'; c <= '9'; c++ {
+		n += bytes.Count(b, []byte("BZh"+string(c)+"\x31\x41\x59\x26\x53\x59"))
+	}
+	return n
+}
+
+func TestPartitionWriter_interleaved(t *testing.T) {
+	days := []time.Time{
+		time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2023, 4, 2, 0, 0, 0, 0, time.UTC),
+		time.Date(2023, 4, 3, 0, 0, 0, 0, time.UTC),
+	}
+
+	tests := []struct {
+		Name         string
+		MaxOpenFiles int
+		Streams      int
+	}{
+		{"all files open", 3, 1},
+		{"reopen", 2, 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			dir := setOutputDir(t)
+
+			orig := *maxOpenFiles
+			*maxOpenFiles = tt.MaxOpenFiles
+			defer func() { *maxOpenFiles = orig }()
+
+			// The rows switch the partition at every row, like the input that not sorted by the timestamp.
+			want := make([][][]string, len(days))
+			w := NewPartitionWriter("test.csv.bz2")
+			for i := 0; i < 300; i++ {
+				row := []string{days[i%len(days)].Format("20060102"), fmt.Sprint(i)}
+				want[i%len(days)] = append(want[i%len(days)], row)
+				if err := w.Write(days[i%len(days)], row); err != nil {
+					t.Fatalf("failed to write: %s", err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("failed to close: %s", err)
+			}
+			if err := CompleteUploads(); err != nil {
+				t.Fatalf("failed to complete: %s", err)
+			}
+
+			for i, day := range days {
+				path := filepath.Join(dir, filepath.FromSlash(day.Format("year=2006/month=1/day=2")), "test.csv.bz2")
+				if got := readBzip2CSV(t, path); !reflect.DeepEqual(got, want[i]) {
+					t.Errorf("%s: expected %q but got %q", path, want[i], got)
+				}
+				if n := countBzip2Streams(t, path); n != tt.Streams {
+					t.Errorf("%s: expected %d streams but got %d", path, tt.Streams, n)
+				}
+			}
+		})
+	}
+}
+
+func TestPartitionWriter_maxRowsPerFile(t *testing.T) {
+	dir := setOutputDir(t)
+
+	orig := *maxRowsPerFile
+	*maxRowsPerFile = 2
+	defer func() { *maxRowsPerFile = orig }()
+
+	day1 := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+	day2 := time.Date(2023, 4, 2, 0, 0, 0, 0, time.UTC)
+
+	w := NewPartitionWriter("test.csv.bz2")
+	for i, d := range []time.Time{day1, day2, day1, day1, day1, day2, day1} {
+		if err := w.Write(d, []string{d.Format("20060102"), fmt.Sprint(i)}); err != nil {
+			t.Fatalf("failed to write: %s", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+	if err := w.Complete(); err != nil {
+		t.Fatalf("failed to complete: %s", err)
+	}
+
+	want := map[string][][]string{
+		"year=2023/month=4/day=1/test.part-00000.csv.bz2": {{"20230401", "0"}, {"20230401", "2"}},
+		"year=2023/month=4/day=1/test.part-00001.csv.bz2": {{"20230401", "3"}, {"20230401", "4"}},
+		"year=2023/month=4/day=1/test.part-00002.csv.bz2": {{"20230401", "6"}},
+		"year=2023/month=4/day=2/test.part-00000.csv.bz2": {{"20230402", "1"}, {"20230402", "5"}},
+	}
+	if files := w.Files(); len(files) != len(want) {
+		t.Errorf("expected %d files but got %q", len(want), files)
+	}
+	for name, rows := range want {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if got := readBzip2CSV(t, path); !reflect.DeepEqual(got, rows) {
+			t.Errorf("%s: expected %q but got %q", name, rows, got)
+		}
+	}
+}
+
+func TestPartitionWriter_stampMtime(t *testing.T) {
+	day := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+	times := []time.Time{day.Add(10 * time.Hour), day.Add(15 * time.Hour), day.Add(12 * time.Hour)}
+
+	tests := []struct {
+		Mode  string
+		Mtime time.Time
+	}{
+		{"partition", day},
+		{"latest-row", day.Add(15 * time.Hour)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Mode, func(t *testing.T) {
+			dir := setOutputDir(t)
+
+			orig := *stampMtime
+			*stampMtime = tt.Mode
+			defer func() { *stampMtime = orig }()
+
+			w := NewPartitionWriter("test.csv.bz2")
+			for _, ts := range times {
+				if err := w.Write(ts, []string{ts.Format("20060102"), "x"}); err != nil {
+					t.Fatalf("failed to write: %s", err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("failed to close: %s", err)
+			}
+			if err := w.Complete(); err != nil {
+				t.Fatalf("failed to complete: %s", err)
+			}
+
+			path := filepath.Join(dir, PartitionDir(day), "test.csv.bz2")
+			if info, err := os.Stat(path); err != nil {
+				t.Fatalf("failed to stat: %s", err)
+			} else if !info.ModTime().Equal(tt.Mtime) {
+				t.Errorf("expected %s but got %s", tt.Mtime, info.ModTime())
+			}
+		})
+	}
+}
+
+func TestPartitionWriter_contentHash(t *testing.T) {
+	dir := setOutputDir(t)
+
+	orig := *nameScheme
+	*nameScheme = "content-hash"
+	defer func() { *nameScheme = orig }()
+
+	day := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+	row := []string{"20230401", "x"}
+
+	var names []string
+	for _, name := range []string{"a.csv.bz2", "b.csv.bz2"} {
+		w := NewPartitionWriter(name)
+		if err := w.Write(day, row); err != nil {
+			t.Fatalf("failed to write: %s", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("failed to close: %s", err)
+		}
+		if err := w.Complete(); err != nil {
+			t.Fatalf("failed to complete: %s", err)
+		}
+
+		files := w.Files()
+		if len(files) != 1 {
+			t.Fatalf("expected 1 file but got %q", files)
+		}
+		if w.Rows(files[0]) != 1 {
+			t.Errorf("expected 1 row in %s but got %d", files[0], w.Rows(files[0]))
+		}
+		names = append(names, files[0])
+	}
+
+	if names[0] != names[1] {
+		t.Errorf("expected the same name for the same content but got %q", names)
+	}
+
+	_, sum, err := fileDigest(names[0])
+	if err != nil {
+		t.Fatalf("failed to digest: %s", err)
+	}
+	if want := filepath.Join(dir, PartitionDir(day), sum[:32]+".csv.bz2"); names[0] != want {
+		t.Errorf("expected %s but got %s", want, names[0])
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, PartitionDir(day)))
+	if err != nil {
+		t.Fatalf("failed to read partition: %s", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected only the renamed file but got %v", entries)
+	}
+}
+
+func TestContentName(t *testing.T) {
+	sum := "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	tests := []struct {
+		Name   string
+		Output string
+	}{
+		{"a.csv.bz2", "0123456789abcdef0123456789abcdef.csv.bz2"},
+		{"a.part-00001.parquet", "0123456789abcdef0123456789abcdef.parquet"},
+		{"a", "0123456789abcdef0123456789abcdef"},
+	}
+
+	for _, tt := range tests {
+		if got := contentName(tt.Name, sum); got != tt.Output {
+			t.Errorf("%s: expected %s but got %s", tt.Name, tt.Output, got)
+		}
+	}
+}
+
+func TestPartitionWriter_onExist(t *testing.T) {
+	day := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+	first := []string{"20230401", "first"}
+	second := []string{"20230401", "second"}
+
+	tests := []struct {
+		Policy string
+		Fail   bool
+		Output [][]string
+	}{
+		{"overwrite", false, [][]string{second}},
+		{"append", false, [][]string{first, second}},
+		{"fail", true, [][]string{first}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Policy, func(t *testing.T) {
+			dir := setOutputDir(t)
+
+			orig := *onExist
+			*onExist = tt.Policy
+			defer func() { *onExist = orig }()
+
+			// Each PartitionWriter is a run, so that the second one finds the file of the previous run.
+			var err error
+			for _, row := range [][]string{first, second} {
+				w := NewPartitionWriter("test.csv.bz2")
+				if err = w.Write(day, row); err != nil {
+					break
+				}
+				if err := w.Close(); err != nil {
+					t.Fatalf("failed to close: %s", err)
+				}
+				if err := w.Complete(); err != nil {
+					t.Fatalf("failed to complete: %s", err)
+				}
+			}
+			if tt.Fail && err == nil {
+				t.Errorf("expected error but got nil")
+			} else if !tt.Fail && err != nil {
+				t.Errorf("failed to write: %s", err)
+			}
+
+			path := filepath.Join(dir, PartitionDir(day), "test.csv.bz2")
+			if got := readBzip2CSV(t, path); !reflect.DeepEqual(got, tt.Output) {
+				t.Errorf("expected %q but got %q", tt.Output, got)
+			}
+		})
+	}
+}
+
+func TestPartName(t *testing.T) {
+	tests := []struct {
+		Name string
+		N    int
+		Part string
+	}{
+		{"test.csv.bz2", 0, "test.part-00000.csv.bz2"},
+		{"test.parquet", 12, "test.part-00012.parquet"},
+		{"test", 3, "test.part-00003"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Part, func(t *testing.T) {
+			if got := partName(tt.Name, tt.N); got != tt.Part {
+				t.Errorf("expected %q but got %q", tt.Part, got)
+			}
+
+			orig, n, ok := parsePartName(tt.Part)
+			if !ok || orig != tt.Name || n != tt.N {
+				t.Errorf("expected %q, %d but got %q, %d, %v", tt.Name, tt.N, orig, n, ok)
+			}
+		})
+	}
+
+	for _, name := range []string{"test.csv.bz2", "test.part-1.csv.bz2", "test.part-abcde.csv"} {
+		if _, _, ok := parsePartName(name); ok {
+			t.Errorf("%s: expected not a part but parsed", name)
+		}
+	}
+}
+
+func TestEscapePartitionValue(t *testing.T) {
+	tests := []struct {
+		Input  string
+		Output string
+	}{
+		{"2023", "2023"},
+		{"", "__HIVE_DEFAULT_PARTITION__"},
+		{"a/b", "a%2Fb"},
+		{"12:34", "12%3A34"},
+		{"a=b", "a%3Db"},
+		{"100%", "100%25"},
+		{"tab\there", "tab%09here"},
+		{"日本語", "日本語"},
+	}
+
+	for _, tt := range tests {
+		if got := EscapePartitionValue(tt.Input); got != tt.Output {
+			t.Errorf("%q: expected %q but got %q", tt.Input, tt.Output, got)
+		}
+		if got := UnescapePartitionValue(tt.Output); got != tt.Input {
+			t.Errorf("%q: expected to unescape into %q but got %q", tt.Output, tt.Input, got)
+		}
+	}
+}
+
+func TestEscapePartitionValue_windowsSafe(t *testing.T) {
+	orig := windowsSafeNames
+	windowsSafeNames = true
+	defer func() { windowsSafeNames = orig }()
+
+	tests := []struct {
+		Input  string
+		Output string
+	}{
+		{"2023", "2023"},
+		{"a b", "a%20b"},
+		{"<a|b>", "%3Ca%7Cb%3E"},
+		{"end.", "end%2E"},
+		{"end ", "end%20"},
+		{"CON", "%43ON"},
+		{"nul.2023", "%6Eul.2023"},
+		{"COM10", "COM10"},
+		{"console", "console"},
+	}
+
+	for _, tt := range tests {
+		if got := EscapePartitionValue(tt.Input); got != tt.Output {
+			t.Errorf("%q: expected %q but got %q", tt.Input, tt.Output, got)
+		}
+		if got := UnescapePartitionValue(tt.Output); got != tt.Input {
+			t.Errorf("%q: expected to unescape into %q but got %q", tt.Output, tt.Input, got)
+		}
+	}
+}
+
+func TestUnescapePartitionDir(t *testing.T) {
+	tests := []struct {
+		Input  string
+		Output string
+	}{
+		{"year=2023/month=4/day=1", "year=2023/month=4/day=1"},
+		{"key=a%3Db/x=y", "key=a=b/x=y"},
+		{"key=a%2Fb=c", "key=a/b=c"},
+		{"k%3Dey=v", "k=ey=v"},
+		{"key=__HIVE_DEFAULT_PARTITION__", "key="},
+		{"plain%20dir", "plain dir"},
+	}
+
+	for _, tt := range tests {
+		if got := unescapePartitionDir(tt.Input); got != tt.Output {
+			t.Errorf("%q: expected %q but got %q", tt.Input, tt.Output, got)
+		}
+	}
+}
+
+func TestPartitionDir(t *testing.T) {
+	got := PartitionDir(time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC))
+	if want := filepath.Join("year=2023", "month=4", "day=1"); got != want {
+		t.Errorf("expected %s but got %s", want, got)
+	}
+}
+
+func TestSetGranularity(t *testing.T) {
+	orig, origGranularity := partitionLayout, partitionGranularity
+	defer func() { partitionLayout, partitionGranularity = orig, origGranularity }()
+
+	tests := []struct {
+		Granularity string
+		Dir         string
+		Keys        []string
+	}{
+		{"year", "year=2023", []string{"year"}},
+		{"month", "year=2023/month=4", []string{"year", "month"}},
+		{"day", "year=2023/month=4/day=1", []string{"year", "month", "day"}},
+		{"hour", "year=2023/month=4/day=1/hour=12", []string{"year", "month", "day", "hour"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Granularity, func(t *testing.T) {
+			if err := SetGranularity(tt.Granularity); err != nil {
+				t.Fatalf("failed to set granularity: %s", err)
+			}
+			got := PartitionDir(time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC))
+			if want := filepath.FromSlash(tt.Dir); got != want {
+				t.Errorf("expected %s but got %s", want, got)
+			}
+			if keys := PartitionKeys(); !reflect.DeepEqual(keys, tt.Keys) {
+				t.Errorf("expected keys %q but got %q", tt.Keys, keys)
+			}
+		})
+	}
+
+	if err := SetGranularity("week"); err == nil {
+		t.Errorf("expected error for unknown granularity but got nil")
+	}
+}
+
+func TestSetLayout(t *testing.T) {
+	orig, origGranularity, origStyle, origPadding := partitionLayout, partitionGranularity, partitionStyle, partitionPadding
+	defer func() {
+		partitionLayout, partitionGranularity, partitionStyle, partitionPadding = orig, origGranularity, origStyle, origPadding
+	}()
+
+	tests := []struct {
+		Style       string
+		Pad         bool
+		Granularity string
+		Dir         string
+	}{
+		{"plain", false, "day", "2023/04/01"},
+		{"plain", false, "hour", "2023/04/01/09"},
+		{"plain", false, "month", "2023/04"},
+		{"plain", true, "day", "2023/04/01"},
+		{"hive", false, "month", "year=2023/month=4"},
+		{"hive", true, "month", "year=2023/month=04"},
+		{"hive", true, "hour", "year=2023/month=04/day=01/hour=09"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s pad=%v %s", tt.Style, tt.Pad, tt.Granularity), func(t *testing.T) {
+			if err := SetLayout(tt.Style, tt.Pad); err != nil {
+				t.Fatalf("failed to set layout: %s", err)
+			}
+			if err := SetGranularity(tt.Granularity); err != nil {
+				t.Fatalf("failed to set granularity: %s", err)
+			}
+			got := PartitionDir(time.Date(2023, 4, 1, 9, 0, 0, 0, time.UTC))
+			if want := filepath.FromSlash(tt.Dir); got != want {
+				t.Errorf("expected %s but got %s", want, got)
+			}
+		})
+	}
+
+	// The granularity set before the layout is kept.
+	if err := SetGranularity("month"); err != nil {
+		t.Fatalf("failed to set granularity: %s", err)
+	}
+	if err := SetLayout("plain", false); err != nil {
+		t.Fatalf("failed to set layout: %s", err)
+	}
+	if got, want := PartitionDir(time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)), filepath.FromSlash("2023/04"); got != want {
+		t.Errorf("expected %s but got %s", want, got)
+	}
+	if keys := PartitionKeys(); !reflect.DeepEqual(keys, []string{"year", "month"}) {
+		t.Errorf("expected keys of hive layout but got %q", keys)
+	}
+
+	if err := SetLayout("flat", false); err == nil {
+		t.Errorf("expected error for unknown layout but got nil")
+	}
+}
+
+func TestDetectPartitionLayout(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "year=2023", "month=4", "a.csv.bz2")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("failed to make directory: %s", err)
+	}
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+
+	layout, err := DetectPartitionLayout(dir)
+	if err != nil {
+		t.Fatalf("failed to detect: %s", err)
+	}
+	if want := partitionGranularities["month"]; layout != want {
+		t.Errorf("expected %s but got %s", want, layout)
+	}
+
+	if _, err := DetectPartitionLayout(t.TempDir()); err == nil {
+		t.Errorf("expected error for empty directory but got nil")
+	}
+
+	plain := t.TempDir()
+	path = filepath.Join(plain, "2023", "04", "01", "a.csv.bz2")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("failed to make directory: %s", err)
+	}
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+	if layout, err := DetectPartitionLayout(plain); err != nil {
+		t.Errorf("failed to detect plain layout: %s", err)
+	} else if want := plainPartitionGranularities["day"]; layout != want {
+		t.Errorf("expected %s but got %s", want, layout)
+	}
+}
+
+func TestPartitionWriter_maxPartitions(t *testing.T) {
+	setOutputDir(t)
+
+	var buf bytes.Buffer
+	origLog, origMax, origWritten, origWarned := textLog, *maxPartitions, writtenPartitions, partitionsWarned
+	textLog, *maxPartitions, writtenPartitions, partitionsWarned = log.New(&buf, "", 0), 2, map[string]bool{}, false
+	defer func() {
+		textLog, *maxPartitions, writtenPartitions, partitionsWarned = origLog, origMax, origWritten, origWarned
+	}()
+
+	w := NewPartitionWriter("test.csv.bz2")
+	for _, day := range []int{1, 2, 1, 3, 4, 2} {
+		d := time.Date(2023, 4, day, 0, 0, 0, 0, time.UTC)
+		if err := w.Write(d, []string{d.Format("20060102")}); err != nil {
+			t.Fatalf("failed to write: %s", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+
+	// The rows are still written, and warned only once at the third partition.
+	if len(writtenPartitions) != 4 {
+		t.Errorf("expected 4 partitions but got %v", writtenPartitions)
+	}
+	if n := strings.Count(buf.String(), "too many partitions"); n != 1 {
+		t.Errorf("expected a warning but got %d:\n%s", n, buf.String())
+	}
+	if !strings.Contains(buf.String(), "at year=2023/month=4/day=3.") {
+		t.Errorf("expected a warning at the third partition but got:\n%s", buf.String())
+	}
+}
+
+func TestPartitionWriter_maxPartitions_strict(t *testing.T) {
+	setOutputDir(t)
+
+	origMax, origStrict, origWritten := *maxPartitions, *strictMode, writtenPartitions
+	*maxPartitions, *strictMode, writtenPartitions = 1, true, map[string]bool{}
+	defer func() { *maxPartitions, *strictMode, writtenPartitions = origMax, origStrict, origWritten }()
+
+	w := NewPartitionWriter("test.csv.bz2")
+	defer w.Discard()
+
+	day1 := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+	day2 := time.Date(2023, 4, 2, 0, 0, 0, 0, time.UTC)
+	if err := w.Write(day1, []string{"20230401"}); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+	if err := w.Write(day2, []string{"20230402"}); !errors.Is(err, errTooManyPartitions) {
+		t.Errorf("expected too many partitions error but got %v", err)
+	}
+	if len(writtenPartitions) != 1 {
+		t.Errorf("expected only the first partition is written but got %v", writtenPartitions)
+	}
+}
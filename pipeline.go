@@ -0,0 +1,229 @@
+package main
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// readAheadBatch is the number of records that sent to the chopping goroutine at once by readAhead.
+	readAheadBatch = 256
+
+	// readAheadDepth is the number of batches that readAhead reads ahead.
+	readAheadDepth = 16
+
+	// asyncWriteSize is the size of the buffers that sent to the compressing goroutine by asyncWriter.
+	asyncWriteSize = 64 * 1024
+
+	// asyncWriteDepth is the number of buffers that asyncWriter holds until compressed.
+	asyncWriteDepth = 16
+)
+
+// recordBatch is the records that read by readAhead, and the error after them.
+type recordBatch struct {
+	records [][]string
+	err     error
+}
+
+// readAheadSource is a RecordSource that made by readAhead.
+type readAheadSource struct {
+	ch   chan recordBatch
+	done chan struct{}
+	wg   sync.WaitGroup
+
+	cur [][]string
+	err error
+}
+
+// readAhead reads records from src in another goroutine, so that reading and parsing the input do not wait for writing the output.
+// The returned function stops reading, and must be called after reading.
+//
+// The records are copied into a buffer for each batch, so src can reuse the record.
+func readAhead(src RecordSource) (RecordSource, func()) {
+	r := &readAheadSource{
+		ch:   make(chan recordBatch, readAheadDepth),
+		done: make(chan struct{}),
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		var buf []string
+		for {
+			b := recordBatch{records: make([][]string, 0, readAheadBatch)}
+			for len(b.records) < readAheadBatch && b.err == nil {
+				var rec []string
+				rec, b.err = src.Next()
+				if b.err != nil {
+					break
+				}
+
+				if cap(buf)-len(buf) < len(rec) {
+					// Allocate for the whole batch at once, assuming the rows have the similar number of columns.
+					buf = make([]string, 0, len(rec)*readAheadBatch)
+				}
+				n := len(buf)
+				buf = append(buf, rec...)
+				b.records = append(b.records, buf[n:len(buf):len(buf)])
+			}
+
+			select {
+			case r.ch <- b:
+			case <-r.done:
+				return
+			}
+			if b.err != nil {
+				return
+			}
+		}
+	}()
+
+	return r, func() {
+		close(r.done)
+		r.wg.Wait()
+	}
+}
+
+// Next returns the next record that read ahead.
+func (r *readAheadSource) Next() ([]string, error) {
+	for len(r.cur) == 0 {
+		if r.err != nil {
+			return nil, r.err
+		}
+		b := <-r.ch
+		r.cur, r.err = b.records, b.err
+	}
+
+	rec := r.cur[0]
+	r.cur = r.cur[1:]
+	return rec, nil
+}
+
+// asyncWriter is an io.Writer that writes into w in another goroutine, so that compressing the output does not block making the rows.
+//
+// The errors of w are reported by the next Write, Flush, or Close after the error.
+type asyncWriter struct {
+	w    io.Writer
+	buf  []byte
+	ch   chan []byte // nil is a request to reply to ack after all data written
+	free chan []byte
+	ack  chan struct{}
+	wg   sync.WaitGroup
+
+	mu  sync.Mutex
+	err error
+}
+
+// newAsyncWriter makes a new asyncWriter that writes into w.
+func newAsyncWriter(w io.Writer) *asyncWriter {
+	a := &asyncWriter{
+		w:    w,
+		ch:   make(chan []byte, asyncWriteDepth),
+		free: make(chan []byte, asyncWriteDepth),
+		ack:  make(chan struct{}),
+	}
+
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+
+		for b := range a.ch {
+			if b == nil {
+				a.ack <- struct{}{}
+				continue
+			}
+
+			if a.error() == nil {
+				if _, err := a.w.Write(b); err != nil {
+					a.mu.Lock()
+					a.err = err
+					a.mu.Unlock()
+				}
+			}
+
+			select {
+			case a.free <- b[:0]:
+			default:
+			}
+		}
+	}()
+
+	return a
+}
+
+func (a *asyncWriter) error() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.err
+}
+
+// Write buffers p, and sends it to the writing goroutine when the buffer is full.
+func (a *asyncWriter) Write(p []byte) (int, error) {
+	if err := a.error(); err != nil {
+		return 0, err
+	}
+
+	n := len(p)
+	for len(p) > 0 {
+		if a.buf == nil {
+			select {
+			case a.buf = <-a.free:
+			default:
+				a.buf = make([]byte, 0, asyncWriteSize)
+			}
+		}
+
+		l := asyncWriteSize - len(a.buf)
+		if l > len(p) {
+			l = len(p)
+		}
+		a.buf = append(a.buf, p[:l]...)
+		p = p[l:]
+
+		if len(a.buf) == asyncWriteSize {
+			a.ch <- a.buf
+			a.buf = nil
+		}
+	}
+	return n, nil
+}
+
+// Flush waits until all data written so far is written into the underlying writer.
+func (a *asyncWriter) Flush() error {
+	if len(a.buf) > 0 {
+		a.ch <- a.buf
+		a.buf = nil
+	}
+	a.ch <- nil
+	<-a.ack
+	return a.error()
+}
+
+// Close flushes the data, and stops the writing goroutine.
+// The underlying writer is not closed.
+func (a *asyncWriter) Close() error {
+	err := a.Flush()
+	close(a.ch)
+	a.wg.Wait()
+	return err
+}
+
+// countWriter is an io.Writer that counts the bytes written into w.
+// The count can be read while writing in another goroutine.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	atomic.AddInt64(&c.n, int64(n))
+	return n, err
+}
+
+// Count returns the number of bytes written so far.
+func (c *countWriter) Count() int64 {
+	return atomic.LoadInt64(&c.n)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestReadAhead(t *testing.T) {
+	var records [][]string
+	for i := 0; i < readAheadBatch*3+10; i++ {
+		records = append(records, []string{fmt.Sprint(i)})
+	}
+
+	src, stop := readAhead(SliceSource(records))
+	defer stop()
+
+	for i, want := range records {
+		got, err := src.Next()
+		if err != nil {
+			t.Fatalf("failed to read record %d: %s", i, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("record %d: expected %q but got %q", i, want, got)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := src.Next(); err != io.EOF {
+			t.Errorf("expected io.EOF but got %v", err)
+		}
+	}
+}
+
+func TestReadAhead_stop(t *testing.T) {
+	var records [][]string
+	for i := 0; i < readAheadBatch*(readAheadDepth+4); i++ {
+		records = append(records, []string{fmt.Sprint(i)})
+	}
+
+	// Stopping in the middle does not block, even if the reading goroutine is waiting to send.
+	src, stop := readAhead(SliceSource(records))
+	if _, err := src.Next(); err != nil {
+		t.Fatalf("failed to read: %s", err)
+	}
+	stop()
+}
+
+// failingWriter is an io.Writer that always fails.
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestAsyncWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := newAsyncWriter(&buf)
+
+	data := bytes.Repeat([]byte("0123456789"), asyncWriteSize/10*3)
+	for i := 0; i < len(data); i += 1000 {
+		end := i + 1000
+		if end > len(data) {
+			end = len(data)
+		}
+		if _, err := w.Write(data[i:end]); err != nil {
+			t.Fatalf("failed to write: %s", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("failed to flush: %s", err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("expected %d bytes but got %d bytes", len(data), buf.Len())
+	}
+
+	if _, err := w.Write([]byte("tail")); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+	if !bytes.HasSuffix(buf.Bytes(), []byte("tail")) {
+		t.Errorf("expected the data written before close")
+	}
+}
+
+func TestAsyncWriter_error(t *testing.T) {
+	w := newAsyncWriter(failingWriter{})
+	if _, err := w.Write([]byte("hello")); err != nil {
+		t.Fatalf("expected the error is reported later but got %s", err)
+	}
+	if err := w.Flush(); err == nil {
+		t.Errorf("expected error by flush but got nil")
+	}
+	if _, err := w.Write([]byte("world")); err == nil {
+		t.Errorf("expected error by write after failed but got nil")
+	}
+	if err := w.Close(); err == nil {
+		t.Errorf("expected error by close but got nil")
+	}
+}
+
+// reusingSource is a RecordSource that reuses the record like csv.Reader with ReuseRecord.
+type reusingSource struct {
+	rec []string
+	n   int
+	max int
+}
+
+func (s *reusingSource) Next() ([]string, error) {
+	if s.n >= s.max {
+		return nil, io.EOF
+	}
+	s.rec[0] = fmt.Sprint(s.n)
+	s.n++
+	return s.rec, nil
+}
+
+func TestReadAhead_reusedRecord(t *testing.T) {
+	src, stop := readAhead(&reusingSource{rec: make([]string, 2), max: readAheadBatch + 10})
+	defer stop()
+
+	var got [][]string
+	for {
+		rec, err := src.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("failed to read: %s", err)
+		}
+		got = append(got, rec)
+	}
+
+	if len(got) != readAheadBatch+10 {
+		t.Fatalf("expected %d records but got %d", readAheadBatch+10, len(got))
+	}
+	for i, rec := range got {
+		if rec[0] != fmt.Sprint(i) {
+			t.Fatalf("record %d: expected %q but got %q", i, fmt.Sprint(i), rec[0])
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	rpprof "runtime/pprof"
+	"runtime/trace"
+)
+
+var (
+	// cpuProfile is the file of -cpuprofile while profiling.
+	cpuProfile *os.File
+
+	// traceOutput is the file of -trace while tracing.
+	traceOutput *os.File
+)
+
+// StartProfiling starts writing -cpuprofile and -trace, and serving -pprof.
+//
+// WARNING: this function reads commandline flags directly.
+// WARNING: this method can stop program with log.Fatal.
+func StartProfiling() {
+	var err error
+	if *cpuProfilePath != "" {
+		cpuProfile, err = os.Create(*cpuProfilePath)
+		if err != nil {
+			fatalf(ExitOutputError, "failed to create CPU profile: %s", err)
+		}
+		if err := rpprof.StartCPUProfile(cpuProfile); err != nil {
+			fatalf(ExitError, "failed to start CPU profile: %s", err)
+		}
+	}
+
+	if *tracePath != "" {
+		traceOutput, err = os.Create(*tracePath)
+		if err != nil {
+			fatalf(ExitOutputError, "failed to create trace: %s", err)
+		}
+		if err := trace.Start(traceOutput); err != nil {
+			fatalf(ExitError, "failed to start trace: %s", err)
+		}
+	}
+
+	if *pprofListen != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+		logger.With("addr", *pprofListen).Infof("serve pprof on %s", *pprofListen)
+		go func() {
+			// The chopping goes on even if failed to serve, because profiling is not the main work.
+			err := http.ListenAndServe(*pprofListen, mux)
+			logger.With("addr", *pprofListen, "error", err).Errorf("failed to serve pprof: %s", err)
+		}()
+	}
+}
+
+// StopProfiling finishes writing -cpuprofile and -trace, and writes -memprofile.
+// The profiles are not written if the program stopped by an error.
+//
+// WARNING: this function reads commandline flags directly.
+func StopProfiling() {
+	if cpuProfile != nil {
+		rpprof.StopCPUProfile()
+		if err := cpuProfile.Close(); err != nil {
+			logger.With("error", err).Errorf("failed to write CPU profile: %s", err)
+		}
+		cpuProfile = nil
+	}
+
+	if traceOutput != nil {
+		trace.Stop()
+		if err := traceOutput.Close(); err != nil {
+			logger.With("error", err).Errorf("failed to write trace: %s", err)
+		}
+		traceOutput = nil
+	}
+
+	if *memProfilePath != "" {
+		if err := writeMemProfile(*memProfilePath); err != nil {
+			logger.With("error", err).Errorf("failed to write memory profile: %s", err)
+		}
+	}
+}
+
+// writeMemProfile writes the heap profile into the file.
+func writeMemProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	// Run GC to get up-to-date statistics.
+	runtime.GC()
+
+	if err := rpprof.WriteHeapProfile(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
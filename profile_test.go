@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProfiling(t *testing.T) {
+	dir := t.TempDir()
+	paths := map[*string]string{
+		cpuProfilePath: filepath.Join(dir, "cpu.prof"),
+		memProfilePath: filepath.Join(dir, "mem.prof"),
+		tracePath:      filepath.Join(dir, "trace.out"),
+	}
+	for flag, path := range paths {
+		orig := *flag
+		*flag = path
+		defer func(flag *string) { *flag = orig }(flag)
+	}
+
+	StartProfiling()
+	StopProfiling()
+
+	for _, path := range paths {
+		if s, err := os.Stat(path); err != nil {
+			t.Errorf("failed to stat %s: %s", path, err)
+		} else if s.Size() == 0 {
+			t.Errorf("expected %s is not empty", path)
+		}
+	}
+
+	if cpuProfile != nil || traceOutput != nil {
+		t.Errorf("expected profiling is stopped")
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"sync"
+)
+
+// RejectWriter writes the rows that rejected by -schema into the CSV file of -reject-file, with the reason and the location.
+// It is safe to use from multiple goroutines of -jobs. All methods do nothing if the RejectWriter is nil.
+type RejectWriter struct {
+	mu sync.Mutex
+	f  *os.File
+	w  *CSVWriter
+}
+
+// rejects is the RejectWriter of -reject-file, or nil if disabled.
+var rejects *RejectWriter
+
+// CreateRejectWriter creates the reject file.
+// Each row of the file is the reason, the input file, the line number, and the values of the rejected row.
+func CreateRejectWriter(path string) (*RejectWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := NewCSVWriter(f)
+	w.Write([]string{"reason", "input", "line"})
+	return &RejectWriter{f: f, w: w}, nil
+}
+
+// Write writes a rejected row.
+// The row is flushed immediately, so that the file can be read while -follow or -watch mode.
+func (r *RejectWriter) Write(reason, inputPath string, line int, row []string) error {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.w.Write(append([]string{reason, inputPath, strconv.Itoa(line)}, row...)); err != nil {
+		return err
+	}
+	r.w.Flush()
+	return r.w.Error()
+}
+
+// Close flushes and closes the reject file.
+func (r *RejectWriter) Close() error {
+	if r == nil {
+		return nil
+	}
+
+	r.w.Flush()
+	err := r.w.Error()
+	if e := r.f.Close(); err == nil {
+		err = e
+	}
+	return err
+}
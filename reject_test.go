@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRejectWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rejects.csv")
+	r, err := CreateRejectWriter(path)
+	if err != nil {
+		t.Fatalf("failed to create: %s", err)
+	}
+	if err := r.Write("column count is required", "input.csv", 3, []string{"20230401", ""}); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open: %s", err)
+	}
+	defer f.Close()
+	c := csv.NewReader(f)
+	c.FieldsPerRecord = -1
+	got, err := c.ReadAll()
+	if err != nil {
+		t.Fatalf("failed to read: %s", err)
+	}
+	want := [][]string{
+		{"reason", "input", "line"},
+		{"column count is required", "input.csv", "3", "20230401", ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+}
+
+func TestRejectWriter_nil(t *testing.T) {
+	var r *RejectWriter
+	if err := r.Write("reason", "input.csv", 1, nil); err != nil {
+		t.Errorf("expected nil but got %s", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Errorf("expected nil but got %s", err)
+	}
+}
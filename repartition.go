@@ -0,0 +1,183 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// readRepartitionRows reads all rows in a partition file, and sorts them by timestamp.
+// Unlike readSortedRows, the rows that have invalid timestamp are an error, so that no row is lost while repartitioning.
+func readRepartitionRows(path string) ([]timedRow, error) {
+	r, err := OpenPartition(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var rows []timedRow
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		t, err := ParseTimestamp(row[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid timestamp: %s: %w", path, row[0], err)
+		}
+		rows = append(rows, timedRow{t, row})
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].Time.Before(rows[j].Time)
+	})
+
+	return rows, nil
+}
+
+// repartitionName returns the output file name for the partition file in -format.
+func repartitionName(path string) string {
+	name := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(path), ".csv.bz2"), ".csv.zst")
+	switch *outputFormat {
+	case "parquet":
+		return name + ".parquet"
+	case "sqlite":
+		return name + ".sqlite"
+	}
+	return name + csvExtension()
+}
+
+// Repartition reads all partitions in the directory from that made in the layout, and writes the rows into -out-dir in the layout of -granularity.
+// The file names are kept, so the rows from the same input file are written into the same file in each new partition.
+//
+// WARNING: this function reads commandline flags directly.
+func Repartition(from, layout string) error {
+	ps, err := ListPartitionsWithLayout(from, layout)
+	if err != nil {
+		return err
+	}
+
+	writers := make(map[string]*PartitionWriter)
+	var rows int64
+	for _, p := range ps {
+		for _, path := range p.Files {
+			name := repartitionName(path)
+			w, ok := writers[name]
+			if !ok {
+				w = NewPartitionWriter(name)
+				writers[name] = w
+			}
+
+			rs, err := readRepartitionRows(path)
+			if err != nil {
+				return err
+			}
+			for _, r := range rs {
+				if err := w.Write(r.Time, r.Row); err != nil {
+					return err
+				}
+			}
+			rows += int64(len(rs))
+
+			// Close for each file, to avoid opening too many files at once.
+			// The next rows into the same file are appended.
+			if err := w.Close(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := CompleteUploads(); err != nil {
+		return err
+	}
+
+	n := len(WrittenPartitions())
+	logger.With("rows", rows, "from_partitions", len(ps), "partitions", n).Infof("repartition %d rows in %d partitions into %d partitions", rows, len(ps), n)
+	return nil
+}
+
+// runRepartition runs repartition subcommand.
+func runRepartition(args []string) {
+	fs := flag.NewFlagSet("repartition", flag.ExitOnError)
+	from := fs.String("from", "", "The output directory of chop-csv to read.")
+	fromGranularity := fs.String("from-granularity", "", "The unit of partitions in -from directory: year, month, day, or hour. In default, detected from the directory names.")
+	gran := fs.String("granularity", *granularity, "The unit of partitions in NEWDIR: year, month, day, or hour.")
+	fs.Usage = func() {
+		fmt.Println("Usage: chop-csv repartition [OPTIONS] [REPARTITION OPTIONS] -from OUTDIR NEWDIR")
+		fmt.Println()
+		fmt.Println("Read the partitions in OUTDIR, and write them into NEWDIR in another granularity, without the original input files.")
+		fmt.Println("The timestamps are parsed with -date-format and -timezone, so specify the same options as when chopped.")
+		fmt.Println()
+		fmt.Println("REPARTITION OPTIONS:")
+		printCommandDefaults(fs)
+	}
+	parseCommand(fs, args)
+
+	if fs.NArg() != 1 || *from == "" {
+		fs.Usage()
+		os.Exit(ExitUsage)
+	}
+
+	var layout string
+	if *fromGranularity != "" {
+		var ok bool
+		layout, ok = partitionLayouts()[*fromGranularity]
+		if !ok {
+			fatalf(ExitUsage, "invalid -from-granularity: unknown granularity: %s", *fromGranularity)
+		}
+	} else {
+		var err error
+		layout, err = DetectPartitionLayout(*from)
+		if err != nil {
+			fatalf(ExitInputError, "failed to detect the granularity of -from: %s", err)
+		}
+	}
+
+	if err := SetGranularity(*gran); err != nil {
+		fatalf(ExitUsage, "invalid -granularity: %s", err)
+	}
+
+	if isRemoteURL(fs.Arg(0)) {
+		fatalf(ExitUsage, "repartition does not support remote output: %s", fs.Arg(0))
+	}
+	if a, err := filepath.Abs(*from); err == nil {
+		if b, err := filepath.Abs(fs.Arg(0)); err == nil && a == b {
+			fatalf(ExitUsage, "NEWDIR must be different from -from")
+		}
+	}
+	*outputDir = fs.Arg(0)
+
+	if !*noLock {
+		l, err := LockOutputDir(*outputDir, *waitLock)
+		if err != nil {
+			fatalf(ExitError, "failed to lock output directory: %s", err)
+		}
+		outputLocks = append(outputLocks, l)
+	}
+
+	if *zstdDict {
+		// The dictionary of NEWDIR is used if exists, otherwise the one of -from is copied.
+		d, err := ReadZstdDict(*outputDir)
+		if os.IsNotExist(err) {
+			d, err = ReadZstdDict(*from)
+		}
+		if err != nil {
+			fatalf(ExitInputError, "failed to read dictionary of -zstd-dict: %s", err)
+		}
+		zstdDictionary = d
+		if err := WriteZstdDict(); err != nil {
+			fatalf(ExitOutputError, "failed to write dictionary of -zstd-dict: %s", err)
+		}
+	}
+
+	if err := Repartition(*from, layout); err != nil {
+		fatalf(ExitError, "failed to repartition: %s", err)
+	}
+}
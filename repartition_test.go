@@ -0,0 +1,60 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRepartition(t *testing.T) {
+	origFormats, origLayout := dateFormats, partitionLayout
+	dateFormats = stringList{"2006-01-02 15:04"}
+	defer func() { dateFormats, partitionLayout = origFormats, origLayout }()
+
+	from := t.TempDir()
+	day1 := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+	day2 := time.Date(2023, 4, 2, 0, 0, 0, 0, time.UTC)
+	writePartitionFile(t, from, day2, "a.csv.bz2", [][]string{
+		{"2023-04-02 10:00", "a3"},
+	})
+	writePartitionFile(t, from, day1, "a.csv.bz2", [][]string{
+		{"2023-04-01 12:00", "a2"},
+		{"2023-04-01 09:00", "a1"},
+	})
+
+	dir := setOutputDir(t)
+	if err := SetGranularity("month"); err != nil {
+		t.Fatalf("failed to set granularity: %s", err)
+	}
+	if err := Repartition(from, partitionGranularities["day"]); err != nil {
+		t.Fatalf("failed to repartition: %s", err)
+	}
+
+	got := readBzip2CSV(t, filepath.Join(dir, "year=2023", "month=4", "a.csv.bz2"))
+	want := [][]string{
+		{"2023-04-01 09:00", "a1"},
+		{"2023-04-01 12:00", "a2"},
+		{"2023-04-02 10:00", "a3"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected output\nexpected: %q\n but got: %q", want, got)
+	}
+}
+
+func TestRepartition_invalidTimestamp(t *testing.T) {
+	origFormats := dateFormats
+	dateFormats = stringList{"2006-01-02 15:04"}
+	defer func() { dateFormats = origFormats }()
+
+	from := t.TempDir()
+	day := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+	writePartitionFile(t, from, day, "a.csv.bz2", [][]string{
+		{"invalid", "a1"},
+	})
+
+	setOutputDir(t)
+	if err := Repartition(from, partitionGranularities["day"]); err == nil {
+		t.Errorf("expected error for invalid timestamp but got nil")
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"sync/atomic"
+	"time"
+)
+
+// maxRetryBackoff is the maximum wait between retries of -retries.
+const maxRetryBackoff = time.Minute
+
+// retriedOutputs is the number of retries of the output operations, that not added into summary yet.
+// It is counted atomically instead of summary, because the retries can happen while chopMu is locked.
+var retriedOutputs int64
+
+// isPermanentError reports whether err is an error that never fixed by retrying, like permission denied or no space.
+func isPermanentError(err error) bool {
+	for _, e := range append([]error{fs.ErrNotExist, fs.ErrExist, fs.ErrPermission}, permanentErrnos...) {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryOutput calls fn, and calls it again with exponential backoff if failed, up to -retries times.
+// op and name are used to log the retries, like "write" and the path of the file.
+// fn must be safe to call again after failed.
+//
+// WARNING: this function reads commandline flags directly.
+func retryOutput(op, name string, fn func() error) error {
+	backoff := *retryBackoff
+	for i := 1; ; i++ {
+		err := fn()
+		if err == nil || i > *outputRetries || isPermanentError(err) {
+			return err
+		}
+
+		atomic.AddInt64(&retriedOutputs, 1)
+		logger.With("file", name, "error", err, "retry", i).Warnf("failed to %s %s, so retry in %s: %s", op, name, backoff, err)
+		time.Sleep(backoff)
+
+		if backoff *= 2; backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
+
+// addRetries adds the retries counted so far into summary.
+func addRetries() {
+	chopMu.Lock()
+	defer chopMu.Unlock()
+	summary.OutputRetries += int(atomic.SwapInt64(&retriedOutputs, 0))
+}
@@ -0,0 +1,9 @@
+package main
+
+import (
+	"syscall"
+)
+
+// permanentErrnos are the errors of the system calls that never fixed by retrying.
+// Plan 9 reports the errors by strings, so only the ones that defined by syscall are here.
+var permanentErrnos = []error{syscall.ENOTDIR, syscall.EISDIR}
@@ -0,0 +1,11 @@
+//go:build !plan9
+// +build !plan9
+
+package main
+
+import (
+	"syscall"
+)
+
+// permanentErrnos are the errors of the system calls that never fixed by retrying.
+var permanentErrnos = []error{syscall.ENOSPC, syscall.ENOTDIR, syscall.EISDIR, syscall.EROFS}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryOutput(t *testing.T) {
+	origRetries, origBackoff := *outputRetries, *retryBackoff
+	*outputRetries, *retryBackoff = 2, time.Millisecond
+	defer func() { *outputRetries, *retryBackoff = origRetries, origBackoff }()
+
+	temporary := errors.New("temporary error")
+	permanent := fmt.Errorf("failed to write: %w", fs.ErrPermission)
+
+	tests := []struct {
+		Name    string
+		Fails   []error
+		Calls   int
+		Retries int64
+		Error   error
+	}{
+		{"success", nil, 1, 0, nil},
+		{"recovered", []error{temporary, temporary}, 3, 2, nil},
+		{"too many", []error{temporary, temporary, temporary}, 3, 2, temporary},
+		{"permanent", []error{permanent}, 1, 0, permanent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			atomic.StoreInt64(&retriedOutputs, 0)
+			defer atomic.StoreInt64(&retriedOutputs, 0)
+
+			calls := 0
+			err := retryOutput("write", "test", func() error {
+				calls++
+				if calls <= len(tt.Fails) {
+					return tt.Fails[calls-1]
+				}
+				return nil
+			})
+
+			if err != tt.Error {
+				t.Errorf("expected error %v but got %v", tt.Error, err)
+			}
+			if calls != tt.Calls {
+				t.Errorf("expected %d calls but got %d", tt.Calls, calls)
+			}
+			if r := atomic.LoadInt64(&retriedOutputs); r != tt.Retries {
+				t.Errorf("expected %d retries but got %d", tt.Retries, r)
+			}
+		})
+	}
+}
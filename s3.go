@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// s3Sink is the Sink for URLs like s3://bucket/key.
+type s3Sink struct {
+	cfg AWSConfig
+}
+
+func (s *s3Sink) Setup() error {
+	cfg, err := LoadAWSConfig()
+	if err != nil {
+		return err
+	}
+	s.cfg = cfg
+	return nil
+}
+
+func (s *s3Sink) Create(u string) (RemoteObject, error) {
+	bucket, key, err := parseBucketURL(u)
+	if err != nil {
+		return nil, err
+	}
+	api := s3API{func(method string, query url.Values, body []byte) (*http.Response, []byte, error) {
+		return s.cfg.s3Request(method, bucket, key, query, body)
+	}}
+	return newMultipartObject(api, u), nil
+}
+
+// parseBucketURL splits URL like s3://bucket/key into the bucket and the key.
+func parseBucketURL(u string) (bucket, key string, err error) {
+	i := strings.Index(u, "://")
+	if i < 0 {
+		return "", "", fmt.Errorf("invalid URL: %s", u)
+	}
+	s := u[i+3:]
+	i = strings.Index(s, "/")
+	if i <= 0 {
+		return "", "", fmt.Errorf("invalid URL: %s", u)
+	}
+	return s[:i], s[i+1:], nil
+}
+
+// escapeKey escapes the object key for URL path, keeping slashes.
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, s := range segments {
+		segments[i] = awsEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// s3Request calls an API of S3.
+func (c AWSConfig) s3Request(method, bucket, key string, query url.Values, body []byte) (*http.Response, []byte, error) {
+	req, err := c.newS3Request(method, bucket, key, query, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return doXMLRequest(req, "s3://"+bucket+"/"+key)
+}
+
+// newS3Request makes a signed request to call an API of S3.
+func (c AWSConfig) newS3Request(method, bucket, key string, query url.Values, body []byte) (*http.Request, error) {
+	var u string
+	if c.Endpoint != "" {
+		u = fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(c.Endpoint, "/"), bucket, escapeKey(key))
+	} else {
+		u = fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, c.Region, escapeKey(key))
+	}
+	if len(query) > 0 {
+		u += "?" + canonicalQuery(query)
+	}
+
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	// The request must be signed with the real time even if -now is set.
+	c.Sign(req, "s3", body, SystemClock.Now())
+	return req, nil
+}
+
+// s3ObjectInfo is an object in the result of ListS3Objects.
+type s3ObjectInfo struct {
+	Key          string
+	LastModified time.Time
+}
+
+// ListS3Objects lists the objects that have the prefix.
+func (c AWSConfig) ListS3Objects(bucket, prefix string) ([]s3ObjectInfo, error) {
+	var objs []s3ObjectInfo
+	token := ""
+	for {
+		q := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		_, b, err := c.s3Request("GET", bucket, "", q, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var r struct {
+			Contents              []s3ObjectInfo
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		if err := xml.Unmarshal(b, &r); err != nil {
+			return nil, err
+		}
+		objs = append(objs, r.Contents...)
+
+		if !r.IsTruncated || r.NextContinuationToken == "" {
+			return objs, nil
+		}
+		token = r.NextContinuationToken
+	}
+}
+
+// doXMLRequest sends req to an API that responds errors in XML, like S3.
+func doXMLRequest(req *http.Request, name string) (*http.Response, []byte, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if resp.StatusCode >= 300 || bytes.Contains(b, []byte("<Error>")) {
+		return nil, nil, xmlError(name, resp.Status, b)
+	}
+	return resp, b, nil
+}
+
+// xmlError makes an error from the error response of an API like S3.
+func xmlError(name, status string, body []byte) error {
+	var e struct {
+		Code    string
+		Message string
+	}
+	xml.Unmarshal(body, &e)
+	if e.Code == "" {
+		return fmt.Errorf("%s: %s", name, status)
+	}
+	return fmt.Errorf("%s: %s: %s", name, e.Code, e.Message)
+}
+
+// s3API is the multipart upload API of S3. The XML API of GCS is compatible with this.
+type s3API struct {
+	request func(method string, query url.Values, body []byte) (*http.Response, []byte, error)
+}
+
+func (a s3API) Put(data []byte) error {
+	_, _, err := a.request("PUT", nil, data)
+	return err
+}
+
+func (a s3API) Begin() (string, error) {
+	_, b, err := a.request("POST", url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return "", err
+	}
+	var r struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.Unmarshal(b, &r); err != nil {
+		return "", err
+	}
+	return r.UploadID, nil
+}
+
+func (a s3API) UploadPart(uploadID string, n int, data []byte) (string, error) {
+	q := url.Values{"partNumber": {strconv.Itoa(n)}, "uploadId": {uploadID}}
+	resp, _, err := a.request("PUT", q, data)
+	if err != nil {
+		return "", err
+	}
+	return resp.Header.Get("ETag"), nil
+}
+
+func (a s3API) Complete(uploadID string, parts []string) error {
+	var b bytes.Buffer
+	b.WriteString("<CompleteMultipartUpload>")
+	for i, etag := range parts {
+		fmt.Fprintf(&b, "<Part><PartNumber>%d</PartNumber><ETag>%s</ETag></Part>", i+1, xmlEscape(etag))
+	}
+	b.WriteString("</CompleteMultipartUpload>")
+
+	_, _, err := a.request("POST", url.Values{"uploadId": {uploadID}}, b.Bytes())
+	return err
+}
+
+func (a s3API) Abort(uploadID string) {
+	a.request("DELETE", url.Values{"uploadId": {uploadID}}, nil)
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseBucketURL(t *testing.T) {
+	for _, u := range []string{"s3://bucket/path/to/file.csv.bz2", "gs://bucket/path/to/file.csv.bz2", "az://bucket/path/to/file.csv.bz2"} {
+		bucket, key, err := parseBucketURL(u)
+		if err != nil {
+			t.Fatalf("failed to parse %s: %s", u, err)
+		}
+		if bucket != "bucket" || key != "path/to/file.csv.bz2" {
+			t.Errorf("%s: expected bucket and path/to/file.csv.bz2 but got %s and %s", u, bucket, key)
+		}
+	}
+
+	if _, _, err := parseBucketURL("s3://bucket"); err == nil {
+		t.Errorf("expected error for URL without key")
+	}
+}
+
+func TestOutputPath(t *testing.T) {
+	if got, want := outputPath("s3://bucket/out/", PartitionDir(time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)), "a.csv.bz2"), "s3://bucket/out/year=2023/month=4/day=1/a.csv.bz2"; got != want {
+		t.Errorf("expected %s but got %s", want, got)
+	}
+}
+
+// fakeS3Request is a request that received by fakeS3.
+type fakeS3Request struct {
+	Method string
+	Query  string
+	Body   []byte
+}
+
+// fakeS3 starts a fake S3 server, and returns the Sink for it and the received requests.
+func fakeS3(t *testing.T) (*s3Sink, *[]fakeS3Request) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var reqs []fakeS3Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		mu.Lock()
+		reqs = append(reqs, fakeS3Request{Method: r.Method, Query: r.URL.RawQuery, Body: body})
+		mu.Unlock()
+
+		switch {
+		case r.Method == "POST" && r.URL.RawQuery == "uploads=":
+			io.WriteString(w, "<InitiateMultipartUploadResult><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>")
+		case r.Method == "PUT" && r.URL.Query().Get("partNumber") != "":
+			w.Header().Set("ETag", `"etag-`+r.URL.Query().Get("partNumber")+`"`)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	orig := uploadSlots
+	uploadSlots = make(chan struct{}, 2)
+	t.Cleanup(func() { uploadSlots = orig })
+
+	cfg := AWSConfig{AccessKeyID: "id", SecretAccessKey: "secret", Region: "us-east-1", Endpoint: srv.URL}
+	return &s3Sink{cfg: cfg}, &reqs
+}
+
+func TestS3Sink(t *testing.T) {
+	tests := []struct {
+		Name    string
+		Size    int
+		Methods []string
+	}{
+		{"small", 10, []string{"PUT"}},
+		{"multipart", uploadPartSize + 10, []string{"POST", "PUT", "PUT", "POST"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			sink, reqs := fakeS3(t)
+
+			o, err := sink.Create("s3://bucket/a.csv.bz2")
+			if err != nil {
+				t.Fatalf("failed to make object: %s", err)
+			}
+			data := bytes.Repeat([]byte("x"), tt.Size)
+			if _, err := o.Write(data); err != nil {
+				t.Fatalf("failed to write: %s", err)
+			}
+			if err := o.Close(); err != nil {
+				t.Fatalf("failed to close: %s", err)
+			}
+			if err := o.Complete(); err != nil {
+				t.Fatalf("failed to complete: %s", err)
+			}
+
+			if len(*reqs) != len(tt.Methods) {
+				t.Fatalf("expected %d requests but got %d: %v", len(tt.Methods), len(*reqs), *reqs)
+			}
+			var uploaded int
+			for i, r := range *reqs {
+				if r.Method != tt.Methods[i] {
+					t.Errorf("request %d: expected %s but got %s", i, tt.Methods[i], r.Method)
+				}
+				if r.Method == "PUT" {
+					uploaded += len(r.Body)
+				}
+			}
+			if uploaded != tt.Size {
+				t.Errorf("expected %d bytes uploaded but got %d bytes", tt.Size, uploaded)
+			}
+
+			if len(tt.Methods) > 1 {
+				last := (*reqs)[len(*reqs)-1]
+				if last.Query != "uploadId=upload-1" || !strings.Contains(string(last.Body), `<PartNumber>2</PartNumber><ETag>&#34;etag-2&#34;</ETag>`) {
+					t.Errorf("unexpected complete request: %s %s", last.Query, last.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestAWSConfig_ListS3Objects(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bucket/" || r.URL.Query().Get("prefix") != "in/" {
+			t.Errorf("unexpected request: %s", r.URL)
+		}
+		if r.URL.Query().Get("continuation-token") == "" {
+			io.WriteString(w, "<ListBucketResult><Contents><Key>in/a.csv</Key><LastModified>2023-04-01T12:00:00.000Z</LastModified></Contents><Contents><Key>in/b.txt</Key><LastModified>2023-04-02T12:00:00.000Z</LastModified></Contents><IsTruncated>true</IsTruncated><NextContinuationToken>next</NextContinuationToken></ListBucketResult>")
+		} else {
+			io.WriteString(w, "<ListBucketResult><Contents><Key>in/c.csv</Key><LastModified>2023-04-03T12:00:00.000Z</LastModified></Contents><IsTruncated>false</IsTruncated></ListBucketResult>")
+		}
+	}))
+	defer srv.Close()
+
+	cfg := AWSConfig{AccessKeyID: "id", SecretAccessKey: "secret", Region: "us-east-1", Endpoint: srv.URL}
+	objs, err := cfg.ListS3Objects("bucket", "in/")
+	if err != nil {
+		t.Fatalf("failed to list: %s", err)
+	}
+	want := []s3ObjectInfo{
+		{"in/a.csv", time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)},
+		{"in/b.txt", time.Date(2023, 4, 2, 12, 0, 0, 0, time.UTC)},
+		{"in/c.csv", time.Date(2023, 4, 3, 12, 0, 0, 0, time.UTC)},
+	}
+	if !reflect.DeepEqual(objs, want) {
+		t.Errorf("expected %v but got %v", want, objs)
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// sampleFile is a file in the partition to sample rows.
+type sampleFile struct {
+	path  string
+	rows  int64
+	index []IndexEntry // nil if the file has no seek index
+}
+
+// countSampleFile counts the rows in the file.
+// The seek index is used if exists, so that the file is not decompressed.
+func countSampleFile(path string) (sampleFile, error) {
+	f := sampleFile{path: path}
+
+	if index, err := ReadIndex(path + ".idx"); err == nil && len(index) > 0 {
+		f.index = index
+		f.rows = index[len(index)-1].Row
+		return f, nil
+	}
+
+	r, err := OpenPartition(path)
+	if err != nil {
+		return f, err
+	}
+	defer r.Close()
+	for {
+		if _, err := r.Read(); err == io.EOF {
+			return f, nil
+		} else if err != nil {
+			return f, fmt.Errorf("%s: %w", path, err)
+		}
+		f.rows++
+	}
+}
+
+// sameStream reports whether the rows a and b are in the same bzip2 stream.
+// It always returns true if the file has no seek index.
+func (f sampleFile) sameStream(a, b int64) bool {
+	for _, e := range f.index {
+		if a < e.Row && e.Row <= b {
+			return false
+		}
+	}
+	return true
+}
+
+// read reads the rows at the positions in picks, that should be sorted.
+// Only the streams that include the picked rows are decompressed.
+func (f sampleFile) read(picks []int64, fn func([]string) error) error {
+	var r *PartitionReader
+	var pos int64
+	defer func() {
+		if r != nil {
+			r.Close()
+		}
+	}()
+
+	for _, p := range picks {
+		if r == nil || !f.sameStream(pos, p) {
+			if r != nil {
+				r.Close()
+			}
+			var err error
+			r, err = OpenPartitionAt(f.path, p)
+			if err != nil {
+				return err
+			}
+			pos = p
+		}
+
+		for ; pos < p; pos++ {
+			if _, err := r.Read(); err != nil {
+				return fmt.Errorf("%s: %w", f.path, err)
+			}
+		}
+		row, err := r.Read()
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.path, err)
+		}
+		pos++
+
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pickRows picks n distinct numbers from [0, total) at random, in sorted order.
+func pickRows(rnd *rand.Rand, total, n int64) []int64 {
+	if total <= n {
+		picks := make([]int64, total)
+		for i := range picks {
+			picks[i] = int64(i)
+		}
+		return picks
+	}
+
+	// Floyd's algorithm.
+	picked := make(map[int64]bool, n)
+	for j := total - n; j < total; j++ {
+		x := rnd.Int63n(j + 1)
+		if picked[x] {
+			x = j
+		}
+		picked[x] = true
+	}
+
+	picks := make([]int64, 0, n)
+	for x := range picked {
+		picks = append(picks, x)
+	}
+	sort.Slice(picks, func(i, j int) bool {
+		return picks[i] < picks[j]
+	})
+	return picks
+}
+
+// Sample writes n rows at random from the files into w.
+// The rows are written in the order of the files and the rows in them.
+func Sample(paths []string, n int64, rnd *rand.Rand, w *CSVWriter) error {
+	files := make([]sampleFile, len(paths))
+	var total int64
+	for i, p := range paths {
+		f, err := countSampleFile(p)
+		if err != nil {
+			return err
+		}
+		files[i] = f
+		total += f.rows
+	}
+
+	picks := pickRows(rnd, total, n)
+
+	var base int64
+	for _, f := range files {
+		var local []int64
+		for len(picks) > 0 && picks[0] < base+f.rows {
+			local = append(local, picks[0]-base)
+			picks = picks[1:]
+		}
+		base += f.rows
+
+		if len(local) == 0 {
+			continue
+		}
+		if err := f.read(local, w.Write); err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+	return w.Error()
+}
+
+// runSample runs sample subcommand.
+func runSample(args []string) {
+	fs := flag.NewFlagSet("sample", flag.ExitOnError)
+	date := fs.String("date", "", "The date of the partition to sample, like 2023-01-04.")
+	n := fs.Int64("n", 20, "The number of rows to sample.")
+	seed := fs.Int64("seed", 0, "The seed of random numbers. 0 means a random seed.")
+	fs.Usage = func() {
+		fmt.Println("Usage: chop-csv sample [OPTIONS] [SAMPLE OPTIONS] OUTDIR")
+		fmt.Println()
+		fmt.Println("Print rows at random from a partition in OUTDIR, and write them to stdout.")
+		fmt.Println("Only the compressed streams that include the sampled rows are decompressed if the seek index exists.")
+		fmt.Println()
+		fmt.Println("SAMPLE OPTIONS:")
+		printCommandDefaults(fs)
+	}
+	parseCommand(fs, args)
+
+	if fs.NArg() != 1 || *date == "" || *n < 1 {
+		fs.Usage()
+		os.Exit(ExitUsage)
+	}
+
+	t, err := ParseTimeFlag(*date)
+	if err != nil {
+		fatalf(ExitUsage, "failed to parse -date: %s", err)
+	}
+
+	matches, err := filepath.Glob(filepath.Join(fs.Arg(0), PartitionDir(t), "*.csv.*"))
+	if err != nil {
+		fatalf(ExitInputError, "failed to find partition: %s", err)
+	}
+	var paths []string
+	for _, m := range matches {
+		if isCSVFile(m) {
+			paths = append(paths, m)
+		}
+	}
+	if len(paths) == 0 {
+		fatalf(ExitInputError, "no such partition: %s", filepath.Join(fs.Arg(0), PartitionDir(t)))
+	}
+
+	if *seed == 0 {
+		*seed = SystemClock.Now().UnixNano()
+	}
+	rnd := rand.New(rand.NewSource(*seed))
+
+	var out io.Writer = os.Stdout
+	var enc *transform.Writer
+	if outputEncoding != unicode.UTF8 {
+		enc = transform.NewWriter(out, outputEncoding.NewEncoder())
+		out = enc
+	}
+
+	if err := Sample(paths, *n, rnd, NewOutputCSVWriter(out)); err != nil {
+		fatalf(ExitInputError, "failed to sample: %s", err)
+	}
+	if enc != nil {
+		if err := enc.Close(); err != nil {
+			fatalf(ExitInputError, "failed to sample: %s", err)
+		}
+	}
+}
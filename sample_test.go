@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPickRows(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	if got, want := pickRows(rnd, 3, 5), []int64{0, 1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v but got %v", want, got)
+	}
+
+	for i := 0; i < 100; i++ {
+		picks := pickRows(rnd, 20, 5)
+		if len(picks) != 5 {
+			t.Fatalf("expected 5 picks but got %v", picks)
+		}
+		for j, p := range picks {
+			if p < 0 || p >= 20 {
+				t.Fatalf("out of range: %v", picks)
+			}
+			if j > 0 && picks[j-1] >= p {
+				t.Fatalf("expected sorted distinct picks but got %v", picks)
+			}
+		}
+	}
+}
+
+func TestSample(t *testing.T) {
+	day := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, interval := range []int{0, 3} {
+		t.Run(fmt.Sprintf("index-interval=%d", interval), func(t *testing.T) {
+			orig := *indexInterval
+			*indexInterval = interval
+			defer func() { *indexInterval = orig }()
+
+			dir := t.TempDir()
+			var all [][]string
+			var paths []string
+			for _, name := range []string{"a.csv.bz2", "b.csv.bz2"} {
+				var rows [][]string
+				for i := 0; i < 10; i++ {
+					rows = append(rows, []string{"20230401", fmt.Sprintf("%s-%d", name[:1], i)})
+				}
+				writePartitionFile(t, dir, day, name, rows)
+				all = append(all, rows...)
+				paths = append(paths, filepath.Join(dir, PartitionDir(day), name))
+			}
+
+			tests := []struct {
+				N    int64
+				Rows int
+			}{
+				{5, 5},
+				{30, 20},
+			}
+			for _, tt := range tests {
+				var buf bytes.Buffer
+				if err := Sample(paths, tt.N, rand.New(rand.NewSource(1)), NewCSVWriter(&buf)); err != nil {
+					t.Fatalf("failed to sample: %s", err)
+				}
+				got, err := csv.NewReader(&buf).ReadAll()
+				if err != nil {
+					t.Fatalf("failed to read: %s", err)
+				}
+				if len(got) != tt.Rows {
+					t.Fatalf("-n %d: expected %d rows but got %q", tt.N, tt.Rows, got)
+				}
+
+				// The sampled rows have to appear in the same order as the inputs.
+				pos := 0
+				for _, row := range got {
+					for pos < len(all) && !reflect.DeepEqual(all[pos], row) {
+						pos++
+					}
+					if pos == len(all) {
+						t.Fatalf("-n %d: unexpected row or order: %q", tt.N, got)
+					}
+					pos++
+				}
+			}
+		})
+	}
+}
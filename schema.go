@@ -0,0 +1,301 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The column types that inferred by SchemaInferrer.
+const (
+	schemaInt    = "int"
+	schemaFloat  = "float"
+	schemaDate   = "date"
+	schemaString = "string"
+)
+
+// schemaParquetTypes is the types of -parquet-schema for the inferred types.
+// Parquet output has no date type, so dates are written as strings in the same format as the input.
+var schemaParquetTypes = map[string]string{
+	schemaInt:    "int64",
+	schemaFloat:  "double",
+	schemaDate:   "string",
+	schemaString: "string",
+}
+
+// SchemaColumn is a column in the schema document of -emit-schema.
+type SchemaColumn struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"` // int, float, date, or string
+	Nullable    bool   `json:"nullable"`
+	ParquetType string `json:"parquet_type"`
+	HiveType    string `json:"hive_type"`
+}
+
+// Schema is the schema document of -emit-schema.
+type Schema struct {
+	Rows    int64          `json:"rows"`
+	Columns []SchemaColumn `json:"columns"`
+}
+
+// columnTypes is the types that all values in a column can be parsed as.
+type columnTypes struct {
+	notInt   bool
+	notFloat bool
+	notDate  bool
+	nulls    int64
+	values   int64
+}
+
+// SchemaInferrer infers the types and the nullability of the columns from the rows that written, for -emit-schema.
+// It is safe to use from multiple goroutines of -jobs. All methods do nothing if the SchemaInferrer is nil.
+type SchemaInferrer struct {
+	mu        sync.Mutex
+	names     []string // the names of the columns, from the header of the first file
+	timestamp int      // the index of the timestamp column, or -1 if projected out
+	columns   []*columnTypes
+	rows      int64
+}
+
+// schema is the SchemaInferrer of -emit-schema, or nil if disabled.
+var schema *SchemaInferrer
+
+// NewSchemaInferrer makes a new SchemaInferrer.
+func NewSchemaInferrer() *SchemaInferrer {
+	return &SchemaInferrer{timestamp: -1}
+}
+
+// isSchemaFloat reports whether s is a decimal number.
+// strconv.ParseFloat also accepts "NaN", "Inf", and hexadecimal numbers, but they are not supported by the most loaders.
+func isSchemaFloat(s string) bool {
+	if strings.ContainsAny(strings.ToLower(s), "inxp_") {
+		return false
+	}
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
+
+// Observe checks the types of the values in the row.
+// header is the column names of the output, or nil if no header.
+// timestamp is the index of the timestamp column in the row, that is always inferred as date.
+func (s *SchemaInferrer) Observe(header, row []string, timestamp int) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.rows == 0 {
+		s.names = append([]string(nil), header...)
+		s.timestamp = timestamp
+	}
+	s.rows++
+
+	for len(s.columns) < len(row) {
+		c := &columnTypes{}
+		// The rows before this column appeared did not have the value.
+		c.nulls = s.rows - 1
+		s.columns = append(s.columns, c)
+	}
+
+	for i, c := range s.columns {
+		if i >= len(row) || row[i] == "" {
+			c.nulls++
+			continue
+		}
+		c.values++
+		v := strings.TrimSpace(row[i])
+		if !c.notInt {
+			if _, err := strconv.ParseInt(v, 10, 64); err != nil {
+				c.notInt = true
+			}
+		}
+		if !c.notFloat && c.notInt {
+			c.notFloat = !isSchemaFloat(v)
+		}
+		if !c.notDate && i != s.timestamp {
+			if _, err := ParseTimestamp(row[i]); err != nil {
+				c.notDate = true
+			}
+		}
+	}
+}
+
+// Schema returns the inferred schema.
+// The type of each column is the narrowest one of int, float, date, and string that all values can be parsed as.
+// The column that has no value is string.
+func (s *SchemaInferrer) Schema() Schema {
+	if s == nil {
+		return Schema{}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sc := Schema{Rows: s.rows, Columns: make([]SchemaColumn, len(s.columns))}
+	for i, c := range s.columns {
+		name := fmt.Sprintf("col%d", i+1)
+		if i < len(s.names) {
+			name = s.names[i]
+		}
+
+		typ := schemaString
+		switch {
+		case c.values == 0:
+		case i == s.timestamp:
+			typ = schemaDate
+		case !c.notInt:
+			typ = schemaInt
+		case !c.notFloat:
+			typ = schemaFloat
+		case !c.notDate:
+			typ = schemaDate
+		}
+
+		sc.Columns[i] = SchemaColumn{
+			Name:        name,
+			Type:        typ,
+			Nullable:    c.nulls > 0,
+			ParquetType: schemaParquetTypes[typ],
+			HiveType:    hiveTypes[schemaParquetTypes[typ]],
+		}
+	}
+	return sc
+}
+
+// WriteSchema writes the inferred schema into path as JSON.
+func WriteSchema(path string, sc Schema) error {
+	b, err := json.MarshalIndent(sc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeOutput(path, append(b, '\n'))
+}
+
+// LoadSchema reads a schema document of -emit-schema.
+func LoadSchema(path string) (Schema, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Schema{}, err
+	}
+	var sc Schema
+	if err := json.Unmarshal(b, &sc); err != nil {
+		return Schema{}, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, c := range sc.Columns {
+		if _, ok := schemaParquetTypes[c.Type]; !ok {
+			return Schema{}, fmt.Errorf("%s: unsupported type of column %s: %s", path, c.Name, c.Type)
+		}
+	}
+	return sc, nil
+}
+
+// LoadParquetSchema reads a schema document of -emit-schema, and returns the column types for -parquet-schema.
+func LoadParquetSchema(path string) (map[string]string, error) {
+	sc, err := LoadSchema(path)
+	if err != nil {
+		return nil, err
+	}
+
+	types := make(map[string]string)
+	for _, c := range sc.Columns {
+		typ := c.ParquetType
+		if typ == "" {
+			typ = schemaParquetTypes[c.Type]
+		}
+		if _, ok := parquetPhysicalTypes[typ]; !ok {
+			return nil, fmt.Errorf("%s: unsupported type of column %s: %s", path, c.Name, c.Type)
+		}
+		types[c.Name] = typ
+	}
+	return types, nil
+}
+
+// SchemaValidator checks the rows against a schema document, for -schema.
+// All methods do nothing if the SchemaValidator is nil.
+type SchemaValidator struct {
+	columns []SchemaColumn
+}
+
+// schemaValidator is the SchemaValidator of -schema, or nil if disabled.
+var schemaValidator *SchemaValidator
+
+// NewSchemaValidator makes a new SchemaValidator for the schema.
+func NewSchemaValidator(sc Schema) *SchemaValidator {
+	return &SchemaValidator{columns: sc.Columns}
+}
+
+// Resolve finds the columns of the schema in the output columns.
+// The columns are found by name if header is not nil, otherwise by position.
+// The index is -1 if the column is not in the header, that is allowed only if the column is nullable.
+func (v *SchemaValidator) Resolve(header []string) ([]int, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	idx := make([]int, len(v.columns))
+	for i, c := range v.columns {
+		if header == nil {
+			idx[i] = i
+			continue
+		}
+
+		idx[i] = -1
+		for j, h := range header {
+			if h == c.Name {
+				idx[i] = j
+				break
+			}
+		}
+		if idx[i] < 0 && !c.Nullable {
+			return nil, fmt.Errorf("required column is missing: %s", c.Name)
+		}
+	}
+	return idx, nil
+}
+
+// Validate checks the types and the required values of the row.
+// idx is the indexes of the columns that returned by Resolve.
+// It returns an error that describes the first violation, or nil if the row is valid.
+func (v *SchemaValidator) Validate(row []string, idx []int) error {
+	if v == nil {
+		return nil
+	}
+
+	for i, c := range v.columns {
+		value := ""
+		if j := idx[i]; 0 <= j && j < len(row) {
+			value = row[j]
+		}
+
+		if value == "" {
+			if !c.Nullable {
+				return fmt.Errorf("column %s is required", c.Name)
+			}
+			continue
+		}
+
+		var ok bool
+		s := strings.TrimSpace(value)
+		switch c.Type {
+		case schemaInt:
+			_, err := strconv.ParseInt(s, 10, 64)
+			ok = err == nil
+		case schemaFloat:
+			ok = isSchemaFloat(s)
+		case schemaDate:
+			_, err := ParseTimestamp(value)
+			ok = err == nil
+		default:
+			ok = true
+		}
+		if !ok {
+			return fmt.Errorf("column %s is not %s: %s", c.Name, c.Type, value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSchemaInferrer(t *testing.T) {
+	orig := dateFormats
+	dateFormats = stringList{"2006-01-02"}
+	defer func() { dateFormats = orig }()
+
+	s := NewSchemaInferrer()
+	header := []string{"timestamp", "count", "price", "day", "name", "empty"}
+	for _, row := range [][]string{
+		{"2023-04-01", "1", "1.5", "2023-04-01", "a", ""},
+		{"2023-04-01", "2", "2", "2023-04-02", "b", ""},
+		{"2023-04-02", "", "NaN", "2023-04-03", "3", ""},
+		{"2023-04-02", "4", "3.25", "", "c", "", "extra"},
+	} {
+		s.Observe(header, row, 0)
+	}
+
+	want := Schema{
+		Rows: 4,
+		Columns: []SchemaColumn{
+			{"timestamp", "date", false, "string", "string"},
+			{"count", "int", true, "int64", "bigint"},
+			{"price", "string", false, "string", "string"},
+			{"day", "date", true, "string", "string"},
+			{"name", "string", false, "string", "string"},
+			{"empty", "string", true, "string", "string"},
+			{"col7", "string", true, "string", "string"},
+		},
+	}
+	if got := s.Schema(); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected schema\nexpected: %+v\n but got: %+v", want, got)
+	}
+}
+
+func TestSchemaInferrer_float(t *testing.T) {
+	s := NewSchemaInferrer()
+	for _, v := range []string{"1", "2.5", "-3e2"} {
+		s.Observe(nil, []string{"20230401", v}, 0)
+	}
+
+	if got := s.Schema().Columns[1]; got.Type != "float" || got.ParquetType != "double" {
+		t.Errorf("expected float but got %+v", got)
+	}
+}
+
+func TestSchemaInferrer_nil(t *testing.T) {
+	var s *SchemaInferrer
+	s.Observe(nil, []string{"20230401"}, 0)
+	if sc := s.Schema(); sc.Rows != 0 || len(sc.Columns) != 0 {
+		t.Errorf("expected empty schema but got %+v", sc)
+	}
+}
+
+func TestLoadParquetSchema(t *testing.T) {
+	s := NewSchemaInferrer()
+	s.Observe([]string{"timestamp", "count", "price"}, []string{"20230401", "1", "1.5"}, 0)
+
+	path := filepath.Join(t.TempDir(), "schema.json")
+	if err := WriteSchema(path, s.Schema()); err != nil {
+		t.Fatalf("failed to write schema: %s", err)
+	}
+
+	got, err := LoadParquetSchema(path)
+	if err != nil {
+		t.Fatalf("failed to load schema: %s", err)
+	}
+	want := map[string]string{"timestamp": "string", "count": "int64", "price": "double"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v but got %v", want, got)
+	}
+}
+
+func TestSchemaValidator(t *testing.T) {
+	v := NewSchemaValidator(Schema{Columns: []SchemaColumn{
+		{Name: "timestamp", Type: "date"},
+		{Name: "count", Type: "int"},
+		{Name: "price", Type: "float", Nullable: true},
+		{Name: "note", Type: "string", Nullable: true},
+	}})
+
+	tests := []struct {
+		Row   []string
+		Error string
+	}{
+		{[]string{"20230401", "1", "1.5", "x"}, ""},
+		{[]string{"20230401", " 2 ", "", ""}, ""},
+		{[]string{"20230401", "1"}, ""},
+		{[]string{"20230401", "", "1.5"}, "column count is required"},
+		{[]string{"20230401", "1.5"}, "column count is not int: 1.5"},
+		{[]string{"20230401", "1", "NaN"}, "column price is not float: NaN"},
+		{[]string{"invalid", "1"}, "column timestamp is not date: invalid"},
+	}
+
+	idx, err := v.Resolve(nil)
+	if err != nil {
+		t.Fatalf("failed to resolve: %s", err)
+	}
+	for _, tt := range tests {
+		err := v.Validate(tt.Row, idx)
+		if tt.Error == "" && err != nil {
+			t.Errorf("%q: expected valid but got %s", tt.Row, err)
+		} else if tt.Error != "" && (err == nil || err.Error() != tt.Error) {
+			t.Errorf("%q: expected %q but got %v", tt.Row, tt.Error, err)
+		}
+	}
+}
+
+func TestSchemaValidator_Resolve(t *testing.T) {
+	v := NewSchemaValidator(Schema{Columns: []SchemaColumn{
+		{Name: "timestamp", Type: "date"},
+		{Name: "count", Type: "int"},
+		{Name: "note", Type: "string", Nullable: true},
+	}})
+
+	idx, err := v.Resolve([]string{"count", "timestamp"})
+	if err != nil {
+		t.Fatalf("failed to resolve: %s", err)
+	}
+	if want := []int{1, 0, -1}; !reflect.DeepEqual(idx, want) {
+		t.Errorf("expected %v but got %v", want, idx)
+	}
+
+	if _, err := v.Resolve([]string{"timestamp", "note"}); err == nil || err.Error() != "required column is missing: count" {
+		t.Errorf("expected missing column error but got %v", err)
+	}
+
+	var nilValidator *SchemaValidator
+	if idx, err := nilValidator.Resolve(nil); idx != nil || err != nil {
+		t.Errorf("expected nil but got %v and %v", idx, err)
+	}
+	if err := nilValidator.Validate([]string{"x"}, nil); err != nil {
+		t.Errorf("expected nil but got %s", err)
+	}
+}
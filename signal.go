@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+)
+
+// interrupted is 1 after SIGINT or SIGTERM received.
+var interrupted int32
+
+// interruptSignal is the signal that interrupted the run.
+var interruptSignal atomic.Value
+
+// HandleSignals traps SIGINT and SIGTERM to stop the run gracefully, and returns a context that canceled at the first signal.
+//
+// At the first signal, chop-csv stops reading the inputs, and closes the output files so that the bzip2 streams are not broken.
+// At the second signal, chop-csv stops immediately.
+func HandleSignals(parent context.Context) context.Context {
+	ctx, cancel := context.WithCancel(parent)
+
+	ch := make(chan os.Signal, 2)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		sig := <-ch
+		interruptSignal.Store(sig)
+		atomic.StoreInt32(&interrupted, 1)
+		cancel()
+		logger.With("signal", sig.String()).Warnf("received %s, stop after closing output files. send it again to stop immediately", sig)
+
+		sig = <-ch
+		logger.With("signal", sig.String()).Warnf("received %s again, stop immediately", sig)
+		UnlockOutputDirs()
+		os.Exit(InterruptedExitCode())
+	}()
+
+	return ctx
+}
+
+// IsInterrupted reports whether the run was interrupted by a signal.
+func IsInterrupted() bool {
+	return atomic.LoadInt32(&interrupted) != 0
+}
+
+// InterruptedExitCode returns the exit code for the interrupted run: 128 + the signal number, like shells.
+func InterruptedExitCode() int {
+	if sig, ok := interruptSignal.Load().(os.Signal); ok {
+		if n, ok := signalNumber(sig); ok {
+			return 128 + n
+		}
+	}
+	return 130
+}
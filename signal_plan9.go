@@ -0,0 +1,10 @@
+package main
+
+import (
+	"os"
+)
+
+// signalNumber returns the number of sig, but Plan 9 has no numbers for the notes.
+func signalNumber(sig os.Signal) (int, bool) {
+	return 0, false
+}
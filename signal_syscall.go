@@ -0,0 +1,15 @@
+//go:build !plan9
+// +build !plan9
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// signalNumber returns the number of sig, like 2 for SIGINT.
+func signalNumber(sig os.Signal) (int, bool) {
+	s, ok := sig.(syscall.Signal)
+	return int(s), ok
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// cancelingSource is a RecordSource that cancels the context after reading n records.
+type cancelingSource struct {
+	src    RecordSource
+	n      int
+	cancel func()
+}
+
+func (s *cancelingSource) Next() ([]string, error) {
+	s.n--
+	if s.n == 0 {
+		s.cancel()
+	}
+	return s.src.Next()
+}
+
+func TestChopSource_canceled(t *testing.T) {
+	dir := setOutputDir(t)
+
+	origSummary, origCheckpoint := summary, checkpoint
+	defer func() { summary, checkpoint = origSummary, origCheckpoint }()
+
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	checkpoint = NewCheckpointer(path, 1000, []string{"queue"})
+
+	rows := [][]string{{"20230401", "a"}, {"20230401", "b"}, {"20230401", "c"}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ChopSource(ctx, &cancelingSource{SliceSource(rows), 2, cancel}, "queue")
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read checkpoint: %s", err)
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(b, &cp); err != nil {
+		t.Fatalf("failed to parse checkpoint: %s", err)
+	}
+	// The records are read ahead, so the chopping can stop before the record that canceled.
+	if cp.Current == nil || cp.Current.Path != "queue" || cp.Current.Rows > 2 {
+		t.Fatalf("expected checkpoint at row 2 or before of queue but got %+v", cp.Current)
+	}
+
+	// The output is closed but not renamed into place, because it is incomplete.
+	name, err := outputName("queue")
+	if err != nil {
+		t.Fatalf("failed to resolve output name: %s", err)
+	}
+	out := filepath.Join(dir, PartitionDir(time.Date(2023, 4, 1, 0, 0, 0, 0, time.Local)), name)
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Errorf("expected the output not to be in place but got %v", err)
+	}
+	if n := cp.Current.Rows; n > 0 {
+		if got := readBzip2CSV(t, localOutputPath(out)); !reflect.DeepEqual(got, rows[:n]) {
+			t.Errorf("expected %q but got %q", rows[:n], got)
+		}
+	}
+}
+
+func TestInterruptedExitCode(t *testing.T) {
+	orig := interruptSignal
+	defer func() { interruptSignal = orig }()
+
+	interruptSignal = atomic.Value{}
+	if code := InterruptedExitCode(); code != 130 {
+		t.Errorf("expected 130 without signal but got %d", code)
+	}
+
+	interruptSignal.Store(syscall.SIGTERM)
+	if code := InterruptedExitCode(); code != 143 {
+		t.Errorf("expected 143 for SIGTERM but got %d", code)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"errors"
+	"io"
+)
+
+var (
+	// errFieldTooLarge is the error for a field larger than -max-field-size.
+	errFieldTooLarge = errors.New("field larger than -max-field-size")
+
+	// errRecordTooLarge is the error for a record larger than -max-record-bytes.
+	errRecordTooLarge = errors.New("record larger than -max-record-bytes")
+)
+
+// dropMode is what sizeLimiter is dropping.
+type dropMode int
+
+const (
+	dropNone   dropMode = iota
+	dropField           // drop until the end of the field
+	dropRecord          // drop until the end of the record
+)
+
+// oversizedRecord is a record that cut by sizeLimiter.
+type oversizedRecord struct {
+	Line int // the line number of the beginning of the record
+	Err  error
+}
+
+// sizeLimiter is an io.Reader between the decoder and csv.Reader, for -max-field-size and -max-record-bytes.
+//
+// csv.Reader holds a whole record in memory, so a huge field like an embedded base64 blob makes a huge memory usage.
+// sizeLimiter follows the quotes and the delimiters in the stream, and drops the rest of an oversized field or record instead of passing it to csv.Reader.
+// The dropped field is closed by a quote if needed, so csv.Reader still reads the following records correctly.
+// The cut records are reported by Oversized with the line number, that is the same as csv.Reader.FieldPos.
+type sizeLimiter struct {
+	r         io.Reader
+	maxField  int64
+	maxRecord int64
+	truncate  bool // drop the rest of an oversized field instead of the whole record
+	comment   byte // the first byte of -comment, or 0
+
+	in  []byte
+	out []byte
+	pos int // the position in out that not read yet
+	err error
+
+	line        int // the number of line breaks passed to csv.Reader
+	recordLine  int
+	recordStart bool
+	fieldStart  bool
+	isComment   bool
+	inQuote     bool
+	afterQuote  bool // just after a quote in a quoted field, that can be the end of the field or an escaped quote
+	fieldBytes  int64
+	recordBytes int64
+	drop        dropMode
+	dropQuoted  bool // whether csv.Reader is in a quoted field when started dropping
+
+	oversized []oversizedRecord
+}
+
+// newSizeLimiter makes a new sizeLimiter that reads from r.
+// maxField or maxRecord can be 0 to disable it.
+func newSizeLimiter(r io.Reader, maxField, maxRecord int64, truncate bool, comment string) *sizeLimiter {
+	l := &sizeLimiter{
+		r:           r,
+		maxField:    maxField,
+		maxRecord:   maxRecord,
+		truncate:    truncate,
+		in:          make([]byte, 64*1024),
+		recordStart: true,
+		fieldStart:  true,
+	}
+	if comment != "" {
+		l.comment = comment[0]
+	}
+	return l
+}
+
+func (l *sizeLimiter) Read(p []byte) (int, error) {
+	for l.pos >= len(l.out) {
+		if l.err != nil {
+			return 0, l.err
+		}
+
+		n, err := l.r.Read(l.in)
+		l.out = l.out[:0]
+		l.pos = 0
+		for _, c := range l.in[:n] {
+			l.step(c)
+		}
+		if err != nil {
+			if l.drop != dropNone && l.dropQuoted {
+				l.out = append(l.out, '"')
+			}
+			l.drop = dropNone
+			l.err = err
+		}
+	}
+
+	n := copy(p, l.out[l.pos:])
+	l.pos += n
+	return n, nil
+}
+
+// step processes a byte of the input.
+func (l *sizeLimiter) step(c byte) {
+	if l.recordStart {
+		l.recordStart = false
+		l.recordLine = l.line + 1
+		l.recordBytes = 0
+		l.isComment = l.comment != 0 && c == l.comment
+	}
+
+	// csv.Reader is in a quoted field before this byte, if the byte is dropped.
+	quoted := l.inQuote
+
+	end := false // the end of the field
+	endRecord := false
+	switch {
+	case l.fieldStart:
+		l.fieldStart = false
+		l.fieldBytes = 0
+		l.inQuote = c == '"' && !l.isComment
+		if c == ',' && !l.isComment {
+			end = true
+			l.fieldStart = true
+		} else if c == '\n' {
+			end, endRecord = true, true
+		} else if !l.inQuote {
+			l.fieldBytes++
+		}
+	case l.inQuote:
+		// The closing quote is not the content, so it is counted only if it turns out to be an escaped quote.
+		if c == '"' {
+			l.inQuote = false
+			l.afterQuote = true
+		} else {
+			l.fieldBytes++
+		}
+	case l.afterQuote && c == '"':
+		// An escaped quote "" is a byte of the content.
+		l.fieldBytes++
+		l.inQuote = true
+		l.afterQuote = false
+	case c == ',' && !l.isComment:
+		end = true
+	case c == '\n':
+		end, endRecord = true, true
+	default:
+		l.fieldBytes++
+	}
+	if c != '"' {
+		l.afterQuote = false
+	}
+	if !endRecord {
+		l.recordBytes++
+	}
+
+	if l.drop == dropNone && !end {
+		switch {
+		case l.maxRecord > 0 && l.recordBytes > l.maxRecord:
+			l.startDrop(dropRecord, quoted, errRecordTooLarge)
+		case l.maxField > 0 && l.fieldBytes > l.maxField:
+			if l.truncate {
+				l.startDrop(dropField, quoted, errFieldTooLarge)
+			} else {
+				l.startDrop(dropRecord, quoted, errFieldTooLarge)
+			}
+		}
+	}
+
+	if end {
+		if l.drop == dropField || (l.drop == dropRecord && endRecord) {
+			if l.dropQuoted {
+				l.out = append(l.out, '"')
+			}
+			l.drop = dropNone
+		}
+		l.fieldStart = true
+	}
+	if l.drop == dropNone {
+		l.out = append(l.out, c)
+		if c == '\n' {
+			l.line++
+		}
+	}
+	if endRecord {
+		l.recordStart = true
+	}
+}
+
+func (l *sizeLimiter) startDrop(mode dropMode, quoted bool, err error) {
+	l.drop = mode
+	l.dropQuoted = quoted
+	if len(l.oversized) == 0 || l.oversized[len(l.oversized)-1].Line != l.recordLine {
+		l.oversized = append(l.oversized, oversizedRecord{Line: l.recordLine, Err: err})
+	} else if mode == dropRecord {
+		// The whole record is dropped after some fields truncated.
+		l.oversized[len(l.oversized)-1].Err = err
+	}
+}
+
+// Oversized reports whether the record that begins at line was cut, and the reason.
+// It must be called for each record in order, because the records before line are forgotten.
+func (l *sizeLimiter) Oversized(line int) (oversizedRecord, bool) {
+	for len(l.oversized) > 0 && l.oversized[0].Line < line {
+		l.oversized = l.oversized[1:]
+	}
+	if len(l.oversized) > 0 && l.oversized[0].Line == line {
+		return l.oversized[0], true
+	}
+	return oversizedRecord{}, false
+}
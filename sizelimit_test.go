@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"strings"
+	"testing"
+)
+
+func readLimited(t *testing.T, input string, maxField, maxRecord int64, truncate bool) ([][]string, *sizeLimiter) {
+	t.Helper()
+
+	l := newSizeLimiter(strings.NewReader(input), maxField, maxRecord, truncate, "")
+	c := csv.NewReader(l)
+	c.FieldsPerRecord = -1
+
+	var rows [][]string
+	for {
+		row, err := c.Read()
+		if err == io.EOF {
+			return rows, l
+		} else if err != nil {
+			t.Fatalf("failed to read: %s", err)
+		}
+		rows = append(rows, row)
+	}
+}
+
+func TestSizeLimiter(t *testing.T) {
+	tests := []struct {
+		Name      string
+		Input     string
+		MaxField  int64
+		MaxRecord int64
+		Error     error
+	}{
+		{"small", "abc,x\nfoo,bar\n", 8, 10, nil},
+		{"large field", "abcdefghijkl,x\nfoo,bar\n", 8, 0, errFieldTooLarge},
+		{"large quoted field", "\"abc,defghijkl\",x\nfoo,bar\n", 8, 0, errFieldTooLarge},
+		{"large record", "abcd,efgh,ijkl\nfoo,bar\n", 0, 10, errRecordTooLarge},
+		{"unlimited", "abcdefghijkl,x\nfoo,bar\n", 0, 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			rows, l := readLimited(t, tt.Input, tt.MaxField, tt.MaxRecord, false)
+
+			if len(rows) != 2 {
+				t.Fatalf("expected 2 rows but got %d rows: %q", len(rows), rows)
+			}
+			if rows[1][0] != "foo" || rows[1][1] != "bar" {
+				t.Errorf("expected the next row is read correctly but got %q", rows[1])
+			}
+
+			o, oversize := l.Oversized(1)
+			if tt.Error == nil && oversize {
+				t.Errorf("expected not oversized but got %v", o.Err)
+			} else if tt.Error != nil && o.Err != tt.Error {
+				t.Errorf("expected %v but got %v", tt.Error, o.Err)
+			}
+			if _, ok := l.Oversized(2); ok {
+				t.Errorf("expected the second row is not reported as oversized")
+			}
+		})
+	}
+}
+
+func TestSizeLimiter_fieldAtLimit(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Input    string
+		Oversize bool
+	}{
+		{"plain", "abcdefgh,x\n", false},
+		{"plain over", "abcdefghi,x\n", true},
+		{"quoted", "\"abcdefgh\",x\n", false},
+		{"quoted over", "\"abcdefghi\",x\n", true},
+		{"quoted last", "x,\"abcdefgh\"\n", false},
+		{"escaped quote", "\"abc\"\"efgh\",x\n", false},
+		{"escaped quote over", "\"abc\"\"efghi\",x\n", true},
+		{"quoted comma", "\"abc,efgh\",x\n", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			rows, l := readLimited(t, tt.Input, 8, 0, false)
+
+			_, oversize := l.Oversized(1)
+			if oversize != tt.Oversize {
+				t.Errorf("expected oversize %v but got %v", tt.Oversize, oversize)
+			}
+			if !tt.Oversize && len(rows) != 1 {
+				t.Errorf("expected 1 row but got %d rows: %q", len(rows), rows)
+			}
+		})
+	}
+}
+
+func TestSizeLimiter_truncate(t *testing.T) {
+	rows, l := readLimited(t, "\"abcdefghijkl\",x\nfoo,bar\n", 8, 0, true)
+
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows but got %d rows: %q", len(rows), rows)
+	}
+	if rows[0][0] != "abcdefgh" || rows[0][1] != "x" {
+		t.Errorf("unexpected truncated row: %q", rows[0])
+	}
+	if rows[1][0] != "foo" || rows[1][1] != "bar" {
+		t.Errorf("unexpected next row: %q", rows[1])
+	}
+
+	if o, ok := l.Oversized(1); !ok || o.Err != errFieldTooLarge {
+		t.Errorf("expected the first row is reported as oversized")
+	}
+	if _, ok := l.Oversized(2); ok {
+		t.Errorf("expected the second row is not reported as oversized")
+	}
+}
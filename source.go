@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"io"
+)
+
+// RecordSource is a source of records that chop-csv chops.
+//
+// Implement this interface to feed records from other than CSV files, like message queues or the other file formats.
+// The first column of each record is the timestamp, like CSV input.
+type RecordSource interface {
+	// Next returns the next record, or io.EOF if there are no more records.
+	// The returned record may be reused by the next call, so copy it to keep.
+	Next() ([]string, error)
+}
+
+// RecordSourceFunc is an adapter to use a function as a RecordSource.
+type RecordSourceFunc func() ([]string, error)
+
+func (f RecordSourceFunc) Next() ([]string, error) {
+	return f()
+}
+
+// SliceSource makes a RecordSource that returns records in order.
+func SliceSource(records [][]string) RecordSource {
+	return RecordSourceFunc(func() ([]string, error) {
+		if len(records) == 0 {
+			return nil, io.EOF
+		}
+		r := records[0]
+		records = records[1:]
+		return r, nil
+	})
+}
+
+// ChopSource chops all records from src.
+// The name identifies the source, like the path of input file. It is used to decide the output file name.
+//
+// When ctx is canceled, ChopSource stops reading src, and closes the output files without renaming them into place.
+// It reports whether all records were read. If the records are invalid, it returns an InputError.
+//
+// WARNING: this method can stop program with log.Fatal.
+func ChopSource(ctx context.Context, src RecordSource, name string) (bool, error) {
+	csvName, err := outputName(name)
+	if err != nil {
+		fatalf(ExitError, "failed to resolve input file path: %s", err)
+	}
+
+	src, stop := readAhead(src)
+	defer stop()
+
+	return chop(ctx, src, name, NewPartitionWriter(csvName), &Summary{})
+}
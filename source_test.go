@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSliceSource(t *testing.T) {
+	records := [][]string{{"20230401", "a"}, {"20230402", "b"}}
+	src := SliceSource(records)
+
+	for i, want := range records {
+		got, err := src.Next()
+		if err != nil {
+			t.Fatalf("failed to read record %d: %s", i, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("expected %q but got %q", want, got)
+		}
+	}
+	if _, err := src.Next(); err != io.EOF {
+		t.Errorf("expected io.EOF but got %v", err)
+	}
+}
+
+func TestChopSource(t *testing.T) {
+	dir := setOutputDir(t)
+
+	origSummary := summary
+	summary = Summary{}
+	defer func() { summary = origSummary }()
+
+	ChopSource(context.Background(), SliceSource([][]string{
+		{"20230401", "a"},
+		{"20230402", "b"},
+		{"20230401", "c"},
+	}), "queue")
+
+	name, err := outputName("queue")
+	if err != nil {
+		t.Fatalf("failed to resolve output name: %s", err)
+	}
+
+	tests := []struct {
+		Day  time.Time
+		Rows [][]string
+	}{
+		{time.Date(2023, 4, 1, 0, 0, 0, 0, time.Local), [][]string{{"20230401", "a"}, {"20230401", "c"}}},
+		{time.Date(2023, 4, 2, 0, 0, 0, 0, time.Local), [][]string{{"20230402", "b"}}},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, PartitionDir(tt.Day), name)
+		if got := readBzip2CSV(t, path); !reflect.DeepEqual(got, tt.Rows) {
+			t.Errorf("%s: expected %q but got %q", path, tt.Rows, got)
+		}
+	}
+
+	if summary.InputFiles != 1 || summary.WrittenRows != 3 {
+		t.Errorf("expected 1 input file and 3 written rows but got %d input files and %d written rows", summary.InputFiles, summary.WrittenRows)
+	}
+}
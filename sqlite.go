@@ -0,0 +1,432 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// sqlitePageSize is the page size of SQLite output.
+const sqlitePageSize = 4096
+
+// sqliteInteriorCells is the maximum number of children of an interior page.
+// An interior cell is at most 13 bytes and its pointer is 2 bytes, so a page can hold more than 200 cells.
+const sqliteInteriorCells = 200
+
+type sqliteChild struct {
+	Page  uint32
+	RowID int64 // the largest rowid in the page
+}
+
+// SQLiteWriter writes rows into a table of SQLite database file, without SQLite library.
+//
+// The rows are written into the leaf pages of the table as they come.
+// The interior pages and the schema are written at every flush, and overwritten by the next flush.
+//
+// WARNING: this struct reads commandline flags directly.
+type SQLiteWriter struct {
+	fs      []*os.File
+	names   []string // the paths of fs, that can be different from the actual names while writing into temporary files
+	table   string
+	columns []string
+
+	leaves []sqliteChild // the finished leaf pages
+	leaf   uint32        // the page number of the current leaf page, or 0
+	cells  [][]byte      // the cells in the current leaf page
+	rowID  int64
+
+	pages     uint32 // the number of pages in the file
+	dataPages uint32 // the number of pages excluding ones written by the last flush
+	size      int64  // the size of the file that flushed so far
+	dirty     bool
+}
+
+// sqliteFiles is the SQLite files closed in this run, to append rows with AppendSQLite.
+var sqliteFiles = map[string]*SQLiteWriter{}
+
+// SQLiteTableName decides the table name for SQLite output from the input file path.
+func SQLiteTableName(inputPath string) string {
+	if *sqliteTable != "" {
+		return *sqliteTable
+	}
+	return fileStem(inputPath)
+}
+
+// CreateSQLite creates a new SQLite database with a table that has the columns.
+// If passed multiple paths, the SQLiteWriter writes the same content into all of them.
+func CreateSQLite(table string, columns []string, paths ...string) (*SQLiteWriter, error) {
+	// SQLite rejects duplicated column names.
+	cs := make([]string, len(columns))
+	used := make(map[string]bool)
+	for i, c := range columns {
+		name := c
+		for n := 2; used[strings.ToLower(name)]; n++ {
+			name = fmt.Sprintf("%s_%d", c, n)
+		}
+		used[strings.ToLower(name)] = true
+		cs[i] = name
+	}
+
+	w := &SQLiteWriter{table: table, columns: cs, pages: 1, dataPages: 1, dirty: true}
+	if err := w.open(os.O_RDWR|os.O_CREATE|os.O_TRUNC, paths); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// AppendSQLite opens SQLiteWriter to append rows into the file that closed in this run.
+func AppendSQLite(paths ...string) (*SQLiteWriter, error) {
+	prev, ok := sqliteFiles[paths[0]]
+	if !ok {
+		return nil, fmt.Errorf("%s: can not append to sqlite file that made by the other run", paths[0])
+	}
+
+	w := *prev
+	w.fs = nil
+	if err := w.open(os.O_RDWR, paths); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+func (w *SQLiteWriter) open(flag int, paths []string) error {
+	w.names = paths
+	for _, path := range paths {
+		f, err := openLocalOutput(path, flag)
+		if err != nil {
+			w.closeFiles()
+			return err
+		}
+		w.fs = append(w.fs, f)
+	}
+	return nil
+}
+
+func (w *SQLiteWriter) closeFiles() error {
+	var err error
+	for _, f := range w.fs {
+		if e := f.Close(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// allocate allocates a new page, and returns its page number (1-origin).
+func (w *SQLiteWriter) allocate() uint32 {
+	if w.pages < w.dataPages {
+		w.pages = w.dataPages
+	}
+	w.pages++
+	return w.pages
+}
+
+func (w *SQLiteWriter) writePage(n uint32, page []byte) error {
+	for _, f := range w.fs {
+		if _, err := f.WriteAt(page, int64(n-1)*sqlitePageSize); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *SQLiteWriter) Write(record []string) error {
+	if len(record) != len(w.columns) {
+		return fmt.Errorf("row has %d columns, but sqlite table has %d columns", len(record), len(w.columns))
+	}
+
+	// Overwrite the pages that written by the last flush.
+	w.pages = w.dataPages
+	w.dirty = true
+
+	values := make([]interface{}, len(record))
+	for i, v := range record {
+		values[i] = v
+	}
+	w.rowID++
+	cell, err := w.makeCell(appendVarint64(nil, w.rowID), sqliteRecord(values))
+	if err != nil {
+		return err
+	}
+
+	if w.leaf != 0 && !sqliteFits(8, w.cells, cell) {
+		if err := w.writePageCells(w.leaf, 0, w.cells); err != nil {
+			return err
+		}
+		w.leaves = append(w.leaves, sqliteChild{w.leaf, w.rowID - 1})
+		w.leaf = 0
+		w.cells = nil
+	}
+	if w.leaf == 0 {
+		w.leaf = w.allocate()
+	}
+	w.cells = append(w.cells, cell)
+	w.dataPages = w.pages
+	return nil
+}
+
+// makeCell makes a cell of table leaf page, and writes the overflow pages if the payload is too large.
+func (w *SQLiteWriter) makeCell(key, payload []byte) ([]byte, error) {
+	cell := appendVarint64(nil, int64(len(payload)))
+	cell = append(cell, key...)
+
+	local := sqliteLocalPayload(len(payload))
+	cell = append(cell, payload[:local]...)
+	if local == len(payload) {
+		return cell, nil
+	}
+
+	rest := payload[local:]
+	next := w.allocate()
+	cell = appendUint32BE(cell, next)
+	for len(rest) > 0 {
+		page := make([]byte, sqlitePageSize)
+		n := copy(page[4:], rest)
+		rest = rest[n:]
+
+		cur := next
+		if len(rest) > 0 {
+			next = w.allocate()
+			binary.BigEndian.PutUint32(page, next)
+		}
+		if err := w.writePage(cur, page); err != nil {
+			return nil, err
+		}
+	}
+	return cell, nil
+}
+
+// sqliteLocalPayload calculates how many bytes of the payload are stored in the table leaf page.
+func sqliteLocalPayload(p int) int {
+	const (
+		u = sqlitePageSize
+		x = u - 35
+		m = (u-12)*32/255 - 23
+	)
+	if p <= x {
+		return p
+	}
+	if k := m + (p-m)%(u-4); k <= x {
+		return k
+	}
+	return m
+}
+
+// sqliteFits reports whether the cell can be added into the page that has the cells.
+func sqliteFits(headerSize int, cells [][]byte, cell []byte) bool {
+	used := headerSize + 2*(len(cells)+1) + len(cell)
+	for _, c := range cells {
+		used += len(c)
+	}
+	return used <= sqlitePageSize
+}
+
+// buildPage builds a b-tree page.
+// If rightmost is not 0, the page is an interior page.
+// The page 1 has the database header in the first 100 bytes.
+func buildPage(n uint32, rightmost uint32, cells [][]byte) []byte {
+	page := make([]byte, sqlitePageSize)
+	h := page
+	if n == 1 {
+		h = page[100:]
+	}
+
+	headerSize := 8
+	h[0] = 0x0D // table b-tree leaf page
+	if rightmost != 0 {
+		headerSize = 12
+		h[0] = 0x05 // table b-tree interior page
+		binary.BigEndian.PutUint32(h[8:], rightmost)
+	}
+	binary.BigEndian.PutUint16(h[3:], uint16(len(cells)))
+
+	end := sqlitePageSize
+	for i, c := range cells {
+		end -= len(c)
+		copy(page[end:], c)
+		binary.BigEndian.PutUint16(h[headerSize+2*i:], uint16(end))
+	}
+	binary.BigEndian.PutUint16(h[5:], uint16(end))
+	return page
+}
+
+func (w *SQLiteWriter) writePageCells(n uint32, rightmost uint32, cells [][]byte) error {
+	return w.writePage(n, buildPage(n, rightmost, cells))
+}
+
+// writeSchema writes the interior pages of the table and the schema, and the database header.
+func (w *SQLiteWriter) writeSchema() error {
+	w.pages = w.dataPages
+
+	children := append([]sqliteChild{}, w.leaves...)
+	if w.leaf != 0 {
+		if err := w.writePageCells(w.leaf, 0, w.cells); err != nil {
+			return err
+		}
+		children = append(children, sqliteChild{w.leaf, w.rowID})
+	}
+
+	// Build the interior pages from the bottom.
+	for len(children) > 1 {
+		var parents []sqliteChild
+		for len(children) > 0 {
+			n := len(children)
+			if n > sqliteInteriorCells {
+				n = sqliteInteriorCells
+			}
+			group := children[:n]
+			children = children[n:]
+
+			cells := make([][]byte, n-1)
+			for i, c := range group[:n-1] {
+				cells[i] = appendVarint64(appendUint32BE(nil, c.Page), c.RowID)
+			}
+			page := w.allocate()
+			if err := w.writePageCells(page, group[n-1].Page, cells); err != nil {
+				return err
+			}
+			parents = append(parents, sqliteChild{page, group[n-1].RowID})
+		}
+		children = parents
+	}
+	root := children[0].Page
+
+	defs := make([]string, len(w.columns))
+	for i, c := range w.columns {
+		defs[i] = quoteSQLiteIdent(c) + " TEXT"
+	}
+	sql := fmt.Sprintf("CREATE TABLE %s (%s)", quoteSQLiteIdent(w.table), strings.Join(defs, ", "))
+	schema, err := w.makeCell(appendVarint64(nil, 1), sqliteRecord([]interface{}{"table", w.table, w.table, int64(root), sql}))
+	if err != nil {
+		return err
+	}
+	if !sqliteFits(108, nil, schema) {
+		return fmt.Errorf("too many columns for sqlite output")
+	}
+
+	page := buildPage(1, 0, [][]byte{schema})
+	h := page[:100]
+	copy(h, "SQLite format 3\x00")
+	binary.BigEndian.PutUint16(h[16:], sqlitePageSize)
+	h[18], h[19] = 1, 1 // legacy journal mode
+	h[21], h[22], h[23] = 64, 32, 32
+	binary.BigEndian.PutUint32(h[24:], 1) // file change counter
+	binary.BigEndian.PutUint32(h[28:], w.pages)
+	binary.BigEndian.PutUint32(h[40:], 1) // schema cookie
+	binary.BigEndian.PutUint32(h[44:], 4) // schema format
+	binary.BigEndian.PutUint32(h[56:], 1) // UTF-8
+	binary.BigEndian.PutUint32(h[92:], 1) // version-valid-for, the same as file change counter
+	binary.BigEndian.PutUint32(h[96:], 3039000)
+	if err := w.writePage(1, page); err != nil {
+		return err
+	}
+
+	for _, f := range w.fs {
+		if err := f.Truncate(int64(w.pages) * sqlitePageSize); err != nil {
+			return err
+		}
+	}
+	w.dirty = false
+	return nil
+}
+
+// Flush writes out all rows that written so far into the file.
+func (w *SQLiteWriter) Flush() error {
+	if !w.dirty {
+		return nil
+	}
+	if err := w.writeSchema(); err != nil {
+		return err
+	}
+	w.size = int64(w.pages) * sqlitePageSize
+	return nil
+}
+
+func (w *SQLiteWriter) Close() error {
+	err := w.Flush()
+	if e := w.closeFiles(); err == nil {
+		err = e
+	}
+	sqliteFiles[w.Name()] = w
+	return err
+}
+
+func (w *SQLiteWriter) Name() string {
+	return w.names[0]
+}
+
+// Size returns the size of the file that flushed so far.
+func (w *SQLiteWriter) Size() int64 {
+	return w.size
+}
+
+// Written returns the approximate size of the file, including the leaf pages that written after the last flush.
+func (w *SQLiteWriter) Written() int64 {
+	return int64(w.dataPages) * sqlitePageSize
+}
+
+// sqliteRecord encodes values in the record format of SQLite.
+// The values are string or int64.
+func sqliteRecord(values []interface{}) []byte {
+	var types, body []byte
+	for _, v := range values {
+		switch v := v.(type) {
+		case string:
+			types = appendVarint64(types, int64(2*len(v)+13))
+			body = append(body, v...)
+		case int64:
+			types = appendVarint64(types, 6)
+			body = appendUint64BE(body, uint64(v))
+		}
+	}
+
+	// The header size includes the varint of itself.
+	size := len(types) + 1
+	if len(appendVarint64(nil, int64(size))) > 1 {
+		size++
+	}
+	b := appendVarint64(nil, int64(size))
+	b = append(b, types...)
+	return append(b, body...)
+}
+
+// appendVarint64 appends v as the variable-length integer of SQLite.
+func appendVarint64(b []byte, v int64) []byte {
+	u := uint64(v)
+	if u > 0x00FFFFFFFFFFFFFF {
+		var buf [9]byte
+		buf[8] = byte(u)
+		u >>= 8
+		for i := 7; i >= 0; i-- {
+			buf[i] = byte(u&0x7F) | 0x80
+			u >>= 7
+		}
+		return append(b, buf[:]...)
+	}
+
+	var buf [9]byte
+	i := len(buf) - 1
+	buf[i] = byte(u & 0x7F)
+	for u >>= 7; u > 0; u >>= 7 {
+		i--
+		buf[i] = byte(u&0x7F) | 0x80
+	}
+	return append(b, buf[i:]...)
+}
+
+func quoteSQLiteIdent(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+func appendUint32BE(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendUint64BE(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// querySQLite runs the query on the database at path by sqlite3 command, and returns the result rows.
+// The test is skipped if sqlite3 command is not installed.
+func querySQLite(t *testing.T, path, query string) []map[string]interface{} {
+	t.Helper()
+
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 command is not installed")
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("sqlite3", "-readonly", "-json", path, query)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("failed to query %s: %s: %s", path, err, stderr.String())
+	}
+
+	// sqlite3 prints nothing if no rows.
+	var rows []map[string]interface{}
+	if len(bytes.TrimSpace(out)) > 0 {
+		if err := json.Unmarshal(out, &rows); err != nil {
+			t.Fatalf("failed to parse the output of sqlite3: %s: %s", err, out)
+		}
+	}
+	return rows
+}
+
+// checkSQLite checks the database at path by "PRAGMA integrity_check", and returns the rows of the table.
+func checkSQLite(t *testing.T, path, table string, columns []string) [][]string {
+	t.Helper()
+
+	if r := querySQLite(t, path, "PRAGMA integrity_check"); len(r) != 1 || r[0]["integrity_check"] != "ok" {
+		t.Fatalf("integrity check failed: %v", r)
+	}
+
+	rs := querySQLite(t, path, fmt.Sprintf("SELECT * FROM %s ORDER BY rowid", quoteSQLiteIdent(table)))
+	rows := make([][]string, len(rs))
+	for i, r := range rs {
+		rows[i] = make([]string, len(columns))
+		for j, c := range columns {
+			s, ok := r[c].(string)
+			if !ok {
+				t.Fatalf("row %d: column %s is not a text: %#v", i+1, c, r[c])
+			}
+			rows[i][j] = s
+		}
+	}
+	return rows
+}
+
+func TestSQLiteWriter_roundTrip(t *testing.T) {
+	columns := []string{"id", "name", "memo"}
+	rows := [][]string{
+		{"1", "", ""},
+		{"2", "日本語, \"quoted\"\nnewline", "x"},
+		// Larger than a page, so it is written into the overflow pages.
+		{"3", strings.Repeat("long text ", 2000), "y"},
+	}
+	// The rows fill many leaf pages, so the interior pages are needed.
+	for i := len(rows) + 1; i <= 5000; i++ {
+		rows = append(rows, []string{fmt.Sprint(i), fmt.Sprintf("name%d", i), strings.Repeat("z", i%100)})
+	}
+
+	path := filepath.Join(t.TempDir(), "test.sqlite")
+	w, err := CreateSQLite("test table", columns, path)
+	if err != nil {
+		t.Fatalf("failed to create: %s", err)
+	}
+	for _, row := range rows {
+		if err := w.Write(row); err != nil {
+			t.Fatalf("failed to write: %s", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+	if err := CompleteUploads(); err != nil {
+		t.Fatalf("failed to complete: %s", err)
+	}
+
+	got := checkSQLite(t, path, "test table", columns)
+	if len(got) != len(rows) {
+		t.Fatalf("expected %d rows but got %d rows", len(rows), len(got))
+	}
+	for i := range rows {
+		if !reflect.DeepEqual(got[i], rows[i]) {
+			t.Errorf("row %d: expected %q but got %q", i+1, rows[i], got[i])
+		}
+	}
+
+	sql := querySQLite(t, path, "SELECT sql FROM sqlite_master WHERE type = 'table'")
+	if want := `CREATE TABLE "test table" ("id" TEXT, "name" TEXT, "memo" TEXT)`; len(sql) != 1 || sql[0]["sql"] != want {
+		t.Errorf("expected schema %q but got %v", want, sql)
+	}
+}
+
+func TestSQLiteWriter_flushAndAppend(t *testing.T) {
+	columns := []string{"a", "b"}
+
+	path := filepath.Join(t.TempDir(), "test.sqlite")
+	w, err := CreateSQLite("test", columns, path)
+	if err != nil {
+		t.Fatalf("failed to create: %s", err)
+	}
+	if err := w.Write([]string{"1", "x"}); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("failed to flush: %s", err)
+	}
+
+	// The file is readable after flushed, even if not closed yet.
+	if got := checkSQLite(t, localOutputPath(path), "test", columns); len(got) != 1 {
+		t.Errorf("expected 1 row after flushed but got %d rows", len(got))
+	}
+
+	if err := w.Write([]string{"2", "y"}); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+
+	w, err = AppendSQLite(path)
+	if err != nil {
+		t.Fatalf("failed to open to append: %s", err)
+	}
+	if err := w.Write([]string{"3", "z"}); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+	if err := CompleteUploads(); err != nil {
+		t.Fatalf("failed to complete: %s", err)
+	}
+
+	got := checkSQLite(t, path, "test", columns)
+	if want := [][]string{{"1", "x"}, {"2", "y"}, {"3", "z"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected rows\nexpected: %q\n but got: %q", want, got)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// InputState is the state of an input file when it was chopped.
+type InputState struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	SHA256  string    `json:"sha256"`
+}
+
+// StateFile is the states of the processed input files, that recorded by -state.
+//
+// The inputs that unchanged from the recorded state are skipped, so that the output files are not rewritten.
+// All methods do nothing if the StateFile is nil.
+type StateFile struct {
+	path   string
+	mu     sync.Mutex            // guards Inputs while chopping in parallel by -jobs
+	Inputs map[string]InputState `json:"inputs"` // the key is the absolute path
+}
+
+// inputState is the StateFile of -state, or nil if disabled.
+var inputState *StateFile
+
+// LoadState loads the state file.
+// The state is empty if the file does not exist yet.
+func LoadState(path string) (*StateFile, error) {
+	s := &StateFile{path: path, Inputs: make(map[string]InputState)}
+
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if s.Inputs == nil {
+		s.Inputs = make(map[string]InputState)
+	}
+	return s, nil
+}
+
+// Unchanged reports whether the file is the same as when it was recorded.
+//
+// The file is unchanged if the size and the modification time are the same.
+// If only the modification time is different, the SHA-256 is compared, so that touched files are not chopped again.
+func (s *StateFile) Unchanged(path string, info fs.FileInfo) bool {
+	if s == nil {
+		return false
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	s.mu.Lock()
+	e, ok := s.Inputs[abs]
+	s.mu.Unlock()
+	if !ok || e.Size != info.Size() {
+		return false
+	}
+	if e.ModTime.Equal(info.ModTime()) {
+		return true
+	}
+
+	if _, sum, err := fileDigest(path); err != nil || sum != e.SHA256 {
+		return false
+	}
+	e.ModTime = info.ModTime()
+	s.mu.Lock()
+	s.Inputs[abs] = e
+	s.mu.Unlock()
+	return true
+}
+
+// Record records the state of the file that chopped.
+func (s *StateFile) Record(path string, info fs.FileInfo) error {
+	if s == nil {
+		return nil
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	_, sum, err := fileDigest(path)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.Inputs[abs] = InputState{Size: info.Size(), ModTime: info.ModTime(), SHA256: sum}
+	s.mu.Unlock()
+	return nil
+}
+
+// Save writes the state into the file.
+// The file is replaced atomically, so that the state is not broken even if stopped while writing.
+func (s *StateFile) Save() error {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	b, err := json.MarshalIndent(s, "", "  ")
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, append(b, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
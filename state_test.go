@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStateFile(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "a.csv")
+	if err := os.WriteFile(input, []byte("20230401,a\n"), 0644); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+	stat := func() os.FileInfo {
+		t.Helper()
+		info, err := os.Stat(input)
+		if err != nil {
+			t.Fatalf("failed to stat: %s", err)
+		}
+		return info
+	}
+
+	path := filepath.Join(dir, "state.json")
+	s, err := LoadState(path)
+	if err != nil {
+		t.Fatalf("failed to load state: %s", err)
+	}
+	if s.Unchanged(input, stat()) {
+		t.Errorf("expected a new file to be changed")
+	}
+	if err := s.Record(input, stat()); err != nil {
+		t.Fatalf("failed to record: %s", err)
+	}
+	if err := s.Save(); err != nil {
+		t.Fatalf("failed to save: %s", err)
+	}
+
+	s, err = LoadState(path)
+	if err != nil {
+		t.Fatalf("failed to reload state: %s", err)
+	}
+	if !s.Unchanged(input, stat()) {
+		t.Errorf("expected the recorded file to be unchanged")
+	}
+
+	// Only touched file is still unchanged, because the content is the same.
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(input, later, later); err != nil {
+		t.Fatalf("failed to touch: %s", err)
+	}
+	if !s.Unchanged(input, stat()) {
+		t.Errorf("expected the touched file to be unchanged")
+	}
+
+	// The same size but different content is changed.
+	if err := os.WriteFile(input, []byte("20230401,b\n"), 0644); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+	if err := os.Chtimes(input, later.Add(time.Hour), later.Add(time.Hour)); err != nil {
+		t.Fatalf("failed to touch: %s", err)
+	}
+	if s.Unchanged(input, stat()) {
+		t.Errorf("expected the rewritten file to be changed")
+	}
+}
+
+func TestStateFile_nil(t *testing.T) {
+	var s *StateFile
+	if s.Unchanged("a.csv", nil) {
+		t.Errorf("expected nil state to report changed")
+	}
+	if err := s.Record("a.csv", nil); err != nil {
+		t.Errorf("expected no error but got %s", err)
+	}
+	if err := s.Save(); err != nil {
+		t.Errorf("expected no error but got %s", err)
+	}
+}
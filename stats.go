@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// statsHeader is the header of the file of -stats-csv.
+var statsHeader = []string{
+	"date",
+	"input_files",
+	"read_rows",
+	"written_rows",
+	"input_bytes",
+	"output_bytes",
+	"duration_seconds",
+	"partitions",
+}
+
+// AppendStatsCSV appends a row of the statistics of the run into the CSV file.
+// The header is written if the file is new or empty.
+func AppendStatsCSV(path string, startAt, endAt time.Time) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	w := NewCSVWriter(f)
+	if info.Size() == 0 {
+		w.Write(statsHeader)
+	}
+	w.Write([]string{
+		startAt.Format(time.RFC3339),
+		strconv.Itoa(summary.InputFiles),
+		strconv.Itoa(summary.ReadRows),
+		strconv.Itoa(summary.WrittenRows),
+		strconv.FormatInt(summary.InputBytes, 10),
+		strconv.FormatInt(summary.OutputBytes, 10),
+		strconv.FormatFloat(endAt.Sub(startAt).Seconds(), 'f', 3, 64),
+		strconv.Itoa(len(writtenPartitions)),
+	})
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
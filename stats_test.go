@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAppendStatsCSV(t *testing.T) {
+	origSummary, origPartitions := summary, writtenPartitions
+	summary = Summary{InputFiles: 2, ReadRows: 10, WrittenRows: 8, InputBytes: 1000, OutputBytes: 300}
+	writtenPartitions = map[string]bool{"year=2023/month=4/day=1": true, "year=2023/month=4/day=2": true}
+	defer func() { summary, writtenPartitions = origSummary, origPartitions }()
+
+	path := filepath.Join(t.TempDir(), "stats.csv")
+	start := time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 2; i++ {
+		if err := AppendStatsCSV(path, start, start.Add(1500*time.Millisecond)); err != nil {
+			t.Fatalf("failed to append: %s", err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open: %s", err)
+	}
+	defer f.Close()
+	got, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to read: %s", err)
+	}
+
+	row := []string{"2023-04-01T12:00:00Z", "2", "10", "8", "1000", "300", "1.500", "2"}
+	if want := [][]string{statsHeader, row, row}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected stats\nexpected: %q\n but got: %q", want, got)
+	}
+}
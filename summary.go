@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+)
+
+// Summary is the statistics of a run.
+type Summary struct {
+	InputFiles      int            `json:"input_files"`
+	EmptyFiles      int            `json:"empty_files"`
+	UnreadableFiles []string       `json:"unreadable_files,omitempty"`
+	FailedFiles     []string       `json:"failed_files,omitempty"`
+	SkippedFiles    int            `json:"skipped_files"`
+	ReadRows        int            `json:"read_rows"`
+	WrittenRows     int            `json:"written_rows"`
+	InputBytes      int64          `json:"input_bytes"`
+	OutputBytes     int64          `json:"output_bytes"`
+	IgnoredRows     int            `json:"ignored_rows"`
+	FilteredRows    int            `json:"filtered_rows"`
+	DuplicateRows   int            `json:"duplicate_rows"`
+	OverflowRows    int            `json:"overflow_rows"`
+	DecodeErrorRows int            `json:"decode_error_rows"`
+	RaggedRows      int            `json:"ragged_rows"`
+	OversizeRows    int            `json:"oversize_rows"`
+	SchemaRejected  int            `json:"schema_rejected_rows"`
+	ReplacedChars   int            `json:"replaced_chars"`
+	ReplacedGaiji   map[string]int `json:"replaced_gaiji,omitempty"`
+	HookRuns        int            `json:"hook_runs"`
+	HookFailures    int            `json:"hook_failures"`
+	OutputRetries   int            `json:"output_retries"`
+}
+
+// summary is the Summary of the current run.
+var summary Summary
+
+// Print prints Summary into log.
+// In JSON format, the statistics are written as a field of one message.
+func (s Summary) Print() {
+	if jsonLog {
+		logger.With("summary", s).Infof("summary")
+		return
+	}
+
+	logger.Infof("input files: %d (empty: %d)", s.InputFiles, s.EmptyFiles)
+	if s.SkippedFiles > 0 {
+		logger.Infof("skipped files that not modified since the last run: %d", s.SkippedFiles)
+	}
+	if len(s.UnreadableFiles) > 0 {
+		logger.Infof("unreadable files: %d", len(s.UnreadableFiles))
+		for _, f := range s.UnreadableFiles {
+			logger.Infof("  %s", f)
+		}
+	}
+	if len(s.FailedFiles) > 0 {
+		logger.Infof("failed files: %d", len(s.FailedFiles))
+		for _, f := range s.FailedFiles {
+			logger.Infof("  %s", f)
+		}
+	}
+	logger.Infof("read rows: %d", s.ReadRows)
+	logger.Infof("written rows: %d", s.WrittenRows)
+	logger.Infof("input bytes: %d, output bytes: %d", s.InputBytes, s.OutputBytes)
+	logger.Infof("ignored rows: %d (invalid timestamp: %d, decode error: %d)", s.IgnoredRows+s.DecodeErrorRows, s.IgnoredRows, s.DecodeErrorRows)
+	logger.Infof("filtered rows: %d", s.FilteredRows)
+	if s.DuplicateRows > 0 {
+		logger.Infof("duplicate rows: %d", s.DuplicateRows)
+	}
+	if s.OverflowRows > 0 {
+		logger.Infof("overflow rows: %d", s.OverflowRows)
+	}
+	if s.RaggedRows > 0 {
+		logger.Infof("ragged rows: %d", s.RaggedRows)
+	}
+	if s.OversizeRows > 0 {
+		logger.Infof("oversized rows: %d", s.OversizeRows)
+	}
+	if s.SchemaRejected > 0 {
+		logger.Infof("rejected rows by schema: %d", s.SchemaRejected)
+	}
+	logger.Infof("replaced characters: %d", s.ReplacedChars)
+	if len(s.ReplacedGaiji) > 0 {
+		codes := make([]string, 0, len(s.ReplacedGaiji))
+		for c := range s.ReplacedGaiji {
+			codes = append(codes, c)
+		}
+		sort.Strings(codes)
+
+		logger.Infof("replaced gaiji:")
+		for _, c := range codes {
+			logger.Infof("  %s: %d", c, s.ReplacedGaiji[c])
+		}
+	}
+	if s.HookRuns > 0 {
+		logger.Infof("hook commands: %d (failed: %d)", s.HookRuns, s.HookFailures)
+	}
+	if s.OutputRetries > 0 {
+		logger.Infof("retried output operations: %d", s.OutputRetries)
+	}
+}
+
+// Add adds the statistics of o into s.
+func (s *Summary) Add(o Summary) {
+	s.InputFiles += o.InputFiles
+	s.EmptyFiles += o.EmptyFiles
+	s.UnreadableFiles = append(s.UnreadableFiles, o.UnreadableFiles...)
+	s.FailedFiles = append(s.FailedFiles, o.FailedFiles...)
+	s.SkippedFiles += o.SkippedFiles
+	s.ReadRows += o.ReadRows
+	s.WrittenRows += o.WrittenRows
+	s.InputBytes += o.InputBytes
+	s.OutputBytes += o.OutputBytes
+	s.IgnoredRows += o.IgnoredRows
+	s.FilteredRows += o.FilteredRows
+	s.DuplicateRows += o.DuplicateRows
+	s.OverflowRows += o.OverflowRows
+	s.DecodeErrorRows += o.DecodeErrorRows
+	s.RaggedRows += o.RaggedRows
+	s.OversizeRows += o.OversizeRows
+	s.SchemaRejected += o.SchemaRejected
+	s.ReplacedChars += o.ReplacedChars
+	if len(o.ReplacedGaiji) > 0 && s.ReplacedGaiji == nil {
+		s.ReplacedGaiji = make(map[string]int)
+	}
+	for c, n := range o.ReplacedGaiji {
+		s.ReplacedGaiji[c] += n
+	}
+	s.HookRuns += o.HookRuns
+	s.HookFailures += o.HookFailures
+	s.OutputRetries += o.OutputRetries
+}
+
+// addSummary adds the statistics of an input file into summary, and resets s to count again.
+// The statistics are counted for each input file and added later, so that the files can be chopped in parallel.
+func addSummary(s *Summary) {
+	chopMu.Lock()
+	summary.Add(*s)
+	summary.OutputRetries += int(atomic.SwapInt64(&retriedOutputs, 0))
+	chopMu.Unlock()
+
+	gaiji := s.ReplacedGaiji
+	for c := range gaiji {
+		delete(gaiji, c)
+	}
+	*s = Summary{ReplacedGaiji: gaiji}
+}
+
+// AddUnreadable records a file or directory that could not be read because of permission, to report it and continue.
+func (s *Summary) AddUnreadable(err error) {
+	logger.With("error", err).Warnf("skip unreadable file: %s", err)
+	s.UnreadableFiles = append(s.UnreadableFiles, err.Error())
+}
+
+// addUnreadable records an unreadable file into summary, like Summary.AddUnreadable but safe to use while chopping in parallel.
+func addUnreadable(err error) {
+	chopMu.Lock()
+	defer chopMu.Unlock()
+	summary.AddUnreadable(err)
+}
+
+// failedExitCode is the exit code of the first input file that failed with -keep-going, or 0 if no file failed.
+var failedExitCode = ExitOK
+
+// addFailed records an input file that failed with -keep-going, to report it and continue.
+func addFailed(inputPath string, code int, err error) {
+	chopMu.Lock()
+	defer chopMu.Unlock()
+
+	logger.With("input", inputPath, "error", err).Errorf("failed to chop %s, so continue with the other files: %s", inputPath, err)
+	summary.FailedFiles = append(summary.FailedFiles, fmt.Sprintf("%s: %s", inputPath, err))
+	if failedExitCode == ExitOK {
+		failedExitCode = code
+	}
+}
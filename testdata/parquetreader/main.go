@@ -0,0 +1,86 @@
+// parquetreader reads a Parquet file by parquet-go, and prints the row groups and the rows as JSON.
+// It is used by the tests to read the output of chop-csv by a real Parquet reader.
+// The null values are printed as empty strings, like chop-csv writes the empty values as null.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+type result struct {
+	RowGroups int        `json:"row_groups"`
+	Columns   []string   `json:"columns"`
+	Rows      [][]string `json:"rows"`
+}
+
+func formatValue(v parquet.Value) string {
+	switch v.Kind() {
+	case parquet.Boolean:
+		return strconv.FormatBool(v.Boolean())
+	case parquet.Int64:
+		return strconv.FormatInt(v.Int64(), 10)
+	case parquet.Double:
+		return strconv.FormatFloat(v.Double(), 'g', -1, 64)
+	case parquet.ByteArray:
+		return string(v.ByteArray())
+	}
+	return ""
+}
+
+func read(path string) (result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return result{}, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return result{}, err
+	}
+	pf, err := parquet.OpenFile(f, stat.Size())
+	if err != nil {
+		return result{}, err
+	}
+
+	r := result{RowGroups: len(pf.RowGroups()), Rows: [][]string{}}
+	for _, c := range pf.Schema().Columns() {
+		r.Columns = append(r.Columns, c[0])
+	}
+	for _, g := range pf.RowGroups() {
+		rows := g.Rows()
+		buf := make([]parquet.Row, 64)
+		for {
+			n, err := rows.ReadRows(buf)
+			for _, row := range buf[:n] {
+				out := make([]string, len(r.Columns))
+				for _, v := range row {
+					out[v.Column()] = formatValue(v)
+				}
+				r.Rows = append(r.Rows, out)
+			}
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				rows.Close()
+				return result{}, err
+			}
+		}
+		rows.Close()
+	}
+	return r, nil
+}
+
+func main() {
+	r, err := read(os.Args[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	json.NewEncoder(os.Stdout).Encode(r)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	// Embed timezone database for Windows that has no zoneinfo.
+	_ "time/tzdata"
+)
+
+// defaultDateFormat is the date format that used when no -date-format specified.
+const defaultDateFormat = "20060102"
+
+// dateFormats is the list of date formats to try in order.
+var dateFormats stringList
+
+// timezone is the location to interpret and partition timestamps.
+// nil means UTC for timestamps without zone, and the zone in the timestamp otherwise.
+var timezone *time.Location
+
+// TimestampParser parses a timestamp in the date column.
+//
+// Implement this for the formats that Go layouts can not express, and set it into DefaultTimestampParser.
+type TimestampParser interface {
+	Parse(s string) (time.Time, error)
+}
+
+// TimestampParserFunc is an adapter to use a function as a TimestampParser.
+type TimestampParserFunc func(s string) (time.Time, error)
+
+func (f TimestampParserFunc) Parse(s string) (time.Time, error) {
+	return f(s)
+}
+
+var (
+	// LayoutTimestampParser is a TimestampParser that uses -date-format.
+	LayoutTimestampParser TimestampParser = TimestampParserFunc(parseLayoutTimestamp)
+
+	// DefaultTimestampParser is the TimestampParser that used by chop-csv.
+	DefaultTimestampParser = LayoutTimestampParser
+)
+
+// ParseTimestamp parses a timestamp in the date column with DefaultTimestampParser.
+func ParseTimestamp(s string) (time.Time, error) {
+	return DefaultTimestampParser.Parse(s)
+}
+
+// parseLayoutTimestamp parses a timestamp with -date-format.
+// It tries each format in dateFormats in order, and returns the error of the first format if all of them failed.
+//
+// If s can not be parsed as is, parseLayoutTimestamp tries again after NormalizeJapaneseDate.
+//
+// WARNING: this function reads commandline flags directly.
+func parseLayoutTimestamp(s string) (time.Time, error) {
+	t, err := parseTimestampFormats(s)
+	if err != nil {
+		if n := NormalizeJapaneseDate(s); n != s {
+			if t, e := parseTimestampFormats(n); e == nil {
+				return t, nil
+			}
+		}
+	}
+	return t, err
+}
+
+func parseTimestampFormats(s string) (time.Time, error) {
+	if len(dateFormats) == 0 {
+		return parseTimestamp(defaultDateFormat, s)
+	}
+
+	var firstErr error
+	for _, format := range dateFormats {
+		t, err := parseTimestamp(format, s)
+		if err == nil {
+			return t, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return time.Time{}, firstErr
+}
+
+func parseTimestamp(format, s string) (time.Time, error) {
+	switch format {
+	case "unix":
+		return parseUnixTime(s, time.Second)
+	case "unixmilli":
+		return parseUnixTime(s, time.Millisecond)
+	}
+
+	if timezone == nil {
+		return time.Parse(format, s)
+	}
+
+	t, err := time.ParseInLocation(format, s, timezone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.In(timezone), nil
+}
+
+// parseUnixTime parses an epoch time in the unit.
+func parseUnixTime(s string, unit time.Duration) (time.Time, error) {
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	perSec := int64(time.Second / unit)
+	t := time.Unix(n/perSec, n%perSec*int64(unit))
+
+	if timezone == nil {
+		return t.UTC(), nil
+	}
+	return t.In(timezone), nil
+}
+
+// timeRangeFormats is the list of formats for -since and -until.
+var timeRangeFormats = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// ParseTimeFlag parses a time in commandline flags like -since or -until.
+// The time without zone is interpreted in -timezone, or UTC if -timezone is not specified.
+func ParseTimeFlag(s string) (time.Time, error) {
+	loc := timezone
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	var firstErr error
+	for _, format := range timeRangeFormats {
+		t, err := time.ParseInLocation(format, s, loc)
+		if err == nil {
+			return t, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return time.Time{}, firstErr
+}
+
+// TimeRange is a half-open range of time, [Since, Until).
+// Zero value of Since or Until means unbounded.
+type TimeRange struct {
+	Since time.Time
+	Until time.Time
+}
+
+// Contains reports whether t is in the range.
+func (r TimeRange) Contains(t time.Time) bool {
+	if !r.Since.IsZero() && t.Before(r.Since) {
+		return false
+	}
+	if !r.Until.IsZero() && !t.Before(r.Until) {
+		return false
+	}
+	return true
+}
+
+// timeRange is the range of timestamps to write.
+var timeRange TimeRange
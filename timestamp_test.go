@@ -0,0 +1,192 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTimestamp_timezone(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatalf("failed to load timezone: %s", err)
+	}
+
+	tests := []struct {
+		Name     string
+		Format   string
+		Timezone *time.Location
+		Input    string
+		Output   string
+	}{
+		{"no zone in UTC", "2006-01-02 15:04", nil, "2023-04-01 01:00", "2023-04-01T01:00:00Z"},
+		{"no zone in timezone", "2006-01-02 15:04", tokyo, "2023-04-01 01:00", "2023-04-01T01:00:00+09:00"},
+		{"with zone", time.RFC3339, nil, "2023-03-31T23:00:00-05:00", "2023-03-31T23:00:00-05:00"},
+		{"with zone in timezone", time.RFC3339, tokyo, "2023-03-31T23:00:00Z", "2023-04-01T08:00:00+09:00"},
+	}
+
+	origFormats, origTimezone := dateFormats, timezone
+	defer func() { dateFormats, timezone = origFormats, origTimezone }()
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			dateFormats, timezone = stringList{tt.Format}, tt.Timezone
+
+			got, err := ParseTimestamp(tt.Input)
+			if err != nil {
+				t.Fatalf("failed to parse: %s", err)
+			}
+			if s := got.Format(time.RFC3339); s != tt.Output {
+				t.Errorf("expected %s but got %s", tt.Output, s)
+			}
+		})
+	}
+}
+
+func TestParseTimestamp_unix(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatalf("failed to load timezone: %s", err)
+	}
+
+	tests := []struct {
+		Name     string
+		Format   string
+		Timezone *time.Location
+		Input    string
+		Output   string
+	}{
+		{"unix", "unix", nil, "1680307200", "2023-04-01T00:00:00Z"},
+		{"unix with spaces", "unix", nil, " 1680307200 ", "2023-04-01T00:00:00Z"},
+		{"unix in timezone", "unix", tokyo, "1680307200", "2023-04-01T09:00:00+09:00"},
+		{"unixmilli", "unixmilli", nil, "1680307200123", "2023-04-01T00:00:00.123Z"},
+		{"negative unixmilli", "unixmilli", nil, "-1500", "1969-12-31T23:59:58.5Z"},
+	}
+
+	origFormats, origTimezone := dateFormats, timezone
+	defer func() { dateFormats, timezone = origFormats, origTimezone }()
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			dateFormats, timezone = stringList{tt.Format}, tt.Timezone
+
+			got, err := ParseTimestamp(tt.Input)
+			if err != nil {
+				t.Fatalf("failed to parse: %s", err)
+			}
+			if s := got.Format(time.RFC3339Nano); s != tt.Output {
+				t.Errorf("expected %s but got %s", tt.Output, s)
+			}
+		})
+	}
+
+	dateFormats, timezone = stringList{"unix"}, nil
+	if _, err := ParseTimestamp("2023-04-01"); err == nil {
+		t.Errorf("expected error for non-numeric input but got nil")
+	}
+}
+
+func TestParseTimestamp_fallback(t *testing.T) {
+	tests := []struct {
+		Name    string
+		Formats stringList
+		Input   string
+		Output  string
+		Error   string
+	}{
+		{"default", nil, "20230401", "2023-04-01T00:00:00Z", ""},
+		{"first format", stringList{"2006-01-02", "2006/01/02", "unix"}, "2023-04-01", "2023-04-01T00:00:00Z", ""},
+		{"second format", stringList{"2006-01-02", "2006/01/02", "unix"}, "2023/04/02", "2023-04-02T00:00:00Z", ""},
+		{"unix as fallback", stringList{"2006-01-02", "2006/01/02", "unix"}, "1680480000", "2023-04-03T00:00:00Z", ""},
+		{"error of first format", stringList{"2006-01-02", "2006/01/02"}, "20230401", "", `parsing time "20230401" as "2006-01-02"`},
+	}
+
+	origFormats, origTimezone := dateFormats, timezone
+	defer func() { dateFormats, timezone = origFormats, origTimezone }()
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			dateFormats, timezone = tt.Formats, nil
+
+			got, err := ParseTimestamp(tt.Input)
+			if tt.Error != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.Error) {
+					t.Fatalf("expected error %q but got %v", tt.Error, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to parse: %s", err)
+			}
+			if s := got.Format(time.RFC3339); s != tt.Output {
+				t.Errorf("expected %s but got %s", tt.Output, s)
+			}
+		})
+	}
+}
+
+func TestParseTimeFlag(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatalf("failed to load timezone: %s", err)
+	}
+
+	tests := []struct {
+		Input    string
+		Timezone *time.Location
+		Output   string
+	}{
+		{"2023-04-01T09:00:00+09:00", nil, "2023-04-01T09:00:00+09:00"},
+		{"2023-04-01T09:00:00", nil, "2023-04-01T09:00:00Z"},
+		{"2023-04-01 09:00:00", tokyo, "2023-04-01T09:00:00+09:00"},
+		{"2023-04-01", nil, "2023-04-01T00:00:00Z"},
+		{"2023-04-01", tokyo, "2023-04-01T00:00:00+09:00"},
+	}
+
+	orig := timezone
+	defer func() { timezone = orig }()
+
+	for _, tt := range tests {
+		timezone = tt.Timezone
+
+		got, err := ParseTimeFlag(tt.Input)
+		if err != nil {
+			t.Errorf("%q: failed to parse: %s", tt.Input, err)
+			continue
+		}
+		if s := got.Format(time.RFC3339); s != tt.Output {
+			t.Errorf("%q: expected %s but got %s", tt.Input, tt.Output, s)
+		}
+	}
+
+	timezone = nil
+	if _, err := ParseTimeFlag("2023/04/01"); err == nil {
+		t.Errorf("expected error but got nil")
+	}
+}
+
+func TestTimeRange_Contains(t *testing.T) {
+	since := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2023, 4, 2, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		Name   string
+		Range  TimeRange
+		Time   time.Time
+		Output bool
+	}{
+		{"unbounded", TimeRange{}, since, true},
+		{"before since", TimeRange{Since: since}, since.Add(-time.Second), false},
+		{"equal to since", TimeRange{Since: since}, since, true},
+		{"before until", TimeRange{Until: until}, until.Add(-time.Second), true},
+		{"equal to until", TimeRange{Until: until}, until, false},
+		{"in range", TimeRange{Since: since, Until: until}, since.Add(12 * time.Hour), true},
+		{"in other zone", TimeRange{Since: since, Until: until}, time.Date(2023, 4, 2, 8, 0, 0, 0, time.FixedZone("JST", 9*60*60)), true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.Range.Contains(tt.Time); got != tt.Output {
+			t.Errorf("%s: expected %v but got %v", tt.Name, tt.Output, got)
+		}
+	}
+}
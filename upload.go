@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto/sha256"
+	"hash"
+	"sync"
+)
+
+// uploadPartSize is the size of a part of multipart upload.
+const uploadPartSize = 16 * 1024 * 1024
+
+// uploadSlots limits the number of parts that uploading at the same time, for -s3-concurrency.
+var uploadSlots chan struct{}
+
+// multipartAPI is the API of a storage to upload an object part by part.
+type multipartAPI interface {
+	// Put uploads a small object at once.
+	Put(data []byte) error
+
+	// Begin starts a multipart upload, and returns the upload ID.
+	Begin() (string, error)
+
+	// UploadPart uploads the n-th part, and returns the ID of the part like ETag. n starts from 1.
+	// It is called concurrently.
+	UploadPart(uploadID string, n int, data []byte) (string, error)
+
+	// Complete makes the object from the uploaded parts.
+	Complete(uploadID string, parts []string) error
+
+	// Abort cancels the multipart upload.
+	Abort(uploadID string)
+}
+
+// multipartObject is a RemoteObject that uploads with multipartAPI.
+//
+// The written data is uploaded part by part in the background, and the object becomes visible when Complete is called.
+// Close does not complete the upload, so that the rows can be appended later in this run.
+type multipartObject struct {
+	api      multipartAPI
+	url      string
+	buf      []byte
+	size     int64
+	hash     hash.Hash
+	uploadID string
+
+	mu    sync.Mutex
+	wg    sync.WaitGroup
+	parts []string
+	err   error
+}
+
+func newMultipartObject(api multipartAPI, url string) *multipartObject {
+	return &multipartObject{api: api, url: url, hash: sha256.New()}
+}
+
+func (o *multipartObject) Write(p []byte) (int, error) {
+	if err := o.error(); err != nil {
+		return 0, err
+	}
+
+	o.buf = append(o.buf, p...)
+	o.size += int64(len(p))
+	o.hash.Write(p)
+	for len(o.buf) >= uploadPartSize {
+		if err := o.uploadPart(o.buf[:uploadPartSize]); err != nil {
+			return 0, err
+		}
+		o.buf = append([]byte{}, o.buf[uploadPartSize:]...)
+	}
+	return len(p), nil
+}
+
+func (o *multipartObject) error() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.err
+}
+
+// uploadPart starts uploading data as the next part in the background.
+func (o *multipartObject) uploadPart(data []byte) error {
+	if o.uploadID == "" {
+		var id string
+		err := retryOutput("start uploading", o.url, func() (err error) {
+			id, err = o.api.Begin()
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		o.uploadID = id
+	}
+
+	o.mu.Lock()
+	n := len(o.parts) + 1
+	o.parts = append(o.parts, "")
+	o.mu.Unlock()
+
+	o.wg.Add(1)
+	uploadSlots <- struct{}{}
+	go func() {
+		defer func() {
+			<-uploadSlots
+			o.wg.Done()
+		}()
+
+		var id string
+		err := retryOutput("upload part of", o.url, func() (err error) {
+			id, err = o.api.UploadPart(o.uploadID, n, data)
+			return err
+		})
+
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		if err != nil {
+			if o.err == nil {
+				o.err = err
+			}
+			return
+		}
+		o.parts[n-1] = id
+	}()
+	return nil
+}
+
+// Complete uploads the rest of data, and makes the object visible.
+func (o *multipartObject) Complete() error {
+	defer func() {
+		o.buf = nil
+	}()
+
+	if o.uploadID == "" {
+		return retryOutput("upload", o.url, func() error { return o.api.Put(o.buf) })
+	}
+
+	var err error
+	if len(o.buf) > 0 {
+		err = o.uploadPart(o.buf)
+	}
+	o.wg.Wait()
+	if err == nil {
+		err = o.err
+	}
+	if err != nil {
+		o.api.Abort(o.uploadID)
+		return err
+	}
+
+	return retryOutput("complete uploading", o.url, func() error { return o.api.Complete(o.uploadID, o.parts) })
+}
+
+// Abort cancels the multipart upload after the parts in progress finished, so that no part is left on the storage.
+// It does nothing if no part was uploaded yet, because the object is uploaded at once by Complete in that case.
+func (o *multipartObject) Abort() {
+	o.wg.Wait()
+	if o.uploadID != "" {
+		o.api.Abort(o.uploadID)
+	}
+	o.buf = nil
+}
+
+// Close does nothing. Use Complete to finish uploading.
+func (o *multipartObject) Close() error {
+	return o.error()
+}
+
+func (o *multipartObject) Name() string {
+	return o.url
+}
+
+func (o *multipartObject) Size() (int64, error) {
+	return o.size, nil
+}
+
+func (o *multipartObject) SHA256() []byte {
+	return o.hash.Sum(nil)
+}
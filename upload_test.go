@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// fakeMultipartAPI is a multipartAPI that records the calls.
+type fakeMultipartAPI struct {
+	mu      sync.Mutex
+	calls   []string
+	data    []byte
+	failing bool // fail all UploadPart
+}
+
+func (a *fakeMultipartAPI) record(call string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.calls = append(a.calls, call)
+}
+
+func (a *fakeMultipartAPI) Put(data []byte) error {
+	a.record(fmt.Sprintf("Put(%d)", len(data)))
+	a.data = data
+	return nil
+}
+
+func (a *fakeMultipartAPI) Begin() (string, error) {
+	a.record("Begin")
+	return "upload-1", nil
+}
+
+func (a *fakeMultipartAPI) UploadPart(uploadID string, n int, data []byte) (string, error) {
+	a.record(fmt.Sprintf("UploadPart(%s, %d, %d)", uploadID, n, len(data)))
+	if a.failing {
+		return "", errors.New("upload failed")
+	}
+	return fmt.Sprintf("part-%d", n), nil
+}
+
+func (a *fakeMultipartAPI) Complete(uploadID string, parts []string) error {
+	a.record(fmt.Sprintf("Complete(%s, %v)", uploadID, parts))
+	return nil
+}
+
+func (a *fakeMultipartAPI) Abort(uploadID string) {
+	a.record(fmt.Sprintf("Abort(%s)", uploadID))
+}
+
+func TestMultipartObject(t *testing.T) {
+	orig := uploadSlots
+	uploadSlots = make(chan struct{}, 2)
+	defer func() { uploadSlots = orig }()
+
+	origRetries := *outputRetries
+	*outputRetries = 0
+	defer func() { *outputRetries = origRetries }()
+
+	tests := []struct {
+		Name    string
+		Size    int
+		Failing bool
+		Calls   []string
+	}{
+		{
+			"small",
+			10,
+			false,
+			[]string{"Put(10)"},
+		},
+		{
+			"multipart",
+			2*uploadPartSize + 10,
+			false,
+			[]string{
+				"Begin",
+				"Complete(upload-1, [part-1 part-2 part-3])",
+				fmt.Sprintf("UploadPart(upload-1, 1, %d)", uploadPartSize),
+				fmt.Sprintf("UploadPart(upload-1, 2, %d)", uploadPartSize),
+				"UploadPart(upload-1, 3, 10)",
+			},
+		},
+		{
+			"failed",
+			uploadPartSize + 10,
+			true,
+			[]string{
+				"Abort(upload-1)",
+				"Begin",
+				fmt.Sprintf("UploadPart(upload-1, 1, %d)", uploadPartSize),
+				"UploadPart(upload-1, 2, 10)",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			api := &fakeMultipartAPI{failing: tt.Failing}
+			o := newMultipartObject(api, "s3://bucket/a.csv.bz2")
+
+			data := bytes.Repeat([]byte("x"), tt.Size)
+			if _, err := o.Write(data); err != nil {
+				t.Fatalf("failed to write: %s", err)
+			}
+
+			err := o.Complete()
+			if tt.Failing && err == nil {
+				t.Errorf("expected error but got nil")
+			} else if !tt.Failing && err != nil {
+				t.Errorf("failed to complete: %s", err)
+			}
+
+			// The parts are uploaded concurrently, so the order of calls is not stable.
+			sort.Strings(api.calls)
+			if !reflect.DeepEqual(api.calls, tt.Calls) {
+				t.Errorf("unexpected calls\nexpected: %q\n but got: %q", tt.Calls, api.calls)
+			}
+			if size, _ := o.Size(); size != int64(tt.Size) {
+				t.Errorf("expected size %d but got %d", tt.Size, size)
+			}
+			if sum := sha256.Sum256(data); !bytes.Equal(o.SHA256(), sum[:]) {
+				t.Errorf("expected SHA-256 %x but got %x", sum, o.SHA256())
+			}
+		})
+	}
+}
+
+func TestDiscardUploads(t *testing.T) {
+	orig := uploadSlots
+	uploadSlots = make(chan struct{}, 2)
+	defer func() { uploadSlots = orig }()
+
+	origUploads := pendingUploads
+	defer func() { pendingUploads = origUploads }()
+
+	started := &fakeMultipartAPI{}
+	small := &fakeMultipartAPI{}
+	other := &fakeMultipartAPI{}
+	pendingUploads = map[string]RemoteObject{
+		"s3://bucket/a.csv.bz2":     newMultipartObject(started, "s3://bucket/a.csv.bz2"),
+		"s3://bucket/a.idx.csv.bz2": newMultipartObject(small, "s3://bucket/a.idx.csv.bz2"),
+		"s3://bucket/b.csv.bz2":     newMultipartObject(other, "s3://bucket/b.csv.bz2"),
+	}
+	pendingUploads["s3://bucket/a.csv.bz2"].Write(bytes.Repeat([]byte("x"), uploadPartSize+10))
+	pendingUploads["s3://bucket/a.idx.csv.bz2"].Write([]byte("small"))
+
+	discardUploads(func(path string) bool { return path != "s3://bucket/b.csv.bz2" })
+
+	// The upload that already started is aborted, and the small one was never uploaded.
+	want := []string{"Abort(upload-1)", "Begin", fmt.Sprintf("UploadPart(upload-1, 1, %d)", uploadPartSize)}
+	sort.Strings(started.calls)
+	if !reflect.DeepEqual(started.calls, want) {
+		t.Errorf("unexpected calls\nexpected: %q\n but got: %q", want, started.calls)
+	}
+	if len(small.calls) != 0 || len(other.calls) != 0 {
+		t.Errorf("expected no calls but got %q and %q", small.calls, other.calls)
+	}
+	if _, ok := pendingUploads["s3://bucket/b.csv.bz2"]; !ok || len(pendingUploads) != 1 {
+		t.Errorf("expected only the unmatched upload is kept but got %v", pendingUploads)
+	}
+
+	pendingUploads["s3://bucket/b.csv.bz2"].Write(bytes.Repeat([]byte("x"), uploadPartSize))
+	abortUploads()
+	if len(pendingUploads) != 0 {
+		t.Errorf("expected all uploads are aborted but got %v", pendingUploads)
+	}
+	if n := len(other.calls); n == 0 || other.calls[n-1] != "Abort(upload-1)" {
+		t.Errorf("expected the upload is aborted but got %q", other.calls)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+)
+
+// RoundTripProblem is a character that can not be converted back into the original bytes.
+type RoundTripProblem struct {
+	Original  []byte // the bytes in the input file
+	Decoded   rune   // the character that decoded from Original
+	Reencoded []byte // the bytes that encoded from Decoded, or nil if Decoded can not be encoded
+	FirstLine int    // the line number that the problem found first
+	Count     int    // the number of occurrences
+}
+
+func (p RoundTripProblem) String() string {
+	desc := fmt.Sprintf("0x%X -> U+%04X", p.Original, p.Decoded)
+	if unicode.Is(unicode.Co, p.Decoded) {
+		desc += " (private use)"
+	}
+	if p.Reencoded == nil {
+		desc += " -> can not encode"
+	} else {
+		desc += fmt.Sprintf(" -> 0x%X", p.Reencoded)
+	}
+	return fmt.Sprintf("%s: found %d times, first at line %d", desc, p.Count, p.FirstLine)
+}
+
+// VerifyRoundTrip decodes r with enc, encodes it again, and reports the characters that the result is different from the original.
+//
+// The characters in the private use area (gaiji) are reported even if they can be converted back, because their meaning depends on the vendor.
+func VerifyRoundTrip(r io.Reader, enc encoding.Encoding) ([]RoundTripProblem, error) {
+	found := make(map[string]*RoundTripProblem)
+	dec := enc.NewDecoder()
+	encoder := enc.NewEncoder()
+
+	report := func(line int, original []byte, decoded rune, reencoded []byte) {
+		key := string(original)
+		if p, ok := found[key]; ok {
+			p.Count++
+		} else {
+			found[key] = &RoundTripProblem{
+				Original:  append([]byte{}, original...),
+				Decoded:   decoded,
+				Reencoded: reencoded,
+				FirstLine: line,
+				Count:     1,
+			}
+		}
+	}
+
+	br := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		original, err := br.ReadBytes('\n')
+		if len(original) == 0 && err == io.EOF {
+			break
+		} else if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		decoded, derr := dec.Bytes(original)
+		reencoded, eerr := encoder.Bytes(decoded)
+		if derr == nil && eerr == nil && bytes.Equal(original, reencoded) && !hasPrivateUse(decoded) {
+			continue
+		}
+
+		// Find the problems character by character.
+		offset := 0
+		for len(decoded) > 0 {
+			c, size := utf8.DecodeRune(decoded)
+			decoded = decoded[size:]
+
+			e, err := encoder.Bytes([]byte(string(c)))
+			if err != nil {
+				e = nil
+			}
+
+			if e != nil && bytes.HasPrefix(original[offset:], e) {
+				if unicode.Is(unicode.Co, c) {
+					report(line, e, c, e)
+				}
+				offset += len(e)
+				continue
+			}
+
+			// Find how many bytes in the original became c.
+			// The longest one is the answer, because an incomplete sequence is also decoded as U+FFFD.
+			n := 1
+			for k := 1; k <= 4 && offset+k <= len(original); k++ {
+				if d, err := dec.Bytes(original[offset : offset+k]); err == nil && string(d) == string(c) {
+					n = k
+				}
+			}
+			if offset+n > len(original) {
+				n = len(original) - offset
+			}
+			report(line, original[offset:offset+n], c, e)
+			offset += n
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	ps := make([]RoundTripProblem, 0, len(found))
+	for _, p := range found {
+		ps = append(ps, *p)
+	}
+	sort.Slice(ps, func(i, j int) bool {
+		return ps[i].FirstLine < ps[j].FirstLine || (ps[i].FirstLine == ps[j].FirstLine && bytes.Compare(ps[i].Original, ps[j].Original) < 0)
+	})
+	return ps, nil
+}
+
+func hasPrivateUse(s []byte) bool {
+	for _, c := range string(s) {
+		if unicode.Is(unicode.Co, c) {
+			return true
+		}
+	}
+	return false
+}
+
+// runVerify runs verify subcommand.
+func runVerify(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Println("Usage: chop-csv verify [OPTIONS] FILE...")
+		fmt.Println()
+		fmt.Println("Check if FILEs can be decoded with -encoding and encoded back into the original bytes without any loss.")
+		fmt.Println("Nothing is written into the output directory.")
+	}
+	parseCommand(fs, args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(ExitUsage)
+	}
+
+	failed := false
+	for _, path := range fs.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+			failed = true
+			continue
+		}
+		ps, err := VerifyRoundTrip(f, inputEncoding)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+			failed = true
+			continue
+		}
+
+		if len(ps) == 0 {
+			fmt.Printf("%s: ok\n", path)
+			continue
+		}
+
+		failed = true
+		fmt.Printf("%s: %d characters are not lossless\n", path, len(ps))
+		for _, p := range ps {
+			fmt.Printf("  %s\n", p)
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
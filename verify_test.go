@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/japanese"
+)
+
+func TestVerifyRoundTrip(t *testing.T) {
+	input := strings.Join([]string{
+		"20230401,\x93\xfa\x96\x7b\x8c\xea", // no problem
+		"20230401,\x87\x90",                 // NEC special character that encoded into the other code
+		"20230401,\xf0\x40\x87\x90",         // user-defined character that can not be decoded
+	}, "\n")
+
+	ps, err := VerifyRoundTrip(strings.NewReader(input), japanese.ShiftJIS)
+	if err != nil {
+		t.Fatalf("failed to verify: %s", err)
+	}
+	if len(ps) != 2 {
+		t.Fatalf("expected 2 problems but got %d: %v", len(ps), ps)
+	}
+
+	if p := ps[0]; !bytes.Equal(p.Original, []byte{0x87, 0x90}) || p.Decoded != '≒' || !bytes.Equal(p.Reencoded, []byte{0x81, 0xe0}) || p.FirstLine != 2 || p.Count != 2 {
+		t.Errorf("unexpected problem: %s", p)
+	}
+	if p := ps[1]; !bytes.Equal(p.Original, []byte{0xf0, 0x40}) || p.Decoded != utf8.RuneError || p.Reencoded != nil || p.FirstLine != 3 || p.Count != 1 {
+		t.Errorf("unexpected problem: %s", p)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// inputWalker walks an input directory for walkInputs.
+type inputWalker struct {
+	fn      filepath.WalkFunc
+	visited []fs.FileInfo // the directories already walked, to detect loops of symbolic links
+	archive fs.FileInfo   // the directory of -archive-dir, or nil
+}
+
+// walkInputs walks the directory in lexical order like filepath.Walk,
+// but it follows symbolic links if -follow-symlinks, and does not descend deeper than -max-depth.
+//
+// A directory that already walked through another symbolic link is skipped, so that a loop of links does not walk forever.
+// The directory of -archive-dir is skipped too, so that the archived files are not chopped again.
+//
+// WARNING: this function reads commandline flags directly.
+func walkInputs(root string, fn filepath.WalkFunc) error {
+	info, err := os.Stat(root)
+	if err != nil {
+		return fn(root, nil, err)
+	}
+
+	w := &inputWalker{fn: fn}
+	if *archiveDir != "" {
+		w.archive, _ = os.Stat(*archiveDir)
+	}
+	err = w.walk(root, info, 0)
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+func (w *inputWalker) walk(path string, info fs.FileInfo, depth int) error {
+	if !info.IsDir() {
+		return w.fn(path, info, nil)
+	}
+
+	if w.archive != nil && os.SameFile(w.archive, info) {
+		return nil
+	}
+
+	if *followSymlinks {
+		for _, v := range w.visited {
+			if os.SameFile(v, info) {
+				logger.With("input", path).Warnf("skip %s because already searched, maybe a loop of symbolic links", path)
+				return nil
+			}
+		}
+		w.visited = append(w.visited, info)
+	}
+
+	if err := w.fn(path, info, nil); err != nil {
+		return err
+	}
+	if *maxDepth > 0 && depth >= *maxDepth {
+		return nil
+	}
+
+	names, err := readDirNames(path)
+	if err != nil {
+		return w.fn(path, info, err)
+	}
+
+	for _, name := range names {
+		p := filepath.Join(path, name)
+
+		fi, err := os.Lstat(p)
+		if err != nil {
+			if err := w.fn(p, fi, err); err != nil && err != filepath.SkipDir {
+				return err
+			}
+			continue
+		}
+
+		if fi.Mode()&fs.ModeSymlink != 0 && *followSymlinks {
+			target, err := os.Stat(p)
+			if err != nil {
+				logger.With("input", p, "error", err).Warnf("skip broken symbolic link: %s", err)
+				continue
+			}
+			fi = target
+		}
+
+		if err := w.walk(p, fi, depth+1); err == filepath.SkipDir {
+			if !fi.IsDir() {
+				return nil
+			}
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readDirNames reads the names in the directory in sorted order.
+func readDirNames(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWalkInputs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.csv", "sub/b.csv", "sub/deep/c.csv", "target/d.csv"} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("failed to prepare directory: %s", err)
+		}
+		if err := os.WriteFile(p, []byte("20230401,x\n"), 0644); err != nil {
+			t.Fatalf("failed to prepare input: %s", err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(dir, "target"), filepath.Join(dir, "sub", "link")); err != nil {
+		t.Skipf("failed to make symbolic link: %s", err)
+	}
+	if err := os.Symlink(dir, filepath.Join(dir, "target", "loop")); err != nil {
+		t.Skipf("failed to make symbolic link: %s", err)
+	}
+
+	tests := []struct {
+		Name           string
+		FollowSymlinks bool
+		MaxDepth       int
+		Output         []string
+	}{
+		{"default", false, 0, []string{"a.csv", "sub/b.csv", "sub/deep/c.csv", "target/d.csv"}},
+		{"max-depth", false, 2, []string{"a.csv", "sub/b.csv", "target/d.csv"}},
+		{"follow-symlinks", true, 0, []string{"a.csv", "sub/b.csv", "sub/deep/c.csv", "sub/link/d.csv"}},
+		{"follow-symlinks and max-depth", true, 1, []string{"a.csv"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			origFollow, origDepth := *followSymlinks, *maxDepth
+			*followSymlinks, *maxDepth = tt.FollowSymlinks, tt.MaxDepth
+			defer func() { *followSymlinks, *maxDepth = origFollow, origDepth }()
+
+			var got []string
+			err := walkInputs(dir, func(path string, info fs.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if info.Mode().IsRegular() {
+					got = append(got, relativeInputPath(dir, path))
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("failed to walk: %s", err)
+			}
+			if !reflect.DeepEqual(got, tt.Output) {
+				t.Errorf("expected %q but got %q", tt.Output, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/width"
+)
+
+// japaneseEras is the list of Japanese eras with the Gregorian year of the first year.
+var japaneseEras = []struct {
+	Name  string
+	Abbr  string
+	Start int
+}{
+	{"令和", "R", 2019},
+	{"平成", "H", 1989},
+	{"昭和", "S", 1926},
+	{"大正", "T", 1912},
+	{"明治", "M", 1868},
+}
+
+// NormalizeJapaneseDate converts full-width characters into half-width, and the year in Japanese era (wareki) into Gregorian.
+//
+// For example, "令和５年４月１日" becomes "2023年4月1日", and "H31.04.30" becomes "2019.04.30".
+func NormalizeJapaneseDate(s string) string {
+	s = strings.TrimSpace(width.Fold.String(s))
+
+	for _, era := range japaneseEras {
+		var rest string
+		if strings.HasPrefix(s, era.Name) {
+			rest = s[len(era.Name):]
+		} else if strings.HasPrefix(s, era.Abbr) && len(s) > len(era.Abbr) && isDigit(s[len(era.Abbr)]) {
+			rest = s[len(era.Abbr):]
+		} else {
+			continue
+		}
+
+		year := 0
+		if strings.HasPrefix(rest, "元") {
+			year = 1
+			rest = rest[len("元"):]
+		} else {
+			i := 0
+			for i < len(rest) && isDigit(rest[i]) {
+				i++
+			}
+			year, _ = strconv.Atoi(rest[:i])
+			rest = rest[i:]
+		}
+		if year == 0 {
+			return s
+		}
+
+		return strconv.Itoa(era.Start+year-1) + rest
+	}
+
+	return s
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
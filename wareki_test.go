@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestNormalizeJapaneseDate(t *testing.T) {
+	tests := []struct {
+		Input  string
+		Output string
+	}{
+		{"令和５年４月１日", "2023年4月1日"},
+		{"令和元年5月1日", "2019年5月1日"},
+		{"平成31年4月30日", "2019年4月30日"},
+		{"H31.04.30", "2019.04.30"},
+		{"S64.01.07", "1989.01.07"},
+		{"ｒ5/4/1", "r5/4/1"},
+		{"２０２３－０４－０１", "2023-04-01"},
+		{"　2023/04/01　", "2023/04/01"},
+		{"Hello", "Hello"},
+		{"令和", "令和"},
+		{"R0.04.01", "R0.04.01"},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeJapaneseDate(tt.Input); got != tt.Output {
+			t.Errorf("NormalizeJapaneseDate(%q): expected %q but got %q", tt.Input, tt.Output, got)
+		}
+	}
+}
+
+func TestParseTimestamp_wareki(t *testing.T) {
+	origFormats, origTimezone := dateFormats, timezone
+	dateFormats, timezone = stringList{"2006年1月2日", "2006.01.02"}, nil
+	defer func() { dateFormats, timezone = origFormats, origTimezone }()
+
+	tests := []struct {
+		Input  string
+		Output string
+	}{
+		{"2023年4月1日", "2023-04-01"},
+		{"令和５年４月１日", "2023-04-01"},
+		{"平成元年1月8日", "1989-01-08"},
+		{"H31.04.30", "2019-04-30"},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseTimestamp(tt.Input)
+		if err != nil {
+			t.Errorf("%q: failed to parse: %s", tt.Input, err)
+			continue
+		}
+		if s := got.Format("2006-01-02"); s != tt.Output {
+			t.Errorf("%q: expected %s but got %s", tt.Input, tt.Output, s)
+		}
+	}
+
+	if _, err := ParseTimestamp("令和X年"); err == nil {
+		t.Errorf("expected error but got nil")
+	}
+}
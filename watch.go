@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// watchedFile is the state of a file in the watched directory.
+type watchedFile struct {
+	size    int64
+	modTime int64 // in nanoseconds
+}
+
+// Watcher finds new or updated CSV files in a directory by polling.
+//
+// A file is ready to chop after its size and modification time are unchanged between two scans,
+// so that the files still being uploaded or copied are not chopped.
+type Watcher struct {
+	dir       string
+	seen      map[string]watchedFile // the state in the last scan
+	processed map[string]watchedFile // the state when chopped
+}
+
+// NewWatcher makes a new Watcher for the directory.
+func NewWatcher(dir string) *Watcher {
+	return &Watcher{
+		dir:       dir,
+		seen:      make(map[string]watchedFile),
+		processed: make(map[string]watchedFile),
+	}
+}
+
+// Scan walks the directory, and returns the files that ready to chop in sorted order.
+func (w *Watcher) Scan() ([]string, error) {
+	seen := make(map[string]watchedFile)
+	var ready []string
+
+	err := filepath.Walk(w.dir, func(path string, info fs.FileInfo, err error) error {
+		if os.IsPermission(err) || os.IsNotExist(err) {
+			// The file may be removed or not readable yet while uploading, so try again in the next scan.
+			return nil
+		} else if err != nil {
+			return err
+		}
+		rel := relativeInputPath(w.dir, path)
+		if info.IsDir() {
+			if path != w.dir && isExcluded(rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !isInputFile(rel) {
+			return nil
+		}
+
+		cur := watchedFile{info.Size(), info.ModTime().UnixNano()}
+		seen[path] = cur
+		if prev, ok := w.seen[path]; !ok || prev != cur {
+			return nil
+		}
+		if done, ok := w.processed[path]; ok && done == cur {
+			return nil
+		}
+		ready = append(ready, path)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	w.seen = seen
+	for path := range w.processed {
+		if _, ok := seen[path]; !ok {
+			delete(w.processed, path)
+		}
+	}
+
+	sort.Strings(ready)
+	return ready, nil
+}
+
+// Done records that the file was chopped, so that it is not chopped again until updated.
+func (w *Watcher) Done(path string) {
+	w.processed[path] = w.seen[path]
+}
+
+// Watch keeps chopping the new or updated CSV files in the directory.
+// The directory is scanned every interval.
+//
+// This function never returns until ctx is canceled.
+//
+// WARNING: this method can stop program with log.Fatal.
+func Watch(ctx context.Context, dir string, interval time.Duration) {
+	logger.With("input", dir).Infof("watch input directory: %s", dir)
+
+	w := NewWatcher(dir)
+	for ctx.Err() == nil {
+		paths, err := w.Scan()
+		if err != nil {
+			fatalf(ExitInputError, "failed to watch directory: %s", err)
+		}
+
+		for _, path := range paths {
+			info, err := os.Stat(path)
+			if err != nil {
+				fatalf(ExitInputError, "failed to get file information: %s", err)
+			}
+			ChopLocal(ctx, path, info)
+			w.Done(path)
+		}
+
+		if len(paths) > 0 {
+			if err := inputState.Save(); err != nil {
+				fatalf(ExitError, "failed to save state: %s", err)
+			}
+			if err := history.Update(); err != nil {
+				logger.With("error", err).Warnf("failed to record history: %s", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.csv")
+	if err := os.WriteFile(path, []byte("20230401,a\n"), 0644); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "ignored.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+
+	w := NewWatcher(dir)
+	scan := func(want []string) {
+		t.Helper()
+		got, err := w.Scan()
+		if err != nil {
+			t.Fatalf("failed to scan: %s", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("expected %q but got %q", want, got)
+		}
+	}
+
+	// A new file is ready after it is unchanged between two scans.
+	scan(nil)
+	scan([]string{path})
+	w.Done(path)
+	scan(nil)
+
+	// An updated file is chopped again after it becomes stable.
+	if err := os.WriteFile(path, []byte("20230401,a\n20230401,b\n"), 0644); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+	scan(nil)
+	scan([]string{path})
+	w.Done(path)
+	scan(nil)
+}
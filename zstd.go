@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dsnet/compress/bzip2"
+	"github.com/klauspost/compress/dict"
+	"github.com/klauspost/compress/zstd"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// zstdDictFile is the name of the dictionary file of -zstd-dict in the output directory.
+const zstdDictFile = "_zstd.dict"
+
+// zstdDictionary is the dictionary of -zstd-dict that loaded or trained, or nil.
+var zstdDictionary []byte
+
+// csvExtension returns the extension of the output files of -format=csv, that is ".csv.zst" if -zstd-dict is set, otherwise ".csv.bz2".
+//
+// WARNING: this function reads commandline flags directly.
+func csvExtension() string {
+	if *zstdDict {
+		return ".csv.zst"
+	}
+	return ".csv.bz2"
+}
+
+// isCSVFile reports whether path is an output file of -format=csv, that compressed by bzip2 or zstd.
+func isCSVFile(path string) bool {
+	return strings.HasSuffix(path, ".csv.bz2") || strings.HasSuffix(path, ".csv.zst")
+}
+
+// streamCompressor is a compressor that can write concatenated streams into a file, like bzip2 and zstd.
+type streamCompressor interface {
+	io.WriteCloser
+
+	// Reset starts a new stream that written into w.
+	Reset(w io.Writer) error
+}
+
+// zstdCompressor is a streamCompressor of zstd.
+// Each stream is a zstd frame, so that a frame can be decompressed from the middle of the file by the seek index.
+type zstdCompressor struct {
+	*zstd.Encoder
+}
+
+func (z zstdCompressor) Reset(w io.Writer) error {
+	z.Encoder.Reset(w)
+	return nil
+}
+
+// zstdMinLevel and zstdMaxLevel are the range of -compression-level for -zstd-dict, that is the same as zstd command.
+const (
+	zstdMinLevel = 1
+	zstdMaxLevel = 22
+)
+
+// zstdLevel returns the compression level of zstd by -compression-level.
+//
+// WARNING: this function reads commandline flags directly.
+func zstdLevel() zstd.EncoderLevel {
+	if *compressLevel == 0 {
+		return zstd.SpeedDefault
+	}
+	return zstd.EncoderLevelFromZstd(*compressLevel)
+}
+
+// newCompressor makes a streamCompressor for -format=csv, that is zstd with the dictionary if -zstd-dict is set, otherwise bzip2.
+//
+// WARNING: this function reads commandline flags directly.
+func newCompressor(w io.Writer) (streamCompressor, error) {
+	if !*zstdDict {
+		return bzip2.NewWriter(w, &bzip2.WriterConfig{
+			Level: bzip2Level(),
+		})
+	}
+	if zstdDictionary == nil {
+		return nil, errors.New("the dictionary of -zstd-dict is not loaded")
+	}
+
+	// Many files are open at once, so the encoder works in the goroutine of the caller with less memory.
+	e, err := zstd.NewWriter(w, zstd.WithEncoderDict(zstdDictionary), zstd.WithEncoderLevel(zstdLevel()), zstd.WithEncoderConcurrency(1), zstd.WithLowerEncoderMem(true))
+	if err != nil {
+		return nil, err
+	}
+	return zstdCompressor{e}, nil
+}
+
+// newDecompressor makes a reader that decompresses the output file of -format=csv at path.
+// The file compressed by zstd is decompressed with the dictionary that found by findZstdDict.
+func newDecompressor(path string, r io.Reader) (io.Reader, error) {
+	if !strings.HasSuffix(path, ".zst") {
+		return bzip2.NewReader(r, nil)
+	}
+
+	d, err := findZstdDict(path)
+	if err != nil {
+		return nil, err
+	}
+	// The concurrency 1 makes the decoder synchronous, so it does not need to be closed.
+	return zstd.NewReader(r, zstd.WithDecoderDicts(d), zstd.WithDecoderConcurrency(1))
+}
+
+// findZstdDict finds the dictionary for the output file at path, from the directory of path and its parents.
+func findZstdDict(path string) ([]byte, error) {
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	for {
+		d, err := ReadZstdDict(dir)
+		if err == nil || !os.IsNotExist(err) {
+			return d, err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, errors.New("dictionary of zstd not found: " + zstdDictFile)
+		}
+		dir = parent
+	}
+}
+
+// ReadZstdDict reads the dictionary of -zstd-dict in the output directory dir.
+func ReadZstdDict(dir string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(dir, zstdDictFile))
+}
+
+// hasZstdDict reports whether the local output directory dir has the dictionary of -zstd-dict.
+func hasZstdDict(dir string) bool {
+	if isRemoteURL(dir) {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(dir, zstdDictFile))
+	return err == nil
+}
+
+// WriteZstdDict writes zstdDictionary into all output directories.
+//
+// WARNING: this function reads commandline flags directly.
+func WriteZstdDict() error {
+	for _, dir := range outputDirs() {
+		if err := makeOutputDir(dir); err != nil {
+			return err
+		}
+		if err := writeOutput(outputPath(dir, zstdDictFile), zstdDictionary); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// zstdSampleRows is the number of rows in a sample to train the dictionary of -zstd-dict.
+// A sample is like a small output file, and fewer samples make the training faster.
+const zstdSampleRows = 32
+
+// sampleRows reads the first rows of the input files, and returns them in CSV of the output encoding, like in the output files.
+// Each sample has zstdSampleRows rows, except the last one of each file.
+// The URLs and the inputs that can be read only once like a named pipe are not sampled.
+//
+// WARNING: this function reads commandline flags directly.
+func sampleRows(inputs []string, rows int) (samples [][]byte, n int, err error) {
+	var paths []string
+	for _, input := range inputs {
+		if isInputURL(input) {
+			continue
+		}
+		err := walkInputs(input, func(path string, info fs.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.Mode().IsRegular() && (path == input || isInputFile(relativeInputPath(input, path))) {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, path := range paths {
+		r, err := Open(path)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		var enc transform.Transformer = transform.Nop
+		if outputEncoding != unicode.UTF8 {
+			enc = outputEncoding.NewEncoder()
+		}
+		e := transform.NewWriter(&buf, enc)
+		c := NewOutputCSVWriter(e)
+
+		for n < rows {
+			row, err := r.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				r.Close()
+				return nil, 0, err
+			}
+			c.Write(row)
+			n++
+			if n%zstdSampleRows == 0 {
+				if samples, err = flushSample(samples, c, &buf); err != nil {
+					r.Close()
+					return nil, 0, err
+				}
+			}
+		}
+		r.Close()
+
+		if samples, err = flushSample(samples, c, &buf); err != nil {
+			return nil, 0, err
+		}
+		if n >= rows {
+			break
+		}
+	}
+	return samples, n, nil
+}
+
+// flushSample appends the rows that written into buf through c as a sample.
+func flushSample(samples [][]byte, c *CSVWriter, buf *bytes.Buffer) ([][]byte, error) {
+	c.Flush()
+	if err := c.Error(); err != nil {
+		return samples, err
+	}
+	if buf.Len() > 0 {
+		samples = append(samples, append([]byte{}, buf.Bytes()...))
+		buf.Reset()
+	}
+	return samples, nil
+}
+
+// TrainZstdDict trains the dictionary of zstd from the first rows of the input files.
+// The ID of the dictionary is made from the rows, but the content can be different in each training, because the builder is not deterministic.
+//
+// WARNING: this function reads commandline flags directly.
+func TrainZstdDict(inputs []string, rows int) (d []byte, err error) {
+	samples, n, err := sampleRows(inputs, rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(samples) < 2 {
+		return nil, fmt.Errorf("too few rows to train the dictionary: %d rows", n)
+	}
+	logger.Infof("train zstd dictionary from %d rows", n)
+
+	h := crc32.NewIEEE()
+	for _, s := range samples {
+		h.Write(s)
+	}
+	// The IDs less than 32768 are reserved by zstd.
+	id := 32768 + h.Sum32()%(1<<31-32768)
+
+	// The builder panics if no common strings found in the samples.
+	defer func() {
+		if r := recover(); r != nil {
+			d, err = nil, fmt.Errorf("failed to train the dictionary from %d rows: %v", n, r)
+		}
+	}()
+
+	return dict.BuildZstdDict(samples, dict.Options{
+		MaxDictSize: 64 * 1024,
+		HashBytes:   6,
+		ZstdDictID:  id,
+		ZstdLevel:   zstdLevel(),
+		// The dictionary can be used by the old versions of zstd command too.
+		ZstdDictCompat: true,
+	})
+}
+
+// SetupZstdDict loads the dictionary of -zstd-dict from -out-dir, or trains it from the inputs and writes it into the output directories if not exists.
+// The dictionary is reused in the next runs, because the files that already written can be decompressed only by the same dictionary.
+//
+// WARNING: this function reads commandline flags directly.
+func SetupZstdDict(inputs []string) error {
+	d, err := ReadZstdDict(*outputDir)
+	if err == nil {
+		logger.With("file", filepath.Join(*outputDir, zstdDictFile)).Infof("use zstd dictionary: %s", filepath.Join(*outputDir, zstdDictFile))
+		zstdDictionary = d
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if deterministic {
+		return errors.New("the dictionary is not trained in the same way on each run. make it without -deterministic first")
+	}
+
+	if zstdDictionary, err = TrainZstdDict(inputs, *zstdDictRows); err != nil {
+		return err
+	}
+	return WriteZstdDict()
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsCSVFile(t *testing.T) {
+	tests := []struct {
+		Input  string
+		Output bool
+	}{
+		{"a.csv.bz2", true},
+		{"a.csv.zst", true},
+		{"a.csv", false},
+		{"a.parquet", false},
+		{"_zstd.dict", false},
+	}
+
+	for _, tt := range tests {
+		if got := isCSVFile(tt.Input); got != tt.Output {
+			t.Errorf("%s: expected %v but got %v", tt.Input, tt.Output, got)
+		}
+	}
+}
+
+func TestZstdDict(t *testing.T) {
+	origDict, origEnabled := zstdDictionary, *zstdDict
+	*zstdDict = true
+	defer func() { zstdDictionary, *zstdDict = origDict, origEnabled }()
+
+	if ext := csvExtension(); ext != ".csv.zst" {
+		t.Errorf("expected .csv.zst but got %s", ext)
+	}
+
+	var input bytes.Buffer
+	for i := 0; i < 500; i++ {
+		fmt.Fprintf(&input, "2023-04-01 %02d:%02d:00,item-%03d,Chiyoda-ku Tokyo,%d\n", i/60%24, i%60, i%37, i*7)
+	}
+	path := filepath.Join(t.TempDir(), "input.csv")
+	if err := os.WriteFile(path, input.Bytes(), 0644); err != nil {
+		t.Fatalf("failed to prepare input: %s", err)
+	}
+
+	d1, err := TrainZstdDict([]string{path}, 300)
+	if err != nil {
+		t.Fatalf("failed to train: %s", err)
+	}
+	d2, err := TrainZstdDict([]string{path}, 300)
+	if err != nil {
+		t.Fatalf("failed to train: %s", err)
+	}
+	// The content can be different, but the ID is always the same.
+	if !bytes.Equal(d1[4:8], d2[4:8]) {
+		t.Errorf("expected the same rows make the same ID but got %x and %x", d1[4:8], d2[4:8])
+	}
+	zstdDictionary = d1
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, zstdDictFile), d1, 0644); err != nil {
+		t.Fatalf("failed to write dictionary: %s", err)
+	}
+	out := filepath.Join(dir, "year=2023", "month=4", "day=1", "a.csv.zst")
+	if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+		t.Fatalf("failed to make directory: %s", err)
+	}
+
+	// Two streams in a file, like the seek index makes.
+	var buf bytes.Buffer
+	c, err := newCompressor(&buf)
+	if err != nil {
+		t.Fatalf("failed to make compressor: %s", err)
+	}
+	c.Write([]byte("first\n"))
+	c.Close()
+	if err := c.Reset(&buf); err != nil {
+		t.Fatalf("failed to reset: %s", err)
+	}
+	c.Write([]byte("second\n"))
+	c.Close()
+	if err := os.WriteFile(out, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("failed to write output: %s", err)
+	}
+
+	f, err := os.Open(out)
+	if err != nil {
+		t.Fatalf("failed to open output: %s", err)
+	}
+	defer f.Close()
+	r, err := newDecompressor(out, f)
+	if err != nil {
+		t.Fatalf("failed to make decompressor: %s", err)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("failed to decompress: %s", err)
+	}
+	if string(b) != "first\nsecond\n" {
+		t.Errorf("unexpected content: %q", string(b))
+	}
+
+	if _, err := newDecompressor(filepath.Join(t.TempDir(), "a.csv.zst"), bytes.NewReader(nil)); err == nil {
+		t.Errorf("expected error without dictionary but got nil")
+	}
+}
+
+func TestSetupZstdDict_deterministic(t *testing.T) {
+	dir := setOutputDir(t)
+
+	origDict, origDeterministic := zstdDictionary, deterministic
+	deterministic = true
+	defer func() { zstdDictionary, deterministic = origDict, origDeterministic }()
+
+	if err := SetupZstdDict(nil); err == nil {
+		t.Errorf("expected error to train with -deterministic but got nil")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, zstdDictFile), []byte("dictionary"), 0644); err != nil {
+		t.Fatalf("failed to write dictionary: %s", err)
+	}
+	if err := SetupZstdDict(nil); err != nil {
+		t.Fatalf("failed to load dictionary: %s", err)
+	}
+	if string(zstdDictionary) != "dictionary" {
+		t.Errorf("unexpected dictionary: %q", zstdDictionary)
+	}
+}